@@ -0,0 +1,176 @@
+package awshandler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	fh "github.com/leonidasdeim/cog/filehandler"
+)
+
+var ErrNoConfiguration = errors.New("no configuration has been deployed")
+
+type Profile struct {
+	Application          string
+	Environment          string
+	ConfigurationProfile string
+}
+
+type LatestConfiguration struct {
+	// Configuration data, empty if it has not changed since the previous call with the session.
+	Configuration    []byte
+	ContentType      string
+	NextToken        string
+	NextPollInterval time.Duration
+}
+
+// AppConfigClient is a subset of AWS AppConfig Data API used by the handler.
+// It is satisfied by a thin adapter around appconfigdata.Client from AWS SDK,
+// which is also responsible for credentials.
+type AppConfigClient interface {
+	StartConfigurationSession(ctx context.Context, p Profile, minPollInterval time.Duration) (token string, err error)
+	GetLatestConfiguration(ctx context.Context, token string) (LatestConfiguration, error)
+}
+
+// AppConfigHandler loads hosted configuration profile deployed with AWS AppConfig.
+// Configuration session is started lazily and restarted when its token expires. Load reuses configuration
+// polled within the interval requested by the service. AppConfig is changed through deployments, so Save is a no-op.
+type AppConfigHandler struct {
+	m        sync.Mutex
+	client   AppConfigClient
+	profile  Profile
+	codec    fh.Codec
+	minPoll  time.Duration
+	nextPoll time.Duration
+	token    string
+	polled   time.Time
+	latest   []byte
+	content  string
+}
+
+func NewAppConfig(client AppConfigClient, p Profile, opts ...Option) (*AppConfigHandler, error) {
+	o := options(opts)
+
+	codec := fh.NewCodec(o.Type)
+	if codec == nil {
+		return nil, fmt.Errorf("bad config type: %s", string(o.Type))
+	}
+
+	return &AppConfigHandler{
+		client:   client,
+		profile:  p,
+		codec:    codec,
+		minPoll:  o.PollInterval,
+		nextPoll: o.PollInterval,
+	}, nil
+}
+
+func (h *AppConfigHandler) Load(data any) error {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	// configuration polled within the interval requested by the service is still current
+	if len(h.latest) == 0 || time.Since(h.polled) >= h.nextPoll {
+		if _, err := h.poll(context.Background()); err != nil {
+			return err
+		}
+	}
+
+	if len(h.latest) == 0 {
+		return ErrNoConfiguration
+	}
+
+	if err := h.codecFor(h.content).Unmarshal(h.latest, data); err != nil {
+		return fmt.Errorf("failed at unmarshal configuration profile %q: %v", h.profile.ConfigurationProfile, err)
+	}
+
+	return nil
+}
+
+func (h *AppConfigHandler) Save(_ any) error {
+	return nil
+}
+
+// Poll AppConfig with the interval requested by the service and send notification to the returned
+// channel when new configuration has been deployed. Channel is closed when context is cancelled.
+func (h *AppConfigHandler) Watch(ctx context.Context) (<-chan struct{}, error) {
+	interval := func() time.Duration {
+		h.m.Lock()
+		defer h.m.Unlock()
+		return h.nextPoll
+	}
+
+	changed := func(ctx context.Context) bool {
+		h.m.Lock()
+		defer h.m.Unlock()
+		c, err := h.poll(ctx)
+		return err == nil && c
+	}
+
+	return watch(ctx, interval, changed), nil
+}
+
+// Get latest configuration, returns true if it differs from the previous one.
+// Empty configuration means it has not changed since the previous call, so the last one is kept.
+func (h *AppConfigHandler) poll(ctx context.Context) (bool, error) {
+	if h.token == "" {
+		if err := h.startSession(ctx); err != nil {
+			return false, err
+		}
+	}
+
+	latest, err := h.client.GetLatestConfiguration(ctx, h.token)
+	if err != nil {
+		// token could be expired, start new session and try once again
+		if serr := h.startSession(ctx); serr != nil {
+			return false, fmt.Errorf("failed at get latest configuration: %v", err)
+		}
+		if latest, err = h.client.GetLatestConfiguration(ctx, h.token); err != nil {
+			return false, fmt.Errorf("failed at get latest configuration: %v", err)
+		}
+	}
+
+	h.polled = time.Now()
+	if latest.NextToken != "" {
+		h.token = latest.NextToken
+	}
+	if latest.NextPollInterval > 0 {
+		h.nextPoll = latest.NextPollInterval
+	}
+
+	if len(latest.Configuration) == 0 || bytes.Equal(latest.Configuration, h.latest) {
+		return false, nil
+	}
+
+	h.latest = latest.Configuration
+	h.content = latest.ContentType
+	return true, nil
+}
+
+// Start new session, it returns full configuration again, which is compared with the last one.
+func (h *AppConfigHandler) startSession(ctx context.Context) error {
+	token, err := h.client.StartConfigurationSession(ctx, h.profile, h.minPoll)
+	if err != nil {
+		return fmt.Errorf("failed at start configuration session: %v", err)
+	}
+
+	h.token = token
+	return nil
+}
+
+func (h *AppConfigHandler) codecFor(contentType string) fh.Codec {
+	switch {
+	case strings.Contains(contentType, "json"):
+		return fh.NewCodec(fh.JSON)
+	case strings.Contains(contentType, "yaml"):
+		return fh.NewCodec(fh.YAML)
+	case strings.Contains(contentType, "toml"):
+		return fh.NewCodec(fh.TOML)
+	default:
+		return h.codec
+	}
+}
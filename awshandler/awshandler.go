@@ -0,0 +1,73 @@
+package awshandler
+
+import (
+	"context"
+	"time"
+
+	fh "github.com/leonidasdeim/cog/filehandler"
+)
+
+type Optional struct {
+	Type         fh.FileType
+	PollInterval time.Duration
+}
+
+type Option func(o *Optional)
+
+// Specify config format. For AppConfig it is used only if content type of the configuration is unknown.
+// - filehandler.JSON (default)
+// - filehandler.YAML
+// - filehandler.TOML
+func WithType(t fh.FileType) Option {
+	return func(o *Optional) {
+		o.Type = t
+	}
+}
+
+// Specify how often Watch polls the service. For AppConfig it is the minimal poll interval
+// requested for the session, service may ask to poll less frequently.
+func WithPollInterval(d time.Duration) Option {
+	return func(o *Optional) {
+		o.PollInterval = d
+	}
+}
+
+func options(opts []Option) *Optional {
+
+	// Set defaults
+	o := &Optional{
+		Type:         fh.JSON,
+		PollInterval: time.Minute,
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return o
+}
+
+func watch(ctx context.Context, interval func() time.Duration, changed func(context.Context) bool) <-chan struct{} {
+	ch := make(chan struct{}, 1)
+
+	go func() {
+		defer close(ch)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval()):
+			}
+
+			if changed(ctx) {
+				select {
+				case ch <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+	return ch
+}
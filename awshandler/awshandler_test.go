@@ -0,0 +1,317 @@
+package awshandler
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testConfig struct {
+	Name string `json:"name" yaml:"name"`
+	Port int    `json:"port" yaml:"port"`
+}
+
+// Fake AppConfig: every session gets full configuration on the first call, later calls of the session
+// return empty configuration until a new one is deployed. Tokens can be used only once.
+type fakeAppConfig struct {
+	m          sync.Mutex
+	deployed   []byte
+	content    string
+	sessions   int
+	calls      int
+	tokens     map[string]int
+	seen       map[int][]byte
+	interval   time.Duration
+	emptyToken bool
+	fail       error
+}
+
+func newFakeAppConfig(config string) *fakeAppConfig {
+	return &fakeAppConfig{deployed: []byte(config), content: "application/json", tokens: map[string]int{}, seen: map[int][]byte{}}
+}
+
+func (f *fakeAppConfig) StartConfigurationSession(_ context.Context, p Profile, _ time.Duration) (string, error) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	if p.Application == "" {
+		return "", errors.New("missing application")
+	}
+
+	f.sessions++
+	token := "session-" + strconv.Itoa(f.sessions)
+	f.tokens[token] = f.sessions
+	return token, nil
+}
+
+func (f *fakeAppConfig) GetLatestConfiguration(_ context.Context, token string) (LatestConfiguration, error) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	f.calls++
+	if f.fail != nil {
+		return LatestConfiguration{}, f.fail
+	}
+
+	session, ok := f.tokens[token]
+	if !ok {
+		return LatestConfiguration{}, errors.New("BadRequestException: invalid or expired token")
+	}
+	delete(f.tokens, token)
+
+	next := "token-" + strconv.Itoa(f.calls)
+	f.tokens[next] = session
+
+	latest := LatestConfiguration{NextToken: next, NextPollInterval: f.interval}
+	if f.emptyToken {
+		latest.NextToken = ""
+		f.tokens[token] = session
+	}
+	if string(f.seen[session]) != string(f.deployed) {
+		f.seen[session] = f.deployed
+		latest.Configuration = f.deployed
+		latest.ContentType = f.content
+	}
+	return latest, nil
+}
+
+func (f *fakeAppConfig) deploy(config string) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	f.deployed = []byte(config)
+}
+
+func (f *fakeAppConfig) expireTokens() {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	f.tokens = map[string]int{}
+}
+
+func (f *fakeAppConfig) stats() (int, int) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	return f.sessions, f.calls
+}
+
+var testProfile = Profile{Application: "app", Environment: "prod", ConfigurationProfile: "main"}
+
+func TestAppConfigLoad(t *testing.T) {
+	f := newFakeAppConfig(`{"name":"app","port":8080}`)
+	h, err := NewAppConfig(f, testProfile, WithPollInterval(time.Nanosecond))
+	require.NoError(t, err)
+
+	var c testConfig
+	require.NoError(t, h.Load(&c))
+	assert.Equal(t, testConfig{Name: "app", Port: 8080}, c)
+
+	// unchanged configuration is returned empty, the last one is used
+	c = testConfig{}
+	require.NoError(t, h.Load(&c))
+	assert.Equal(t, testConfig{Name: "app", Port: 8080}, c)
+
+	sessions, calls := f.stats()
+	assert.Equal(t, 1, sessions)
+	assert.Equal(t, 2, calls)
+
+	f.deploy(`{"name":"app","port":8081}`)
+	require.NoError(t, h.Load(&c))
+	assert.Equal(t, 8081, c.Port)
+}
+
+func TestAppConfigContentType(t *testing.T) {
+	f := newFakeAppConfig("name: app\nport: 8080\n")
+	f.content = "application/x-yaml"
+
+	h, err := NewAppConfig(f, testProfile)
+	require.NoError(t, err)
+
+	var c testConfig
+	require.NoError(t, h.Load(&c))
+	assert.Equal(t, testConfig{Name: "app", Port: 8080}, c)
+}
+
+func TestAppConfigPollInterval(t *testing.T) {
+	f := newFakeAppConfig(`{"name":"app"}`)
+	f.interval = time.Hour
+
+	h, err := NewAppConfig(f, testProfile, WithPollInterval(time.Nanosecond))
+	require.NoError(t, err)
+
+	var c testConfig
+	require.NoError(t, h.Load(&c))
+	require.NoError(t, h.Load(&c))
+
+	// configuration polled within the interval requested by the service is reused
+	_, calls := f.stats()
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, "app", c.Name)
+}
+
+func TestAppConfigExpiredToken(t *testing.T) {
+	f := newFakeAppConfig(`{"name":"app"}`)
+	h, err := NewAppConfig(f, testProfile, WithPollInterval(time.Nanosecond))
+	require.NoError(t, err)
+
+	var c testConfig
+	require.NoError(t, h.Load(&c))
+
+	f.expireTokens()
+	changed, err := h.poll(context.Background())
+	require.NoError(t, err)
+	// new session returns the same configuration again, it is not a change
+	assert.False(t, changed)
+
+	sessions, _ := f.stats()
+	assert.Equal(t, 2, sessions)
+
+	require.NoError(t, h.Load(&c))
+	assert.Equal(t, "app", c.Name)
+}
+
+func TestAppConfigEmptyNextToken(t *testing.T) {
+	f := newFakeAppConfig(`{"name":"app"}`)
+	f.emptyToken = true
+
+	h, err := NewAppConfig(f, testProfile, WithPollInterval(time.Nanosecond))
+	require.NoError(t, err)
+
+	var c testConfig
+	require.NoError(t, h.Load(&c))
+	require.NoError(t, h.Load(&c))
+
+	// token is kept if the service does not return the next one
+	sessions, _ := f.stats()
+	assert.Equal(t, 1, sessions)
+	assert.Equal(t, "app", c.Name)
+}
+
+func TestAppConfigErrors(t *testing.T) {
+	f := newFakeAppConfig(`{"name":"app"}`)
+	f.fail = errors.New("ThrottlingException")
+
+	h, err := NewAppConfig(f, testProfile)
+	require.NoError(t, err)
+
+	var c testConfig
+	assert.ErrorContains(t, h.Load(&c), "ThrottlingException")
+
+	h, err = NewAppConfig(f, Profile{})
+	require.NoError(t, err)
+	assert.ErrorContains(t, h.Load(&c), "failed at start configuration session")
+
+	f = newFakeAppConfig("")
+	h, err = NewAppConfig(f, testProfile)
+	require.NoError(t, err)
+	assert.ErrorIs(t, h.Load(&c), ErrNoConfiguration)
+
+	assert.NoError(t, h.Save(c))
+}
+
+func TestAppConfigWatch(t *testing.T) {
+	f := newFakeAppConfig(`{"name":"app"}`)
+	f.interval = time.Millisecond
+
+	h, err := NewAppConfig(f, testProfile)
+	require.NoError(t, err)
+
+	var c testConfig
+	require.NoError(t, h.Load(&c))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := h.Watch(ctx)
+	require.NoError(t, err)
+
+	select {
+	case <-ch:
+		t.Fatal("unexpected notification without deployment")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	f.deploy(`{"name":"deployed"}`)
+
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		t.Fatal("expected notification about deployment")
+	}
+
+	// configuration polled by watch is loaded
+	require.NoError(t, h.Load(&c))
+	assert.Equal(t, "deployed", c.Name)
+
+	cancel()
+	for range ch {
+	}
+}
+
+// Fake Secrets Manager keeping versions of one secret.
+type fakeSecrets struct {
+	m       sync.Mutex
+	value   []byte
+	version int
+}
+
+func (f *fakeSecrets) GetSecretValue(_ context.Context, id string) (Secret, error) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	if f.version == 0 {
+		return Secret{}, errors.New("ResourceNotFoundException")
+	}
+	return Secret{Value: f.value, VersionId: "v" + strconv.Itoa(f.version)}, nil
+}
+
+func (f *fakeSecrets) PutSecretValue(_ context.Context, id string, value []byte) (string, error) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	f.value = value
+	f.version++
+	return "v" + strconv.Itoa(f.version), nil
+}
+
+func TestSecretsManager(t *testing.T) {
+	f := &fakeSecrets{}
+	h, err := NewSecretsManager(f, "app/config", WithPollInterval(time.Millisecond))
+	require.NoError(t, err)
+
+	var c testConfig
+	assert.ErrorContains(t, h.Load(&c), "ResourceNotFoundException")
+
+	require.NoError(t, h.Save(testConfig{Name: "app", Port: 8080}))
+	require.NoError(t, h.Load(&c))
+	assert.Equal(t, testConfig{Name: "app", Port: 8080}, c)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := h.Watch(ctx)
+	require.NoError(t, err)
+
+	select {
+	case <-ch:
+		t.Fatal("unexpected notification without rotation")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// rotation creates new version
+	_, err = f.PutSecretValue(ctx, "app/config", []byte(`{"name":"rotated"}`))
+	require.NoError(t, err)
+
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		t.Fatal("expected notification about rotation")
+	}
+
+	cancel()
+	for range ch {
+	}
+}
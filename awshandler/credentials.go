@@ -0,0 +1,225 @@
+package awshandler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	instanceEndpoint  = "http://169.254.169.254"
+	containerEndpoint = "http://169.254.170.2"
+	// Credentials are refreshed this long before they expire.
+	credentialsExpiryWindow = 5 * time.Minute
+)
+
+var ErrNoCredentials = errors.New("no AWS credentials found")
+
+// Credentials used to sign requests to AWS.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// Zero if credentials do not expire.
+	Expires time.Time
+}
+
+// CredentialsProvider retrieves credentials, e.g. from environment or instance role.
+type CredentialsProvider interface {
+	Retrieve(ctx context.Context) (Credentials, error)
+}
+
+// CredentialsFunc is an adapter to use function as credentials provider.
+type CredentialsFunc func(ctx context.Context) (Credentials, error)
+
+func (f CredentialsFunc) Retrieve(ctx context.Context) (Credentials, error) {
+	return f(ctx)
+}
+
+// Use fixed credentials.
+func StaticCredentials(accessKeyID, secretAccessKey, sessionToken string) CredentialsProvider {
+	return CredentialsFunc(func(_ context.Context) (Credentials, error) {
+		return Credentials{AccessKeyID: accessKeyID, SecretAccessKey: secretAccessKey, SessionToken: sessionToken}, nil
+	})
+}
+
+// Read credentials from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables.
+func EnvCredentials() CredentialsProvider {
+	return CredentialsFunc(func(_ context.Context) (Credentials, error) {
+		c := Credentials{
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}
+		if c.AccessKeyID == "" || c.SecretAccessKey == "" {
+			return c, fmt.Errorf("%w in environment", ErrNoCredentials)
+		}
+		return c, nil
+	})
+}
+
+// Read credentials of the ECS task role or EKS pod identity from the container credentials endpoint,
+// set with AWS_CONTAINER_CREDENTIALS_FULL_URI or AWS_CONTAINER_CREDENTIALS_RELATIVE_URI environment variable.
+// Authorization token is read from AWS_CONTAINER_AUTHORIZATION_TOKEN or AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE.
+func ContainerCredentials() CredentialsProvider {
+	return CredentialsFunc(func(ctx context.Context) (Credentials, error) {
+		url := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+		if rel := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); rel != "" {
+			url = containerEndpoint + rel
+		}
+		if url == "" {
+			return Credentials{}, fmt.Errorf("%w: container credentials endpoint is not set", ErrNoCredentials)
+		}
+
+		h := map[string]string{}
+		token := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN")
+		if file := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE"); file != "" {
+			b, err := os.ReadFile(file)
+			if err != nil {
+				return Credentials{}, fmt.Errorf("failed at read container authorization token: %v", err)
+			}
+			token = strings.TrimSpace(string(b))
+		}
+		if token != "" {
+			h["Authorization"] = token
+		}
+
+		b, err := metadataGet(ctx, http.MethodGet, url, h)
+		if err != nil {
+			return Credentials{}, fmt.Errorf("failed at get container credentials: %v", err)
+		}
+		return decodeCredentials(b)
+	})
+}
+
+// Read credentials of the EC2 instance role from instance metadata service (IMDSv2).
+// Empty endpoint uses the default address of the service.
+func InstanceCredentials(endpoint string) CredentialsProvider {
+	if endpoint == "" {
+		endpoint = instanceEndpoint
+	}
+	endpoint = strings.TrimSuffix(endpoint, "/")
+
+	return CredentialsFunc(func(ctx context.Context) (Credentials, error) {
+		token, err := metadataGet(ctx, http.MethodPut, endpoint+"/latest/api/token", map[string]string{"X-aws-ec2-metadata-token-ttl-seconds": "60"})
+		if err != nil {
+			return Credentials{}, fmt.Errorf("failed at get instance metadata token: %v", err)
+		}
+
+		h := map[string]string{"X-aws-ec2-metadata-token": string(token)}
+		path := endpoint + "/latest/meta-data/iam/security-credentials/"
+
+		role, err := metadataGet(ctx, http.MethodGet, path, h)
+		if err != nil {
+			return Credentials{}, fmt.Errorf("failed at get instance role: %v", err)
+		}
+
+		b, err := metadataGet(ctx, http.MethodGet, path+strings.TrimSpace(string(role)), h)
+		if err != nil {
+			return Credentials{}, fmt.Errorf("failed at get instance credentials: %v", err)
+		}
+		return decodeCredentials(b)
+	})
+}
+
+// Get credentials from the first provider which has them: environment, container and instance role.
+// Credentials are cached and refreshed before they expire.
+func DefaultCredentials() CredentialsProvider {
+	return CachedCredentials(CredentialsFunc(func(ctx context.Context) (Credentials, error) {
+		providers := []CredentialsProvider{EnvCredentials()}
+		if os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI") != "" || os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI") != "" {
+			providers = append(providers, ContainerCredentials())
+		}
+		providers = append(providers, InstanceCredentials(""))
+
+		errs := []string{}
+		for _, p := range providers {
+			c, err := p.Retrieve(ctx)
+			if err == nil {
+				return c, nil
+			}
+			errs = append(errs, err.Error())
+		}
+		return Credentials{}, fmt.Errorf("%w: %s", ErrNoCredentials, strings.Join(errs, "; "))
+	}))
+}
+
+// Cache credentials of the provider until they are about to expire.
+func CachedCredentials(p CredentialsProvider) CredentialsProvider {
+	return &cachedCredentials{provider: p}
+}
+
+type cachedCredentials struct {
+	m        sync.Mutex
+	provider CredentialsProvider
+	creds    *Credentials
+}
+
+func (c *cachedCredentials) Retrieve(ctx context.Context) (Credentials, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.creds != nil && (c.creds.Expires.IsZero() || time.Until(c.creds.Expires) > credentialsExpiryWindow) {
+		return *c.creds, nil
+	}
+
+	creds, err := c.provider.Retrieve(ctx)
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	c.creds = &creds
+	return creds, nil
+}
+
+func decodeCredentials(b []byte) (Credentials, error) {
+	var r struct {
+		Code            string
+		AccessKeyId     string
+		SecretAccessKey string
+		Token           string
+		Expiration      time.Time
+	}
+	if err := json.Unmarshal(b, &r); err != nil {
+		return Credentials{}, fmt.Errorf("failed at decode credentials: %v", err)
+	}
+	if r.Code != "" && r.Code != "Success" {
+		return Credentials{}, fmt.Errorf("failed at get credentials: %s", r.Code)
+	}
+	if r.AccessKeyId == "" || r.SecretAccessKey == "" {
+		return Credentials{}, fmt.Errorf("failed at decode credentials: %w", ErrNoCredentials)
+	}
+
+	return Credentials{AccessKeyID: r.AccessKeyId, SecretAccessKey: r.SecretAccessKey, SessionToken: r.Token, Expires: r.Expiration}, nil
+}
+
+func metadataGet(ctx context.Context, method string, url string, header map[string]string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", res.Status)
+	}
+	return io.ReadAll(io.LimitReader(res.Body, 64*1024))
+}
@@ -0,0 +1,331 @@
+package awshandler
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Minimal poll interval accepted by AppConfig session.
+const minAppConfigPollInterval = 15 * time.Second
+
+type httpClient struct {
+	service  string
+	region   string
+	endpoint string
+	client   *http.Client
+	creds    CredentialsProvider
+}
+
+type ClientOption func(c *httpClient)
+
+// Sign requests with credentials of the provider. By default DefaultCredentials are used.
+func WithCredentials(p CredentialsProvider) ClientOption {
+	return func(c *httpClient) {
+		c.creds = p
+	}
+}
+
+// Use custom service address, e.g. VPC endpoint or emulator in tests.
+func WithEndpoint(url string) ClientOption {
+	return func(c *httpClient) {
+		c.endpoint = strings.TrimSuffix(url, "/")
+	}
+}
+
+// Use custom HTTP client. By default http.DefaultClient is used.
+func WithHTTPClient(hc *http.Client) ClientOption {
+	return func(c *httpClient) {
+		c.client = hc
+	}
+}
+
+func newHTTPClient(service, signingName, region string, opts []ClientOption) *httpClient {
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+
+	c := &httpClient{
+		service:  signingName,
+		region:   region,
+		endpoint: fmt.Sprintf("https://%s.%s.amazonaws.com", service, region),
+		client:   http.DefaultClient,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.creds == nil {
+		c.creds = DefaultCredentials()
+	}
+
+	return c
+}
+
+// AppConfigClient which calls AppConfig Data API directly. Requests are signed with SigV4,
+// credentials are resolved and refreshed by the credentials provider. Empty region is read from
+// AWS_REGION or AWS_DEFAULT_REGION environment variable.
+func NewAppConfigClient(region string, opts ...ClientOption) AppConfigClient {
+	return &appConfigClient{newHTTPClient("appconfigdata", "appconfig", region, opts)}
+}
+
+// SecretsManagerClient which calls Secrets Manager API directly, see NewAppConfigClient.
+func NewSecretsManagerClient(region string, opts ...ClientOption) SecretsManagerClient {
+	return &secretsManagerClient{newHTTPClient("secretsmanager", "secretsmanager", region, opts)}
+}
+
+type appConfigClient struct {
+	*httpClient
+}
+
+func (c *appConfigClient) StartConfigurationSession(ctx context.Context, p Profile, minPollInterval time.Duration) (string, error) {
+	in := map[string]any{
+		"ApplicationIdentifier":          p.Application,
+		"EnvironmentIdentifier":          p.Environment,
+		"ConfigurationProfileIdentifier": p.ConfigurationProfile,
+	}
+	if minPollInterval >= minAppConfigPollInterval {
+		in["RequiredMinimumPollIntervalInSeconds"] = int(minPollInterval.Seconds())
+	}
+
+	body, err := json.Marshal(in)
+	if err != nil {
+		return "", err
+	}
+
+	_, b, err := c.do(ctx, http.MethodPost, "/configurationsessions", nil, body, map[string]string{"Content-Type": "application/json"})
+	if err != nil {
+		return "", err
+	}
+
+	var out struct {
+		InitialConfigurationToken string
+	}
+	if err := json.Unmarshal(b, &out); err != nil {
+		return "", fmt.Errorf("failed at decode configuration session: %v", err)
+	}
+	return out.InitialConfigurationToken, nil
+}
+
+func (c *appConfigClient) GetLatestConfiguration(ctx context.Context, token string) (LatestConfiguration, error) {
+	res, b, err := c.do(ctx, http.MethodGet, "/configuration", url.Values{"configuration_token": {token}}, nil, nil)
+	if err != nil {
+		return LatestConfiguration{}, err
+	}
+
+	latest := LatestConfiguration{
+		Configuration: b,
+		ContentType:   res.Header.Get("Content-Type"),
+		NextToken:     res.Header.Get("Next-Poll-Configuration-Token"),
+	}
+	if s, err := strconv.Atoi(res.Header.Get("Next-Poll-Interval-In-Seconds")); err == nil {
+		latest.NextPollInterval = time.Duration(s) * time.Second
+	}
+	return latest, nil
+}
+
+type secretsManagerClient struct {
+	*httpClient
+}
+
+func (c *secretsManagerClient) GetSecretValue(ctx context.Context, id string) (Secret, error) {
+	var out struct {
+		SecretString string
+		SecretBinary []byte
+		VersionId    string
+	}
+	if err := c.call(ctx, "GetSecretValue", map[string]any{"SecretId": id}, &out); err != nil {
+		return Secret{}, err
+	}
+
+	s := Secret{Value: out.SecretBinary, VersionId: out.VersionId}
+	if out.SecretString != "" {
+		s.Value = []byte(out.SecretString)
+	}
+	return s, nil
+}
+
+func (c *secretsManagerClient) PutSecretValue(ctx context.Context, id string, value []byte) (string, error) {
+	// request token makes retries of the same request idempotent
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+
+	var out struct {
+		VersionId string
+	}
+	in := map[string]any{"SecretId": id, "SecretString": string(value), "ClientRequestToken": hex.EncodeToString(token)}
+	if err := c.call(ctx, "PutSecretValue", in, &out); err != nil {
+		return "", err
+	}
+	return out.VersionId, nil
+}
+
+// Call JSON 1.1 protocol operation of Secrets Manager.
+func (c *secretsManagerClient) call(ctx context.Context, op string, in any, out any) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	h := map[string]string{"Content-Type": "application/x-amz-json-1.1", "X-Amz-Target": "secretsmanager." + op}
+	_, b, err := c.do(ctx, http.MethodPost, "/", nil, body, h)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(b, out); err != nil {
+		return fmt.Errorf("failed at decode %s response: %v", op, err)
+	}
+	return nil
+}
+
+// Send signed request and read the response body, body of the returned response is closed.
+// Error responses are returned as errors.
+func (c *httpClient) do(ctx context.Context, method string, path string, query url.Values, body []byte, header map[string]string) (*http.Response, []byte, error) {
+	u := c.endpoint + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed at create request: %v", err)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+
+	creds, err := c.creds.Retrieve(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed at retrieve credentials: %v", err)
+	}
+	signRequest(req, body, creds, c.region, c.service, time.Now())
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed at %s request: %v", c.service, err)
+	}
+	defer res.Body.Close()
+
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed at read %s response: %v", c.service, err)
+	}
+
+	if res.StatusCode >= 300 {
+		return nil, nil, fmt.Errorf("failed at %s request: %s: %s", c.service, res.Status, errorMessage(b))
+	}
+	return res, b, nil
+}
+
+// Get error type and message of AWS error response.
+func errorMessage(b []byte) string {
+	var e struct {
+		Type       string `json:"__type"`
+		Message    string `json:"message"`
+		MessageCap string `json:"Message"`
+	}
+	if json.Unmarshal(b, &e) != nil {
+		return strings.TrimSpace(string(b))
+	}
+
+	msg := e.Message
+	if msg == "" {
+		msg = e.MessageCap
+	}
+	if i := strings.LastIndex(e.Type, "#"); i >= 0 {
+		e.Type = e.Type[i+1:]
+	}
+	return strings.TrimPrefix(e.Type+": "+msg, ": ")
+}
+
+// Sign request with AWS Signature Version 4.
+func signRequest(req *http.Request, body []byte, c Credentials, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if c.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.SessionToken)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for k, v := range req.Header {
+		k = strings.ToLower(k)
+		if k == "content-type" || strings.HasPrefix(k, "x-amz-") {
+			headers[k] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		strings.ReplaceAll(req.URL.Query().Encode(), "+", "%20"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hexSHA256(body),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hexSHA256([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+c.SecretAccessKey), date)
+	for _, s := range []string{region, service, "aws4_request"} {
+		key = hmacSHA256(key, s)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hexSHA256(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,241 @@
+package awshandler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testCredentials = StaticCredentials("AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "")
+
+func TestSignRequest(t *testing.T) {
+	// get-vanilla case of AWS SigV4 test suite
+	req, err := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	require.NoError(t, err)
+
+	creds, err := testCredentials.Retrieve(context.Background())
+	require.NoError(t, err)
+
+	signRequest(req, nil, creds, "us-east-1", "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	assert.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+	assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+		"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		req.Header.Get("Authorization"))
+}
+
+func TestSignRequestSessionToken(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/?b=2&a=x%20y", nil)
+	require.NoError(t, err)
+
+	signRequest(req, nil, Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret", SessionToken: "session"}, "eu-west-1", "appconfig", time.Now())
+
+	assert.Equal(t, "session", req.Header.Get("X-Amz-Security-Token"))
+	assert.Contains(t, req.Header.Get("Authorization"), "SignedHeaders=host;x-amz-date;x-amz-security-token,")
+}
+
+func TestAppConfigClient(t *testing.T) {
+	var polls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		assert.Contains(t, auth, "Credential=AKIDEXAMPLE/")
+		assert.Contains(t, auth, "/eu-west-1/appconfig/aws4_request")
+
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/configurationsessions":
+			var in map[string]any
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&in))
+			assert.Equal(t, map[string]any{
+				"ApplicationIdentifier":                "app",
+				"EnvironmentIdentifier":                "prod",
+				"ConfigurationProfileIdentifier":       "main",
+				"RequiredMinimumPollIntervalInSeconds": float64(60),
+			}, in)
+
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"InitialConfigurationToken":"initial"}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/configuration":
+			n := atomic.AddInt32(&polls, 1)
+			if n == 1 {
+				assert.Equal(t, "initial", r.URL.Query().Get("configuration_token"))
+			} else {
+				assert.Equal(t, "next-1", r.URL.Query().Get("configuration_token"))
+			}
+
+			w.Header().Set("Next-Poll-Configuration-Token", "next-1")
+			w.Header().Set("Next-Poll-Interval-In-Seconds", "0")
+			if n == 1 {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"name":"app","port":8080}`))
+			}
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"Message":"unexpected request"}`))
+		}
+	}))
+	defer srv.Close()
+
+	client := NewAppConfigClient("eu-west-1", WithEndpoint(srv.URL), WithCredentials(testCredentials))
+	h, err := NewAppConfig(client, testProfile)
+	require.NoError(t, err)
+
+	var c testConfig
+	require.NoError(t, h.Load(&c))
+	assert.Equal(t, testConfig{Name: "app", Port: 8080}, c)
+
+	changed, err := h.poll(context.Background())
+	require.NoError(t, err)
+	assert.False(t, changed)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&polls))
+}
+
+func TestSecretsManagerClient(t *testing.T) {
+	var stored string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/x-amz-json-1.1", r.Header.Get("Content-Type"))
+		assert.Contains(t, r.Header.Get("Authorization"), "/us-east-1/secretsmanager/aws4_request")
+
+		var in map[string]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&in))
+		assert.Equal(t, "app/config", in["SecretId"])
+
+		switch r.Header.Get("X-Amz-Target") {
+		case "secretsmanager.PutSecretValue":
+			assert.Len(t, in["ClientRequestToken"], 32)
+			stored = in["SecretString"]
+			w.Write([]byte(`{"VersionId":"v1"}`))
+		case "secretsmanager.GetSecretValue":
+			if stored == "" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"__type":"com.amazonaws.secretsmanager#ResourceNotFoundException","message":"Secrets Manager can't find the specified secret."}`))
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"SecretString": stored, "VersionId": "v1"})
+		}
+	}))
+	defer srv.Close()
+
+	t.Setenv("AWS_REGION", "us-east-1")
+	client := NewSecretsManagerClient("", WithEndpoint(srv.URL), WithCredentials(testCredentials))
+	h, err := NewSecretsManager(client, "app/config")
+	require.NoError(t, err)
+
+	var c testConfig
+	assert.ErrorContains(t, h.Load(&c), "ResourceNotFoundException: Secrets Manager can't find the specified secret.")
+
+	require.NoError(t, h.Save(testConfig{Name: "app", Port: 8080}))
+	require.NoError(t, h.Load(&c))
+	assert.Equal(t, testConfig{Name: "app", Port: 8080}, c)
+}
+
+func TestEnvCredentials(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+
+	_, err := EnvCredentials().Retrieve(context.Background())
+	assert.ErrorIs(t, err, ErrNoCredentials)
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_SESSION_TOKEN", "session")
+
+	c, err := DefaultCredentials().Retrieve(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret", SessionToken: "session"}, c)
+}
+
+func credentialsJSON(expires time.Time) string {
+	return `{"Code":"Success","AccessKeyId":"ASIA","SecretAccessKey":"secret","Token":"session","Expiration":"` +
+		expires.UTC().Format(time.RFC3339) + `"}`
+}
+
+func TestContainerCredentials(t *testing.T) {
+	expires := time.Now().Add(time.Hour).Truncate(time.Second)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v2/credentials/task", r.URL.Path)
+		assert.Equal(t, "container-token", r.Header.Get("Authorization"))
+		w.Write([]byte(credentialsJSON(expires)))
+	}))
+	defer srv.Close()
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "")
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", srv.URL+"/v2/credentials/task")
+	t.Setenv("AWS_CONTAINER_AUTHORIZATION_TOKEN", "container-token")
+
+	c, err := DefaultCredentials().Retrieve(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "ASIA", c.AccessKeyID)
+	assert.Equal(t, "session", c.SessionToken)
+	assert.True(t, expires.Equal(c.Expires))
+}
+
+func TestInstanceCredentials(t *testing.T) {
+	var requests int32
+	expires := time.Now().Add(time.Hour)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+
+		if r.Method == http.MethodPut && r.URL.Path == "/latest/api/token" {
+			assert.Equal(t, "60", r.Header.Get("X-aws-ec2-metadata-token-ttl-seconds"))
+			w.Write([]byte("imds-token"))
+			return
+		}
+
+		if r.Header.Get("X-aws-ec2-metadata-token") != "imds-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/latest/meta-data/iam/security-credentials/":
+			w.Write([]byte("app-role\n"))
+		case "/latest/meta-data/iam/security-credentials/app-role":
+			w.Write([]byte(credentialsJSON(expires)))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	p := CachedCredentials(InstanceCredentials(srv.URL))
+
+	c, err := p.Retrieve(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "ASIA", c.AccessKeyID)
+
+	// cached until they are about to expire
+	_, err = p.Retrieve(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+}
+
+func TestCachedCredentialsRefresh(t *testing.T) {
+	var calls int32
+	p := CachedCredentials(CredentialsFunc(func(_ context.Context) (Credentials, error) {
+		n := atomic.AddInt32(&calls, 1)
+		// expires within refresh window, so next call refreshes them
+		return Credentials{AccessKeyID: strings.Repeat("A", int(n)), SecretAccessKey: "s", Expires: time.Now().Add(time.Minute)}, nil
+	}))
+
+	c1, err := p.Retrieve(context.Background())
+	require.NoError(t, err)
+	c2, err := p.Retrieve(context.Background())
+	require.NoError(t, err)
+
+	assert.NotEqual(t, c1.AccessKeyID, c2.AccessKeyID)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestErrorMessage(t *testing.T) {
+	assert.Equal(t, "BadRequestException: token expired", errorMessage([]byte(`{"__type":"BadRequestException","Message":"token expired"}`)))
+	assert.Equal(t, "bad gateway", errorMessage([]byte("bad gateway\n")))
+}
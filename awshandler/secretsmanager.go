@@ -0,0 +1,107 @@
+package awshandler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	fh "github.com/leonidasdeim/cog/filehandler"
+)
+
+type Secret struct {
+	Value     []byte
+	VersionId string
+}
+
+// SecretsManagerClient is a subset of AWS Secrets Manager API used by the handler.
+// It is satisfied by a thin adapter around secretsmanager.Client from AWS SDK,
+// which is also responsible for credentials.
+type SecretsManagerClient interface {
+	// Get current (AWSCURRENT) version of the secret.
+	GetSecretValue(ctx context.Context, id string) (Secret, error)
+	// Store new version of the secret, returns its version id.
+	PutSecretValue(ctx context.Context, id string, value []byte) (string, error)
+}
+
+// SecretsManagerHandler keeps marshaled config as a secret value in AWS Secrets Manager.
+type SecretsManagerHandler struct {
+	m        sync.Mutex
+	client   SecretsManagerClient
+	id       string
+	codec    fh.Codec
+	interval time.Duration
+	version  string
+}
+
+func NewSecretsManager(client SecretsManagerClient, secretId string, opts ...Option) (*SecretsManagerHandler, error) {
+	o := options(opts)
+
+	codec := fh.NewCodec(o.Type)
+	if codec == nil {
+		return nil, fmt.Errorf("bad secret type: %s", string(o.Type))
+	}
+
+	return &SecretsManagerHandler{
+		client:   client,
+		id:       secretId,
+		codec:    codec,
+		interval: o.PollInterval,
+	}, nil
+}
+
+func (h *SecretsManagerHandler) Load(data any) error {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	s, err := h.client.GetSecretValue(context.Background(), h.id)
+	if err != nil {
+		return fmt.Errorf("failed at get secret %q: %w", h.id, err)
+	}
+
+	if err := h.codec.Unmarshal(s.Value, data); err != nil {
+		return fmt.Errorf("failed at unmarshal secret %q: %v", h.id, err)
+	}
+
+	h.version = s.VersionId
+	return nil
+}
+
+func (h *SecretsManagerHandler) Save(data any) error {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	b, err := h.codec.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	version, err := h.client.PutSecretValue(context.Background(), h.id, b)
+	if err != nil {
+		return fmt.Errorf("failed at put secret %q: %w", h.id, err)
+	}
+
+	h.version = version
+	return nil
+}
+
+// Poll current version of the secret and send notification to the returned channel when it has been
+// rotated or changed by another writer. Channel is closed when context is cancelled.
+func (h *SecretsManagerHandler) Watch(ctx context.Context) (<-chan struct{}, error) {
+	interval := func() time.Duration {
+		return h.interval
+	}
+
+	changed := func(ctx context.Context) bool {
+		s, err := h.client.GetSecretValue(ctx, h.id)
+		if err != nil {
+			return false
+		}
+
+		h.m.Lock()
+		defer h.m.Unlock()
+		return s.VersionId != h.version
+	}
+
+	return watch(ctx, interval, changed), nil
+}
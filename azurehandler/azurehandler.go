@@ -0,0 +1,371 @@
+package azurehandler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const keyVaultRefContentType = "application/vnd.microsoft.appconfig.keyvaultref+json"
+
+type Setting struct {
+	Key         string
+	Value       string
+	Label       string
+	ContentType string
+	ETag        string
+}
+
+// AppConfigClient is a subset of Azure App Configuration API used by the handler.
+// It is satisfied by a thin adapter around azappconfig.Client from Azure SDK,
+// which is also responsible for credentials.
+type AppConfigClient interface {
+	// List settings which keys start with prefix and have the given label. Empty label selects settings without label.
+	ListSettings(ctx context.Context, prefix string, label string) ([]Setting, error)
+	// Get single setting, it is used to poll the sentinel key.
+	GetSetting(ctx context.Context, key string, label string) (Setting, error)
+}
+
+// SecretResolver resolves Key Vault reference (secret identifier URI) to the secret value.
+// It is satisfied by a thin adapter around azsecrets.Client from Azure SDK.
+type SecretResolver interface {
+	ResolveSecret(ctx context.Context, uri string) (string, error)
+}
+
+// AppConfigHandler loads settings from Azure App Configuration and binds them to the config struct.
+// Hierarchical keys ("Server:Port") are mapped to nested fields, labels select environment and
+// Key Vault references are resolved to secret values. Settings are managed in Azure, so Save is a no-op.
+type AppConfigHandler struct {
+	m         sync.Mutex
+	client    AppConfigClient
+	secrets   SecretResolver
+	prefix    string
+	separator string
+	labels    []string
+	sentinel  string
+	interval  time.Duration
+	etag      string
+	label     string
+	notify    chan struct{}
+}
+
+type Optional struct {
+	Prefix       string
+	Separator    string
+	Labels       []string
+	Sentinel     string
+	PollInterval time.Duration
+	Secrets      SecretResolver
+}
+
+type Option func(o *Optional)
+
+// Load only keys which start with the prefix, prefix is trimmed from the key.
+func WithPrefix(p string) Option {
+	return func(o *Optional) {
+		o.Prefix = p
+	}
+}
+
+// Specify hierarchical key separator. By default it is ":".
+func WithSeparator(s string) Option {
+	return func(o *Optional) {
+		o.Separator = s
+	}
+}
+
+// Select labels, e.g. environment name. Settings without label are loaded first,
+// then settings of each label in the given order override them.
+func WithLabels(labels ...string) Option {
+	return func(o *Optional) {
+		o.Labels = labels
+	}
+}
+
+// Poll only the sentinel key and reload all settings when it changes.
+// By default all settings are compared on every poll.
+func WithSentinel(key string) Option {
+	return func(o *Optional) {
+		o.Sentinel = key
+	}
+}
+
+// Specify how often Watch polls for changes. By default it is 30 seconds.
+func WithPollInterval(d time.Duration) Option {
+	return func(o *Optional) {
+		o.PollInterval = d
+	}
+}
+
+// Resolve Key Vault references with the resolver. Without it, references fail the Load.
+func WithSecretResolver(r SecretResolver) Option {
+	return func(o *Optional) {
+		o.Secrets = r
+	}
+}
+
+func New(client AppConfigClient, opts ...Option) (*AppConfigHandler, error) {
+
+	// Set defaults
+	o := &Optional{
+		Separator:    ":",
+		PollInterval: 30 * time.Second,
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return &AppConfigHandler{
+		client:    client,
+		secrets:   o.Secrets,
+		prefix:    o.Prefix,
+		separator: o.Separator,
+		labels:    append([]string{""}, o.Labels...),
+		sentinel:  o.Sentinel,
+		interval:  o.PollInterval,
+		notify:    make(chan struct{}, 1),
+	}, nil
+}
+
+func (h *AppConfigHandler) Load(data any) error {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	ctx := context.Background()
+
+	settings, sentinel, err := h.list(ctx)
+	if err != nil {
+		return err
+	}
+
+	doc := map[string]any{}
+	for _, s := range settings {
+		value := s.Value
+		if strings.HasPrefix(s.ContentType, keyVaultRefContentType) {
+			if value, err = h.resolveSecret(ctx, s); err != nil {
+				return err
+			}
+		}
+		setPath(doc, strings.Split(strings.TrimPrefix(s.Key, h.prefix), h.separator), value)
+	}
+
+	typed := bind(reflect.TypeOf(data), doc)
+
+	b, err := json.Marshal(typed)
+	if err != nil {
+		return fmt.Errorf("failed at bind settings: %v", err)
+	}
+	if err := json.Unmarshal(b, data); err != nil {
+		return fmt.Errorf("failed at bind settings: %v", err)
+	}
+
+	h.etag = sentinel.ETag
+	h.label = sentinel.Label
+	return nil
+}
+
+func (h *AppConfigHandler) Save(_ any) error {
+	return nil
+}
+
+// Trigger reload from outside, e.g. from Event Grid webhook receiving App Configuration change events.
+func (h *AppConfigHandler) Notify() {
+	select {
+	case h.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Poll settings (or the sentinel key) and send notification to the returned channel when they change
+// or when Notify is called. Channel is closed when context is cancelled.
+func (h *AppConfigHandler) Watch(ctx context.Context) (<-chan struct{}, error) {
+	ch := make(chan struct{}, 1)
+
+	go func() {
+		defer close(ch)
+
+		t := time.NewTicker(h.interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-h.notify:
+			case <-t.C:
+				if !h.changed(ctx) {
+					continue
+				}
+			}
+
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+func (h *AppConfigHandler) changed(ctx context.Context) bool {
+	h.m.Lock()
+	etag, label := h.etag, h.label
+	h.m.Unlock()
+
+	if h.sentinel != "" {
+		s, err := h.client.GetSetting(ctx, h.sentinel, label)
+		return err == nil && s.ETag != etag
+	}
+
+	_, s, err := h.list(ctx)
+	return err == nil && s.ETag != etag
+}
+
+// List settings of all labels, later labels override earlier ones.
+// Returned sentinel setting holds the sentinel key, or combined etag of all settings if sentinel is not used.
+func (h *AppConfigHandler) list(ctx context.Context) ([]Setting, Setting, error) {
+	byKey := map[string]Setting{}
+	keys := []string{}
+	etags := []string{}
+
+	for _, label := range h.labels {
+		settings, err := h.client.ListSettings(ctx, h.prefix, label)
+		if err != nil {
+			return nil, Setting{}, fmt.Errorf("failed at list settings with label %q: %v", label, err)
+		}
+
+		for _, s := range settings {
+			if _, ok := byKey[s.Key]; !ok {
+				keys = append(keys, s.Key)
+			}
+			byKey[s.Key] = s
+			etags = append(etags, label+"/"+s.Key+"="+s.ETag)
+		}
+	}
+
+	// order of listed settings is not guaranteed
+	sort.Strings(etags)
+
+	result := []Setting{}
+	sentinel := Setting{ETag: strings.Join(etags, ",")}
+
+	for _, k := range keys {
+		if h.sentinel != "" && k == h.sentinel {
+			sentinel = byKey[k]
+			continue
+		}
+		result = append(result, byKey[k])
+	}
+
+	// sentinel key could be outside of the prefix, look it up starting from the most specific label
+	for i := len(h.labels) - 1; h.sentinel != "" && sentinel.Key == "" && i >= 0; i-- {
+		if s, err := h.client.GetSetting(ctx, h.sentinel, h.labels[i]); err == nil {
+			sentinel = s
+		}
+	}
+
+	return result, sentinel, nil
+}
+
+func (h *AppConfigHandler) resolveSecret(ctx context.Context, s Setting) (string, error) {
+	if h.secrets == nil {
+		return "", fmt.Errorf("setting %q is a Key Vault reference, but secret resolver is not configured", s.Key)
+	}
+
+	ref := struct {
+		Uri string `json:"uri"`
+	}{}
+	if err := json.Unmarshal([]byte(s.Value), &ref); err != nil {
+		return "", fmt.Errorf("failed at parse Key Vault reference %q: %v", s.Key, err)
+	}
+
+	value, err := h.secrets.ResolveSecret(ctx, ref.Uri)
+	if err != nil {
+		return "", fmt.Errorf("failed at resolve Key Vault reference %q: %v", s.Key, err)
+	}
+
+	return value, nil
+}
+
+func setPath(doc map[string]any, path []string, value string) {
+	for _, p := range path[:len(path)-1] {
+		next, ok := doc[p].(map[string]any)
+		if !ok {
+			next = map[string]any{}
+			doc[p] = next
+		}
+		doc = next
+	}
+	doc[path[len(path)-1]] = value
+}
+
+// Convert string values of the settings document to the types of the matching struct fields.
+func bind(t reflect.Type, v any) any {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		out := map[string]any{}
+		for k, val := range v {
+			var ft reflect.Type
+			if t != nil && t.Kind() == reflect.Struct {
+				if sf, ok := fieldByKey(t, k); ok {
+					ft = sf.Type
+				}
+			} else if t != nil && t.Kind() == reflect.Map {
+				ft = t.Elem()
+			}
+			out[k] = bind(ft, val)
+		}
+		return out
+	case string:
+		return bindString(t, v)
+	}
+
+	return v
+}
+
+func bindString(t reflect.Type, v string) any {
+	if t == nil {
+		return v
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return json.Number(v)
+	case reflect.Slice, reflect.Map, reflect.Struct:
+		var out any
+		if err := json.Unmarshal([]byte(v), &out); err == nil {
+			return out
+		}
+	}
+
+	return v
+}
+
+func fieldByKey(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name := strings.Split(sf.Tag.Get("json"), ",")[0]
+		if strings.EqualFold(name, key) || strings.EqualFold(sf.Name, key) {
+			return sf, true
+		}
+	}
+	return reflect.StructField{}, false
+}
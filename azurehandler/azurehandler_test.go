@@ -0,0 +1,237 @@
+package azurehandler
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testConfig struct {
+	Name   string
+	Debug  bool
+	Server struct {
+		Host string `json:"host"`
+		Port int    `json:"port"`
+	}
+	Tags     []string
+	Limits   map[string]float64
+	Password string
+}
+
+// In-memory App Configuration store, settings get new etag on every change.
+type fakeAppConfig struct {
+	m        sync.Mutex
+	settings map[string]Setting
+	version  int
+}
+
+func newFakeAppConfig() *fakeAppConfig {
+	return &fakeAppConfig{settings: map[string]Setting{}}
+}
+
+func (f *fakeAppConfig) set(key, label, value, contentType string) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	f.version++
+	f.settings[key+"\x00"+label] = Setting{Key: key, Value: value, Label: label, ContentType: contentType, ETag: strconv.Itoa(f.version)}
+}
+
+func (f *fakeAppConfig) ListSettings(_ context.Context, prefix string, label string) ([]Setting, error) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	result := []Setting{}
+	for _, s := range f.settings {
+		if strings.HasPrefix(s.Key, prefix) && s.Label == label {
+			result = append(result, s)
+		}
+	}
+	return result, nil
+}
+
+func (f *fakeAppConfig) GetSetting(_ context.Context, key string, label string) (Setting, error) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	s, ok := f.settings[key+"\x00"+label]
+	if !ok {
+		return Setting{}, errors.New("setting not found")
+	}
+	return s, nil
+}
+
+type fakeVault map[string]string
+
+func (v fakeVault) ResolveSecret(_ context.Context, uri string) (string, error) {
+	s, ok := v[uri]
+	if !ok {
+		return "", errors.New("SecretNotFound")
+	}
+	return s, nil
+}
+
+func TestLoad(t *testing.T) {
+	f := newFakeAppConfig()
+	f.set("app:Name", "", "base", "")
+	f.set("app:Debug", "", "true", "")
+	f.set("app:Server:host", "", "localhost", "")
+	f.set("app:Server:port", "", "8080", "")
+	f.set("app:Server:port", "production", "443", "")
+	f.set("app:Tags", "", `["a","b"]`, "application/json")
+	f.set("app:Limits:cpu", "", "0.5", "")
+	f.set("app:Password", "production", `{"uri":"https://vault.vault.azure.net/secrets/password"}`, keyVaultRefContentType+";charset=utf-8")
+	f.set("other:Name", "", "other", "")
+
+	h, err := New(f, WithPrefix("app:"), WithLabels("production"),
+		WithSecretResolver(fakeVault{"https://vault.vault.azure.net/secrets/password": "s3cret"}))
+	require.NoError(t, err)
+
+	var c testConfig
+	require.NoError(t, h.Load(&c))
+
+	assert.Equal(t, "base", c.Name)
+	assert.True(t, c.Debug)
+	assert.Equal(t, "localhost", c.Server.Host)
+	assert.Equal(t, 443, c.Server.Port)
+	assert.Equal(t, []string{"a", "b"}, c.Tags)
+	assert.Equal(t, map[string]float64{"cpu": 0.5}, c.Limits)
+	assert.Equal(t, "s3cret", c.Password)
+
+	assert.NoError(t, h.Save(c))
+}
+
+func TestLoadSeparator(t *testing.T) {
+	f := newFakeAppConfig()
+	f.set("Server/port", "", "9090", "")
+
+	h, err := New(f, WithSeparator("/"))
+	require.NoError(t, err)
+
+	var c testConfig
+	require.NoError(t, h.Load(&c))
+	assert.Equal(t, 9090, c.Server.Port)
+}
+
+func TestLoadKeyVaultErrors(t *testing.T) {
+	f := newFakeAppConfig()
+	f.set("Password", "", `{"uri":"https://vault.vault.azure.net/secrets/missing"}`, keyVaultRefContentType)
+
+	h, err := New(f)
+	require.NoError(t, err)
+
+	var c testConfig
+	assert.ErrorContains(t, h.Load(&c), "secret resolver is not configured")
+
+	h, err = New(f, WithSecretResolver(fakeVault{}))
+	require.NoError(t, err)
+	assert.ErrorContains(t, h.Load(&c), "SecretNotFound")
+}
+
+func TestLoadBadValue(t *testing.T) {
+	f := newFakeAppConfig()
+	f.set("Server:port", "", "not-a-number", "")
+
+	h, err := New(f)
+	require.NoError(t, err)
+
+	var c testConfig
+	assert.ErrorContains(t, h.Load(&c), "failed at bind settings")
+}
+
+func expectNotification(t *testing.T, ch <-chan struct{}) {
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		t.Fatal("expected notification")
+	}
+}
+
+func expectNoNotification(t *testing.T, ch <-chan struct{}) {
+	select {
+	case <-ch:
+		t.Fatal("unexpected notification")
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestWatch(t *testing.T) {
+	f := newFakeAppConfig()
+	for i := 0; i < 10; i++ {
+		f.set("Limits:"+strconv.Itoa(i), "", "1", "")
+	}
+
+	h, err := New(f, WithPollInterval(time.Millisecond))
+	require.NoError(t, err)
+
+	var c testConfig
+	require.NoError(t, h.Load(&c))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := h.Watch(ctx)
+	require.NoError(t, err)
+
+	expectNoNotification(t, ch)
+
+	f.set("Debug", "", "true", "")
+	expectNotification(t, ch)
+
+	cancel()
+	for range ch {
+	}
+}
+
+func TestWatchSentinel(t *testing.T) {
+	f := newFakeAppConfig()
+	f.set("app:Name", "", "app", "")
+	f.set("sentinel", "production", "1", "")
+
+	h, err := New(f, WithPrefix("app:"), WithLabels("production"), WithSentinel("sentinel"), WithPollInterval(time.Millisecond))
+	require.NoError(t, err)
+
+	var c testConfig
+	require.NoError(t, h.Load(&c))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := h.Watch(ctx)
+	require.NoError(t, err)
+
+	// settings are reloaded only after the sentinel changes
+	f.set("app:Name", "", "changed", "")
+	expectNoNotification(t, ch)
+
+	f.set("sentinel", "production", "2", "")
+	expectNotification(t, ch)
+
+	require.NoError(t, h.Load(&c))
+	assert.Equal(t, "changed", c.Name)
+	expectNoNotification(t, ch)
+
+	cancel()
+	for range ch {
+	}
+}
+
+func TestNotify(t *testing.T) {
+	f := newFakeAppConfig()
+	h, err := New(f, WithPollInterval(time.Hour))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := h.Watch(ctx)
+	require.NoError(t, err)
+
+	h.Notify()
+	expectNotification(t, ch)
+
+	cancel()
+	for range ch {
+	}
+}
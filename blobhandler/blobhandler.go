@@ -0,0 +1,192 @@
+package blobhandler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sync"
+	"time"
+
+	fh "github.com/leonidasdeim/cog/filehandler"
+)
+
+var (
+	// Wraps fs.ErrNotExist, so cog saves defaults on init when the object does not exist.
+	ErrNotFound           = fmt.Errorf("object not found: %w", fs.ErrNotExist)
+	ErrPreconditionFailed = errors.New("object has been modified by another writer")
+)
+
+// Bucket is a minimal object storage client. Version is an opaque token of the object revision
+// (ETag, generation), it is used for conditional writes and change detection.
+type Bucket interface {
+	// Get object data and version. Returns ErrNotFound if object does not exist.
+	Get(ctx context.Context, key string) (data []byte, version string, err error)
+	// Get object version without reading data. Returns ErrNotFound if object does not exist.
+	Head(ctx context.Context, key string) (version string, err error)
+	// Write object only if its current version matches. Empty version means object must not exist.
+	// Returns new version, or ErrPreconditionFailed if condition is not met.
+	Put(ctx context.Context, key string, data []byte, version string) (string, error)
+}
+
+// BlobHandler keeps marshaled config as an object in the bucket.
+// Save is conditional on the version seen by last Load or Save, Watch polls object version.
+type BlobHandler struct {
+	m        sync.Mutex
+	bucket   Bucket
+	key      string
+	codec    fh.Codec
+	interval time.Duration
+	version  string
+}
+
+type Optional struct {
+	Key          string
+	Type         fh.FileType
+	PollInterval time.Duration
+	Compression  fh.Compressor
+}
+
+type Option func(o *Optional)
+
+// Add custom object key. By default it is set to "app.<type>".
+func WithKey(k string) Option {
+	return func(o *Optional) {
+		o.Key = k
+	}
+}
+
+// Specify object format.
+// - filehandler.JSON (default)
+// - filehandler.YAML
+// - filehandler.TOML
+func WithType(t fh.FileType) Option {
+	return func(o *Optional) {
+		o.Type = t
+	}
+}
+
+// Specify how often Watch polls object version. By default it is 30 seconds.
+func WithPollInterval(d time.Duration) Option {
+	return func(o *Optional) {
+		o.PollInterval = d
+	}
+}
+
+// Compress stored object to save storage and bandwidth of polling. Plain objects are still read,
+// so compression can be enabled for existing objects.
+func WithCompression(c fh.Compressor) Option {
+	return func(o *Optional) {
+		o.Compression = c
+	}
+}
+
+func New(bucket Bucket, opts ...Option) (*BlobHandler, error) {
+
+	// Set defaults
+	o := &Optional{
+		Type:         fh.JSON,
+		PollInterval: 30 * time.Second,
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	codec := fh.NewCodec(o.Type)
+	if codec == nil {
+		return nil, fmt.Errorf("bad object type: %s", string(o.Type))
+	}
+
+	if o.Key == "" {
+		o.Key = "app." + codec.GetExtension()
+	}
+	if o.Compression != nil {
+		codec = fh.Compressed(codec, o.Compression)
+	}
+
+	return &BlobHandler{
+		bucket:   bucket,
+		key:      o.Key,
+		codec:    codec,
+		interval: o.PollInterval,
+	}, nil
+}
+
+func (h *BlobHandler) Load(data any) error {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	b, version, err := h.bucket.Get(context.Background(), h.key)
+	if err != nil {
+		return fmt.Errorf("failed at read object %q: %w", h.key, err)
+	}
+
+	if err := h.codec.Unmarshal(b, data); err != nil {
+		return fmt.Errorf("failed at unmarshal object %q: %v", h.key, err)
+	}
+
+	h.version = version
+	return nil
+}
+
+func (h *BlobHandler) Save(data any) error {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	b, err := h.codec.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	version, err := h.bucket.Put(context.Background(), h.key, b, h.version)
+	if err != nil {
+		return fmt.Errorf("failed at write object %q: %w", h.key, err)
+	}
+
+	h.version = version
+	return nil
+}
+
+// Get object version seen by last Load or Save.
+func (h *BlobHandler) Version() string {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	return h.version
+}
+
+// Poll object version and send notification to the returned channel when it differs from
+// the version seen by last Load or Save. Channel is closed when context is cancelled.
+func (h *BlobHandler) Watch(ctx context.Context) (<-chan struct{}, error) {
+	ch := make(chan struct{}, 1)
+
+	go func() {
+		defer close(ch)
+
+		t := time.NewTicker(h.interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+
+			version, err := h.bucket.Head(ctx, h.key)
+			if err != nil {
+				continue
+			}
+
+			if version != h.Version() {
+				select {
+				case ch <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+	return ch, nil
+}
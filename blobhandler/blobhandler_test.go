@@ -0,0 +1,261 @@
+package blobhandler
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	fh "github.com/leonidasdeim/cog/filehandler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testConfig struct {
+	Name string `json:"name" yaml:"name"`
+	Port int    `json:"port" yaml:"port"`
+}
+
+type object struct {
+	data    []byte
+	version string
+}
+
+// In-memory bucket with versioned objects.
+type memoryBucket struct {
+	m       sync.Mutex
+	objects map[string]object
+	last    int
+}
+
+func newMemoryBucket() *memoryBucket {
+	return &memoryBucket{objects: map[string]object{}}
+}
+
+func (b *memoryBucket) Get(_ context.Context, key string) ([]byte, string, error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	o, ok := b.objects[key]
+	if !ok {
+		return nil, "", ErrNotFound
+	}
+	return o.data, o.version, nil
+}
+
+func (b *memoryBucket) Head(ctx context.Context, key string) (string, error) {
+	_, version, err := b.Get(ctx, key)
+	return version, err
+}
+
+func (b *memoryBucket) Put(_ context.Context, key string, data []byte, version string) (string, error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if b.objects[key].version != version {
+		return "", ErrPreconditionFailed
+	}
+
+	b.last++
+	o := object{data: data, version: strconv.Itoa(b.last)}
+	b.objects[key] = o
+	return o.version, nil
+}
+
+func TestLoadSave(t *testing.T) {
+	bucket := newMemoryBucket()
+	h, err := New(bucket, WithType(fh.YAML))
+	require.NoError(t, err)
+
+	var c testConfig
+	assert.ErrorIs(t, h.Load(&c), ErrNotFound)
+
+	require.NoError(t, h.Save(testConfig{Name: "app", Port: 8080}))
+	assert.Equal(t, "1", h.Version())
+	assert.Equal(t, "name: app\nport: 8080\n", string(bucket.objects["app.yaml"].data))
+
+	require.NoError(t, h.Load(&c))
+	assert.Equal(t, testConfig{Name: "app", Port: 8080}, c)
+}
+
+func TestSaveConflict(t *testing.T) {
+	bucket := newMemoryBucket()
+	h, err := New(bucket, WithKey("config/app.json"))
+	require.NoError(t, err)
+	other, err := New(bucket, WithKey("config/app.json"))
+	require.NoError(t, err)
+
+	var c testConfig
+	require.NoError(t, h.Save(testConfig{Name: "app"}))
+	require.NoError(t, other.Load(&c))
+	require.NoError(t, other.Save(testConfig{Name: "other"}))
+
+	assert.ErrorIs(t, h.Save(testConfig{Name: "app", Port: 1}), ErrPreconditionFailed)
+	assert.Equal(t, "1", h.Version())
+
+	require.NoError(t, h.Load(&c))
+	assert.Equal(t, "other", c.Name)
+	assert.NoError(t, h.Save(testConfig{Name: "app", Port: 1}))
+}
+
+func TestCompression(t *testing.T) {
+	bucket := newMemoryBucket()
+	plain, err := New(bucket)
+	require.NoError(t, err)
+	compressed, err := New(bucket, WithCompression(fh.Gzip))
+	require.NoError(t, err)
+
+	require.NoError(t, plain.Save(testConfig{Name: "plain"}))
+
+	var c testConfig
+	require.NoError(t, compressed.Load(&c))
+	assert.Equal(t, "plain", c.Name)
+
+	require.NoError(t, compressed.Save(testConfig{Name: "compressed"}))
+	assert.True(t, bytes.HasPrefix(bucket.objects["app.json"].data, fh.Gzip.Magic()))
+
+	require.NoError(t, compressed.Load(&c))
+	assert.Equal(t, "compressed", c.Name)
+}
+
+func TestWatch(t *testing.T) {
+	bucket := newMemoryBucket()
+	h, err := New(bucket, WithPollInterval(time.Millisecond))
+	require.NoError(t, err)
+	require.NoError(t, h.Save(testConfig{Name: "app"}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := h.Watch(ctx)
+	require.NoError(t, err)
+
+	select {
+	case <-ch:
+		t.Fatal("unexpected notification without change")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	_, err = bucket.Put(ctx, "app.json", []byte(`{"name":"other"}`), "1")
+	require.NoError(t, err)
+
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		t.Fatal("expected notification about changed object")
+	}
+
+	cancel()
+	for range ch {
+	}
+}
+
+func TestHTTPBucket(t *testing.T) {
+	tests := []struct {
+		provider      Provider
+		endpoint      string
+		versionHeader string
+		create        http.Header
+		update        http.Header
+	}{
+		{
+			provider:      S3,
+			endpoint:      "/bucket/",
+			versionHeader: "ETag",
+			create:        http.Header{"If-None-Match": {"*"}},
+			update:        http.Header{"If-Match": {`"v1"`}},
+		},
+		{
+			provider:      GCS,
+			endpoint:      "/bucket",
+			versionHeader: "x-goog-generation",
+			create:        http.Header{"X-Goog-If-Generation-Match": {"0"}},
+			update:        http.Header{"X-Goog-If-Generation-Match": {`"v1"`}},
+		},
+		{
+			provider:      Azure,
+			endpoint:      "/bucket?sv=2021&sig=abc",
+			versionHeader: "ETag",
+			create:        http.Header{"If-None-Match": {"*"}, "X-Ms-Blob-Type": {"BlockBlob"}, "X-Ms-Version": {azureApiVersion}},
+			update:        http.Header{"If-Match": {`"v1"`}, "X-Ms-Blob-Type": {"BlockBlob"}, "X-Ms-Version": {azureApiVersion}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.provider), func(t *testing.T) {
+			var (
+				data    []byte
+				version string
+				headers []http.Header
+			)
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/bucket/app.json", r.URL.Path)
+				assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+				if tt.provider == Azure {
+					assert.Equal(t, "sv=2021&sig=abc", r.URL.RawQuery)
+				}
+
+				switch r.Method {
+				case http.MethodPut:
+					headers = append(headers, r.Header.Clone())
+					match := r.Header.Get("If-Match") + r.Header.Get("X-Goog-If-Generation-Match")
+					if version != "" && match != version || version == "" && match != "" && match != "0" {
+						w.WriteHeader(http.StatusPreconditionFailed)
+						return
+					}
+					data, _ = io.ReadAll(r.Body)
+					version = `"v` + strconv.Itoa(len(headers)) + `"`
+				case http.MethodGet, http.MethodHead:
+					if version == "" {
+						w.WriteHeader(http.StatusNotFound)
+						return
+					}
+				}
+				w.Header().Set(tt.versionHeader, version)
+				if r.Method == http.MethodGet {
+					w.Write(data)
+				}
+			}))
+			defer srv.Close()
+
+			b := NewHTTPBucket(srv.URL+tt.endpoint, tt.provider, WithSigner(func(r *http.Request) error {
+				r.Header.Set("Authorization", "Bearer token")
+				return nil
+			}))
+			h, err := New(b)
+			require.NoError(t, err)
+
+			var c testConfig
+			assert.ErrorIs(t, h.Load(&c), ErrNotFound)
+
+			require.NoError(t, h.Save(testConfig{Name: "app"}))
+			assert.Equal(t, `"v1"`, h.Version())
+
+			require.NoError(t, h.Load(&c))
+			assert.Equal(t, "app", c.Name)
+
+			require.NoError(t, h.Save(testConfig{Name: "app", Port: 1}))
+			assert.Equal(t, `"v2"`, h.Version())
+
+			stale, err := New(b)
+			require.NoError(t, err)
+			assert.ErrorIs(t, stale.Save(testConfig{}), ErrPreconditionFailed)
+
+			head, err := b.Head(context.Background(), "app.json")
+			require.NoError(t, err)
+			assert.Equal(t, `"v2"`, head)
+
+			require.Len(t, headers, 3)
+			for k, v := range tt.create {
+				assert.Equal(t, v, headers[0][k], k)
+			}
+			for k, v := range tt.update {
+				assert.Equal(t, v, headers[1][k], k)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package blobhandler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Object storage provider. It defines which headers are used for versioning and conditional writes.
+type Provider string
+
+const (
+	// Amazon S3 and S3 compatible storages: ETag with If-Match / If-None-Match.
+	S3 Provider = "s3"
+	// Google Cloud Storage XML API: object generation with x-goog-if-generation-match.
+	GCS Provider = "gcs"
+	// Azure Blob Storage: ETag with If-Match / If-None-Match.
+	Azure Provider = "azure"
+)
+
+const azureApiVersion = "2021-08-06"
+
+// HTTPBucket is a Bucket implementation which talks to the object storage REST API directly.
+// Object URL is built as "<endpoint>/<key>". Authentication is provided by request signer,
+// e.g. SigV4 signer for S3, OAuth bearer token for GCS or SAS token in the endpoint for Azure.
+type HTTPBucket struct {
+	endpoint string
+	provider Provider
+	client   *http.Client
+	sign     func(*http.Request) error
+}
+
+type BucketOption func(b *HTTPBucket)
+
+// Use custom HTTP client. By default http.DefaultClient is used.
+func WithClient(c *http.Client) BucketOption {
+	return func(b *HTTPBucket) {
+		b.client = c
+	}
+}
+
+// Sign every request before it is sent, e.g. add Authorization header.
+func WithSigner(f func(*http.Request) error) BucketOption {
+	return func(b *HTTPBucket) {
+		b.sign = f
+	}
+}
+
+func NewHTTPBucket(endpoint string, provider Provider, opts ...BucketOption) *HTTPBucket {
+	b := &HTTPBucket{
+		endpoint: endpoint,
+		provider: provider,
+		client:   http.DefaultClient,
+	}
+
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	return b
+}
+
+func (b *HTTPBucket) Get(ctx context.Context, key string) ([]byte, string, error) {
+	res, err := b.do(ctx, http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed at read object body: %v", err)
+	}
+
+	return data, b.version(res), nil
+}
+
+func (b *HTTPBucket) Head(ctx context.Context, key string) (string, error) {
+	res, err := b.do(ctx, http.MethodHead, key, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	res.Body.Close()
+
+	return b.version(res), nil
+}
+
+func (b *HTTPBucket) Put(ctx context.Context, key string, data []byte, version string) (string, error) {
+	res, err := b.do(ctx, http.MethodPut, key, data, b.conditions(version))
+	if err != nil {
+		return "", err
+	}
+	res.Body.Close()
+
+	return b.version(res), nil
+}
+
+func (b *HTTPBucket) conditions(version string) http.Header {
+	h := http.Header{}
+
+	switch b.provider {
+	case GCS:
+		if version == "" {
+			version = "0"
+		}
+		h.Set("x-goog-if-generation-match", version)
+	default:
+		if version == "" {
+			h.Set("If-None-Match", "*")
+		} else {
+			h.Set("If-Match", version)
+		}
+	}
+
+	if b.provider == Azure {
+		h.Set("x-ms-blob-type", "BlockBlob")
+	}
+
+	return h
+}
+
+func (b *HTTPBucket) version(res *http.Response) string {
+	if b.provider == GCS {
+		return res.Header.Get("x-goog-generation")
+	}
+	return res.Header.Get("ETag")
+}
+
+func (b *HTTPBucket) do(ctx context.Context, method string, key string, body []byte, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, b.url(key), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed at create request: %v", err)
+	}
+
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if b.provider == Azure {
+		req.Header.Set("x-ms-version", azureApiVersion)
+	}
+
+	if b.sign != nil {
+		if err := b.sign(req); err != nil {
+			return nil, fmt.Errorf("failed at sign request: %v", err)
+		}
+	}
+
+	res, err := b.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed at %s object: %v", strings.ToLower(method), err)
+	}
+
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		res.Body.Close()
+		return nil, ErrNotFound
+	case res.StatusCode == http.StatusPreconditionFailed, res.StatusCode == http.StatusConflict:
+		res.Body.Close()
+		return nil, ErrPreconditionFailed
+	case res.StatusCode >= 300:
+		res.Body.Close()
+		return nil, fmt.Errorf("failed at %s object: unexpected status %s", strings.ToLower(method), res.Status)
+	}
+
+	return res, nil
+}
+
+func (b *HTTPBucket) url(key string) string {
+	base, query := b.endpoint, ""
+
+	// Azure SAS token is usually provided as a query of the container URL
+	if i := strings.Index(base, "?"); i >= 0 {
+		base, query = base[:i], base[i:]
+	}
+
+	return strings.TrimSuffix(base, "/") + "/" + strings.TrimPrefix(key, "/") + query
+}
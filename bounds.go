@@ -0,0 +1,131 @@
+package cog
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var ErrUnsafeChange = errors.New("unsafe config change")
+
+// Check numeric fields tagged with `maxDelta:"50%"` (relative to the old value) or `maxDelta:"100"` (absolute)
+// and `monotonic:"increase"` or `monotonic:"decrease"` against the old config.
+func checkBounds[T any](old, new T) error {
+	o := reflect.ValueOf(&old).Elem()
+	n := reflect.ValueOf(&new).Elem()
+
+	if o.Kind() != reflect.Struct {
+		return nil
+	}
+
+	return boundsFields(o, n, "")
+}
+
+func boundsFields(old, new reflect.Value, prefix string) error {
+	t := old.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+
+		of, nf := old.Field(i), new.Field(i)
+
+		if of.Kind() == reflect.Struct && !isMarshaler(of.Type()) {
+			p := prefix + sf.Name + "."
+			if sf.Anonymous {
+				p = prefix
+			}
+			if err := boundsFields(of, nf, p); err != nil {
+				return err
+			}
+			continue
+		}
+
+		delta, monotonic := sf.Tag.Get("maxDelta"), sf.Tag.Get("monotonic")
+		if delta == "" && monotonic == "" {
+			continue
+		}
+
+		path := prefix + sf.Name
+
+		ov, ok := number(of)
+		if !ok {
+			return fmt.Errorf("failed at check bounds of %s: %s is not a number", path, of.Type())
+		}
+		nv, _ := number(nf)
+
+		if err := checkMonotonic(path, monotonic, ov, nv); err != nil {
+			return err
+		}
+
+		if err := checkDelta(path, delta, ov, nv); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func checkMonotonic(path string, monotonic string, old, new float64) error {
+	switch monotonic {
+	case "":
+		return nil
+	case "increase":
+		if new < old {
+			return fmt.Errorf("%w: %s may only increase (%v -> %v)", ErrUnsafeChange, path, old, new)
+		}
+	case "decrease":
+		if new > old {
+			return fmt.Errorf("%w: %s may only decrease (%v -> %v)", ErrUnsafeChange, path, old, new)
+		}
+	default:
+		return fmt.Errorf("failed at check bounds of %s: unknown monotonic %q", path, monotonic)
+	}
+
+	return nil
+}
+
+// Relative delta is not checked if the old value is zero.
+func checkDelta(path string, delta string, old, new float64) error {
+	if delta == "" {
+		return nil
+	}
+
+	relative := strings.HasSuffix(delta, "%")
+
+	max, err := strconv.ParseFloat(strings.TrimSuffix(delta, "%"), 64)
+	if err != nil || max < 0 {
+		return fmt.Errorf("failed at check bounds of %s: invalid maxDelta %q", path, delta)
+	}
+
+	change := math.Abs(new - old)
+	if relative {
+		if old == 0 {
+			return nil
+		}
+		change = change / math.Abs(old) * 100
+	}
+
+	if change > max {
+		return fmt.Errorf("%w: %s may change by at most %s (%v -> %v)", ErrUnsafeChange, path, delta, old, new)
+	}
+
+	return nil
+}
+
+func number(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
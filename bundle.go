@@ -0,0 +1,365 @@
+package cog
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+)
+
+// Version of the bundle archive layout.
+const bundleVersion = 1
+
+// Maximal size of the unpacked bundle archive, in bytes.
+const maxBundleSize = 64 << 20
+
+const (
+	bundleManifest   = "manifest.json"
+	bundleConfig     = "config.json"
+	bundleHistory    = "history.json"
+	bundleProvenance = "provenance.json"
+)
+
+var ErrSchemaMismatch = errors.New("bundle schema does not match config")
+
+// Bundle is the full state of the instance: effective config, revision, history of changes and provenance of the fields.
+// It is used for support bundles, cloning environments and migrating a service between hosts.
+type Bundle[T any] struct {
+	// Version of the bundle archive layout.
+	Version int
+	// Version of the config schema, see SchemaVersion.
+	Schema   string
+	Exported time.Time
+	// Effective config. Fields tagged with `secret:"true"` are encrypted with the key provider,
+	// or empty if cog.WithFieldEncryption has not been used.
+	Config    T
+	Revision  uint64
+	Timestamp string
+	// Update reports of the last changes, oldest first, see c.UpdateReports.
+	History []UpdateReport
+	// Source which provided the field on init, see InitReport.Sources.
+	Sources map[string]Source
+}
+
+// Get version of the config schema: hash of the field paths, types and tags of T.
+// It changes when config struct changes, so state of one schema is not imported to another.
+func SchemaVersion[T any]() string {
+	h := sha256.New()
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() == reflect.Struct {
+		walkFields(reflect.New(t).Elem(), "", func(path string, sf reflect.StructField, _ reflect.Value) {
+			fmt.Fprintf(h, "%s %s %s\n", path, sf.Type, sf.Tag)
+		})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// Write state of the instance to w as a gzipped tar archive.
+// f, _ := os.Create("support.tar.gz")
+// err := c.ExportBundle(f)
+func (cog *C[T]) ExportBundle(w io.Writer) error {
+	b := Bundle[T]{
+		Version:   bundleVersion,
+		Schema:    SchemaVersion[T](),
+		Exported:  cog.opts.Clock.Now().UTC(),
+		Revision:  cog.Revision(),
+		Timestamp: cog.GetTimestamp(),
+		History:   cog.UpdateReports(),
+		Sources:   cog.InitReport().Sources,
+	}
+
+	config, err := encryptFields(stripDerived(cog.Config()), cog.opts.KeyProvider)
+	if err != nil {
+		return err
+	}
+	if cog.opts.KeyProvider == nil {
+		config = clearSecrets(config)
+	}
+	b.Config = config
+
+	return writeBundle(w, b)
+}
+
+// Read bundle exported by c.ExportBundle. Secret fields are left as they are stored in the bundle.
+// Unpacked archive is limited to 64 MiB and its config to Limits.MaxSize of cog.WithLimits, if it is set.
+// Larger bundle is rejected with cog.ErrLimitExceeded before it is read into memory.
+func ReadBundle[T any](r io.Reader, opts ...Option) (Bundle[T], error) {
+	var b Bundle[T]
+
+	entries, err := readArchive(r, newOptional(opts).Limits)
+	if err != nil {
+		return b, fmt.Errorf("failed at read bundle: %w", err)
+	}
+
+	var m bundleMeta
+	if err := decodeEntry(entries, bundleManifest, &m); err != nil {
+		return b, err
+	}
+	if m.Version != bundleVersion {
+		return b, fmt.Errorf("bundle version %d is not supported", m.Version)
+	}
+
+	history := []bundleReport{}
+	if err := decodeEntry(entries, bundleHistory, &history); err != nil {
+		return b, err
+	}
+	if err := decodeEntry(entries, bundleConfig, &b.Config); err != nil {
+		return b, err
+	}
+	if err := decodeEntry(entries, bundleProvenance, &b.Sources); err != nil {
+		return b, err
+	}
+
+	b.Version, b.Schema, b.Exported, b.Revision, b.Timestamp = m.Version, m.Schema, m.Exported, m.Revision, m.Timestamp
+	for _, r := range history {
+		b.History = append(b.History, r.report())
+	}
+
+	return b, nil
+}
+
+// Create new cog instance with the state from the bundle. Instance is created with options as by New,
+// then bundle config is applied as an update, so it is validated and saved by the handler.
+// Secret fields missing in the bundle keep values loaded by the instance. Revision and history are restored.
+// Returns cog.ErrSchemaMismatch if bundle has been exported with the different config schema.
+// c, err := cog.ImportBundle[ConfigStruct](f, cog.WithHandler(h))
+func ImportBundle[T any](r io.Reader, opts ...Option) (*C[T], error) {
+	b, err := ReadBundle[T](r, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if schema := SchemaVersion[T](); b.Schema != schema {
+		return nil, fmt.Errorf("%w: bundle %s, config %s", ErrSchemaMismatch, b.Schema, schema)
+	}
+
+	cog, err := New[T](opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	config := b.Config
+	if err := decryptFields(&config, cog.opts.KeyProvider); err != nil {
+		cog.Close()
+		return nil, err
+	}
+	config = keepSecrets(config, cog.Config())
+
+	if err := cog.UpdateWithMeta(config, Meta{"bundle": b.Exported.Format(time.RFC3339)}); err != nil {
+		cog.Close()
+		return nil, fmt.Errorf("failed at apply bundle config: %w", err)
+	}
+
+	cog.restoreState(b)
+
+	return cog, nil
+}
+
+// Restore revision and history of the bundle, they are kept if the instance is ahead.
+func (cog *C[T]) restoreState(b Bundle[T]) {
+	cog.revs.lock.Lock()
+	if b.Revision > cog.revs.current {
+		cog.revs.current = b.Revision
+		cog.revs.broadcast()
+	}
+	cog.revs.lock.Unlock()
+
+	cog.status.lock.Lock()
+	defer cog.status.lock.Unlock()
+
+	reports := append(append([]UpdateReport{}, b.History...), cog.status.reports...)
+	if n := cog.opts.UpdateReports; len(reports) > n {
+		reports = reports[len(reports)-n:]
+	}
+	cog.status.reports = reports
+}
+
+// Get copy of the config with secret fields zeroed.
+func clearSecrets[T any](config T) T {
+	v := reflect.ValueOf(&config).Elem()
+	if v.Kind() != reflect.Struct {
+		return config
+	}
+
+	walkFields(v, "", func(_ string, sf reflect.StructField, f reflect.Value) {
+		if isSecret(sf) && f.CanSet() {
+			f.Set(reflect.Zero(f.Type()))
+		}
+	})
+
+	return config
+}
+
+// Copy secret fields which are empty in the config from the current one.
+func keepSecrets[T any](config T, current T) T {
+	v := reflect.ValueOf(&config).Elem()
+	if v.Kind() != reflect.Struct {
+		return config
+	}
+	cur := reflect.ValueOf(current)
+
+	walkFields(v, "", func(path string, sf reflect.StructField, f reflect.Value) {
+		if !isSecret(sf) || !f.CanSet() || !f.IsZero() {
+			return
+		}
+		f.Set(fieldByPath(cur, path))
+	})
+
+	return config
+}
+
+type bundleMeta struct {
+	Version   int       `json:"version"`
+	Schema    string    `json:"schema"`
+	Exported  time.Time `json:"exported"`
+	Revision  uint64    `json:"revision"`
+	Timestamp string    `json:"timestamp"`
+}
+
+// Update report with errors as strings, so they survive JSON encoding.
+type bundleReport struct {
+	Revision    uint64         `json:"revision"`
+	Started     time.Time      `json:"started"`
+	Duration    time.Duration  `json:"duration"`
+	Subscribers []bundleTiming `json:"subscribers"`
+	Err         string         `json:"error,omitempty"`
+	Meta        Meta           `json:"meta,omitempty"`
+}
+
+type bundleTiming struct {
+	Id       int           `json:"id"`
+	Name     string        `json:"name"`
+	Duration time.Duration `json:"duration"`
+	Err      string        `json:"error,omitempty"`
+}
+
+func newBundleReport(r UpdateReport) bundleReport {
+	b := bundleReport{Revision: r.Revision, Started: r.Started, Duration: r.Duration, Err: errString(r.Err), Meta: r.Meta, Subscribers: []bundleTiming{}}
+	for _, s := range r.Subscribers {
+		b.Subscribers = append(b.Subscribers, bundleTiming{Id: s.Id, Name: s.Name, Duration: s.Duration, Err: errString(s.Err)})
+	}
+	return b
+}
+
+func (b bundleReport) report() UpdateReport {
+	r := UpdateReport{Revision: b.Revision, Started: b.Started, Duration: b.Duration, Err: stringErr(b.Err), Meta: b.Meta, Subscribers: []SubscriberTiming{}}
+	for _, s := range b.Subscribers {
+		r.Subscribers = append(r.Subscribers, SubscriberTiming{Id: s.Id, Name: s.Name, Duration: s.Duration, Err: stringErr(s.Err)})
+	}
+	return r
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func stringErr(s string) error {
+	if s == "" {
+		return nil
+	}
+	return errors.New(s)
+}
+
+func writeBundle[T any](w io.Writer, b Bundle[T]) error {
+	history := []bundleReport{}
+	for _, r := range b.History {
+		history = append(history, newBundleReport(r))
+	}
+
+	entries := []struct {
+		name string
+		data any
+	}{
+		{bundleManifest, bundleMeta{Version: b.Version, Schema: b.Schema, Exported: b.Exported, Revision: b.Revision, Timestamp: b.Timestamp}},
+		{bundleConfig, b.Config},
+		{bundleHistory, history},
+		{bundleProvenance, b.Sources},
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	for _, e := range entries {
+		data, err := json.MarshalIndent(e.data, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed at encode bundle %s: %v", e.name, err)
+		}
+
+		hdr := &tar.Header{Name: e.name, Mode: 0600, Size: int64(len(data)), ModTime: b.Exported}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("failed at write bundle: %v", err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			return fmt.Errorf("failed at write bundle: %v", err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed at write bundle: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed at write bundle: %v", err)
+	}
+	return nil
+}
+
+// Read entries of the archive. Unpacked size is limited by maxBundleSize and size of the config entry by limits.
+func readArchive(r io.Reader, l Limits) (map[string][]byte, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	entries := map[string][]byte{}
+	remaining := int64(maxBundleSize)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		max := remaining
+		if hdr.Name == bundleConfig && l.MaxSize > 0 && int64(l.MaxSize) < max {
+			max = int64(l.MaxSize)
+		}
+		if hdr.Size > max {
+			return nil, fmt.Errorf("%w: bundle %s is %d bytes, max %d", ErrLimitExceeded, hdr.Name, hdr.Size, max)
+		}
+
+		// header size is not trusted, entry is read up to the limit
+		data, err := io.ReadAll(io.LimitReader(tr, max+1))
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(data)) > max {
+			return nil, fmt.Errorf("%w: bundle %s is larger than %d bytes", ErrLimitExceeded, hdr.Name, max)
+		}
+		entries[hdr.Name] = data
+		remaining -= int64(len(data))
+	}
+}
+
+func decodeEntry(entries map[string][]byte, name string, v any) error {
+	data, ok := entries[name]
+	if !ok {
+		return fmt.Errorf("bundle has no %s", name)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed at decode bundle %s: %v", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package cog
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"reflect"
+)
+
+var ErrNoCandidate = errors.New("there is no candidate config")
+
+// Candidate config evaluated next to the current one.
+type candidate[T any] struct {
+	config      T
+	weight      float64
+	base        T
+	placeholder map[string]string
+}
+
+// Hold candidate config next to the current one, so part of the traffic can run against it before it is promoted,
+// see c.Select. Weight is a fraction of the keys selecting candidate, from 0 to 1. Candidate is checked the same
+// way as Update (hooks, normalization, validation, authorization and policy), but subscribers are not notified
+// and it is not saved. Setting new candidate replaces the previous one.
+func (cog *C[T]) SetCandidate(config T, weight float64) error {
+	if weight < 0 || weight > 1 {
+		return fmt.Errorf("candidate weight must be from 0 to 1, got %v", weight)
+	}
+
+	cog.update.Lock()
+	defer cog.update.Unlock()
+
+	if err := cog.checkClosed(); err != nil {
+		return err
+	}
+
+	config, placeholder, err := cog.check("", cog.getHooks(), cog.config, config)
+	if err != nil {
+		return fmt.Errorf("failed at check candidate config: %w", err)
+	}
+
+	cog.lock.Lock()
+	cog.candidate = &candidate[T]{config: config, weight: weight, base: cog.config, placeholder: placeholder}
+	cog.lock.Unlock()
+
+	return nil
+}
+
+// Get candidate config, false if there is none.
+func (cog *C[T]) Candidate() (T, bool) {
+	cog.lock.Lock()
+	defer cog.lock.Unlock()
+
+	if cog.candidate == nil {
+		return *new(T), false
+	}
+	return cog.candidate.config, true
+}
+
+// Drop candidate config, all keys select the current config.
+func (cog *C[T]) DropCandidate() {
+	cog.lock.Lock()
+	defer cog.lock.Unlock()
+
+	cog.candidate = nil
+}
+
+// Select config for the request by its key, e.g. user or tenant ID. Returns candidate config and true
+// for the fraction of keys set by the candidate weight, current config and false for the rest.
+// Key keeps selecting the same config while weight is not lowered, so it is safe to increase weight gradually.
+// cfg, _ := c.Select(userID)
+func (cog *C[T]) Select(key string) (T, bool) {
+	cog.lock.Lock()
+	defer cog.lock.Unlock()
+
+	if cog.candidate != nil && bucket(key) < cog.candidate.weight {
+		return cog.candidate.config, true
+	}
+	return cog.config, false
+}
+
+// Apply candidate config as it has been checked by SetCandidate: update hooks and checks are not run again,
+// subscribers are notified and config is saved the same way as on Update. Candidate is dropped once it has been applied.
+// Returns cog.ErrNoCandidate if there is no candidate, or an error if config has changed since candidate was set.
+func (cog *C[T]) Promote() error {
+	cog.update.Lock()
+	defer cog.update.Unlock()
+
+	if err := cog.canUpdate(); err != nil {
+		return err
+	}
+
+	cog.lock.Lock()
+	c := cog.candidate
+	cog.lock.Unlock()
+
+	if c == nil {
+		return ErrNoCandidate
+	}
+
+	old := cog.config
+	if !reflect.DeepEqual(old, c.base) {
+		return fmt.Errorf("config has changed since candidate was set, set candidate again")
+	}
+
+	if cog.opts.Shadow {
+		return cog.shadowUpdate(old, c.config, nil, nil)
+	}
+
+	if err := cog.commit(cog.getHooks(), old, c.config, c.placeholder, nil); err != nil {
+		return err
+	}
+
+	cog.lock.Lock()
+	if cog.candidate == c {
+		cog.candidate = nil
+	}
+	cog.lock.Unlock()
+
+	return nil
+}
+
+// Map key to a stable position from 0 to 1.
+func bucket(key string) float64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return float64(h.Sum64()%10000) / 10000
+}
@@ -0,0 +1,58 @@
+package cog
+
+// Subscriber which receives previous config together with the new one, see AddSubscriberEv.
+type SubscriberEv[T any] func(old, new T) error
+
+// Callback which receives previous config together with the new one, see AddCallbackEv.
+type CallbackEv[T any] func(old, new T)
+
+// Register subscriber which receives config it has been called with the last time together with the new one,
+// e.g. to restart listener only when the port has changed. Old config of the first call is the one
+// at the moment of registration. Config passed with a failed call does not become the old one.
+// It is called and rolled back the same way as subscribers added with AddSubscriber.
+func (cog *C[T]) AddSubscriberEv(f SubscriberEv[T]) int {
+	if f == nil {
+		return cog.addSubscriber(nil, "")
+	}
+
+	// subscribers are called one change at a time
+	var old *T
+	return cog.addSubscriber(func(new T) error {
+		if old == nil {
+			// config delivered before the first change, change in progress at registration is not delivered
+			cog.lock.Lock()
+			prev := cog.notified
+			cog.lock.Unlock()
+			old = &prev
+		}
+		if err := f(*old, new); err != nil {
+			return err
+		}
+		old = &new
+		return nil
+	}, funcName(f))
+}
+
+// Register callback which receives config it has been called with the last time together with the new one.
+// Old config of the first call is the one at the moment of registration. Changes superseded while callback
+// is busy are skipped, so old and new configs can be a few revisions apart, see cog.WithCallbackDelivery.
+func (cog *C[T]) AddCallbackEv(f CallbackEv[T]) int {
+	if f == nil {
+		return cog.addCallback(nil, "")
+	}
+
+	// no change can be posted between the snapshot and registration
+	cog.lock.Lock()
+	defer cog.lock.Unlock()
+
+	old := cog.config
+	if cog.posted != nil {
+		old = *cog.posted
+	}
+
+	// mailbox delivers changes one at a time
+	return cog.putCallback(func(_ uint64, new T) {
+		f(old, new)
+		old = new
+	}, funcName(f))
+}
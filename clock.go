@@ -0,0 +1,20 @@
+package cog
+
+import "time"
+
+// Clock provides current time and timers. Replace it with cog.WithClock to test time dependent behavior
+// (timestamps, debouncing, retries, periodic checks) without waiting for real time to pass.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
@@ -0,0 +1,45 @@
+package cog
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrClosed = errors.New("config instance is closed")
+
+// Close the instance: wait for the change in progress to be saved, stop background goroutines (watchers,
+// health checks, lease renewal, ramps) and wait until callbacks have returned. Subsequent updates and reloads
+// fail with cog.ErrClosed, config can still be read. Closing closed instance does nothing.
+// Close must not be called from subscribers, hooks or callbacks.
+func (cog *C[T]) Close() error {
+	cog.update.Lock()
+	if cog.closed {
+		cog.update.Unlock()
+		return nil
+	}
+	cog.closed = true
+	cog.setRamp(nil)
+	cog.update.Unlock()
+
+	cog.stop()
+	cog.workers.Wait()
+
+	return cog.AwaitApplied(context.Background(), cog.Revision())
+}
+
+// Check if instance has been closed. Update lock must be held.
+func (cog *C[T]) checkClosed() error {
+	if cog.closed {
+		return ErrClosed
+	}
+	return nil
+}
+
+// Run background goroutine, Close waits for it to return after the instance is stopped.
+func (cog *C[T]) background(f func()) {
+	cog.workers.Add(1)
+	go func() {
+		defer cog.workers.Done()
+		f()
+	}()
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/leonidasdeim/cog"
+)
+
+// Send command to the control socket of the running instance and print config or history.
+func runCtl(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("ctl", flag.ContinueOnError)
+	socket := fs.String("socket", "", `path of the control socket, e.g. /var/run/myapp/cog.sock, or named pipe on Windows, e.g. \\.\pipe\myapp-cog`)
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *socket == "" || fs.NArg() == 0 {
+		return fmt.Errorf("socket and command are expected, e.g. cogctl ctl --socket cog.sock get")
+	}
+
+	req := cog.ControlRequest{Command: fs.Arg(0)}
+	if req.Command == cog.ControlUpdate {
+		if fs.NArg() != 2 {
+			return fmt.Errorf("merge patch is expected, e.g. cogctl ctl --socket cog.sock update '{\"port\": 8081}'")
+		}
+		req.Patch = json.RawMessage(fs.Arg(1))
+	}
+
+	resp, err := cog.Control(*socket, req)
+	if err != nil {
+		return err
+	}
+	if resp.Error != "" {
+		return errors.New(resp.Error)
+	}
+
+	out := resp.Config
+	switch req.Command {
+	case cog.ControlHistory:
+		out = resp.History
+	case cog.ControlSources:
+		if out, err = json.Marshal(resp.Sources); err != nil {
+			return err
+		}
+	}
+
+	var b bytes.Buffer
+	if err := json.Indent(&b, out, "", "  "); err != nil {
+		return err
+	}
+	fmt.Fprintf(&b, "\nrevision: %d\n", resp.Revision)
+
+	_, err = b.WriteTo(stdout)
+	return err
+}
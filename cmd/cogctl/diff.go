@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/leonidasdeim/cog"
+)
+
+// Files differ, reported with exit code 1 as by diff(1).
+var errDifferent = errors.New("config files differ")
+
+func runDiff(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return fmt.Errorf("two config files are expected, e.g. cogctl diff staging.yaml prod.yaml")
+	}
+
+	d, err := cog.Compare(
+		cog.CompareFile[map[string]any](fs.Arg(0)),
+		cog.CompareFile[map[string]any](fs.Arg(1)),
+	)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(stdout, d.String()); err != nil {
+		return err
+	}
+	if len(d) > 0 {
+		return errDifferent
+	}
+	return nil
+}
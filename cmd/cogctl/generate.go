@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	fh "github.com/leonidasdeim/cog/filehandler"
+)
+
+// Shape of the config value inferred from the file.
+type shape struct {
+	kind   string // "null", "scalar", "object", "list" or "any"
+	scalar string
+	fields map[string]*shape
+	elem   *shape
+}
+
+func runGenerate(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("generate", flag.ContinueOnError)
+	from := fs.String("from", "", "existing config file (.json, .yaml, .yml or .toml)")
+	pkg := fs.String("pkg", "config", "package name of the generated code")
+	name := fs.String("type", "Config", "name of the root struct")
+	out := fs.String("out", "", "output file, stdout by default")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *from == "" {
+		return fmt.Errorf("config file is not provided, use --from")
+	}
+
+	src, err := generate(*from, *pkg, *name)
+	if err != nil {
+		return err
+	}
+
+	if *out == "" {
+		_, err = stdout.Write(src)
+		return err
+	}
+	return os.WriteFile(*out, src, 0664)
+}
+
+// Generate Go source of the config struct inferred from the file.
+func generate(file, pkg, name string) ([]byte, error) {
+	t := fileType(file)
+	codec := fh.NewCodec(t)
+	if codec == nil {
+		return nil, fmt.Errorf("unsupported config file type: %s", filepath.Ext(file))
+	}
+
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed at read config file: %v", err)
+	}
+
+	var doc any
+	if err := codec.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("failed at decode config file: %v", err)
+	}
+
+	root := infer(doc)
+	if root.kind != "object" {
+		return nil, fmt.Errorf("config file must contain an object, not %s", root.kind)
+	}
+
+	g := generator{tag: string(t), names: map[string]bool{}}
+	g.structs(name, root)
+
+	buf := bytes.Buffer{}
+	fmt.Fprintf(&buf, "// Generated by cogctl from %s, review types and add tags as needed.\n\n", filepath.Base(file))
+	fmt.Fprintf(&buf, "package %s\n\n", pkg)
+	if g.time {
+		buf.WriteString("import \"time\"\n\n")
+	}
+	buf.Write(g.buf.Bytes())
+
+	return format.Source(buf.Bytes())
+}
+
+func fileType(file string) fh.FileType {
+	switch strings.ToLower(strings.TrimPrefix(filepath.Ext(file), ".")) {
+	case "json":
+		return fh.JSON
+	case "yaml", "yml":
+		return fh.YAML
+	case "toml":
+		return fh.TOML
+	}
+	return fh.DYNAMIC
+}
+
+func infer(v any) *shape {
+	switch v := v.(type) {
+	case nil:
+		return &shape{kind: "null"}
+	case map[string]any:
+		s := &shape{kind: "object", fields: map[string]*shape{}}
+		for k, f := range v {
+			s.fields[k] = infer(f)
+		}
+		return s
+	case map[any]any:
+		s := &shape{kind: "object", fields: map[string]*shape{}}
+		for k, f := range v {
+			s.fields[fmt.Sprint(k)] = infer(f)
+		}
+		return s
+	case []any:
+		s := &shape{kind: "list", elem: &shape{kind: "null"}}
+		for _, e := range v {
+			s.elem = merge(s.elem, infer(e))
+		}
+		return s
+	case string:
+		return &shape{kind: "scalar", scalar: "string"}
+	case bool:
+		return &shape{kind: "scalar", scalar: "bool"}
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return &shape{kind: "scalar", scalar: "int"}
+	case float32:
+		return &shape{kind: "scalar", scalar: "float64"}
+	case float64:
+		// JSON numbers are decoded as float64
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return &shape{kind: "scalar", scalar: "int"}
+		}
+		return &shape{kind: "scalar", scalar: "float64"}
+	case time.Time:
+		return &shape{kind: "scalar", scalar: "time.Time"}
+	}
+	return &shape{kind: "any"}
+}
+
+// Merge shapes of the values found at the same place, e.g. elements of the list.
+func merge(a, b *shape) *shape {
+	switch {
+	case a.kind == "null":
+		return b
+	case b.kind == "null":
+		return a
+	case a.kind != b.kind:
+		return &shape{kind: "any"}
+	}
+
+	switch a.kind {
+	case "scalar":
+		if a.scalar == b.scalar {
+			return a
+		}
+		if (a.scalar == "int" || a.scalar == "float64") && (b.scalar == "int" || b.scalar == "float64") {
+			return &shape{kind: "scalar", scalar: "float64"}
+		}
+		return &shape{kind: "any"}
+	case "object":
+		s := &shape{kind: "object", fields: map[string]*shape{}}
+		for k, f := range a.fields {
+			s.fields[k] = f
+		}
+		for k, f := range b.fields {
+			if prev, ok := s.fields[k]; ok {
+				f = merge(prev, f)
+			}
+			s.fields[k] = f
+		}
+		return s
+	case "list":
+		return &shape{kind: "list", elem: merge(a.elem, b.elem)}
+	}
+	return a
+}
+
+type generator struct {
+	buf   bytes.Buffer
+	tag   string
+	names map[string]bool
+	time  bool
+}
+
+// Write struct and its nested structs, nested ones are written after the parent.
+func (g *generator) structs(name string, s *shape) {
+	g.names[name] = true
+
+	keys := make([]string, 0, len(s.fields))
+	for k := range s.fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	type nested struct {
+		name  string
+		shape *shape
+	}
+	pending := []nested{}
+	fields := map[string]bool{}
+
+	fmt.Fprintf(&g.buf, "type %s struct {\n", name)
+	for _, k := range keys {
+		field := uniqueName(identifier(k), fields)
+		fields[field] = true
+
+		typ := g.typeOf(name, k, s.fields[k], func(n string, s *shape) {
+			pending = append(pending, nested{n, s})
+		})
+		fmt.Fprintf(&g.buf, "\t%s %s `%s:%q`\n", field, typ, g.tag, k)
+	}
+	g.buf.WriteString("}\n\n")
+
+	for _, n := range pending {
+		g.structs(n.name, n.shape)
+	}
+}
+
+func (g *generator) typeOf(parent, key string, s *shape, nest func(string, *shape)) string {
+	switch s.kind {
+	case "scalar":
+		if s.scalar == "time.Time" {
+			g.time = true
+		}
+		return s.scalar
+	case "object":
+		name := g.structName(parent, identifier(key))
+		g.names[name] = true
+		nest(name, s)
+		return name
+	case "list":
+		return "[]" + g.typeOf(parent, singular(key), s.elem, nest)
+	}
+	return "any"
+}
+
+// Get name of the nested struct, prefixed with parent name on collision.
+func (g *generator) structName(parent, name string) string {
+	if !g.names[name] {
+		return name
+	}
+	return uniqueName(parent+name, g.names)
+}
+
+func uniqueName(name string, taken map[string]bool) string {
+	n := name
+	for i := 2; taken[n]; i++ {
+		n = fmt.Sprintf("%s%d", name, i)
+	}
+	return n
+}
+
+var initialisms = map[string]bool{
+	"API": true, "CPU": true, "DB": true, "DNS": true, "DSN": true, "HTTP": true, "HTTPS": true, "ID": true, "IP": true,
+	"JSON": true, "SQL": true, "SSH": true, "TCP": true, "TLS": true, "TTL": true, "UDP": true, "URI": true,
+	"URL": true, "UUID": true, "XML": true,
+}
+
+// Convert config key to exported Go identifier, e.g. "server_url" to "ServerURL".
+func identifier(key string) string {
+	words := strings.FieldsFunc(key, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	b := strings.Builder{}
+	for _, w := range words {
+		if u := strings.ToUpper(w); initialisms[u] {
+			b.WriteString(u)
+			continue
+		}
+		r := []rune(w)
+		b.WriteString(strings.ToUpper(string(r[0])) + string(r[1:]))
+	}
+
+	id := b.String()
+	if id == "" || !unicode.IsLetter([]rune(id)[0]) {
+		id = "Field" + id
+	}
+	return id
+}
+
+// Get singular form of the list key used to name its element struct, e.g. "servers" to "server".
+func singular(key string) string {
+	switch {
+	case strings.HasSuffix(key, "ies"):
+		return strings.TrimSuffix(key, "ies") + "y"
+	case strings.HasSuffix(key, "sses"):
+		return strings.TrimSuffix(key, "es")
+	case strings.HasSuffix(key, "s") && !strings.HasSuffix(key, "ss"):
+		return strings.TrimSuffix(key, "s")
+	}
+	return key
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func TestGenerateGolden(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "generate", "app.*"))
+	require.NoError(t, err)
+
+	for _, in := range inputs {
+		if filepath.Ext(in) == ".golden" {
+			continue
+		}
+
+		t.Run(filepath.Base(in), func(t *testing.T) {
+			src, err := generate(in, "config", "Config")
+			require.NoError(t, err)
+
+			golden := in + ".golden"
+			if *update {
+				require.NoError(t, os.WriteFile(golden, src, 0664))
+			}
+
+			want, err := os.ReadFile(golden)
+			require.NoError(t, err)
+			assert.Equal(t, string(want), string(src))
+		})
+	}
+}
+
+func TestRunGenerate(t *testing.T) {
+	in := filepath.Join("testdata", "generate", "app.json")
+	out := bytes.Buffer{}
+	require.NoError(t, runGenerate([]string{"--from", in, "--pkg", "settings", "--type", "Settings"}, &out))
+	assert.Contains(t, out.String(), "package settings\n")
+	assert.Contains(t, out.String(), "type Settings struct {\n")
+
+	file := filepath.Join(t.TempDir(), "config.go")
+	require.NoError(t, runGenerate([]string{"--from", in, "--out", file}, &out))
+	b, err := os.ReadFile(file)
+	require.NoError(t, err)
+	want, err := os.ReadFile(in + ".golden")
+	require.NoError(t, err)
+	assert.Equal(t, want, b)
+}
+
+func TestGenerateErrors(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		file := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(file, []byte(content), 0664))
+		return file
+	}
+
+	assert.ErrorContains(t, runGenerate(nil, &bytes.Buffer{}), "use --from")
+
+	_, err := generate(write("app.ini", "a=1"), "config", "Config")
+	assert.ErrorContains(t, err, "unsupported config file type: .ini")
+
+	_, err = generate(filepath.Join(dir, "missing.json"), "config", "Config")
+	assert.ErrorContains(t, err, "failed at read config file")
+
+	_, err = generate(write("broken.json", "{"), "config", "Config")
+	assert.ErrorContains(t, err, "failed at decode config file")
+
+	_, err = generate(write("list.json", "[1, 2]"), "config", "Config")
+	assert.ErrorContains(t, err, "must contain an object, not list")
+}
+
+func TestIdentifier(t *testing.T) {
+	tests := map[string]string{
+		"name":       "Name",
+		"server_url": "ServerURL",
+		"http-port":  "HTTPPort",
+		"max conns":  "MaxConns",
+		"2fa":        "Field2fa",
+		"":           "Field",
+		"db.dsn":     "DBDSN",
+	}
+
+	for key, want := range tests {
+		assert.Equal(t, want, identifier(key), key)
+	}
+}
+
+func TestSingular(t *testing.T) {
+	tests := map[string]string{
+		"servers":   "server",
+		"proxies":   "proxy",
+		"addresses": "address",
+		"class":     "class",
+		"data":      "data",
+	}
+
+	for key, want := range tests {
+		assert.Equal(t, want, singular(key), key)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/leonidasdeim/cog"
+)
+
+// Files have error findings, reported with exit code 1 to block the change in CI.
+var errLintFailed = errors.New("config files have lint errors")
+
+// Lint config files without config type: secret-looking values are reported.
+func runLint(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("lint", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print findings as JSON lines")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("config files are expected, e.g. cogctl lint app.yaml")
+	}
+
+	enc := json.NewEncoder(stdout)
+	failed := false
+	for _, file := range fs.Args() {
+		findings, err := cog.LintFile[map[string]any](file)
+		if err != nil {
+			return fmt.Errorf("failed at lint %s: %v", file, err)
+		}
+
+		for _, f := range findings {
+			if f.Severity == cog.LintError {
+				failed = true
+			}
+
+			if *asJSON {
+				err = enc.Encode(struct {
+					File string `json:"file"`
+					cog.Finding
+				}{file, f})
+			} else {
+				_, err = fmt.Fprintf(stdout, "%s: %s\n", file, f)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if failed {
+		return errLintFailed
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+// Command cogctl helps to adopt cog in existing projects.
+//
+// Usage:
+//
+//	cogctl generate --from app.yaml --pkg config [--type Config] [--out config.go]
+//	cogctl diff staging.yaml prod.yaml
+//	cogctl lint [--json] app.yaml ...
+//	cogctl ctl --socket /var/run/myapp/cog.sock get|reload|history|sources|update '{"port": 8081}'
+//	cogctl tui --socket /var/run/myapp/cog.sock
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+const usage = `Usage: cogctl <command> [flags]
+
+Commands:
+  generate    infer Go config struct from an existing config file
+  diff        show how two config files differ, exits with 1 if they do
+  lint        report secret-looking values in config files, exits with 1 on errors
+  ctl         get, update or reload config of the running instance via its control socket
+  tui         browse and edit config of the running instance in the terminal
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "generate":
+		err = runGenerate(os.Args[2:], os.Stdout)
+	case "diff":
+		err = runDiff(os.Args[2:], os.Stdout)
+	case "lint":
+		err = runLint(os.Args[2:], os.Stdout)
+	case "ctl":
+		err = runCtl(os.Args[2:], os.Stdout)
+	case "tui":
+		err = runTUI(os.Args[2:], os.Stdin, os.Stdout)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if errors.Is(err, errDifferent) || errors.Is(err, errLintFailed) {
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cogctl: %v\n", err)
+		os.Exit(1)
+	}
+}
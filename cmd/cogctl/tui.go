@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/leonidasdeim/cog"
+)
+
+const tuiHelp = `Commands:
+  list [filter]          show fields, only paths containing filter if it is given
+  show <n|path>          show value of the field
+  set <n|path> <value>   update the field, value is JSON or plain string, e.g. set server.port 8081
+  history                show the last changes
+  reload                 reload config from its source
+  refresh                fetch current config
+  help                   show this help
+  quit                   exit
+`
+
+// Control client sending the command to the instance.
+type controlFunc func(req cog.ControlRequest) (cog.ControlResponse, error)
+
+// Config field shown by the browser.
+type field struct {
+	path  string
+	value any
+}
+
+// Browser of the live config: fields are listed with their values and sources, edits are sent
+// to the instance as merge patches, so they are validated and applied the same way as updates.
+type browser struct {
+	control  controlFunc
+	out      io.Writer
+	revision uint64
+	fields   []field
+	sources  map[string]cog.Source
+}
+
+// Browse and edit config of the running instance in the terminal via its control socket.
+func runTUI(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("tui", flag.ContinueOnError)
+	socket := fs.String("socket", "", `path of the control socket, e.g. /var/run/myapp/cog.sock, or named pipe on Windows, e.g. \\.\pipe\myapp-cog`)
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *socket == "" {
+		return fmt.Errorf("socket is expected, e.g. cogctl tui --socket cog.sock")
+	}
+
+	b := &browser{
+		control: func(req cog.ControlRequest) (cog.ControlResponse, error) {
+			return cog.Control(*socket, req)
+		},
+		out: stdout,
+	}
+	return b.run(stdin)
+}
+
+// Read commands until quit or end of the input.
+func (b *browser) run(stdin io.Reader) error {
+	if err := b.refresh(); err != nil {
+		return err
+	}
+	b.list("")
+
+	in := bufio.NewScanner(stdin)
+	for {
+		fmt.Fprint(b.out, "cog> ")
+		if !in.Scan() {
+			fmt.Fprintln(b.out)
+			return in.Err()
+		}
+
+		cmd, arg, _ := strings.Cut(strings.TrimSpace(in.Text()), " ")
+		arg = strings.TrimSpace(arg)
+
+		var err error
+		switch cmd {
+		case "":
+		case "list", "ls", "l":
+			b.list(arg)
+		case "show", "s":
+			err = b.show(arg)
+		case "set":
+			err = b.set(arg)
+		case "history", "h":
+			err = b.history()
+		case "reload":
+			err = b.reload()
+		case "refresh", "r":
+			if err = b.refresh(); err == nil {
+				b.list("")
+			}
+		case "help", "?":
+			fmt.Fprint(b.out, tuiHelp)
+		case "quit", "exit", "q":
+			return nil
+		default:
+			err = fmt.Errorf("unknown command %q, type help to see the commands", cmd)
+		}
+
+		if err != nil {
+			fmt.Fprintf(b.out, "error: %v\n", err)
+		}
+	}
+}
+
+// Send command to the instance, error of the command is returned as error.
+func (b *browser) send(req cog.ControlRequest) (cog.ControlResponse, error) {
+	resp, err := b.control(req)
+	if err != nil {
+		return resp, err
+	}
+	if resp.Error != "" {
+		return resp, errors.New(resp.Error)
+	}
+	return resp, nil
+}
+
+// Fetch current config and sources of the fields.
+func (b *browser) refresh() error {
+	resp, err := b.send(cog.ControlRequest{Command: cog.ControlGet})
+	if err != nil {
+		return err
+	}
+	if err := b.setConfig(resp); err != nil {
+		return err
+	}
+
+	resp, err = b.send(cog.ControlRequest{Command: cog.ControlSources})
+	if err != nil {
+		return err
+	}
+	b.sources = resp.Sources
+	return nil
+}
+
+func (b *browser) setConfig(resp cog.ControlResponse) error {
+	d := json.NewDecoder(bytes.NewReader(resp.Config))
+	d.UseNumber()
+
+	var doc map[string]any
+	if err := d.Decode(&doc); err != nil {
+		return fmt.Errorf("failed at decode config: %v", err)
+	}
+
+	b.revision = resp.Revision
+	b.fields = flatten(doc, "", nil)
+	return nil
+}
+
+func (b *browser) list(filter string) {
+	w := tabwriter.NewWriter(b.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "revision %d\n", b.revision)
+	for i, f := range b.fields {
+		if filter != "" && !strings.Contains(strings.ToLower(f.path), strings.ToLower(filter)) {
+			continue
+		}
+		fmt.Fprintf(w, "%3d\t%s\t%s\t%s\n", i+1, f.path, encode(f.value, ""), b.source(f.path))
+	}
+	w.Flush()
+}
+
+func (b *browser) show(arg string) error {
+	f, err := b.field(arg)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(b.out, "%s (%s)\n%s\n", f.path, b.source(f.path), encode(f.value, "  "))
+	return nil
+}
+
+func (b *browser) set(arg string) error {
+	ref, raw, _ := strings.Cut(arg, " ")
+	f, err := b.field(ref)
+	if err != nil {
+		return err
+	}
+	if raw = strings.TrimSpace(raw); raw == "" {
+		return fmt.Errorf("value is expected, e.g. set %s <value>", f.path)
+	}
+
+	var value any
+	if err := json.Unmarshal([]byte(raw), &value); err != nil {
+		// plain string does not need to be quoted
+		value = raw
+	}
+
+	patch, err := json.Marshal(patchOf(f.path, value))
+	if err != nil {
+		return err
+	}
+
+	resp, err := b.send(cog.ControlRequest{Command: cog.ControlUpdate, Patch: patch})
+	if err != nil {
+		return fmt.Errorf("update rejected: %v", err)
+	}
+	if err := b.setConfig(resp); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(b.out, "updated %s, revision %d\n", f.path, b.revision)
+	return nil
+}
+
+func (b *browser) reload() error {
+	resp, err := b.send(cog.ControlRequest{Command: cog.ControlReload})
+	if err != nil {
+		return err
+	}
+	if err := b.setConfig(resp); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(b.out, "reloaded, revision %d\n", b.revision)
+	return nil
+}
+
+// Update report as encoded by the control socket.
+type historyEntry struct {
+	Revision uint64            `json:"revision"`
+	Started  time.Time         `json:"started"`
+	Duration time.Duration     `json:"duration"`
+	Err      string            `json:"error"`
+	Meta     map[string]string `json:"meta"`
+}
+
+func (b *browser) history() error {
+	resp, err := b.send(cog.ControlRequest{Command: cog.ControlHistory})
+	if err != nil {
+		return err
+	}
+
+	var history []historyEntry
+	if err := json.Unmarshal(resp.History, &history); err != nil {
+		return fmt.Errorf("failed at decode history: %v", err)
+	}
+	if len(history) == 0 {
+		fmt.Fprintln(b.out, "no changes")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(b.out, 0, 4, 2, ' ', 0)
+	for _, h := range history {
+		result := "applied"
+		if h.Err != "" {
+			result = "failed: " + h.Err
+		}
+		line := fmt.Sprintf("%d\t%s\t%s\t%s", h.Revision, h.Started.Format(time.RFC3339), h.Duration, result)
+		if len(h.Meta) > 0 {
+			line += "\t" + meta(h.Meta)
+		}
+		fmt.Fprintln(w, line)
+	}
+	w.Flush()
+	return nil
+}
+
+// Find field by its number in the list or by path.
+func (b *browser) field(ref string) (field, error) {
+	if ref == "" {
+		return field{}, fmt.Errorf("field number or path is expected")
+	}
+	if n, err := strconv.Atoi(ref); err == nil {
+		if n < 1 || n > len(b.fields) {
+			return field{}, fmt.Errorf("there is no field %d", n)
+		}
+		return b.fields[n-1], nil
+	}
+	for _, f := range b.fields {
+		if strings.EqualFold(f.path, ref) {
+			return f, nil
+		}
+	}
+	return field{}, fmt.Errorf("there is no field %q", ref)
+}
+
+// Get source of the field, paths of the sources are matched case-insensitively as config may have JSON tags.
+func (b *browser) source(path string) cog.Source {
+	if s, ok := b.sources[path]; ok {
+		return s
+	}
+	for p, s := range b.sources {
+		if strings.EqualFold(p, path) {
+			return s
+		}
+	}
+	return "-"
+}
+
+// List leaf fields of the document sorted by path, lists are not expanded.
+func flatten(doc map[string]any, prefix string, fields []field) []field {
+	keys := make([]string, 0, len(doc))
+	for k := range doc {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		path := k
+		if prefix != "" {
+			path = prefix + "." + k
+		}
+		if m, ok := doc[k].(map[string]any); ok && len(m) > 0 {
+			fields = flatten(m, path, fields)
+			continue
+		}
+		fields = append(fields, field{path: path, value: doc[k]})
+	}
+	return fields
+}
+
+// Build merge patch setting the field at path.
+func patchOf(path string, value any) map[string]any {
+	keys := strings.Split(path, ".")
+	patch := map[string]any{keys[len(keys)-1]: value}
+	for i := len(keys) - 2; i >= 0; i-- {
+		patch = map[string]any{keys[i]: patch}
+	}
+	return patch
+}
+
+func encode(v any, indent string) string {
+	var b []byte
+	var err error
+	if indent == "" {
+		b, err = json.Marshal(v)
+	} else {
+		b, err = json.MarshalIndent(v, "", indent)
+	}
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+func meta(m map[string]string) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k+"="+m[k])
+	}
+	return strings.Join(pairs, " ")
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/leonidasdeim/cog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type tuiTestConfig struct {
+	Name     string `default:"app"`
+	Token    string `secret:"true" default:"s3cr3t"`
+	Database struct {
+		Host string `default:"db"`
+		Port int    `default:"5432" validate:"max=65535"`
+	}
+	Tags []string
+}
+
+// Handler keeping config in memory.
+type memoryHandler struct {
+	data []byte
+}
+
+func (h *memoryHandler) Load(data any) error {
+	if h.data == nil {
+		return errors.New("no config")
+	}
+	return json.Unmarshal(h.data, data)
+}
+
+func (h *memoryHandler) Save(data any) error {
+	var err error
+	h.data, err = json.Marshal(data)
+	return err
+}
+
+func TestTUI(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "cog.sock")
+	c, err := cog.New[tuiTestConfig](cog.WithHandler(&memoryHandler{}), cog.WithControlSocket(socket))
+	require.NoError(t, err)
+	defer c.Close()
+
+	input := strings.Join([]string{
+		"list data",
+		"show 2",
+		"set database.port 6543",
+		"set 1 replica",
+		"set 4 replica",
+		"set Database.Port 70000",
+		"set Tags [\"a\", \"b\"]",
+		"history",
+		"reload",
+		"show nope",
+		"drop",
+		"quit",
+		"list",
+	}, "\n")
+
+	var out bytes.Buffer
+	require.NoError(t, runTUI([]string{"--socket", socket}, strings.NewReader(input), &out))
+
+	cfg := c.Config()
+	assert.Equal(t, "replica", cfg.Database.Host)
+	assert.Equal(t, 6543, cfg.Database.Port)
+	assert.Equal(t, []string{"a", "b"}, cfg.Tags)
+	assert.Equal(t, "s3cr3t", cfg.Token, "secret should not be changed by the browser")
+
+	got := out.String()
+	assert.Contains(t, got, "revision 1\n  1  Database.Host  \"db\"   default\n  2  Database.Port  5432   default\n")
+	assert.Contains(t, got, "  3  Name           \"app\"  default\n  4  Tags           null   -\n")
+	assert.Contains(t, got, "Database.Port (default)\n5432\n")
+	assert.Contains(t, got, "updated Database.Port, revision 2\n")
+	assert.Contains(t, got, "updated Database.Host, revision 3\n")
+	assert.Contains(t, got, "error: update rejected: failed at apply patch: json: cannot unmarshal string")
+	assert.Contains(t, got, "error: update rejected: failed at validate config:")
+	assert.Contains(t, got, "updated Tags, revision 4\n")
+	assert.Regexp(t, `cog> 2 +\S+ +\S+ +applied\n3 +\S+ +\S+ +applied\n4 +\S+ +\S+ +applied\n`, got)
+	assert.Contains(t, got, "reloaded, revision 4\n")
+	assert.Contains(t, got, "error: there is no field \"nope\"\n")
+	assert.Contains(t, got, "error: unknown command \"drop\"")
+	assert.NotContains(t, got, "s3cr3t")
+
+	// list after quit is not run
+	assert.Equal(t, 2, strings.Count(got, "Database.Host  "))
+}
+
+func TestTUIErrors(t *testing.T) {
+	err := runTUI(nil, strings.NewReader(""), &bytes.Buffer{})
+	assert.ErrorContains(t, err, "socket is expected")
+
+	err = runTUI([]string{"--socket", filepath.Join(t.TempDir(), "missing.sock")}, strings.NewReader(""), &bytes.Buffer{})
+	assert.ErrorContains(t, err, "failed at connect control socket")
+}
+
+func TestFlatten(t *testing.T) {
+	fields := flatten(map[string]any{
+		"b": map[string]any{"y": 1, "x": map[string]any{"z": true}},
+		"a": []any{1, 2},
+		"c": map[string]any{},
+	}, "", nil)
+
+	assert.Equal(t, []field{
+		{"a", []any{1, 2}},
+		{"b.x.z", true},
+		{"b.y", 1},
+		{"c", map[string]any{}},
+	}, fields)
+}
+
+func TestPatchOf(t *testing.T) {
+	assert.Equal(t, map[string]any{"a": 1}, patchOf("a", 1))
+	assert.Equal(t, map[string]any{"a": map[string]any{"b": map[string]any{"c": "x"}}}, patchOf("a.b.c", "x"))
+}
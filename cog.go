@@ -1,96 +1,592 @@
 package cog
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
+	"reflect"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
-	"github.com/go-playground/validator/v10"
 	fh "github.com/leonidasdeim/cog/filehandler"
+	"github.com/leonidasdeim/cog/handlerapi"
 )
 
 type Subscriber[T any] func(T) error
 type Callback[T any] func(T)
+type RevisionCallback[T any] func(revision uint64, config T)
 type MaskFn[T any] func(*T)
 
+// C holds configuration of type T. All methods are safe for concurrent use.
+// Updates and reloads are serialized, config returned by Config() is a copy of the last applied config.
+// Subscribers and hooks are called synchronously during the change. They can read the instance
+// and register callbacks or subscribers, but must not Update or Reload it.
+// Callbacks are called in separate goroutines after the change is applied.
 type C[T any] struct {
+	// update serializes changes, lock guards fields and is held only briefly, never while calling user code.
+	// Fields which are read outside of changes are written holding both locks,
+	// so code holding the update lock can read them without lock.
+	update      sync.Mutex
 	lock        sync.Mutex
+	opts        Optional
 	config      T
+	base        T
+	updated     time.Time
+	present     fieldSet
+	source      sourceDoc[T]
+	meta        metadataCache
+	placeholder map[string]string
+	changeMeta  Meta
+	changeCtx   context.Context
+	candidate   *candidate[T]
+	unknownKeys []string
+	raw         []byte
+	roundTrip   []string
+	usage       *string
+	initReport  InitReport
 	timestamp   string
 	handler     ConfigHandler
-	subscribers map[int](Subscriber[T])
-	callbacks   map[int](Callback[T])
+	subscribers map[int]subscriber[T]
+	checks      map[int](func(T) error)
+	callbacks   map[int](*mailbox[T])
+	notified    T
+	posted      *T
+	nextId      int
+	hooks       hooks[T]
+	secrets     map[string]secretMeta
+	leader      bool
+	revs        revisions
+	ramp        *rampState[T]
+	status      status
+	watch       watchState
+	done        chan struct{}
+	stopOnce    sync.Once
+	workers     sync.WaitGroup
+	closed      bool
 }
 
-type ConfigHandler interface {
-	Load(any) error
-	Save(any) error
-}
+var ErrReadOnly = errors.New("config is read-only")
+var ErrImmutable = errors.New("immutable field can not be updated")
+
+// ConfigHandler loads and saves config document, see handlerapi package.
+type ConfigHandler = handlerapi.ConfigHandler
+
+// ReadOnlyHandler can not write the source, see handlerapi package.
+// Instance with such handler is read-only the same way as with cog.ReadOnly.
+type ReadOnlyHandler = handlerapi.ReadOnlyHandler
 
 // Initialize library. Returns cog instance.
 // Receives config handler.
 // To use default builtin JSON file handler:
 // c, err := cog.Init[ConfigStruct](handler.New())
+//
+// Deprecated: use cog.New with options, e.g. cog.New[ConfigStruct](cog.WithHandler(h)).
 func Init[T any](handler ...ConfigHandler) (*C[T], error) {
+	opts := []Option{}
+	if len(handler) > 0 {
+		opts = append(opts, WithHandler(handler[0]))
+	}
+
+	return New[T](opts...)
+}
+
+// Create new cog instance configured with options.
+// c, err := cog.New[ConfigStruct](cog.WithHandler(h), cog.WithEnvPrecedence(cog.EnvOverridesFile))
+func New[T any](opts ...Option) (*C[T], error) {
+	return newInstance[T](context.Background(), opts)
+}
+
+func newInstance[T any](ctx context.Context, opts []Option) (*C[T], error) {
+	o := newOptional(opts)
+
 	cog := C[T]{
-		callbacks:   make(map[int]Callback[T]),
-		subscribers: make(map[int]Subscriber[T]),
+		opts:        o,
+		handler:     o.Handler,
+		callbacks:   make(map[int]*mailbox[T]),
+		subscribers: make(map[int]subscriber[T]),
+		checks:      make(map[int]func(T) error),
+		status:      status{current: Status{Healthy: true}},
+		watch:       watchState{resume: make(chan struct{}, 1)},
+		done:        make(chan struct{}),
+		revs:        newRevisions(),
 	}
 
-	if len(handler) > 0 {
-		cog.handler = handler[0]
-	} else {
+	if cog.handler == nil {
 		cog.handler, _ = fh.New() // default DYNAMIC file handler
 	}
-
-	cog.load()
-	cog.defaults()
-
-	if err := validate(cog.Config()); err != nil {
-		return nil, err
+	if h, ok := cog.handler.(ReadOnlyHandler); ok && h.ReadOnly() {
+		// source can not be written, updates are rejected unless cog.ReadOnlyInMemory is used
+		cog.opts.ReadOnly = true
+	}
+	if o.Logger != nil {
+		cog.OnEvent(cog.logEvent)
 	}
 
-	if err := cog.save(); err != nil {
+	report := InitReport{Started: o.Clock.Now()}
+	cog.setChangeContext(ctx)
+	err := cog.init(&report)
+	cog.setChangeContext(nil)
+	cog.finishInit(report, err)
+	if err != nil {
 		return nil, err
 	}
 
 	return &cog, nil
 }
 
+func newOptional(opts []Option) Optional {
+
+	// Set defaults
+	o := Optional{
+		ReloadRetry:   5 * time.Second,
+		Clock:         systemClock{},
+		RampInterval:  time.Second,
+		UpdateReports: 10,
+	}
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return o
+}
+
+// Load and resolve config, save it and start background goroutines. Progress is recorded to the report.
+func (cog *C[T]) init(report *InitReport) error {
+	if err := cog.load(report); err != nil {
+		return err
+	}
+
+	sources, err := cog.resolve(&cog.config, cog.present)
+	if err != nil {
+		return err
+	}
+	report.Sources = sources
+
+	if cog.placeholder, err = cog.expandPlaceholders(&cog.config, nil); err != nil {
+		return err
+	}
+
+	if err := normalize(&cog.config, configDir(cog.handler)); err != nil {
+		return err
+	}
+
+	if err := cog.validate(cog.Config(), PhaseInit); err != nil {
+		return err
+	}
+
+	if err := cog.loadSecretAges(); err != nil {
+		return err
+	}
+	cog.trackSecrets(cog.config)
+
+	cog.acquireLease()
+
+	if report.FromSnapshot || report.Unavailable || !cog.leader || cog.opts.ReadOnly || cog.opts.DisableInitSave {
+		// source is unavailable and config will be synchronized on reload, or instance does not write the source on init
+		cog.base = cog.config
+		cog.updateTimestamp()
+	} else {
+		if err := cog.save(); err != nil {
+			return err
+		}
+		report.Saved = true
+		report.Warnings = append(report.Warnings, cog.roundTrip...)
+	}
+
+	cog.publish()
+	cog.reportUsage()
+
+	if err := cog.startWatching(); err != nil {
+		return err
+	}
+
+	cog.startHealthCheck()
+	cog.startSecretRotationCheck()
+	cog.startLeaseRenewal()
+
+	return cog.startControl()
+}
+
 // Update configuration data. After update subscribers will be notified.
 func (cog *C[T]) Update(new T) error {
-	cog.lock.Lock()
-	defer cog.lock.Unlock()
+	return cog.UpdateAs("", new)
+}
+
+// Update configuration data on behalf of the actor, e.g. user or service calling admin API.
+// Actor and changes are passed to the authorizer configured with cog.WithUpdateAuthorizer
+// and to the policy configured with cog.WithUpdatePolicy.
+// If leader lease is configured, only the leader can update, other instances get cog.ErrNotLeader.
+// Frozen config rejects updates with cog.ErrFrozen, see c.Freeze.
+// Read-only instance rejects updates with cog.ErrReadOnly, unless cog.ReadOnlyInMemory is used.
+func (cog *C[T]) UpdateAs(actor string, new T) error {
+	return cog.updateAs(actor, new, nil)
+}
+
+func (cog *C[T]) updateAs(actor string, new T, meta Meta) error {
+	return cog.updateCtx(context.Background(), actor, replace(new), meta)
+}
+
+// Update configuration data computed from the current one, e.g. to increment a counter or toggle a flag.
+// Mutation is called with the current config under the update lock, so concurrent updates and reloads
+// can not happen in between and no change is lost. Error returned by the mutation abandons the update.
+// Current config is a shallow copy: maps, slices and pointers are shared, replace them instead of modifying in place.
+// Mutation must not call other update methods of the instance.
+// err := c.UpdateFunc(func(cur ConfigStruct) (ConfigStruct, error) { cur.Replicas++; return cur, nil })
+func (cog *C[T]) UpdateFunc(mutate func(cur T) (T, error)) error {
+	return cog.updateCtx(context.Background(), "", mutate, nil)
+}
 
-	if err := validate(new); err != nil {
+// Mutation replacing config with the new one.
+func replace[T any](new T) func(T) (T, error) {
+	return func(T) (T, error) {
+		return new, nil
+	}
+}
+
+func (cog *C[T]) updateCtx(ctx context.Context, actor string, mutate func(cur T) (T, error), meta Meta) error {
+	cog.update.Lock()
+	defer cog.update.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := cog.canUpdate(); err != nil {
+		return err
+	}
+
+	cog.setChangeMeta(meta)
+	defer cog.setChangeMeta(nil)
+	cog.setChangeContext(ctx)
+	defer cog.setChangeContext(nil)
+
+	old := cog.config
+	hooks := cog.getHooks()
+
+	new, err := mutate(old)
+	if err != nil {
+		return err
+	}
+
+	new, placeholder, err := cog.check(actor, hooks, old, new)
+	if cog.opts.Shadow {
+		return cog.shadowUpdate(old, new, meta, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	return cog.commit(hooks, old, new, placeholder, meta)
+}
+
+// Check that the instance accepts updates: it is not closed, read-only or frozen and it is the leader.
+func (cog *C[T]) canUpdate() error {
+	if err := cog.checkClosed(); err != nil {
+		return err
+	}
+
+	switch {
+	case cog.opts.ReadOnly && !cog.opts.MemoryUpdates:
+		return ErrReadOnly
+	case !cog.opts.ReadOnly && !cog.IsLeader():
+		return ErrNotLeader
+	}
+
+	return cog.checkFrozen()
+}
+
+// Apply checked config: notify subscribers, save and publish it. Must be called under the update lock.
+func (cog *C[T]) commit(hooks hooks[T], old T, new T, placeholder map[string]string, meta Meta) error {
+	first, ramp, err := cog.planRamp(old, new)
+	if err != nil {
 		return err
 	}
 
-	if err := cog.notify(new); err != nil {
+	if err := cog.notify(first, cog.delivered()); err != nil {
 		return err
 	}
+	// change is applied once subscribers have accepted it, so it is not cancelled anymore
+	cog.setChangeContext(withoutCancel(cog.ChangeContext()))
+	cog.setRamp(ramp)
 
+	cog.lock.Lock()
 	cog.config = new
+	cog.updated = cog.opts.Clock.Now()
+	cog.lock.Unlock()
+	cog.placeholder = placeholder
+
+	cog.trackSecrets(new)
 
 	if err := cog.save(); err != nil {
 		return err
 	}
 
+	cog.publish()
+	cog.reportUsage()
+	hooks.runAfterUpdate(old, new)
+
+	d := diff(old, new)
+	cog.emit(Event{Type: EventUpdated, Time: cog.opts.Clock.Now(), Fields: d.Paths(), Diff: d, Meta: meta.clone()})
+
 	return nil
 }
 
+// Run update hooks, resolve placeholders, normalize and check the new config before it is applied.
+// Returns config to apply and its placeholders.
+func (cog *C[T]) check(actor string, hooks hooks[T], old T, new T) (T, map[string]string, error) {
+	c, err := cog.preflight(actor, hooks, old, new)
+	if err != nil {
+		return c.config, nil, err
+	}
+	if err := c.err(); err != nil {
+		return c.config, nil, err
+	}
+	return c.config, c.placeholder, nil
+}
+
+// Result of the update checks, shared by Update, Check and Simulate.
+type checked[T any] struct {
+	config      T
+	placeholder map[string]string
+	diff        Diff
+	// exceeded limits or validation error
+	invalid   error
+	immutable []string
+	// unsafe change of the bounded field
+	unsafe error
+	// authorization or policy denial
+	denied   error
+	rejected []error
+}
+
+// Get the error update is rejected with, problems are reported in the order they are checked.
+func (c checked[T]) err() error {
+	switch {
+	case c.invalid != nil:
+		return c.invalid
+	case len(c.immutable) > 0:
+		return fmt.Errorf("%w: %s", ErrImmutable, strings.Join(c.immutable, ", "))
+	case c.unsafe != nil:
+		return c.unsafe
+	}
+	return c.denied
+}
+
+// Run update hooks, resolve placeholders and normalize the new config, then check it against the current one.
+// Error is returned if config can not be prepared, problems found are reported in the result.
+// Authorization and policy are asked only if config is otherwise valid. Must be called under the update lock.
+func (cog *C[T]) preflight(actor string, hooks hooks[T], old T, new T) (checked[T], error) {
+	c := checked[T]{}
+
+	var err error
+	if c.config, err = hooks.runBeforeUpdate(old, new); err != nil {
+		return c, err
+	}
+
+	if c.placeholder, err = cog.expandPlaceholders(&c.config, cog.placeholder); err != nil {
+		return c, err
+	}
+
+	if err := normalize(&c.config, configDir(cog.handler)); err != nil {
+		return c, err
+	}
+
+	c.diff = diff(old, c.config)
+	c.invalid = checkLimits(c.config, cog.opts.Limits)
+	if c.invalid == nil {
+		c.invalid = cog.validate(c.config, PhaseUpdate)
+	}
+	c.immutable = c.diff.Immutable()
+	c.unsafe = checkBounds(old, c.config)
+
+	if c.err() == nil {
+		c.denied = cog.authorize(actor, old, c.config)
+		if c.denied == nil {
+			c.denied = cog.evaluatePolicy(actor, old, c.config)
+		}
+	}
+
+	return c, nil
+}
+
+// Reload configuration from the handler. Loaded data goes through the same sources, normalization
+// and validation as on init, then subscribers are notified the same way as on Update.
+// Reloaded configuration is not saved back. If configuration has not changed, nothing happens.
+func (cog *C[T]) Reload() error {
+	cog.update.Lock()
+	defer cog.update.Unlock()
+
+	if err := cog.checkClosed(); err != nil {
+		return err
+	}
+
+	_, err := cog.reload(false)
+	return err
+}
+
+// Reload configuration. If reload is triggered by the watcher, external change is checked
+// for a conflict with local changes and configured conflict policy is applied.
+func (cog *C[T]) reload(watched bool) (*Conflict[T], error) {
+	new, present, err := cog.read()
+	if err != nil {
+		return nil, fmt.Errorf("failed at reload config: %v", err)
+	}
+
+	return cog.apply(new, present, watched)
+}
+
+// Apply config document loaded from the source: resolve other sources and apply the change.
+func (cog *C[T]) apply(new T, present fieldSet, watched bool) (*Conflict[T], error) {
+	doc := sourceDoc[T]{new, present}
+
+	if _, err := cog.resolve(&new, present); err != nil {
+		return nil, err
+	}
+
+	placeholder, err := cog.expandPlaceholders(&new, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := normalize(&new, configDir(cog.handler)); err != nil {
+		return nil, err
+	}
+
+	old := cog.config
+	external := new
+	merged := false
+
+	var conflict *Conflict[T]
+	if watched {
+		if reflect.DeepEqual(new, cog.base) {
+			// source has not been changed, e.g. notification was caused by own save
+			return nil, nil
+		}
+
+		if cog.conflicts() {
+			conflict = &Conflict[T]{Base: cog.base, Local: old, External: new}
+
+			switch cog.opts.ConflictPolicy {
+			case LocalWins:
+				return conflict, cog.save()
+			case ReportConflict:
+				return conflict, nil
+			case MergeChanges:
+				new, conflict.Fields = merge(cog.base, old, new)
+				if len(conflict.Fields) == 0 {
+					conflict = nil
+				}
+				merged = true
+			}
+		}
+	}
+
+	hooks := cog.getHooks()
+
+	new, err = hooks.runBeforeUpdate(old, new)
+	if err != nil {
+		return conflict, err
+	}
+
+	// local changes may have been merged
+	placeholder, _ = cog.expandPlaceholders(&new, placeholder)
+
+	if err := normalize(&new, configDir(cog.handler)); err != nil {
+		return conflict, err
+	}
+
+	if reflect.DeepEqual(old, new) {
+		cog.base = external
+		cog.placeholder = placeholder
+		cog.setSource(doc)
+		if merged {
+			// local changes are still not saved
+			return conflict, cog.save()
+		}
+		return conflict, nil
+	}
+
+	if err := cog.validate(new, PhaseUpdate); err != nil {
+		return conflict, err
+	}
+
+	first, ramp, err := cog.planRamp(old, new)
+	if err != nil {
+		return conflict, err
+	}
+
+	if err := cog.notify(first, cog.delivered()); err != nil {
+		return conflict, err
+	}
+	cog.setRamp(ramp)
+
+	cog.lock.Lock()
+	cog.config = new
+	cog.base = external
+	cog.present = present
+	cog.lock.Unlock()
+	cog.placeholder = placeholder
+	cog.setSource(doc)
+
+	cog.trackSecrets(new)
+
+	if merged {
+		if err := cog.save(); err != nil {
+			return conflict, err
+		}
+	} else {
+		cog.updateTimestamp()
+	}
+
+	cog.publish()
+	cog.reportUsage()
+	hooks.runAfterUpdate(old, new)
+
+	return conflict, nil
+}
+
 // Register new callback function. It will be called after config update in non blocking goroutine.
+// Changes are delivered to every callback in order, one at a time, see cog.WithCallbackDelivery.
 // This method returns callback id (int). It can be used to remove callback by calling cog.RemoveCallback(id).
 func (cog *C[T]) AddCallback(f Callback[T]) int {
+	if f == nil {
+		return cog.addCallback(nil, "")
+	}
+
+	return cog.addCallback(func(_ uint64, config T) {
+		f(config)
+	}, funcName(f))
+}
+
+// Register new callback function which receives revision of the change together with the config.
+func (cog *C[T]) AddRevisionCallback(f RevisionCallback[T]) int {
+	if f == nil {
+		return cog.addCallback(nil, "")
+	}
+
+	return cog.addCallback(f, funcName(f))
+}
+
+func (cog *C[T]) addCallback(f RevisionCallback[T], name string) int {
 	cog.lock.Lock()
 	defer cog.lock.Unlock()
 
-	l := len(cog.callbacks) + 1
-	cog.callbacks[l] = f
+	return cog.putCallback(f, name)
+}
+
+// Register callback holding the lock.
+func (cog *C[T]) putCallback(f RevisionCallback[T], name string) int {
+	cog.nextId++
+	cog.callbacks[cog.nextId] = nil
+	if f != nil {
+		cog.callbacks[cog.nextId] = newMailbox(f, name, cog.opts.Delivery, cog.revs.done)
+	}
 
-	return l
+	return cog.nextId
 }
 
 // Remove callback by id.
@@ -110,13 +606,17 @@ func (cog *C[T]) RemoveCallback(id int) error {
 // If at least one subscriber returns an error, update stops and rollback is initiated for all updated subscribers.
 // This method returns subscriber id (int). It can be used to remove subscriber by calling cog.RemoveSubscriber(id).
 func (cog *C[T]) AddSubscriber(f Subscriber[T]) int {
+	return cog.addSubscriber(f, funcName(f))
+}
+
+func (cog *C[T]) addSubscriber(f Subscriber[T], name string) int {
 	cog.lock.Lock()
 	defer cog.lock.Unlock()
 
-	l := len(cog.subscribers) + 1
-	cog.subscribers[l] = f
+	cog.nextId++
+	cog.subscribers[cog.nextId] = subscriber[T]{f: f, name: name}
 
-	return l
+	return cog.nextId
 }
 
 // Remove subscriber by id.
@@ -126,6 +626,7 @@ func (cog *C[T]) RemoveSubscriber(id int) error {
 
 	if _, ok := cog.subscribers[id]; ok {
 		delete(cog.subscribers, id)
+		delete(cog.checks, id)
 		return nil
 	}
 
@@ -148,6 +649,16 @@ func (cog *C[T]) Config() T {
 	return cog.config
 }
 
+// Check if field was explicitly provided by the loaded config document.
+// Field is addressed by path of struct field names, e.g. "Server.Port".
+// Returns false for fields which got their values from defaults or environment variables.
+func (cog *C[T]) IsSet(path string) bool {
+	cog.lock.Lock()
+	defer cog.lock.Unlock()
+
+	return cog.present[path]
+}
+
 func (cog *C[T]) String(masks ...MaskFn[T]) (string, error) {
 	data := cog.Config()
 
@@ -159,62 +670,227 @@ func (cog *C[T]) String(masks ...MaskFn[T]) (string, error) {
 	return string(b), err
 }
 
-func (cog *C[T]) load() {
-	if err := cog.handler.Load(&cog.config); err != nil {
-		cog.config = *new(T)
+// Load config on init. If it can not be loaded, local snapshot is used if it is configured.
+// Otherwise initialization continues with defaults, unless retry policy without fallback is configured.
+// Outcome is recorded to the report.
+func (cog *C[T]) load(report *InitReport) error {
+	started := cog.opts.Clock.Now()
+	defer cog.reportLoad(report, started)
+
+	config, present, err := cog.loadWithRetries()
+	if err == nil {
+		cog.config, cog.present = config, present
+		cog.source = sourceDoc[T]{config, present}
+		cog.writeSnapshot(config, present)
+		report.Loaded = true
+		return nil
 	}
+	report.LoadErr = err
+
+	if errors.Is(err, ErrDecryption) || errors.Is(err, ErrLimitExceeded) {
+		// falling back would overwrite encrypted values or oversized source on save
+		return err
+	}
+	if cog.ChangeContext().Err() != nil {
+		// init has been cancelled
+		return err
+	}
+
+	if cog.opts.Snapshot != "" {
+		if config, present, serr := readSnapshot[T](cog.opts.Snapshot, cog.opts.KeyProvider); serr == nil {
+			cog.config, cog.present = config, present
+			cog.source = sourceDoc[T]{config, present}
+			cog.status.current.FromSnapshot = true
+			report.FromSnapshot = true
+			return nil
+		}
+	}
+
+	if p := cog.opts.InitRetries; p != nil && !p.FallbackToDefaults {
+		return err
+	}
+
+	cog.config, cog.present = *new(T), nil
+	// defaults are saved only if source does not exist yet, otherwise they would overwrite it
+	report.Unavailable = !errors.Is(err, fs.ErrNotExist)
+	return nil
+}
+
+func (cog *C[T]) read() (T, fieldSet, error) {
+	var config T
+	err := cog.loadDoc(&config)
+	cog.recordRaw()
+	if err != nil {
+		return *new(T), nil, err
+	}
+
+	if err := decryptFields(&config, cog.opts.KeyProvider); err != nil {
+		return *new(T), nil, err
+	}
+
+	if err := checkLimits(config, cog.opts.Limits); err != nil {
+		return *new(T), nil, err
+	}
+
+	present, unknown := loadKeys[T](cog.loadDoc)
+
+	cog.lock.Lock()
+	cog.unknownKeys = unknown
+	cog.lock.Unlock()
+
+	return config, present, nil
 }
 
 func (cog *C[T]) save() error {
+	if cog.opts.ReadOnly {
+		// changes are kept only in memory, base is not changed as source has not been written
+		cog.updateTimestamp()
+		return nil
+	}
+
+	if !cog.IsLeader() {
+		return ErrNotLeader
+	}
+
+	hooks := cog.getHooks()
+	if err := hooks.runBeforeSave(cog.config); err != nil {
+		return err
+	}
+
 	cog.updateTimestamp()
 
-	if err := cog.handler.Save(cog.config); err != nil {
+	doc := cog.restorePlaceholders(stripDerived(cog.config), cog.placeholder)
+
+	stored, err := encryptFields(doc, cog.opts.KeyProvider)
+	if err != nil {
 		return err
 	}
+
+	if err := cog.saveDoc(stored); err != nil {
+		return err
+	}
+	cog.source = sourceDoc[T]{doc, allFields[T]()}
+
+	cog.base = cog.config
+	cog.recordChecksum()
+	cog.writeSnapshot(doc, nil)
+
+	if cog.opts.RoundTripCheck {
+		cog.roundTrip = cog.checkRoundTrip(doc)
+	}
 	return nil
 }
 
-func (cog *C[T]) notify(config T) error {
-	updated := []Subscriber[T]{}
+func (cog *C[T]) authorize(actor string, old T, new T) error {
+	if cog.opts.Authorizer == nil {
+		return nil
+	}
+
+	d := diff(old, new)
+	if len(d) == 0 {
+		return nil
+	}
 
-	for _, f := range cog.subscribers {
-		if f == nil {
-			continue
+	if err := cog.opts.Authorizer(actor, d); err != nil {
+		return fmt.Errorf("update is not authorized: %w", err)
+	}
+
+	return nil
+}
+
+// Notify subscribers registered at the moment and callbacks registered once subscribers have accepted the change,
+// instance is not locked while they are called.
+// If subscriber rejects the config, subscribers which have accepted it are rolled back to prev,
+// the config they have been delivered before.
+func (cog *C[T]) notify(config T, prev T) error {
+	cog.lock.Lock()
+	subscribers := sortedSubscribers(cog.subscribers)
+	cog.notified = prev
+	cog.lock.Unlock()
+
+	report := UpdateReport{Started: cog.opts.Clock.Now(), Subscribers: []SubscriberTiming{}, Meta: cog.ChangeMeta()}
+	updated := []Subscriber[T]{}
+	// changes are serialized, so revision is known before subscribers accept it
+	next := cog.Revision() + 1
+
+	ctx := cog.ChangeContext()
+
+	for _, s := range subscribers {
+		name := s.name
+		started := cog.opts.Clock.Now()
+
+		err := ctx.Err()
+		if err != nil {
+			cog.rollback(updated, prev)
+			report.Duration = cog.opts.Clock.Now().Sub(report.Started)
+			report.Err = fmt.Errorf("update has been cancelled before subscriber %s: %w", name, err)
+			cog.recordReport(report)
+			return report.Err
 		}
-		if err := f(config); err != nil {
-			cog.rollback(updated)
-			return fmt.Errorf("subscriber returned an error on update: %v", err)
+
+		observe("subscriber", name, next, func() {
+			err = s.f(config)
+		})
+
+		report.Subscribers = append(report.Subscribers, SubscriberTiming{
+			Id:       s.id,
+			Name:     name,
+			Duration: cog.opts.Clock.Now().Sub(started),
+			Err:      err,
+		})
+
+		if err != nil {
+			cog.rollback(updated, prev)
+			report.Duration = cog.opts.Clock.Now().Sub(report.Started)
+			report.Err = fmt.Errorf("subscriber returned an error on update: %v", err)
+			cog.recordReport(report)
+			return report.Err
 		}
-		updated = append(updated, f)
+		updated = append(updated, s.f)
 	}
 
-	for _, f := range cog.callbacks {
-		if f == nil {
-			continue
+	// callbacks registered while subscribers have been called get the change as well
+	cog.lock.Lock()
+	callbacks := make([]*mailbox[T], 0, len(cog.callbacks))
+	for _, m := range cog.callbacks {
+		if m != nil {
+			callbacks = append(callbacks, m)
 		}
-		go f(config)
+	}
+	cog.posted = &config
+	cog.lock.Unlock()
+
+	rev := cog.revs.next(len(callbacks))
+	report.Revision = rev
+	report.Duration = cog.opts.Clock.Now().Sub(report.Started)
+	cog.recordReport(report)
+
+	for _, m := range callbacks {
+		m.post(delivery[T]{revision: rev, config: config})
 	}
 
 	return nil
 }
 
-func (cog *C[T]) rollback(subscribers []Subscriber[T]) {
+func (cog *C[T]) rollback(subscribers []Subscriber[T], prev T) {
+	// rollback is not cancelled with the change
+	cog.setChangeContext(nil)
+
 	for _, f := range subscribers {
-		f(cog.config)
+		f(prev)
 	}
 }
 
-func (cog *C[T]) defaults() {
-	SetDefaults(&cog.config)
+// Stop background goroutines of the instance.
+func (cog *C[T]) stop() {
+	cog.stopOnce.Do(func() {
+		close(cog.done)
+	})
 }
 
 func (cog *C[T]) updateTimestamp() {
-	cog.timestamp = strconv.FormatInt(time.Now().Unix(), 10)
-}
+	cog.lock.Lock()
+	defer cog.lock.Unlock()
 
-func validate[T any](data T) error {
-	if err := validator.New().Struct(data); err != nil {
-		return fmt.Errorf("failed at validate config: %v", err)
-	}
-	return nil
+	cog.timestamp = strconv.FormatInt(cog.opts.Clock.Now().Unix(), 10)
 }
@@ -1,15 +1,36 @@
 package cog
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"text/template"
 	"time"
 
 	fh "github.com/leonidasdeim/cog/filehandler"
+	"github.com/leonidasdeim/cog/handlerapi/mocks"
+	"github.com/leonidasdeim/cog/metadata"
+	nh "github.com/leonidasdeim/cog/natshandler"
+	sh "github.com/leonidasdeim/cog/scripthandler"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
@@ -41,6 +62,7 @@ type testCase struct {
 	TestString               string
 	TestStringWithoutVersion string
 	TestStringWithDefaults   string
+	TestStringExplicitZero   string
 }
 
 type testSuite struct {
@@ -54,18 +76,21 @@ var testCases = []testCase{
 		"{\"name\":\"config_test\",\"version\":123}",
 		"{\"name\":\"config_test\"}",
 		"{\"version\":123}",
+		"{\"name\":\"\",\"version\":123,\"isprefork\":false}",
 	},
 	{
 		fh.YAML,
 		"name: config_test\nversion: 123\n",
 		"name: config_test\n",
 		"version: 123\n",
+		"name: \"\"\nversion: 123\nisprefork: false\n",
 	},
 	{
 		fh.TOML,
 		"name = \"config_test\"\nversion = 123\n",
 		"name = \"config_test\"\n",
 		"version = 123\n",
+		"name = \"\"\nversion = 123\nIsPrefork = false\n",
 	},
 }
 
@@ -237,268 +262,4202 @@ func (s *testSuite) TestDynamicTypeIsResolved() {
 	assert.FileExistsf(s.T(), fmt.Sprintf(activeConfig, string(s.testCase.Type)), "expected active config file not exists")
 }
 
-func (s *testSuite) TestSubscribersAreRegistered() {
-	subs := [3]Subscriber[testConfig]{
-		func(tc testConfig) error {
-			return nil
-		},
-		func(tc testConfig) error {
-			return nil
-		},
-		func(tc testConfig) error {
-			return nil
-		},
+func (s *testSuite) TestDynamicTypeAmbiguity() {
+	other := fh.JSON
+	if s.testCase.Type == fh.JSON {
+		other = fh.TOML
 	}
+	require.NoError(s.T(), os.WriteFile(fmt.Sprintf(defaultConfig, string(s.testCase.Type)), []byte(s.testCase.TestString), permissions))
+	require.NoError(s.T(), os.WriteFile(fmt.Sprintf(defaultConfig, string(other)), []byte{}, permissions))
 
-	c, err := setup(s.T(), fmt.Sprintf(defaultConfig, string(s.testCase.Type)), "", s.testCase.Type, s.testCase.TestString)
+	_, err := fh.New(fh.WithName(appName))
+	assert.ErrorIs(s.T(), err, fh.ErrAmbiguousType)
+	assert.ErrorContains(s.T(), err, fmt.Sprintf(defaultConfig, string(s.testCase.Type)))
+	assert.ErrorContains(s.T(), err, fmt.Sprintf(defaultConfig, string(other)))
+
+	h, err := fh.New(fh.WithName(appName), fh.WithTypePrecedence(s.testCase.Type, other))
 	require.NoErrorf(s.T(), err, testSetupErrorMsg)
 
-	for _, cb := range subs {
-		c.AddSubscriber(cb)
-	}
+	c, err := Init[testConfig](h)
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	assert.Equalf(s.T(), testData, c.Config(), expectedResultErrorMsg)
+	assert.FileExistsf(s.T(), fmt.Sprintf(activeConfig, string(s.testCase.Type)), "expected active config file not exists")
+}
 
-	assert.Equalf(s.T(), len(subs), len(c.subscribers), "expected number of subscribers")
+func (s *testSuite) TestInitReport() {
+	os.Setenv("TEST_ENV_NAME", "env_name")
+
+	doc := map[fh.FileType]string{
+		fh.JSON: "{\"version\":123,\"verison\":1}",
+		fh.YAML: "version: 123\nverison: 1\n",
+		fh.TOML: "version = 123\nverison = 1\n",
+	}[s.testCase.Type]
+
+	c, err := setup(s.T(), fmt.Sprintf(defaultConfig, string(s.testCase.Type)), "", s.testCase.Type, doc)
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	report := c.InitReport()
+	assert.True(s.T(), report.Loaded)
+	assert.True(s.T(), report.Created)
+	assert.True(s.T(), report.Saved)
+	assert.NoError(s.T(), report.Err)
+	assert.True(s.T(), filepath.IsAbs(report.Location))
+	assert.Equal(s.T(), fmt.Sprintf(activeConfig, string(s.testCase.Type)), filepath.Base(report.Location))
+	assert.Equal(s.T(), []string{"Name"}, report.FieldsFrom(SourceEnv))
+	assert.Equal(s.T(), []string{"Version"}, report.FieldsFrom(SourceFile))
+	assert.Equal(s.T(), []string{"IsPrefork"}, report.FieldsFrom(SourceDefault))
+	assert.Equal(s.T(), []string{`unknown key "verison"`}, report.Warnings)
+	assert.False(s.T(), report.Started.IsZero())
+
+	h, err := fh.New(fh.WithName(appName), fh.WithType(s.testCase.Type))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	_, err = New[testConfig](WithHandler(h), WithInitReport(&report))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	assert.False(s.T(), report.Created)
+
+	os.Setenv("TEST_ENV_NAME", "")
+	require.NoError(s.T(), os.Remove(fmt.Sprintf(activeConfig, string(s.testCase.Type))))
+	require.NoError(s.T(), os.Remove(fmt.Sprintf(defaultConfig, string(s.testCase.Type))))
+
+	h, err = fh.New(fh.WithName(appName), fh.WithType(s.testCase.Type))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	_, err = New[testConfig](WithHandler(h), WithInitReport(&report))
+	assert.Error(s.T(), err)
+	assert.Equal(s.T(), err, report.Err)
+	assert.False(s.T(), report.Loaded)
+	assert.Error(s.T(), report.LoadErr)
+	assert.Len(s.T(), report.Warnings, 1)
 }
 
-func (s *testSuite) TestCallbacksAreRegistered() {
-	cbs := [3]Callback[testConfig]{
-		func(tc testConfig) {},
-		func(tc testConfig) {},
-		func(tc testConfig) {},
-	}
-	c, err := setup(s.T(), fmt.Sprintf(defaultConfig, string(s.testCase.Type)), "", s.testCase.Type, s.testCase.TestString)
+func (s *testSuite) TestRaw() {
+	active := fmt.Sprintf(activeConfig, string(s.testCase.Type))
+	c, err := setup(s.T(), active, "", s.testCase.Type, s.testCase.TestString)
 	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	assert.Equal(s.T(), []byte(s.testCase.TestString), c.InitReport().Raw)
 
-	for _, f := range cbs {
-		c.AddCallback(f)
-	}
+	require.NoError(s.T(), os.WriteFile(active, []byte(s.testCase.TestStringWithDefaults), permissions))
+	require.NoError(s.T(), c.Reload())
+	assert.Equal(s.T(), []byte(s.testCase.TestStringWithDefaults), c.Raw())
 
-	assert.Equalf(s.T(), len(cbs), len(c.callbacks), "expected number of callbacks")
+	broken := []byte("{{ broken")
+	require.NoError(s.T(), os.WriteFile(active, broken, permissions))
+	assert.Error(s.T(), c.Reload())
+	assert.Equal(s.T(), broken, c.Raw(), "bytes which can not be decoded should be kept")
+	assert.Equal(s.T(), testDataDefaultName, c.Config())
 }
 
-var (
-	newData                = testConfig{Name: "new_data", Version: 456}
-	newDataWithoutRequired = testConfig{Name: "new_data"}
-)
+func (s *testSuite) TestRoundTripCheck() {
+	type roundTripConfig struct {
+		Version int
+		At      time.Time
+	}
 
-func (s *testSuite) TestConfigUpdated() {
-	c, err := setup(s.T(), fmt.Sprintf(defaultConfig, string(s.testCase.Type)), "", s.testCase.Type, s.testCase.TestString)
+	doc := map[fh.FileType]string{
+		fh.JSON: "{\"version\":123,\"extra\":1}",
+		fh.YAML: "version: 123\nextra: 1\n",
+		fh.TOML: "version = 123\nextra = 1\n",
+	}[s.testCase.Type]
+	require.NoError(s.T(), os.WriteFile(fmt.Sprintf(activeConfig, string(s.testCase.Type)), []byte(doc), permissions))
+
+	h, err := fh.New(fh.WithName(appName), fh.WithType(s.testCase.Type))
 	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	c, err := New[roundTripConfig](WithHandler(h), WithRoundTripCheck())
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	assert.Contains(s.T(), c.InitReport().Warnings, `unknown key "extra" has been dropped on save`)
 
-	err = c.Update(newData)
-	require.NoErrorf(s.T(), err, "error while updating config: %v", err)
+	events := make(chan Event, 1)
+	c.OnEvent(func(e Event) {
+		if e.Type == EventRoundTripLoss {
+			events <- e
+		}
+	})
 
-	got := c.Config()
-	assert.Equalf(s.T(), newData, got, expectedResultErrorMsg)
+	require.NoError(s.T(), c.Update(roundTripConfig{Version: 124}))
+	assert.Empty(s.T(), events, "lossless save should not be reported")
+
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.FixedZone("CET", 3600))
+	require.NoError(s.T(), c.Update(roundTripConfig{Version: 124, At: at}))
+
+	e := <-events
+	assert.Equal(s.T(), []string{"At"}, e.Fields)
+	assert.ErrorContains(s.T(), e.Err, "lossy round trip of At")
+	assert.Equal(s.T(), at, c.Config().At, "config should not be changed")
+	assert.Equal(s.T(), int64(2), c.Status().RoundTripLosses)
 }
 
-func (s *testSuite) TestCallbacksAreNotifiedAndRemoved() {
-	var calls1, calls2 int
-	cbs := [3]Callback[testConfig]{
-		func(tc testConfig) { calls1++ },
-		func(tc testConfig) { calls2++ },
-		nil,
+func (s *testSuite) TestOverrides() {
+	type overrideConfig struct {
+		Timeout  time.Duration
+		Database struct {
+			Password string
+		}
 	}
 
-	c, err := setup(s.T(), fmt.Sprintf(defaultConfig, string(s.testCase.Type)), "", s.testCase.Type, s.testCase.TestString)
-	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	doc := map[fh.FileType]string{
+		fh.JSON: "{\"timeout\":\"5m\",\"database\":{\"password\":\"ref:db\"}}",
+		fh.YAML: "timeout: 5m\ndatabase:\n  password: ref:db\n",
+		fh.TOML: "timeout = \"5m\"\n[database]\npassword = \"ref:db\"\n",
+	}[s.testCase.Type]
+	active := fmt.Sprintf(activeConfig, string(s.testCase.Type))
+	require.NoError(s.T(), os.WriteFile(active, []byte(doc), permissions))
 
-	c.AddCallback(cbs[0])
-	callbackId := c.AddCallback(cbs[1])
-	c.AddCallback(cbs[2])
+	duration := fh.TypeOverride(
+		func(d time.Duration) (any, error) { return d.String(), nil },
+		func(v any) (time.Duration, error) { return time.ParseDuration(fmt.Sprint(v)) },
+	)
+	secrets := map[string]string{"db": "pa55"}
+	password := fh.FieldOverride("Database.Password",
+		func(p string) (any, error) {
+			for ref, v := range secrets {
+				if v == p {
+					return "ref:" + ref, nil
+				}
+			}
+			return nil, fmt.Errorf("unknown secret")
+		},
+		func(v any) (string, error) { return secrets[strings.TrimPrefix(fmt.Sprint(v), "ref:")], nil },
+	)
 
-	c.Update(newData)
-	c.Update(newData)
-	time.Sleep(100 * time.Millisecond)
+	h, err := fh.New(fh.WithName(appName), fh.WithType(s.testCase.Type), fh.WithOverrides(duration, password))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	c, err := New[overrideConfig](WithHandler(h))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	assert.Equal(s.T(), 5*time.Minute, c.Config().Timeout)
+	assert.Equal(s.T(), "pa55", c.Config().Database.Password)
 
-	c.RemoveCallback(callbackId)
+	cfg := c.Config()
+	cfg.Timeout = 90 * time.Second
+	require.NoError(s.T(), c.Update(cfg))
 
-	c.Update(newData)
-	c.Update(newData)
-	time.Sleep(100 * time.Millisecond)
+	b, err := os.ReadFile(active)
+	require.NoError(s.T(), err)
+	assert.Contains(s.T(), string(b), "1m30s")
+	assert.Contains(s.T(), string(b), "ref:db")
+	assert.NotContains(s.T(), string(b), "pa55")
 
-	assert.Equal(s.T(), 4, calls1)
-	assert.Equal(s.T(), 2, calls2)
-}
+	cfg.Database.Password = "leaked"
+	assert.ErrorContains(s.T(), c.Update(cfg), "failed at marshal Database.Password: unknown secret")
 
-func (s *testSuite) TestRemoveCallbackWrongId() {
-	c, err := setup(s.T(), fmt.Sprintf(defaultConfig, string(s.testCase.Type)), "", s.testCase.Type, s.testCase.TestString)
+	mismatch := fh.FieldOverride("Timeout",
+		func(p string) (any, error) { return p, nil },
+		func(v any) (string, error) { return fmt.Sprint(v), nil },
+	)
+	h, err = fh.New(fh.WithName(appName), fh.WithType(s.testCase.Type), fh.WithOverrides(mismatch))
 	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	_, err = New[overrideConfig](WithHandler(h), WithInitRetries(RetryPolicy{Attempts: 1}))
+	assert.ErrorContains(s.T(), err, "override of Timeout expects string, field is time.Duration")
+}
 
-	id := c.AddCallback(func(tc testConfig) {})
+func (s *testSuite) TestFormat() {
+	type formatConfig struct {
+		Name   string
+		Server struct {
+			Port int
+			Host string
+		}
+	}
 
-	err = c.RemoveCallback(id + 1)
-	require.Errorf(s.T(), err, "RemoveCallback should return error")
+	cfg := formatConfig{Name: "app"}
+	cfg.Server.Port = 80
+	cfg.Server.Host = "localhost"
+
+	formats := []struct {
+		format   fh.Format
+		expected map[fh.FileType]string
+	}{
+		{
+			fh.Format{Indent: "  ", SortKeys: true, TrailingNewline: true},
+			map[fh.FileType]string{
+				fh.JSON: "{\n  \"Name\": \"app\",\n  \"Server\": {\n    \"Host\": \"localhost\",\n    \"Port\": 80\n  }\n}\n",
+				fh.YAML: "name: app\nserver:\n  host: localhost\n  port: 80\n",
+				fh.TOML: "Name = 'app'\n\n[Server]\n  Host = 'localhost'\n  Port = 80\n",
+			},
+		},
+		{
+			fh.Format{FlowStyle: true},
+			map[fh.FileType]string{
+				fh.JSON: "{\n\t\"Name\": \"app\",\n\t\"Server\": {\n\t\t\"Port\": 80,\n\t\t\"Host\": \"localhost\"\n\t}\n}",
+				fh.YAML: "{name: app, server: {port: 80, host: localhost}}\n",
+				fh.TOML: "Name = 'app'\nServer = {Port = 80, Host = 'localhost'}\n",
+			},
+		},
+	}
+
+	for _, f := range formats {
+		h, err := fh.New(fh.WithName(appName), fh.WithType(s.testCase.Type), fh.WithFormat(f.format))
+		require.NoErrorf(s.T(), err, testSetupErrorMsg)
+		c, err := New[formatConfig](WithHandler(h))
+		require.NoErrorf(s.T(), err, testSetupErrorMsg)
+		require.NoError(s.T(), c.Update(cfg))
+
+		b, err := os.ReadFile(fmt.Sprintf(activeConfig, string(s.testCase.Type)))
+		require.NoError(s.T(), err)
+		assert.Equal(s.T(), f.expected[s.testCase.Type], string(b))
+
+		require.NoError(s.T(), c.Reload())
+		assert.Equal(s.T(), cfg, c.Config())
+	}
+
+	if s.testCase.Type == fh.YAML {
+		h, err := fh.New(fh.WithName(appName), fh.WithType(fh.YAML), fh.WithFormat(fh.Format{Indent: "\t"}))
+		require.NoErrorf(s.T(), err, testSetupErrorMsg)
+		assert.ErrorContains(s.T(), h.Save(cfg), "yaml indent must consist of spaces")
+	}
 }
 
-func (s *testSuite) TestSubscribersAreNotifiedAndRemoved() {
-	var calls1, calls2 int
-	subs := [3]Subscriber[testConfig]{
-		func(tc testConfig) error {
-			calls1++
-			return nil
+func (s *testSuite) TestMinimalDiff() {
+	type diffConfig struct {
+		Name   string   `json:"name" yaml:"name" toml:"name"`
+		Tags   []string `json:"tags" yaml:"tags" toml:"tags"`
+		Server struct {
+			Host string `json:"host" yaml:"host" toml:"host"`
+			Port int    `json:"port" yaml:"port" toml:"port"`
+		} `json:"server" yaml:"server" toml:"server"`
+	}
+
+	docs := map[fh.FileType][2]string{
+		fh.JSON: {
+			"{\n  \"name\": \"app\",\n  \"tags\": [\"a\", \"b\"],\n  \"server\": {\"host\": \"localhost\", \"port\": 80}\n}\n",
+			"{\n  \"name\": \"app\",\n  \"tags\": [\"a\", \"c\"],\n  \"server\": {\"host\": \"localhost\", \"port\": 8080}\n}\n",
 		},
-		func(tc testConfig) error {
-			calls2++
-			return nil
+		fh.YAML: {
+			"# service config\nname: app # name\ntags: [a, b]\nserver:\n  host: localhost\n  port: 80\n",
+			"# service config\nname: app # name\ntags: [a, c]\nserver:\n  host: localhost\n  port: 8080\n",
+		},
+		fh.TOML: {
+			"# service config\nname = \"app\" # name\ntags = [\"a\", \"b\"]\n\n[server]\nhost = \"localhost\"\nport = 80\n",
+			"# service config\nname = \"app\" # name\ntags = [\"a\", 'c']\n\n[server]\nhost = \"localhost\"\nport = 8080\n",
 		},
-		nil,
 	}
+	doc := docs[s.testCase.Type]
 
-	c, err := setup(s.T(), fmt.Sprintf(defaultConfig, string(s.testCase.Type)), "", s.testCase.Type, s.testCase.TestString)
+	active := fmt.Sprintf(activeConfig, string(s.testCase.Type))
+	require.NoError(s.T(), os.WriteFile(active, []byte(doc[0]), permissions))
+
+	h, err := fh.New(fh.WithName(appName), fh.WithType(s.testCase.Type), fh.WithMinimalDiff())
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	c, err := New[diffConfig](WithHandler(h))
 	require.NoErrorf(s.T(), err, testSetupErrorMsg)
 
-	c.AddSubscriber(subs[0])
-	subscriberId := c.AddSubscriber(subs[1])
-	c.AddSubscriber(subs[2])
+	b, err := os.ReadFile(active)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), doc[0], string(b), "unchanged config should not be rewritten")
 
-	c.Update(newData)
-	c.Update(newData)
-	time.Sleep(100 * time.Millisecond)
+	cfg := c.Config()
+	cfg.Tags = []string{"a", "c"}
+	cfg.Server.Port = 8080
+	require.NoError(s.T(), c.Update(cfg))
 
-	c.RemoveSubscriber(subscriberId)
+	b, err = os.ReadFile(active)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), doc[1], string(b))
 
-	c.Update(newData)
-	c.Update(newData)
-	time.Sleep(100 * time.Millisecond)
+	cfg.Tags = append(cfg.Tags, "d")
+	require.NoError(s.T(), c.Update(cfg))
+	require.NoError(s.T(), c.Reload())
+	assert.Equal(s.T(), cfg, c.Config(), "structural change should rewrite the file")
+}
 
-	assert.Equal(s.T(), 4, calls1)
-	assert.Equal(s.T(), 2, calls2)
+func (s *testSuite) TestOverridesFile() {
+	overrides := fmt.Sprintf("%s.overrides.%s", appName, string(s.testCase.Type))
+	defer os.Remove(overrides)
+
+	newHandler := func() *fh.FileHandler {
+		h, err := fh.New(fh.WithName(appName), fh.WithType(s.testCase.Type), fh.WithOverridesFile())
+		require.NoErrorf(s.T(), err, testSetupErrorMsg)
+		return h
+	}
+
+	require.NoError(s.T(), os.WriteFile(fmt.Sprintf(defaultConfig, string(s.testCase.Type)), []byte(s.testCase.TestString), permissions))
+	c, err := New[testConfig](WithHandler(newHandler()))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	active := fmt.Sprintf(activeConfig, string(s.testCase.Type))
+	base, err := os.ReadFile(active)
+	require.NoError(s.T(), err)
+
+	cfg := c.Config()
+	cfg.Version = 124
+	require.NoError(s.T(), c.Update(cfg))
+
+	b, err := os.ReadFile(active)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), string(base), string(b), "active config file should not be changed")
+
+	doc := map[string]any{}
+	require.NoError(s.T(), fh.NewCodec(s.testCase.Type).Unmarshal(mustRead(s.T(), overrides), &doc))
+	assert.NotContains(s.T(), doc, "name", "values equal to the active config file should not be overridden")
+	assert.Len(s.T(), doc, 2, "version and default value of isprefork should be overridden")
+
+	c, err = New[testConfig](WithHandler(newHandler()))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	assert.Equal(s.T(), cfg, c.Config())
+	assert.True(s.T(), c.IsSet("Version"))
 }
 
-func (s *testSuite) TestRemoveSubscriberWrongId() {
-	c, err := setup(s.T(), fmt.Sprintf(defaultConfig, string(s.testCase.Type)), "", s.testCase.Type, s.testCase.TestString)
+func mustRead(t *testing.T, file string) []byte {
+	b, err := os.ReadFile(file)
+	require.NoError(t, err)
+	return b
+}
+
+type bundleTestConfig struct {
+	Name  string `default:"app"`
+	Token string `secret:"true" env:"TEST_BUNDLE_TOKEN"`
+}
+
+func (s *testSuite) TestBundle() {
+	c, err := New[bundleTestConfig](WithHandler(&stubFileHandler{}))
 	require.NoErrorf(s.T(), err, testSetupErrorMsg)
 
-	id := c.AddSubscriber(func(tc testConfig) error { return nil })
+	require.NoError(s.T(), c.Update(bundleTestConfig{Name: "app", Token: "secret"}))
+	require.NoError(s.T(), c.UpdateWithMeta(bundleTestConfig{Name: "app2", Token: "secret"}, Meta{"reason": "test"}))
 
-	err = c.RemoveSubscriber(id + 1)
-	require.Errorf(s.T(), err, "RemoveCallback should return error")
+	var buf bytes.Buffer
+	require.NoError(s.T(), c.ExportBundle(&buf))
+
+	b, err := ReadBundle[bundleTestConfig](bytes.NewReader(buf.Bytes()))
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), SchemaVersion[bundleTestConfig](), b.Schema)
+	assert.Equal(s.T(), bundleTestConfig{Name: "app2"}, b.Config, "secrets should not be exported without key provider")
+	assert.Equal(s.T(), uint64(3), b.Revision)
+	require.Len(s.T(), b.History, 2)
+	assert.Equal(s.T(), Meta{"reason": "test"}, b.History[1].Meta)
+	assert.Equal(s.T(), SourceDefault, b.Sources["Name"])
+
+	os.Setenv("TEST_BUNDLE_TOKEN", "host-secret")
+	defer os.Setenv("TEST_BUNDLE_TOKEN", "")
+
+	h, err := fh.New(fh.WithName(appName), fh.WithType(s.testCase.Type))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	imported, err := ImportBundle[bundleTestConfig](bytes.NewReader(buf.Bytes()), WithHandler(h))
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), bundleTestConfig{Name: "app2", Token: "host-secret"}, imported.Config())
+	assert.Equal(s.T(), uint64(3), imported.Revision())
+	assert.Len(s.T(), imported.UpdateReports(), 3)
+
+	_, err = ImportBundle[testConfig](bytes.NewReader(buf.Bytes()), WithHandler(&stubFileHandler{}))
+	assert.ErrorIs(s.T(), err, ErrSchemaMismatch)
 }
 
-func (s *testSuite) TestSubscriberReturnsError() {
-	var subCalls uint64
-	subs := [2]Subscriber[testConfig]{
-		func(tc testConfig) error {
-			subCalls++
-			return nil
-		},
-		func(tc testConfig) error {
-			return errors.New("test error")
-		},
-	}
+func (s *testSuite) TestBundleLimits() {
+	c, err := New[bundleTestConfig](WithHandler(&stubFileHandler{}))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
 
-	var cbCalls int
-	cbs := [2]Callback[testConfig]{
-		func(tc testConfig) { cbCalls++ },
-		func(tc testConfig) { cbCalls++ },
+	var buf bytes.Buffer
+	require.NoError(s.T(), c.ExportBundle(&buf))
+
+	_, err = ReadBundle[bundleTestConfig](bytes.NewReader(buf.Bytes()), WithLimits(Limits{MaxSize: 5}))
+	assert.ErrorIs(s.T(), err, ErrLimitExceeded)
+	_, err = ImportBundle[bundleTestConfig](bytes.NewReader(buf.Bytes()), WithHandler(&stubFileHandler{}), WithLimits(Limits{MaxSize: 5}))
+	assert.ErrorIs(s.T(), err, ErrLimitExceeded)
+
+	// small archive unpacking to more than the max bundle size
+	buf.Reset()
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	require.NoError(s.T(), tw.WriteHeader(&tar.Header{Name: bundleHistory, Mode: 0600, Size: maxBundleSize + 1}))
+	_, err = io.Copy(tw, io.LimitReader(zeroReader{}, maxBundleSize+1))
+	require.NoError(s.T(), err)
+	require.NoError(s.T(), tw.Close())
+	require.NoError(s.T(), gz.Close())
+
+	_, err = ReadBundle[bundleTestConfig](bytes.NewReader(buf.Bytes()))
+	assert.ErrorIs(s.T(), err, ErrLimitExceeded)
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
 	}
+	return len(p), nil
+}
 
-	c, err := setup(s.T(), fmt.Sprintf(defaultConfig, string(s.testCase.Type)), "", s.testCase.Type, s.testCase.TestString)
+func (s *testSuite) TestWatcher() {
+	doc := map[fh.FileType]string{
+		fh.JSON: "{\"name\":\"edited\",\"version\":124}",
+		fh.YAML: "name: edited\nversion: 124\n",
+		fh.TOML: "name = \"edited\"\nversion = 124\n",
+	}[s.testCase.Type]
+
+	require.NoError(s.T(), os.WriteFile(fmt.Sprintf(defaultConfig, string(s.testCase.Type)), []byte(s.testCase.TestString), permissions))
+	h, err := fh.New(fh.WithName(appName), fh.WithType(s.testCase.Type))
 	require.NoErrorf(s.T(), err, testSetupErrorMsg)
 
-	for _, f := range subs {
-		c.AddSubscriber(f)
-	}
+	c, err := New[testConfig](WithHandler(h), WithWatcher())
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	defer c.stop()
 
-	for _, f := range cbs {
-		c.AddCallback(f)
+	events := make(chan Event, 10)
+	c.OnEvent(func(e Event) {
+		if e.Type == EventReloaded || e.Type == EventReloadFailed {
+			events <- e
+		}
+	})
+	updated := make(chan testConfig, 10)
+	c.AddCallback(func(cfg testConfig) { updated <- cfg })
+
+	// own save is not reloaded
+	cfg := c.Config()
+	cfg.Version = 2
+	require.NoError(s.T(), c.Update(cfg))
+	<-updated
+	select {
+	case e := <-events:
+		s.T().Fatalf("own save should not be reloaded, got %s", e.Type)
+	case <-time.After(100 * time.Millisecond):
 	}
 
-	err = c.Update(newData)
-	require.Errorf(s.T(), err, "update config did not failed")
+	require.NoError(s.T(), os.WriteFile(fmt.Sprintf(activeConfig, string(s.testCase.Type)), []byte(doc), permissions))
 
-	want := testData
-	got := c.Config()
+	// file can be reloaded while it is being written, final state is reloaded eventually
+	timeout := time.After(5 * time.Second)
+	for cfg.Version != 124 {
+		select {
+		case cfg = <-updated:
+		case <-timeout:
+			s.T().Fatal("external change has not been reloaded")
+		}
+	}
+	assert.Equal(s.T(), "edited", cfg.Name)
+	assert.Equal(s.T(), cfg, c.Config())
 
-	assert.Equalf(s.T(), want, got, "config is not equal to old data")
-	assert.NotEqualf(s.T(), newData, got, "config was updated to new data")
-	assert.NotEqualf(s.T(), 1, (subCalls % 2), "updated subscriber is not rolled back: %d", subCalls)
-	assert.Zero(s.T(), cbCalls, "callbacks are called in case of subscriber error: %d", cbCalls)
+	_, err = New[fileHandlerTestConfig](WithHandler(&stubFileHandler{}), WithWatcher())
+	assert.ErrorContains(s.T(), err, "can not be watched")
 }
 
-func (s *testSuite) TestUpdateConfigIsValidated() {
+func (s *testSuite) TestCompare() {
+	docs := map[fh.FileType][2]string{
+		fh.JSON: {"{\"name\":\"a\",\"version\":1}", "{\"name\":\"a\",\"version\":2,\"extra\":true}"},
+		fh.YAML: {"name: a\nversion: 1\n", "name: a\nversion: 2\nextra: true\n"},
+		fh.TOML: {"name = \"a\"\nversion = 1\n", "name = \"a\"\nversion = 2\nextra = true\n"},
+	}[s.testCase.Type]
+
+	require.NoError(s.T(), os.MkdirAll(testDir, os.ModePerm))
+	a := filepath.Join(testDir, "a."+string(s.testCase.Type))
+	b := filepath.Join(testDir, "b."+string(s.testCase.Type))
+	require.NoError(s.T(), os.WriteFile(a, []byte(docs[0]), permissions))
+	require.NoError(s.T(), os.WriteFile(b, []byte(docs[1]), permissions))
+
+	d, err := Compare(CompareFile[testConfig](a), CompareFile[testConfig](b))
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), Diff{{Path: "Version", Old: 1, New: 2}}, d)
+
+	raw, err := Compare(CompareFile[map[string]any](a), CompareFile[map[string]any](b))
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), []string{"extra", "version"}, raw.Paths())
+
 	c, err := setup(s.T(), fmt.Sprintf(defaultConfig, string(s.testCase.Type)), "", s.testCase.Type, s.testCase.TestString)
 	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	d, err = Compare(CompareFile[testConfig](b), CompareInstance(c))
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), []string{"Name", "Version", "IsPrefork"}, d.Paths())
 
-	err = c.Update(newDataWithoutRequired)
-	require.Errorf(s.T(), err, "expected error not thrown")
+	_, err = Compare(CompareFile[testConfig](a), CompareFile[testConfig](filepath.Join(testDir, "missing.json")))
+	assert.ErrorContains(s.T(), err, "failed at load second config")
+}
 
-	// config should not be updated
-	got := c.Config()
-	assert.Equalf(s.T(), testData, got, expectedResultErrorMsg)
+type telemetryTestConfig struct {
+	Name     string `default:"app"`
+	Port     int
+	Token    string `secret:"true"`
+	Internal string `telemetry:"-"`
 }
 
-type stubFileHandler struct {
-	returnValue error
+func (s *testSuite) TestTelemetry() {
+	reports := []Usage{}
+	c, err := New[telemetryTestConfig](WithHandler(&stubFileHandler{}), WithTelemetry(func(u Usage) { reports = append(reports, u) }))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	require.Len(s.T(), reports, 1)
+	assert.Equal(s.T(), Usage{
+		Schema:   SchemaVersion[telemetryTestConfig](),
+		Revision: 1,
+		Fields:   []FieldUsage{{Path: "Name"}, {Path: "Port"}, {Path: "Token", Secret: true}},
+	}, reports[0])
+
+	require.NoError(s.T(), c.Update(telemetryTestConfig{Name: "app", Port: 8080, Token: "s3cr3t", Internal: "x"}))
+	require.Len(s.T(), reports, 2)
+	assert.Equal(s.T(), uint64(2), reports[1].Revision)
+	assert.Equal(s.T(), []string{"Port", "Token"}, reports[1].SetFields())
+	assert.NotContains(s.T(), fmt.Sprintf("%+v", reports[1]), "s3cr3t")
+
+	// usage has not changed
+	require.NoError(s.T(), c.Update(telemetryTestConfig{Name: "app", Port: 9090, Token: "s3cr3t", Internal: "y"}))
+	assert.Len(s.T(), reports, 2)
 }
 
-func (s *stubFileHandler) Load(_ any) error {
-	return nil
+type ctxKey struct{}
+
+type ctxFileHandler struct {
+	stubFileHandler
+	loads, saves []context.Context
 }
 
-func (s *stubFileHandler) Save(_ any) error {
-	return s.returnValue
+func (h *ctxFileHandler) LoadContext(ctx context.Context, _ any) error {
+	h.loads = append(h.loads, ctx)
+	return ctx.Err()
 }
 
-type fileHandlerTestConfig struct {
-	Name string `default:"app"`
-	Port string `default:"8080"`
+func (h *ctxFileHandler) SaveContext(ctx context.Context, _ any) error {
+	h.saves = append(h.saves, ctx)
+	return ctx.Err()
 }
 
-func (s *testSuite) TestFileHandlerSaveFail() {
-	stubFh := stubFileHandler{errors.New("filehandler error")}
+func (s *testSuite) TestContext() {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := InitCtx[fileHandlerTestConfig](ctx, WithHandler(&stubFileHandler{}))
+	assert.ErrorIs(s.T(), err, context.Canceled, "cancelled init should not fall back to defaults")
 
-	c, err := Init[fileHandlerTestConfig](&stubFh)
-	require.Errorf(s.T(), err, "filehandler should return error")
-	assert.ErrorContainsf(s.T(), err, "filehandler error", "not a filehandler error")
-	assert.Nilf(s.T(), c, "cog instance should be nil in case of error")
-}
+	h := &ctxFileHandler{}
+	ctx = context.WithValue(context.Background(), ctxKey{}, "init")
+	c, err := InitCtx[fileHandlerTestConfig](ctx, WithHandler(h))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	require.NotEmpty(s.T(), h.loads)
+	require.Len(s.T(), h.saves, 1)
+	assert.Equal(s.T(), "init", h.loads[0].Value(ctxKey{}))
+	assert.Equal(s.T(), "init", h.saves[0].Value(ctxKey{}))
+	assert.Nil(s.T(), c.ChangeContext().Value(ctxKey{}), "context should not be kept after init")
 
-func (s *testSuite) TestFileHandlerUpdateFail() {
-	stubFh := stubFileHandler{}
+	ctx, cancel = context.WithCancel(context.WithValue(context.Background(), ctxKey{}, "update"))
+	defer cancel()
 
-	c, err := Init[fileHandlerTestConfig](&stubFh)
-	require.NoErrorf(s.T(), err, "filehandler should not return error")
-	require.NotNilf(s.T(), c, "cong instance should not be nil")
+	received := []context.Context{}
+	first := func(ctx context.Context, cfg fileHandlerTestConfig) error {
+		received = append(received, ctx)
+		if cfg.Port == "9090" {
+			cancel()
+		}
+		return nil
+	}
+	c.AddSubscriberCtx(first)
+	called := false
+	c.AddSubscriber(func(fileHandlerTestConfig) error {
+		called = true
+		return nil
+	})
 
-	stubFh.returnValue = errors.New("filehandler error")
+	require.NoError(s.T(), c.UpdateCtx(ctx, fileHandlerTestConfig{Name: "app", Port: "8081"}))
+	require.Len(s.T(), received, 1)
+	assert.Equal(s.T(), "update", received[0].Value(ctxKey{}))
+	assert.Equal(s.T(), "update", h.saves[1].Value(ctxKey{}))
+	assert.True(s.T(), called)
 
-	err = c.Update(fileHandlerTestConfig{
-		Name: "newName",
+	r, _ := c.LastUpdateReport()
+	assert.Contains(s.T(), r.Subscribers[0].Name, "TestContext")
+
+	called = false
+	err = c.UpdateCtx(ctx, fileHandlerTestConfig{Name: "app", Port: "9090"})
+	assert.ErrorIs(s.T(), err, context.Canceled)
+	assert.False(s.T(), called, "subscribers should not be called after context is done")
+	assert.Equal(s.T(), "8081", c.Config().Port)
+	require.Len(s.T(), received, 3)
+	assert.NoError(s.T(), received[2].Err(), "rollback should not be cancelled")
+
+	assert.ErrorIs(s.T(), c.UpdateCtx(ctx, fileHandlerTestConfig{Name: "app", Port: "8082"}), context.Canceled)
+
+	// change accepted by all subscribers is saved even if context is done afterwards
+	ctx, cancel = context.WithCancel(context.WithValue(context.Background(), ctxKey{}, "late"))
+	defer cancel()
+	c.AddSubscriber(func(cfg fileHandlerTestConfig) error {
+		if cfg.Port == "7070" {
+			cancel()
+		}
+		return nil
 	})
-	require.Errorf(s.T(), err, "filehandler should return error")
-	assert.ErrorContainsf(s.T(), err, "filehandler error", "not a filehandler error")
+	saves := len(h.saves)
+	require.NoError(s.T(), c.UpdateCtx(ctx, fileHandlerTestConfig{Name: "app", Port: "7070"}))
+	assert.Equal(s.T(), "7070", c.Config().Port)
+	require.Len(s.T(), h.saves, saves+1)
+	assert.Equal(s.T(), "late", h.saves[saves].Value(ctxKey{}))
+	assert.NoError(s.T(), h.saves[saves].Err())
 }
 
-func (s *testSuite) TestString() {
-	c, err := setup(s.T(), fmt.Sprintf(defaultConfig, string(s.testCase.Type)), "", s.testCase.Type, s.testCase.TestString)
+func (s *testSuite) TestClose() {
+	c, err := New[fileHandlerTestConfig](WithHandler(&stubFileHandler{}))
 	require.NoErrorf(s.T(), err, testSetupErrorMsg)
 
-	got := c.Config()
-	assert.Equalf(s.T(), testData, got, expectedResultErrorMsg)
+	release := make(chan struct{})
+	c.AddCallback(func(fileHandlerTestConfig) { <-release })
+	require.NoError(s.T(), c.Update(fileHandlerTestConfig{Name: "app", Port: "8081"}))
 
-	str, err := c.String(func(tc *testConfig) {
-		tc.Name = "[masked]"
-	})
+	closed := make(chan error)
+	go func() { closed <- c.Close() }()
+
+	select {
+	case <-closed:
+		s.T().Fatal("close should wait for callbacks")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+
+	select {
+	case err := <-closed:
+		assert.NoError(s.T(), err)
+	case <-time.After(time.Second):
+		s.T().Fatal("close has not returned")
+	}
+
+	assert.ErrorIs(s.T(), c.Update(fileHandlerTestConfig{Name: "app", Port: "8082"}), ErrClosed)
+	assert.ErrorIs(s.T(), c.Reload(), ErrClosed)
+	assert.ErrorIs(s.T(), c.RefreshEnv(), ErrClosed)
+	assert.Equal(s.T(), "8081", c.Config().Port, "config should be readable after close")
+	assert.NoError(s.T(), c.Close())
+}
+
+type lintTestConfig struct {
+	Name    string `default:"app"`
+	Port    int    `default:"8080"`
+	ApiKey  string
+	Token   string `secret:"true"`
+	Timeout int    `deprecated:"use Deadline"`
+}
+
+func (s *testSuite) TestLint() {
+	doc := map[fh.FileType]string{
+		fh.JSON: "{\"name\":\"app\",\"port\":9090,\"apikey\":\"Zk3#q9LmP2xW\",\"token\":\"Zk3#q9LmP2xW\",\"timeout\":5,\"prot\":1}",
+		fh.YAML: "name: app\nport: 9090\napikey: Zk3#q9LmP2xW\ntoken: Zk3#q9LmP2xW\ntimeout: 5\nprot: 1\n",
+		fh.TOML: "name = \"app\"\nport = 9090\napikey = \"Zk3#q9LmP2xW\"\ntoken = \"Zk3#q9LmP2xW\"\ntimeout = 5\nprot = 1\n",
+	}[s.testCase.Type]
+
+	findings, err := Lint[lintTestConfig]([]byte(doc), s.testCase.Type)
+	require.NoError(s.T(), err)
+
+	rules := []string{}
+	paths := []string{}
+	for _, f := range findings {
+		rules = append(rules, f.Rule)
+		paths = append(paths, f.Path)
+	}
+	assert.Equal(s.T(), []string{"secret-value", "deprecated-field", "redundant-default", "unknown-key"}, rules)
+	assert.Equal(s.T(), []string{"ApiKey", "Timeout", "Name", "prot"}, paths)
+	assert.Contains(s.T(), findings[1].Message, "use Deadline")
+
+	raw, err := Lint[map[string]any]([]byte(doc), s.testCase.Type)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), []Finding{raw[0], raw[1]}, raw)
+
+	custom := LintRuleFunc(func(t LintTarget) []Finding {
+		return []Finding{{Rule: "custom", Severity: LintInfo, Path: "x", Message: fmt.Sprint(len(t.Fields))}}
+	})
+	findings, err = Lint[lintTestConfig]([]byte(doc), s.testCase.Type, custom)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), []Finding{{Rule: "custom", Severity: LintInfo, Path: "x", Message: "5"}}, findings)
+
+	require.NoError(s.T(), os.MkdirAll(testDir, os.ModePerm))
+	file := filepath.Join(testDir, "lint."+string(s.testCase.Type))
+	require.NoError(s.T(), os.WriteFile(file, []byte(doc), permissions))
+	findings, err = LintFile[lintTestConfig](file, UnknownKeyRule())
+	require.NoError(s.T(), err)
+	assert.Len(s.T(), findings, 1)
+
+	_, err = Lint[lintTestConfig]([]byte("{"), s.testCase.Type)
+	assert.ErrorContains(s.T(), err, "failed at decode config document")
+}
+
+type testLogger struct {
+	lines []string
+}
+
+func (l *testLogger) Printf(format string, v ...any) {
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func (s *testSuite) TestOptions() {
+	stubFh := stubFileHandler{errors.New("source must not be written on init")}
+	logger := &testLogger{}
+
+	c, err := New[fileHandlerTestConfig](WithHandler(&stubFh), WithoutSave(), WithLogger(logger))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	assert.False(s.T(), c.InitReport().Saved)
+
+	err = c.Update(fileHandlerTestConfig{Name: "app", Port: "81"})
+	assert.ErrorContains(s.T(), err, "source must not be written on init")
+
+	stubFh.returnValue = nil
+	require.NoError(s.T(), c.Update(fileHandlerTestConfig{Name: "app", Port: "82"}))
+	assert.Equal(s.T(), "cog: updated [Port]", logger.lines[len(logger.lines)-1])
+
+	_, err = Init[fileHandlerTestConfig](&stubFileHandler{errors.New("deprecated init uses handler")})
+	assert.ErrorContains(s.T(), err, "deprecated init uses handler")
+}
+
+type wizardTestConfig struct {
+	Name     string `desc:"application name" default:"app"`
+	Mode     string `enum:"dev,prod" default:"dev"`
+	Port     int    `validate:"min=1024" default:"8080"`
+	Token    string `secret:"true" validate:"required"`
+	Tags     []string
+	Internal string `wizard:"-" default:"x"`
+}
+
+func (s *testSuite) TestWizard() {
+	out := &bytes.Buffer{}
+	file := filepath.Join(testDir, "wizard."+string(s.testCase.Type))
+	require.NoError(s.T(), os.MkdirAll(testDir, os.ModePerm))
+
+	config, err := Wizard[wizardTestConfig](
+		WithWizardIO(strings.NewReader("\nstaging\nprod\n80\n9090\n\ns3cr3t\n"), out),
+		WithWizardFile(file),
+	)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), wizardTestConfig{Name: "app", Mode: "prod", Port: 9090, Token: "s3cr3t", Internal: "x"}, config)
+
+	prompts := out.String()
+	assert.Contains(s.T(), prompts, "Name - application name (app): ")
+	assert.Contains(s.T(), prompts, "Mode [dev/prod] (dev): ")
+	assert.Contains(s.T(), prompts, "invalid value: expected one of dev, prod")
+	assert.Contains(s.T(), prompts, "Port (8080): ")
+	assert.Contains(s.T(), prompts, "invalid value: Key: 'wizardTestConfig.Port'")
+	assert.Contains(s.T(), prompts, "invalid value: Key: 'wizardTestConfig.Token'")
+	assert.NotContains(s.T(), prompts, "Internal")
+
+	saved, err := CompareFile[wizardTestConfig](file).load()
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), []any{"prod", 9090, "s3cr3t"}, []any{saved.Mode, saved.Port, saved.Token})
+
+	_, err = Wizard[wizardTestConfig](WithWizardIO(strings.NewReader("\n\n\n\ns3cr3t\n"), io.Discard), WithWizardFile(file))
+	assert.ErrorIs(s.T(), err, os.ErrExist)
+
+	_, err = Wizard[wizardTestConfig](WithWizardIO(strings.NewReader("\n"), io.Discard))
+	assert.ErrorIs(s.T(), err, io.ErrUnexpectedEOF)
+}
+
+type counterTestConfig struct {
+	Count int
+}
+
+func (s *testSuite) TestUpdateFunc() {
+	c, err := New[counterTestConfig](WithHandler(&stubFileHandler{}))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	increment := func(cur counterTestConfig) (counterTestConfig, error) {
+		cur.Count++
+		return cur, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(s.T(), c.UpdateFunc(increment))
+		}()
+	}
+	wg.Wait()
+	assert.Equal(s.T(), 20, c.Config().Count)
+
+	rev := c.Revision()
+	err = c.UpdateFunc(func(cur counterTestConfig) (counterTestConfig, error) {
+		return cur, errors.New("mutation failed")
+	})
+	assert.ErrorContains(s.T(), err, "mutation failed")
+	assert.Equal(s.T(), rev, c.Revision())
+}
+
+type patchTestConfig struct {
+	Name   string
+	Server struct {
+		Host string
+		Port int `validate:"min=1024" default:"8080"`
+	}
+	Tags []string
+}
+
+func (s *testSuite) TestPatch() {
+	c, err := New[patchTestConfig](WithHandler(&stubFileHandler{}))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	cfg := patchTestConfig{Name: "app", Tags: []string{"a"}}
+	cfg.Server.Host = "localhost"
+	cfg.Server.Port = 8080
+	require.NoError(s.T(), c.Update(cfg))
+
+	updated := make(chan patchTestConfig, 1)
+	c.AddSubscriber(func(cfg patchTestConfig) error {
+		updated <- cfg
+		return nil
+	})
+
+	require.NoError(s.T(), c.Patch([]byte(`{"server": {"port": 9090}, "tags": null}`)))
+	cfg.Server.Port = 9090
+	cfg.Tags = nil
+	assert.Equal(s.T(), cfg, c.Config())
+	assert.Equal(s.T(), cfg, <-updated)
+
+	require.NoError(s.T(), c.PatchMap(map[string]any{"Name": "other"}))
+	assert.Equal(s.T(), "other", c.Config().Name)
+
+	err = c.Patch([]byte(`{"server": {"port": 80}}`))
+	assert.ErrorContains(s.T(), err, "failed at validate config")
+	err = c.Patch([]byte(`{"prot": 1}`))
+	assert.ErrorContains(s.T(), err, "unknown field")
+	err = c.Patch([]byte(`[1]`))
+	assert.ErrorContains(s.T(), err, "failed at decode patch")
+	assert.Equal(s.T(), 9090, c.Config().Server.Port)
+}
+
+type controlTestConfig struct {
+	Name  string `default:"app"`
+	Port  int    `default:"8080"`
+	Token string `secret:"true" default:"s3cr3t"`
+}
+
+func (s *testSuite) TestControlSocket() {
+	require.NoError(s.T(), os.MkdirAll(testDir, os.ModePerm))
+	socket := filepath.Join(testDir, "cog.sock")
+
+	actors := make(chan string, 1)
+	c, err := New[controlTestConfig](WithHandler(&stubFileHandler{}), WithControlSocket(socket),
+		WithUpdateAuthorizer(func(actor string, _ Diff) error {
+			actors <- actor
+			return nil
+		}))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	resp, err := Control(socket, ControlRequest{Command: ControlGet})
+	require.NoError(s.T(), err)
+	assert.Empty(s.T(), resp.Error)
+	assert.JSONEq(s.T(), `{"Name":"app","Port":8080,"Token":""}`, string(resp.Config))
+
+	resp, err = Control(socket, ControlRequest{Command: ControlUpdate, Patch: json.RawMessage(`{"port":9090}`)})
+	require.NoError(s.T(), err)
+	assert.Empty(s.T(), resp.Error)
+	assert.Equal(s.T(), c.Revision(), resp.Revision)
+	assert.Equal(s.T(), controlTestConfig{Name: "app", Port: 9090, Token: "s3cr3t"}, c.Config())
+	assert.Equal(s.T(), fmt.Sprintf("uid:%d", os.Getuid()), <-actors)
+
+	resp, err = Control(socket, ControlRequest{Command: ControlHistory})
+	require.NoError(s.T(), err)
+	var history []map[string]any
+	require.NoError(s.T(), json.Unmarshal(resp.History, &history))
+	require.Len(s.T(), history, 1)
+	assert.EqualValues(s.T(), resp.Revision, history[0]["revision"])
+
+	resp, err = Control(socket, ControlRequest{Command: ControlSources})
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), SourceDefault, resp.Sources["Port"])
+
+	resp, err = Control(socket, ControlRequest{Command: ControlReload})
+	require.NoError(s.T(), err)
+	assert.Empty(s.T(), resp.Error)
+
+	resp, err = Control(socket, ControlRequest{Command: "drop"})
+	require.NoError(s.T(), err)
+	assert.Contains(s.T(), resp.Error, "unknown control command")
+
+	require.NoError(s.T(), c.Close())
+	_, err = os.Stat(socket)
+	assert.ErrorIs(s.T(), err, os.ErrNotExist)
+
+	denied, err := New[controlTestConfig](WithHandler(&stubFileHandler{}), WithControlSocket(socket),
+		WithControlAuthorizer(func(peer Peer, command string) error {
+			if command != ControlGet {
+				return ErrControlDenied
+			}
+			return nil
+		}))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	defer denied.Close()
+
+	resp, err = Control(socket, ControlRequest{Command: ControlReload})
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), ErrControlDenied.Error(), resp.Error)
+}
+
+func (s *testSuite) TestChangeEv() {
+	c, err := New[fileHandlerTestConfig](WithHandler(&stubFileHandler{}))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	changes := [][2]string{}
+	c.AddSubscriberEv(func(old, new fileHandlerTestConfig) error {
+		changes = append(changes, [2]string{old.Port, new.Port})
+		return nil
+	})
+	callbacks := make(chan [2]string, 3)
+	c.AddCallbackEv(func(old, new fileHandlerTestConfig) {
+		callbacks <- [2]string{old.Port, new.Port}
+	})
+
+	require.NoError(s.T(), c.Update(fileHandlerTestConfig{Name: "app", Port: "81"}))
+	assert.Equal(s.T(), [2]string{"8080", "81"}, <-callbacks)
+
+	c.AddSubscriber(func(cfg fileHandlerTestConfig) error {
+		if cfg.Port == "82" {
+			return errors.New("port is in use")
+		}
+		return nil
+	})
+	assert.Error(s.T(), c.Update(fileHandlerTestConfig{Name: "app", Port: "82"}))
+
+	require.NoError(s.T(), c.Update(fileHandlerTestConfig{Name: "app", Port: "83"}))
+	assert.Equal(s.T(), [2]string{"81", "83"}, <-callbacks)
+
+	assert.Equal(s.T(), [][2]string{{"8080", "81"}, {"81", "82"}, {"82", "81"}, {"81", "83"}}, changes)
+}
+
+func (s *testSuite) TestChangeEvRegistration() {
+	c, err := New[controlTestConfig](WithHandler(&stubFileHandler{}))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			c.UpdateFunc(func(cur controlTestConfig) (controlTestConfig, error) {
+				cur.Port++
+				return cur, nil
+			})
+		}
+	}()
+
+	// every change is seen, starting from the one after registration
+	var lock sync.Mutex
+	gaps := []string{}
+	for i := 0; i < 20; i++ {
+		c.AddSubscriberEv(func(old, new controlTestConfig) error {
+			if new.Port != old.Port+1 {
+				lock.Lock()
+				gaps = append(gaps, fmt.Sprintf("subscriber %d -> %d", old.Port, new.Port))
+				lock.Unlock()
+			}
+			return nil
+		})
+		c.AddCallbackEv(func(old, new controlTestConfig) {
+			if new.Port <= old.Port {
+				lock.Lock()
+				gaps = append(gaps, fmt.Sprintf("callback %d -> %d", old.Port, new.Port))
+				lock.Unlock()
+			}
+		})
+		time.Sleep(time.Millisecond)
+	}
+	<-done
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(s.T(), c.AwaitApplied(ctx, c.Revision()))
+
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Empty(s.T(), gaps)
+}
+
+func (s *testSuite) TestChangeEvRegisteredFromSubscriber() {
+	c, err := New[controlTestConfig](WithHandler(&stubFileHandler{}))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	changes := make(chan string, 4)
+	registered := false
+	c.AddSubscriber(func(cfg controlTestConfig) error {
+		if registered {
+			return nil
+		}
+		registered = true
+		c.AddSubscriberEv(func(old, new controlTestConfig) error {
+			changes <- fmt.Sprintf("subscriber %d -> %d", old.Port, new.Port)
+			return nil
+		})
+		c.AddCallbackEv(func(old, new controlTestConfig) {
+			changes <- fmt.Sprintf("callback %d -> %d", old.Port, new.Port)
+		})
+		return nil
+	})
+
+	updated := make(chan error)
+	go func() {
+		updated <- c.Update(controlTestConfig{Name: "app", Port: 1})
+	}()
+	select {
+	case err := <-updated:
+		require.NoError(s.T(), err)
+	case <-time.After(time.Second):
+		s.T().Fatal("registration from subscriber should not block the update")
+	}
+
+	// change in progress is not delivered to the subscriber, but callback is registered before it is posted
+	assert.Equal(s.T(), "callback 8080 -> 1", <-changes)
+
+	require.NoError(s.T(), c.Update(controlTestConfig{Name: "app", Port: 2}))
+	assert.Equal(s.T(), "subscriber 1 -> 2", <-changes)
+	assert.Equal(s.T(), "callback 1 -> 2", <-changes)
+}
+
+func (s *testSuite) TestSubscribersAreRegistered() {
+	subs := [3]Subscriber[testConfig]{
+		func(tc testConfig) error {
+			return nil
+		},
+		func(tc testConfig) error {
+			return nil
+		},
+		func(tc testConfig) error {
+			return nil
+		},
+	}
+
+	c, err := setup(s.T(), fmt.Sprintf(defaultConfig, string(s.testCase.Type)), "", s.testCase.Type, s.testCase.TestString)
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	for _, cb := range subs {
+		c.AddSubscriber(cb)
+	}
+
+	assert.Equalf(s.T(), len(subs), len(c.subscribers), "expected number of subscribers")
+}
+
+func (s *testSuite) TestCallbacksAreRegistered() {
+	cbs := [3]Callback[testConfig]{
+		func(tc testConfig) {},
+		func(tc testConfig) {},
+		func(tc testConfig) {},
+	}
+	c, err := setup(s.T(), fmt.Sprintf(defaultConfig, string(s.testCase.Type)), "", s.testCase.Type, s.testCase.TestString)
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	for _, f := range cbs {
+		c.AddCallback(f)
+	}
+
+	assert.Equalf(s.T(), len(cbs), len(c.callbacks), "expected number of callbacks")
+}
+
+var (
+	newData                = testConfig{Name: "new_data", Version: 456}
+	newDataWithoutRequired = testConfig{Name: "new_data"}
+)
+
+func (s *testSuite) TestConfigUpdated() {
+	c, err := setup(s.T(), fmt.Sprintf(defaultConfig, string(s.testCase.Type)), "", s.testCase.Type, s.testCase.TestString)
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	err = c.Update(newData)
+	require.NoErrorf(s.T(), err, "error while updating config: %v", err)
+
+	got := c.Config()
+	assert.Equalf(s.T(), newData, got, expectedResultErrorMsg)
+}
+
+func (s *testSuite) TestCallbacksAreNotifiedAndRemoved() {
+	var calls1, calls2 int32
+	cbs := [3]Callback[testConfig]{
+		func(tc testConfig) { atomic.AddInt32(&calls1, 1) },
+		func(tc testConfig) { atomic.AddInt32(&calls2, 1) },
+		nil,
+	}
+
+	c, err := setup(s.T(), fmt.Sprintf(defaultConfig, string(s.testCase.Type)), "", s.testCase.Type, s.testCase.TestString)
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	c.AddCallback(cbs[0])
+	callbackId := c.AddCallback(cbs[1])
+	c.AddCallback(cbs[2])
+
+	c.Update(newData)
+	c.Update(newData)
+	time.Sleep(100 * time.Millisecond)
+
+	c.RemoveCallback(callbackId)
+
+	c.Update(newData)
+	c.Update(newData)
+	time.Sleep(100 * time.Millisecond)
+
+	assert.Equal(s.T(), int32(4), atomic.LoadInt32(&calls1))
+	assert.Equal(s.T(), int32(2), atomic.LoadInt32(&calls2))
+}
+
+func (s *testSuite) TestRemoveCallbackWrongId() {
+	c, err := setup(s.T(), fmt.Sprintf(defaultConfig, string(s.testCase.Type)), "", s.testCase.Type, s.testCase.TestString)
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	id := c.AddCallback(func(tc testConfig) {})
+
+	err = c.RemoveCallback(id + 1)
+	require.Errorf(s.T(), err, "RemoveCallback should return error")
+}
+
+func (s *testSuite) TestSubscribersAreNotifiedAndRemoved() {
+	var calls1, calls2 int
+	subs := [3]Subscriber[testConfig]{
+		func(tc testConfig) error {
+			calls1++
+			return nil
+		},
+		func(tc testConfig) error {
+			calls2++
+			return nil
+		},
+		nil,
+	}
+
+	c, err := setup(s.T(), fmt.Sprintf(defaultConfig, string(s.testCase.Type)), "", s.testCase.Type, s.testCase.TestString)
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	c.AddSubscriber(subs[0])
+	subscriberId := c.AddSubscriber(subs[1])
+	c.AddSubscriber(subs[2])
+
+	c.Update(newData)
+	c.Update(newData)
+	time.Sleep(100 * time.Millisecond)
+
+	c.RemoveSubscriber(subscriberId)
+
+	c.Update(newData)
+	c.Update(newData)
+	time.Sleep(100 * time.Millisecond)
+
+	assert.Equal(s.T(), 4, calls1)
+	assert.Equal(s.T(), 2, calls2)
+}
+
+func (s *testSuite) TestRemoveSubscriberWrongId() {
+	c, err := setup(s.T(), fmt.Sprintf(defaultConfig, string(s.testCase.Type)), "", s.testCase.Type, s.testCase.TestString)
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	id := c.AddSubscriber(func(tc testConfig) error { return nil })
+
+	err = c.RemoveSubscriber(id + 1)
+	require.Errorf(s.T(), err, "RemoveCallback should return error")
+}
+
+func (s *testSuite) TestSubscriberReturnsError() {
+	var subCalls uint64
+	subs := [2]Subscriber[testConfig]{
+		func(tc testConfig) error {
+			subCalls++
+			return nil
+		},
+		func(tc testConfig) error {
+			return errors.New("test error")
+		},
+	}
+
+	var cbCalls int
+	cbs := [2]Callback[testConfig]{
+		func(tc testConfig) { cbCalls++ },
+		func(tc testConfig) { cbCalls++ },
+	}
+
+	c, err := setup(s.T(), fmt.Sprintf(defaultConfig, string(s.testCase.Type)), "", s.testCase.Type, s.testCase.TestString)
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	for _, f := range subs {
+		c.AddSubscriber(f)
+	}
+
+	for _, f := range cbs {
+		c.AddCallback(f)
+	}
+
+	err = c.Update(newData)
+	require.Errorf(s.T(), err, "update config did not failed")
+
+	want := testData
+	got := c.Config()
+
+	assert.Equalf(s.T(), want, got, "config is not equal to old data")
+	assert.NotEqualf(s.T(), newData, got, "config was updated to new data")
+	assert.NotEqualf(s.T(), 1, (subCalls % 2), "updated subscriber is not rolled back: %d", subCalls)
+	assert.Zero(s.T(), cbCalls, "callbacks are called in case of subscriber error: %d", cbCalls)
+}
+
+func (s *testSuite) TestUpdateConfigIsValidated() {
+	c, err := setup(s.T(), fmt.Sprintf(defaultConfig, string(s.testCase.Type)), "", s.testCase.Type, s.testCase.TestString)
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	err = c.Update(newDataWithoutRequired)
+	require.Errorf(s.T(), err, "expected error not thrown")
+
+	// config should not be updated
+	got := c.Config()
+	assert.Equalf(s.T(), testData, got, expectedResultErrorMsg)
+}
+
+type stubFileHandler struct {
+	returnValue error
+}
+
+func (s *stubFileHandler) Load(_ any) error {
+	return nil
+}
+
+func (s *stubFileHandler) Save(_ any) error {
+	return s.returnValue
+}
+
+type fileHandlerTestConfig struct {
+	Name string `default:"app"`
+	Port string `default:"8080"`
+}
+
+func (s *testSuite) TestFileHandlerSaveFail() {
+	stubFh := stubFileHandler{errors.New("filehandler error")}
+
+	c, err := Init[fileHandlerTestConfig](&stubFh)
+	require.Errorf(s.T(), err, "filehandler should return error")
+	assert.ErrorContainsf(s.T(), err, "filehandler error", "not a filehandler error")
+	assert.Nilf(s.T(), c, "cog instance should be nil in case of error")
+}
+
+func (s *testSuite) TestFileHandlerUpdateFail() {
+	stubFh := stubFileHandler{}
+
+	c, err := Init[fileHandlerTestConfig](&stubFh)
+	require.NoErrorf(s.T(), err, "filehandler should not return error")
+	require.NotNilf(s.T(), c, "cong instance should not be nil")
+
+	stubFh.returnValue = errors.New("filehandler error")
+
+	err = c.Update(fileHandlerTestConfig{
+		Name: "newName",
+	})
+	require.Errorf(s.T(), err, "filehandler should return error")
+	assert.ErrorContainsf(s.T(), err, "filehandler error", "not a filehandler error")
+}
+
+func (s *testSuite) TestString() {
+	c, err := setup(s.T(), fmt.Sprintf(defaultConfig, string(s.testCase.Type)), "", s.testCase.Type, s.testCase.TestString)
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	got := c.Config()
+	assert.Equalf(s.T(), testData, got, expectedResultErrorMsg)
+
+	str, err := c.String(func(tc *testConfig) {
+		tc.Name = "[masked]"
+	})
+	require.NoErrorf(s.T(), err, "string method should not return error")
+
+	strExpected := `{
+  "Name": "[masked]",
+  "Version": 123,
+  "IsPrefork": true
+}`
+
+	assert.Equal(s.T(), strExpected, str)
+
+	str, err = c.String()
 	require.NoErrorf(s.T(), err, "string method should not return error")
 
-	strExpected := `{
-  "Name": "[masked]",
-  "Version": 123,
-  "IsPrefork": true
-}`
+	strExpected = `{
+  "Name": "config_test",
+  "Version": 123,
+  "IsPrefork": true
+}`
+
+	assert.Equal(s.T(), strExpected, str)
+}
+
+func (s *testSuite) TestUpdateHooks() {
+	c, err := setup(s.T(), fmt.Sprintf(defaultConfig, string(s.testCase.Type)), "", s.testCase.Type, s.testCase.TestString)
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	var order []string
+	c.OnBeforeUpdate(func(old, new testConfig) (testConfig, error) {
+		order = append(order, "before_update")
+		assert.Equal(s.T(), testData, old)
+		new.Name = "normalized"
+		return new, nil
+	})
+	c.OnBeforeSave(func(tc testConfig) error {
+		order = append(order, "before_save")
+		assert.Equal(s.T(), "normalized", tc.Name)
+		return nil
+	})
+	c.OnAfterUpdate(func(old, new testConfig) {
+		order = append(order, "after_update")
+		assert.Equal(s.T(), testData, old)
+	})
+
+	err = c.Update(newData)
+	require.NoErrorf(s.T(), err, "error while updating config: %v", err)
+
+	assert.Equal(s.T(), []string{"before_update", "before_save", "after_update"}, order)
+	assert.Equal(s.T(), "normalized", c.Config().Name)
+}
+
+func (s *testSuite) TestBeforeUpdateHookCancelsUpdate() {
+	c, err := setup(s.T(), fmt.Sprintf(defaultConfig, string(s.testCase.Type)), "", s.testCase.Type, s.testCase.TestString)
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	var notified bool
+	c.AddSubscriber(func(tc testConfig) error {
+		notified = true
+		return nil
+	})
+	c.OnBeforeUpdate(func(old, new testConfig) (testConfig, error) {
+		return new, errors.New("invariant violated")
+	})
+
+	err = c.Update(newData)
+	require.Errorf(s.T(), err, "update should fail")
+	assert.ErrorContains(s.T(), err, "invariant violated")
+	assert.False(s.T(), notified, "subscribers should not be notified")
+	assert.Equal(s.T(), testData, c.Config())
+}
+
+type normalizeTestConfig struct {
+	Name    string   `normalize:"trim,lower"`
+	Tags    []string `normalize:"trim,upper"`
+	DataDir string   `normalize:"trim,path"`
+}
+
+func (s *testSuite) TestNormalization() {
+	err := os.Mkdir(testDir, os.ModePerm)
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	h, err := fh.New(fh.WithName(appName), fh.WithPath(testDir), fh.WithType(s.testCase.Type))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	c, err := Init[normalizeTestConfig](h)
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	err = c.Update(normalizeTestConfig{Name: "  My-App ", Tags: []string{" a", "b "}, DataDir: " data "})
+	require.NoErrorf(s.T(), err, "error while updating config: %v", err)
+
+	dir, _ := filepath.Abs(testDir)
+	assert.Equal(s.T(), normalizeTestConfig{Name: "my-app", Tags: []string{"A", "B"}, DataDir: filepath.Join(dir, "data")}, c.Config())
+}
+
+type pathTestConfig struct {
+	Version int
+	Certs   string `path:"relative-to-config"`
+}
+
+func (s *testSuite) TestPathRelativeToConfig() {
+	err := os.Mkdir(testDir, os.ModePerm)
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	h, err := fh.New(fh.WithName(appName), fh.WithPath(testDir), fh.WithType(s.testCase.Type))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	c, err := Init[pathTestConfig](h)
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	var got string
+	c.AddSubscriber(func(pc pathTestConfig) error {
+		got = pc.Certs
+		return nil
+	})
+
+	err = c.Update(pathTestConfig{Version: 2, Certs: "certs/server.pem"})
+	require.NoErrorf(s.T(), err, "error while updating config: %v", err)
+
+	dir, _ := filepath.Abs(testDir)
+	assert.Equal(s.T(), filepath.Join(dir, "certs/server.pem"), got)
+	assert.Equal(s.T(), filepath.Join(dir, "certs/server.pem"), c.Config().Certs)
+}
+
+func (s *testSuite) TestEnvOverridesFile() {
+	os.Setenv("TEST_ENV_NAME", "env_name")
+
+	f := fmt.Sprintf(defaultConfig, string(s.testCase.Type))
+	err := os.WriteFile(f, []byte(s.testCase.TestString), permissions)
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	h, err := fh.New(fh.WithName(appName), fh.WithType(s.testCase.Type))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	c, err := New[testConfig](WithHandler(h), WithEnvPrecedence(EnvOverridesFile))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	assert.Equalf(s.T(), testDataEnvName, c.Config(), expectedResultErrorMsg)
+}
+
+func (s *testSuite) TestExplicitZeroValuesAreRespected() {
+	c, err := setup(s.T(), fmt.Sprintf(defaultConfig, string(s.testCase.Type)), "", s.testCase.Type, s.testCase.TestStringExplicitZero)
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	assert.Equalf(s.T(), testConfig{Version: 123}, c.Config(), expectedResultErrorMsg)
+}
+
+func (s *testSuite) TestIsSet() {
+	c, err := setup(s.T(), fmt.Sprintf(defaultConfig, string(s.testCase.Type)), "", s.testCase.Type, s.testCase.TestStringWithDefaults)
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	assert.True(s.T(), c.IsSet("Version"), "version is provided by the file")
+	assert.False(s.T(), c.IsSet("Name"), "name is set from default tag")
+	assert.False(s.T(), c.IsSet("IsPrefork"), "isPrefork is set from default tag")
+	assert.False(s.T(), c.IsSet("Unknown"))
+}
+
+type phaseTestConfig struct {
+	Name   string `validate:"required"`
+	Secret string `validate:"required" phase:"init"`
+	Store  struct {
+		Host string `validate:"required" phase:"update"`
+	}
+}
+
+func (s *testSuite) TestValidationPhases() {
+	stubFh := stubFileHandler{}
+
+	_, err := Init[phaseTestConfig](&stubFh)
+	require.Errorf(s.T(), err, "init phase field should be validated at init")
+
+	initial := phaseTestConfig{Name: "app", Secret: "secret"}
+	err = validate(initial, PhaseInit)
+	require.NoErrorf(s.T(), err, "update phase field should not be validated at init")
+
+	update := phaseTestConfig{Name: "app"}
+	err = validate(update, PhaseUpdate)
+	require.Errorf(s.T(), err, "update phase field should be validated at update")
+
+	update.Store.Host = "localhost"
+	err = validate(update, PhaseUpdate)
+	require.NoErrorf(s.T(), err, "init phase field should not be validated at update")
+}
+
+type envTestConfig struct {
+	Port int `env:"TEST_ENV_PORT" default:"8080"`
+}
+
+func (s *testSuite) TestInvalidEnvValue() {
+	os.Setenv("TEST_ENV_PORT", "abc")
+	defer os.Unsetenv("TEST_ENV_PORT")
+
+	_, err := New[envTestConfig](WithHandler(&stubFileHandler{}))
+	require.Errorf(s.T(), err, "invalid env value should fail init")
+	assert.ErrorContains(s.T(), err, "TEST_ENV_PORT")
+	assert.ErrorContains(s.T(), err, "expected int")
+
+	c, err := New[envTestConfig](WithHandler(&stubFileHandler{}), WithLenientEnv())
+	require.NoErrorf(s.T(), err, "invalid env value should be ignored")
+	assert.Equal(s.T(), 8080, c.Config().Port)
+}
+
+type pingHandler struct {
+	stubFileHandler
+	err chan error
+}
+
+func (p *pingHandler) Ping(_ context.Context) error {
+	return <-p.err
+}
+
+func (s *testSuite) TestHealthCheck() {
+	h := &pingHandler{err: make(chan error)}
+
+	c, err := New[fileHandlerTestConfig](WithHandler(h), WithHealthCheck(time.Millisecond))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	assert.True(s.T(), c.Status().Healthy)
+
+	events := make(chan Event, 2)
+	c.OnEvent(func(e Event) {
+		events <- e
+	})
+
+	h.err <- errors.New("unreachable")
+	e := <-events
+	assert.Equal(s.T(), EventSourceUnhealthy, e.Type)
+	assert.ErrorContains(s.T(), e.Err, "unreachable")
+
+	st := c.Status()
+	assert.False(s.T(), st.Healthy)
+	assert.False(s.T(), st.UnhealthySince.IsZero())
+	assert.Equal(s.T(), int64(1), st.ConsecutiveFailures)
+
+	h.err <- nil
+	e = <-events
+	assert.Equal(s.T(), EventSourceRecovered, e.Type)
+	assert.True(s.T(), c.Status().Healthy)
+	assert.Equal(s.T(), int64(1), c.Status().Failures)
+}
+
+type watchHandler struct {
+	stubFileHandler
+	lock    sync.Mutex
+	config  fileHandlerTestConfig
+	loadErr error
+	changes chan struct{}
+}
+
+func (w *watchHandler) Load(data any) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.loadErr != nil {
+		return w.loadErr
+	}
+
+	b, err := json.Marshal(w.config)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, data)
+}
+
+func (w *watchHandler) Watch(_ context.Context) (<-chan struct{}, error) {
+	return w.changes, nil
+}
+
+func (w *watchHandler) set(c fileHandlerTestConfig) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.config = c
+	w.loadErr = nil
+}
+
+func (w *watchHandler) fail(err error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.loadErr = err
+}
+
+func (s *testSuite) TestWatchableHandlerIsReloaded() {
+	h := &watchHandler{config: fileHandlerTestConfig{Name: "app", Port: "80"}, changes: make(chan struct{})}
+
+	c, err := New[fileHandlerTestConfig](WithHandler(h))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	updated := make(chan fileHandlerTestConfig, 1)
+	c.AddSubscriber(func(cfg fileHandlerTestConfig) error {
+		updated <- cfg
+		return nil
+	})
+	events := make(chan Event, 1)
+	c.OnEvent(func(e Event) {
+		events <- e
+	})
+
+	h.set(fileHandlerTestConfig{Name: "app", Port: "8080"})
+	h.changes <- struct{}{}
+
+	assert.Equal(s.T(), "8080", (<-updated).Port)
+	assert.Equal(s.T(), EventReloaded, (<-events).Type)
+	assert.Equal(s.T(), "8080", c.Config().Port)
+
+	// unchanged config does not notify subscribers
+	h.changes <- struct{}{}
+	assert.Equal(s.T(), EventReloaded, (<-events).Type)
+	assert.Empty(s.T(), updated)
+}
+
+func (s *testSuite) TestConflictIsReported() {
+	h := &watchHandler{config: fileHandlerTestConfig{Name: "app", Port: "80"}, changes: make(chan struct{})}
+
+	c, err := New[fileHandlerTestConfig](WithHandler(h), WithConflictPolicy(ReportConflict))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	conflicts := make(chan Conflict[fileHandlerTestConfig], 1)
+	c.OnConflict(func(cf Conflict[fileHandlerTestConfig]) {
+		conflicts <- cf
+	})
+	events := make(chan Event, 1)
+	c.OnEvent(func(e Event) {
+		events <- e
+	})
+
+	// local change is not saved
+	h.returnValue = errors.New("filehandler error")
+	err = c.Update(fileHandlerTestConfig{Name: "app", Port: "1000"})
+	require.Errorf(s.T(), err, "filehandler should return error")
+
+	h.set(fileHandlerTestConfig{Name: "app", Port: "2000"})
+	h.changes <- struct{}{}
+
+	cf := <-conflicts
+	assert.Equal(s.T(), "80", cf.Base.Port)
+	assert.Equal(s.T(), "1000", cf.Local.Port)
+	assert.Equal(s.T(), "2000", cf.External.Port)
+	assert.Equal(s.T(), EventConflict, (<-events).Type)
+	assert.Equal(s.T(), "1000", c.Config().Port, "local changes should be kept")
+}
+
+func (s *testSuite) TestConflictingChangesAreMerged() {
+	h := &watchHandler{config: fileHandlerTestConfig{Name: "app", Port: "80"}, changes: make(chan struct{})}
+
+	c, err := New[fileHandlerTestConfig](WithHandler(h), WithConflictPolicy(MergeChanges))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	events := make(chan Event, 1)
+	c.OnEvent(func(e Event) {
+		events <- e
+	})
+
+	// local change is not saved
+	h.returnValue = errors.New("filehandler error")
+	err = c.Update(fileHandlerTestConfig{Name: "local", Port: "80"})
+	require.Errorf(s.T(), err, "filehandler should return error")
+	h.returnValue = nil
+
+	h.set(fileHandlerTestConfig{Name: "app", Port: "2000"})
+	h.changes <- struct{}{}
+
+	assert.Equal(s.T(), EventReloaded, (<-events).Type)
+	assert.Equal(s.T(), fileHandlerTestConfig{Name: "local", Port: "2000"}, c.Config())
+
+	// both sides change the same field, name is changed only externally
+	h.returnValue = errors.New("filehandler error")
+	err = c.Update(fileHandlerTestConfig{Name: "local", Port: "3000"})
+	require.Errorf(s.T(), err, "filehandler should return error")
+	h.returnValue = nil
+
+	conflicts := make(chan Conflict[fileHandlerTestConfig], 1)
+	c.OnConflict(func(cf Conflict[fileHandlerTestConfig]) {
+		conflicts <- cf
+	})
+
+	h.set(fileHandlerTestConfig{Name: "external", Port: "4000"})
+	h.changes <- struct{}{}
+
+	assert.Equal(s.T(), []string{"Port"}, (<-conflicts).Fields)
+	assert.Equal(s.T(), EventConflict, (<-events).Type)
+	assert.Equal(s.T(), EventReloaded, (<-events).Type)
+	assert.Equal(s.T(), fileHandlerTestConfig{Name: "external", Port: "3000"}, c.Config(), "conflicting field should keep local value")
+}
+
+func (s *testSuite) TestPauseWatching() {
+	h := &watchHandler{config: fileHandlerTestConfig{Name: "app", Port: "80"}, changes: make(chan struct{})}
+
+	c, err := New[fileHandlerTestConfig](WithHandler(h))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	events := make(chan Event, 1)
+	c.OnEvent(func(e Event) {
+		events <- e
+	})
+
+	c.PauseWatching()
+
+	h.set(fileHandlerTestConfig{Name: "app", Port: "8080"})
+	h.changes <- struct{}{}
+	h.changes <- struct{}{}
+
+	assert.Empty(s.T(), events)
+	assert.Equal(s.T(), "80", c.Config().Port, "config should not be reloaded while paused")
+
+	c.ResumeWatching()
+
+	assert.Equal(s.T(), EventReloaded, (<-events).Type)
+	assert.Equal(s.T(), "8080", c.Config().Port)
+}
+
+func (s *testSuite) TestFreeze() {
+	h := &watchHandler{config: fileHandlerTestConfig{Name: "app", Port: "80"}, changes: make(chan struct{})}
+
+	c, err := New[fileHandlerTestConfig](WithHandler(h), WithFreezePolicy(FreezeReloads))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	events := make(chan Event, 3)
+	c.OnEvent(func(e Event) {
+		events <- e
+	})
+
+	c.Freeze("black friday")
+	assert.Equal(s.T(), EventFrozen, (<-events).Type)
+
+	status := c.Status()
+	assert.True(s.T(), status.Frozen)
+	assert.Equal(s.T(), "black friday", status.FreezeReason)
+	assert.False(s.T(), status.FrozenSince.IsZero())
+
+	err = c.Update(fileHandlerTestConfig{Name: "app", Port: "81"})
+	assert.ErrorIs(s.T(), err, ErrFrozen)
+	assert.ErrorContains(s.T(), err, "black friday")
+
+	h.set(fileHandlerTestConfig{Name: "app", Port: "8080"})
+	h.changes <- struct{}{}
+	h.changes <- struct{}{}
+	assert.Equal(s.T(), "80", c.Config().Port, "config should not be reloaded while frozen")
+
+	c.Unfreeze()
+	assert.Equal(s.T(), EventUnfrozen, (<-events).Type)
+	assert.Equal(s.T(), EventReloaded, (<-events).Type)
+	assert.Equal(s.T(), "8080", c.Config().Port)
+	assert.False(s.T(), c.Status().Frozen)
+
+	require.NoError(s.T(), c.Update(fileHandlerTestConfig{Name: "app", Port: "81"}))
+}
+
+func (s *testSuite) TestDebounceCoalescesWritePatterns() {
+	initial := fileHandlerTestConfig{Name: "app", Port: "80"}
+	final := fileHandlerTestConfig{Name: "app", Port: "8080"}
+
+	patterns := map[string][]func(h *watchHandler){
+		// vim: rename original to backup, write new file, chmod, remove backup
+		"vim": {
+			func(h *watchHandler) { h.fail(os.ErrNotExist) },
+			func(h *watchHandler) { h.fail(errors.New("unexpected end of input")) },
+			func(h *watchHandler) { h.set(final) },
+			func(h *watchHandler) {},
+		},
+		// rsync: write temporary file, rename it over the original
+		"rsync": {
+			func(h *watchHandler) {},
+			func(h *watchHandler) { h.set(final) },
+		},
+		// kubelet: write new data directory, swap ..data symlink, remove old directory
+		"kubelet": {
+			func(h *watchHandler) {},
+			func(h *watchHandler) {},
+			func(h *watchHandler) { h.set(final) },
+			func(h *watchHandler) {},
+		},
+	}
+
+	for name, steps := range patterns {
+		h := &watchHandler{config: initial, changes: make(chan struct{})}
+
+		c, err := New[fileHandlerTestConfig](WithHandler(h), WithDebounce(50*time.Millisecond))
+		require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+		updates := make(chan fileHandlerTestConfig, len(steps))
+		c.AddSubscriber(func(cfg fileHandlerTestConfig) error {
+			updates <- cfg
+			return nil
+		})
+		events := make(chan Event, len(steps))
+		c.OnEvent(func(e Event) {
+			events <- e
+		})
+
+		for _, step := range steps {
+			step(h)
+			h.changes <- struct{}{}
+		}
+
+		assert.Equalf(s.T(), EventReloaded, (<-events).Type, "%s: final state should be reloaded", name)
+		assert.Equalf(s.T(), final, <-updates, name)
+
+		time.Sleep(100 * time.Millisecond)
+		assert.Emptyf(s.T(), events, "%s: burst should cause a single reload", name)
+		assert.Emptyf(s.T(), updates, "%s: burst should cause a single update", name)
+	}
+}
+
+func (s *testSuite) TestFailedReloadKeepsLastGoodConfig() {
+	h := &watchHandler{config: fileHandlerTestConfig{Name: "app", Port: "80"}, changes: make(chan struct{})}
+
+	c, err := New[fileHandlerTestConfig](WithHandler(h), WithReloadRetry(20*time.Millisecond))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	events := make(chan Event, 1)
+	c.OnEvent(func(e Event) {
+		events <- e
+	})
+
+	h.fail(errors.New("syntax error"))
+	h.changes <- struct{}{}
+
+	e := <-events
+	assert.Equal(s.T(), EventReloadFailed, e.Type)
+	assert.ErrorContains(s.T(), e.Err, "syntax error")
+	assert.Equal(s.T(), "80", c.Config().Port, "last good config should be kept")
+	assert.ErrorContains(s.T(), c.Status().LastReloadError, "syntax error")
+
+	// operator fixes the typo, reload is retried without new notification
+	h.set(fileHandlerTestConfig{Name: "app", Port: "8080"})
+
+	for e = <-events; e.Type == EventReloadFailed; e = <-events {
+	}
+	assert.Equal(s.T(), EventReloaded, e.Type)
+	assert.Equal(s.T(), "8080", c.Config().Port)
+	assert.NoError(s.T(), c.Status().LastReloadError)
+	assert.GreaterOrEqual(s.T(), c.Status().ReloadFailures, int64(1))
+}
+
+type flakyHandler struct {
+	stubFileHandler
+	failures int
+	attempts int
+}
+
+func (f *flakyHandler) Load(data any) error {
+	f.attempts++
+	if f.attempts <= f.failures {
+		return errors.New("connection refused")
+	}
+	return json.Unmarshal([]byte(`{"Name":"remote","Port":"9000"}`), data)
+}
+
+func (s *testSuite) TestInitRetries() {
+	h := &flakyHandler{failures: 2}
+
+	c, err := New[fileHandlerTestConfig](WithHandler(h), WithInitRetries(RetryPolicy{Attempts: 3, Delay: time.Millisecond}))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	assert.Equal(s.T(), fileHandlerTestConfig{Name: "remote", Port: "9000"}, c.Config())
+
+	h = &flakyHandler{failures: 3}
+
+	_, err = New[fileHandlerTestConfig](WithHandler(h), WithInitRetries(RetryPolicy{Attempts: 3, Delay: time.Millisecond}))
+	assert.ErrorContains(s.T(), err, "connection refused")
+	assert.Equal(s.T(), 3, h.attempts)
+
+	h = &flakyHandler{failures: 3}
+
+	c, err = New[fileHandlerTestConfig](WithHandler(h), WithInitRetries(RetryPolicy{Attempts: 3, Delay: time.Millisecond, FallbackToDefaults: true}))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	assert.Equal(s.T(), fileHandlerTestConfig{Name: "app", Port: "8080"}, c.Config())
+}
+
+// Handler of the remote source which can be down.
+type downHandler struct {
+	remoteHandler
+	loadErr error
+	release chan struct{}
+	saves   int
+}
+
+func (h *downHandler) Load(data any) error {
+	if h.release != nil {
+		<-h.release
+	}
+	if h.loadErr != nil {
+		return h.loadErr
+	}
+	return h.remoteHandler.Load(data)
+}
+
+func (h *downHandler) Save(data any) error {
+	h.saves++
+	return h.remoteHandler.Save(data)
+}
+
+func (s *testSuite) TestInitFallbackDoesNotOverwriteSource() {
+	remote := `{"Name":"remote","Port":"9000"}`
+
+	h := &downHandler{remoteHandler: remoteHandler{data: remote}, loadErr: errors.New("connection refused")}
+	c, err := New[fileHandlerTestConfig](WithHandler(h), WithInitRetries(RetryPolicy{Attempts: 2, Delay: time.Millisecond, FallbackToDefaults: true}))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	assert.Equal(s.T(), fileHandlerTestConfig{Name: "app", Port: "8080"}, c.Config())
+	assert.Equal(s.T(), 0, h.saves)
+	assert.Equal(s.T(), remote, h.data)
+	report := c.InitReport()
+	assert.True(s.T(), report.Unavailable)
+	assert.False(s.T(), report.Saved)
+
+	// source is synchronized on reload
+	h.loadErr = nil
+	require.NoError(s.T(), c.Reload())
+	assert.Equal(s.T(), fileHandlerTestConfig{Name: "remote", Port: "9000"}, c.Config())
+	assert.Equal(s.T(), 0, h.saves)
+
+	release := make(chan struct{})
+	defer close(release)
+	h = &downHandler{remoteHandler: remoteHandler{data: remote}, release: release}
+	c, err = New[fileHandlerTestConfig](WithHandler(h), WithInitTimeout(20*time.Millisecond))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	assert.Equal(s.T(), fileHandlerTestConfig{Name: "app", Port: "8080"}, c.Config())
+	assert.Equal(s.T(), 0, h.saves)
+	assert.True(s.T(), c.InitReport().Unavailable)
+
+	// defaults are saved when source does not exist yet
+	h = &downHandler{loadErr: fmt.Errorf("failed at read: %w", fs.ErrNotExist)}
+	c, err = New[fileHandlerTestConfig](WithHandler(h))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	assert.Equal(s.T(), 1, h.saves)
+	assert.JSONEq(s.T(), `{"Name":"app","Port":"8080"}`, h.data)
+	assert.False(s.T(), c.InitReport().Unavailable)
+	assert.True(s.T(), c.InitReport().Saved)
+}
+
+func (s *testSuite) TestInitTimeout() {
+	h := &flakyHandler{failures: 1000}
+
+	start := time.Now()
+	_, err := New[fileHandlerTestConfig](WithHandler(h), WithInitTimeout(50*time.Millisecond), WithInitRetries(RetryPolicy{Delay: 10 * time.Millisecond}))
+	assert.ErrorContains(s.T(), err, "init timeout")
+	assert.Less(s.T(), time.Since(start), time.Second)
+}
+
+type snapshotTestConfig struct {
+	Name     string `default:"app"`
+	Password string `secret:"true" env:"TEST_SNAPSHOT_PASSWORD"`
+}
+
+type remoteHandler struct {
+	err  error
+	data string
+}
+
+func (r *remoteHandler) Load(data any) error {
+	if r.err != nil {
+		return r.err
+	}
+	return json.Unmarshal([]byte(r.data), data)
+}
+
+func (r *remoteHandler) Save(data any) error {
+	if r.err != nil {
+		return r.err
+	}
+	b, err := json.Marshal(data)
+	r.data = string(b)
+	return err
+}
+
+func (s *testSuite) TestSnapshotIsUsedWhenSourceIsUnavailable() {
+	snapshot := filepath.Join(testDir, "snapshot.json")
+	defer os.RemoveAll(testDir)
+
+	h := &remoteHandler{data: `{"Name":"remote","Password":"secret"}`}
+
+	_, err := New[snapshotTestConfig](WithHandler(h), WithSnapshot(snapshot), WithoutSnapshotSecrets())
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	info, err := os.Stat(snapshot)
+	require.NoError(s.T(), err, "snapshot should be written")
+	assert.Equal(s.T(), os.FileMode(0600), info.Mode().Perm())
+
+	b, _ := os.ReadFile(snapshot)
+	assert.NotContains(s.T(), string(b), "secret", "secrets should be excluded")
+
+	h.err = errors.New("connection refused")
+	s.T().Setenv("TEST_SNAPSHOT_PASSWORD", "from_env")
+
+	c, err := New[snapshotTestConfig](WithHandler(h), WithSnapshot(snapshot), WithoutSnapshotSecrets())
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	assert.Equal(s.T(), snapshotTestConfig{Name: "remote", Password: "from_env"}, c.Config())
+	assert.True(s.T(), c.Status().FromSnapshot)
+}
+
+type snapshotValidTestConfig struct {
+	Name string `validate:"required"`
+}
+
+func (s *testSuite) TestSnapshotIsNotWrittenOnInvalidReload() {
+	snapshot := filepath.Join(testDir, "snapshot.json")
+	defer os.RemoveAll(testDir)
+
+	h := &remoteHandler{data: `{"Name":"remote"}`}
+	c, err := New[snapshotValidTestConfig](WithHandler(h), WithSnapshot(snapshot))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	h.data = `{"Name":""}`
+	assert.Error(s.T(), c.Reload())
+	b, _ := os.ReadFile(snapshot)
+	assert.Contains(s.T(), string(b), "remote", "invalid config should not be written to the snapshot")
+
+	require.NoError(s.T(), c.RefreshEnv())
+	assert.Equal(s.T(), "remote", c.Config().Name)
+
+	h.data = `{"Name":"edited"}`
+	require.NoError(s.T(), c.Reload())
+	b, _ = os.ReadFile(snapshot)
+	assert.Contains(s.T(), string(b), "edited")
+}
+
+type tenantStore struct {
+	KeyedHandlerFunc
+	keys []string
+}
+
+func (t *tenantStore) Keys(_ context.Context) ([]string, error) {
+	return t.keys, nil
+}
+
+func (s *testSuite) TestManager() {
+	store := &tenantStore{
+		KeyedHandlerFunc: func(key string) (ConfigHandler, error) {
+			return &remoteHandler{data: fmt.Sprintf(`{"Name":%q}`, key)}, nil
+		},
+		keys: []string{"eu-a", "eu-b", "us-a"},
+	}
+
+	m, err := InitMulti[fileHandlerTestConfig](store, []string{"eu-a", "us-a"})
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	c, ok := m.Get("eu-a")
+	require.True(s.T(), ok)
+	assert.Equal(s.T(), "eu-a", c.Config().Name)
+
+	updated := make(chan string, 3)
+	_, err = m.AddCallback("eu-*", func(key string, cfg fileHandlerTestConfig) {
+		updated <- key + ":" + cfg.Port
+	})
+	require.NoError(s.T(), err)
+
+	require.NoError(s.T(), m.Sync(context.Background()))
+	assert.Equal(s.T(), []string{"eu-a", "eu-b", "us-a"}, m.Keys())
+
+	eu, err := m.Match("eu-*")
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), []string{"eu-a", "eu-b"}, eu)
+
+	for _, key := range m.Keys() {
+		c, _ := m.Get(key)
+		require.NoError(s.T(), c.Update(fileHandlerTestConfig{Name: key, Port: "1"}))
+	}
+
+	got := []string{<-updated, <-updated}
+	assert.ElementsMatch(s.T(), []string{"eu-a:1", "eu-b:1"}, got, "callback should be registered for matching instances added later")
+	time.Sleep(10 * time.Millisecond)
+	assert.Empty(s.T(), updated)
+
+	store.keys = []string{"eu-a"}
+	require.NoError(s.T(), m.Sync(context.Background()))
+	assert.Equal(s.T(), []string{"eu-a"}, m.Keys())
+}
+
+// Handler recording context of the watch, it is cancelled when instance is closed.
+type watchedHandler struct {
+	remoteHandler
+	ctx context.Context
+}
+
+func (h *watchedHandler) Watch(ctx context.Context) (<-chan struct{}, error) {
+	h.ctx = ctx
+	return make(chan struct{}), nil
+}
+
+func (s *testSuite) TestManagerClosesInstancesOnInitFailure() {
+	handlers := map[string]*watchedHandler{}
+	store := KeyedHandlerFunc(func(key string) (ConfigHandler, error) {
+		if key == "bad" {
+			return nil, errors.New("no such tenant")
+		}
+		h := &watchedHandler{remoteHandler: remoteHandler{data: fmt.Sprintf(`{"Name":%q}`, key)}}
+		handlers[key] = h
+		return h, nil
+	})
+
+	m, err := InitMulti[fileHandlerTestConfig](store, []string{"eu-a", "eu-b", "bad"})
+	assert.ErrorContains(s.T(), err, "no such tenant")
+	assert.Nil(s.T(), m)
+
+	require.Len(s.T(), handlers, 2)
+	for key, h := range handlers {
+		assert.Error(s.T(), h.ctx.Err(), "instance %s should be closed", key)
+	}
+}
+
+func (s *testSuite) TestManagerAddDoesNotBlock() {
+	release := make(chan struct{})
+	store := KeyedHandlerFunc(func(key string) (ConfigHandler, error) {
+		h := &downHandler{remoteHandler: remoteHandler{data: fmt.Sprintf(`{"Name":%q}`, key)}}
+		if key == "slow" {
+			h.release = release
+		}
+		return h, nil
+	})
+
+	m, err := InitMulti[fileHandlerTestConfig](store, []string{"eu-a"})
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	added := make(chan *C[fileHandlerTestConfig], 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			c, err := m.Add("slow")
+			assert.NoError(s.T(), err)
+			added <- c
+		}()
+	}
+
+	// other keys can be used while the instance is initialized
+	c, ok := m.Get("eu-a")
+	require.True(s.T(), ok)
+	assert.Equal(s.T(), "eu-a", c.Config().Name)
+	_, err = m.Add("eu-b")
+	require.NoError(s.T(), err)
+	_, ok = m.Get("slow")
+	assert.False(s.T(), ok)
+
+	close(release)
+	first, second := <-added, <-added
+	assert.Same(s.T(), first, second, "concurrent calls should return the same instance")
+	assert.Equal(s.T(), []string{"eu-a", "eu-b", "slow"}, m.Keys())
+}
+
+type sectionTestConfig struct {
+	Name     string
+	Database struct {
+		Host string `yaml:"host"`
+		Port int    `yaml:"port"`
+	}
+}
+
+func (s *testSuite) TestSectionFiles() {
+	err := os.Mkdir(testDir, os.ModePerm)
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	main, err := fh.New(fh.WithName(appName), fh.WithPath(testDir), fh.WithType(s.testCase.Type))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	require.NoError(s.T(), main.Save(struct{ Name string }{"app"}))
+
+	err = os.WriteFile(filepath.Join(testDir, "db.yaml"), []byte("host: db.local\nport: 5432\n"), permissions)
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	h, err := fh.New(fh.WithName(appName), fh.WithPath(testDir), fh.WithType(s.testCase.Type), fh.WithSectionFile("Database", "db.yaml"))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	c, err := Init[sectionTestConfig](h)
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	assert.Equal(s.T(), "app", c.Config().Name)
+	assert.Equal(s.T(), "db.local", c.Config().Database.Host)
+	assert.Equal(s.T(), 5432, c.Config().Database.Port)
+
+	cfg := c.Config()
+	cfg.Database.Host = "db.remote"
+	require.NoError(s.T(), c.Update(cfg))
+
+	b, err := os.ReadFile(filepath.Join(testDir, "db.yaml"))
+	require.NoError(s.T(), err)
+	assert.Contains(s.T(), string(b), "db.remote")
+
+	b, err = os.ReadFile(filepath.Join(testDir, fmt.Sprintf(activeConfig, s.testCase.Type)))
+	require.NoError(s.T(), err)
+	assert.NotContains(s.T(), string(b), "db.remote", "section should be split out of the main file")
+	assert.Contains(s.T(), string(b), "app")
+}
+
+type ownerTestConfig struct {
+	Name     string
+	Payments struct {
+		Provider string
+		ApiKey   string `secret:"true"`
+	} `owner:"team-payments"`
+}
+
+func (s *testSuite) TestUpdateAuthorizer() {
+	var got Diff
+	authorizer := func(actor string, d Diff) error {
+		got = d
+		for _, o := range d.Owners() {
+			if o != "" && o != actor {
+				return fmt.Errorf("%s can not change fields owned by %s", actor, o)
+			}
+		}
+		return nil
+	}
+
+	c, err := New[ownerTestConfig](WithHandler(&stubFileHandler{}), WithUpdateAuthorizer(authorizer))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	cfg := c.Config()
+	cfg.Name = "app"
+	cfg.Payments.ApiKey = "key"
+
+	err = c.UpdateAs("team-search", cfg)
+	assert.ErrorContains(s.T(), err, "owned by team-payments")
+	assert.Equal(s.T(), ownerTestConfig{}, c.Config())
+
+	require.Len(s.T(), got, 2)
+	assert.Equal(s.T(), Change{Path: "Name", Old: "", New: "app"}, got[0])
+	assert.Equal(s.T(), Change{Path: "Payments.ApiKey", Old: "", New: "key", Owner: "team-payments", Secret: true}, got[1])
+	assert.NotContains(s.T(), got.String(), "key\n")
+
+	err = c.UpdateAs("team-payments", cfg)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), "key", c.Config().Payments.ApiKey)
+}
+
+type simulateTestConfig struct {
+	Name     string `validate:"required"`
+	Workers  int    `restart:"true"`
+	Database struct {
+		Host string
+	} `immutable:"true"`
+}
+
+type cacheApplier struct {
+	applied int
+}
+
+func (a *cacheApplier) Apply(cfg simulateTestConfig) error {
+	a.applied++
+	return nil
+}
+
+func (a *cacheApplier) CanApply(cfg simulateTestConfig) error {
+	if cfg.Workers > 8 {
+		return fmt.Errorf("too many workers: %d", cfg.Workers)
+	}
+	return nil
+}
+
+func (s *testSuite) TestSimulate() {
+	h := &remoteHandler{data: `{"Name":"app","Workers":2,"Database":{"Host":"db"}}`}
+	c, err := New[simulateTestConfig](WithHandler(h))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	a := &cacheApplier{}
+	c.AddApplier(a)
+	initial := c.Config()
+
+	cfg := c.Config()
+	cfg.Name = ""
+	cfg.Workers = 16
+	cfg.Database.Host = "replica"
+
+	sim, err := c.Simulate(cfg)
+	require.NoError(s.T(), err)
+	assert.False(s.T(), sim.OK())
+	assert.Len(s.T(), sim.Diff, 3)
+	assert.Equal(s.T(), []string{"Workers"}, sim.RestartRequired)
+	assert.Equal(s.T(), []string{"Database.Host"}, sim.Immutable)
+	assert.Error(s.T(), sim.Invalid)
+	require.Len(s.T(), sim.Rejected, 1)
+	assert.ErrorContains(s.T(), sim.Rejected[0], "too many workers")
+
+	assert.Equal(s.T(), initial, c.Config())
+	assert.Equal(s.T(), 0, a.applied)
+
+	cfg = c.Config()
+	cfg.Workers = 4
+	sim, err = c.Simulate(cfg)
+	require.NoError(s.T(), err)
+	assert.True(s.T(), sim.OK())
+	assert.Equal(s.T(), []string{"Workers"}, sim.RestartRequired)
+
+	cfg.Database.Host = "replica"
+	assert.ErrorIs(s.T(), c.Update(cfg), ErrImmutable)
+	assert.Equal(s.T(), initial, c.Config())
+
+	cfg.Database.Host = "db"
+	require.NoError(s.T(), c.Update(cfg))
+	assert.Equal(s.T(), 1, a.applied)
+}
+
+func (s *testSuite) TestSimulateMatchesCheck() {
+	h := &remoteHandler{data: `{"Name":"app","Workers":2,"Database":{"Host":"db"}}`}
+	c, err := New[simulateTestConfig](WithHandler(h), WithUpdateAuthorizer(func(actor string, d Diff) error {
+		for _, ch := range d {
+			if ch.Path == "Name" {
+				return errors.New("name can not be changed")
+			}
+		}
+		return nil
+	}))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	c.AddApplier(&cacheApplier{})
+
+	current := c.Config()
+	configs := map[string]simulateTestConfig{}
+	configs["valid"] = current
+	cfg := current
+	cfg.Workers = 4
+	configs["restart"] = cfg
+	cfg.Name = ""
+	configs["invalid"] = cfg
+	cfg.Name = "api"
+	configs["denied"] = cfg
+	cfg = current
+	cfg.Database.Host = "replica"
+	configs["immutable"] = cfg
+	cfg = current
+	cfg.Workers = 16
+	configs["rejected"] = cfg
+
+	for name, cfg := range configs {
+		sim, err := c.Simulate(cfg)
+		require.NoError(s.T(), err, name)
+		checkErr := c.Check(cfg)
+		assert.Equal(s.T(), sim.OK(), checkErr == nil, "%s: %v", name, checkErr)
+	}
+
+	sim, err := c.Simulate(configs["denied"])
+	require.NoError(s.T(), err)
+	assert.ErrorContains(s.T(), sim.Denied, "name can not be changed")
+	assert.Equal(s.T(), current, c.Config())
+}
+
+func (s *testSuite) TestCheckIsRejectedAsUpdate() {
+	h := &remoteHandler{data: `{"Name":"app","Workers":2,"Database":{"Host":"db"}}`}
+	c, err := New[simulateTestConfig](WithHandler(h))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	cfg := c.Config()
+	cfg.Workers = 4
+
+	c.Freeze("release")
+	assert.ErrorIs(s.T(), c.Check(cfg), ErrFrozen)
+	_, err = c.Simulate(cfg)
+	assert.ErrorIs(s.T(), err, ErrFrozen)
+	c.Unfreeze()
+	assert.NoError(s.T(), c.Check(cfg))
+
+	ro, err := New[simulateTestConfig](WithHandler(h), ReadOnly())
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	assert.ErrorIs(s.T(), ro.Check(cfg), ErrReadOnly)
+	_, err = ro.Simulate(cfg)
+	assert.ErrorIs(s.T(), err, ErrReadOnly)
+
+	mem, err := New[simulateTestConfig](WithHandler(h), ReadOnlyInMemory())
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	assert.NoError(s.T(), mem.Check(cfg))
+}
+
+func (s *testSuite) TestCheck() {
+	h := &remoteHandler{data: `{"Name":"app","Workers":2,"Database":{"Host":"db"}}`}
+	c, err := New[simulateTestConfig](WithHandler(h))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	a := &cacheApplier{}
+	c.AddApplier(a)
+	initial := c.Config()
+	rev := c.Revision()
+
+	cfg := c.Config()
+	cfg.Workers = 4
+	assert.NoError(s.T(), c.Check(cfg))
+
+	cfg.Workers = 16
+	err = c.Check(cfg)
+	assert.ErrorIs(s.T(), err, ErrCannotApply)
+	assert.ErrorContains(s.T(), err, "too many workers")
+
+	cfg.Workers = 4
+	cfg.Name = ""
+	assert.ErrorContains(s.T(), c.Check(cfg), "failed at validate config")
+
+	cfg.Name = "app"
+	cfg.Database.Host = "replica"
+	assert.ErrorIs(s.T(), c.Check(cfg), ErrImmutable)
+
+	assert.Equal(s.T(), initial, c.Config())
+	assert.Equal(s.T(), rev, c.Revision())
+	assert.Equal(s.T(), 0, a.applied)
+
+	require.NoError(s.T(), c.Close())
+	assert.ErrorIs(s.T(), c.Check(initial), ErrClosed)
+}
+
+func (s *testSuite) TestShadowMode() {
+	h := &remoteHandler{data: `{"Name":"app","Workers":2,"Database":{"Host":"db"}}`}
+	c, err := New[simulateTestConfig](WithHandler(h), WithShadowMode())
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	a := &cacheApplier{}
+	c.AddApplier(a)
+	initial := c.Config()
+	saved := h.data
+
+	events := []Event{}
+	c.OnEvent(func(e Event) {
+		events = append(events, e)
+	})
+
+	cfg := c.Config()
+	cfg.Workers = 4
+	require.NoError(s.T(), c.UpdateWithMeta(cfg, Meta{"reason": "soak"}))
+
+	cfg.Workers = 16
+	assert.ErrorContains(s.T(), c.Update(cfg), "too many workers")
+
+	cfg.Workers = 4
+	cfg.Database.Host = "replica"
+	assert.ErrorIs(s.T(), c.Update(cfg), ErrImmutable)
+
+	// nothing is applied or saved
+	assert.Equal(s.T(), initial, c.Config())
+	assert.Equal(s.T(), saved, h.data)
+	assert.Equal(s.T(), 0, a.applied)
+
+	require.Len(s.T(), events, 3)
+	assert.Equal(s.T(), EventShadowUpdate, events[0].Type)
+	assert.NoError(s.T(), events[0].Err)
+	assert.Equal(s.T(), []string{"Workers"}, events[0].Fields)
+	assert.Equal(s.T(), 4, events[0].Diff[0].New)
+	assert.Equal(s.T(), Meta{"reason": "soak"}, events[0].Meta)
+	assert.ErrorContains(s.T(), events[1].Err, "too many workers")
+	assert.ErrorIs(s.T(), events[2].Err, ErrImmutable)
+
+	status := c.Status()
+	assert.Equal(s.T(), int64(3), status.ShadowUpdates)
+	assert.Equal(s.T(), int64(2), status.ShadowRejected)
+}
+
+func (s *testSuite) TestCandidate() {
+	h := &remoteHandler{data: `{"Name":"app","Workers":2,"Database":{"Host":"db"}}`}
+	c, err := New[simulateTestConfig](WithHandler(h))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	a := &cacheApplier{}
+	c.AddApplier(a)
+	current := c.Config()
+
+	checks := 0
+	c.OnBeforeUpdate(func(old, new simulateTestConfig) (simulateTestConfig, error) {
+		checks++
+		return new, nil
+	})
+
+	assert.ErrorIs(s.T(), c.Promote(), ErrNoCandidate)
+
+	cfg := c.Config()
+	cfg.Database.Host = "replica"
+	assert.ErrorIs(s.T(), c.SetCandidate(cfg, 0.5), ErrImmutable)
+	assert.Error(s.T(), c.SetCandidate(current, 2))
+
+	cfg = c.Config()
+	cfg.Workers = 4
+	require.NoError(s.T(), c.SetCandidate(cfg, 0.3))
+	candidate, ok := c.Candidate()
+	require.True(s.T(), ok)
+	assert.Equal(s.T(), cfg, candidate)
+	assert.Equal(s.T(), current, c.Config())
+	assert.Equal(s.T(), 0, a.applied)
+
+	selected := map[string]bool{}
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		got, isCandidate := c.Select(key)
+		if isCandidate {
+			assert.Equal(s.T(), cfg, got)
+			selected[key] = true
+		} else {
+			assert.Equal(s.T(), current, got)
+		}
+	}
+	assert.InDelta(s.T(), 300, len(selected), 60)
+
+	// keys keep selecting candidate when weight grows
+	require.NoError(s.T(), c.SetCandidate(cfg, 0.6))
+	for key := range selected {
+		_, isCandidate := c.Select(key)
+		assert.True(s.T(), isCandidate)
+	}
+
+	// candidate is applied as checked, hooks are not run again
+	checks = 0
+	require.NoError(s.T(), c.Promote())
+	assert.Equal(s.T(), cfg, c.Config())
+	assert.Equal(s.T(), 1, a.applied)
+	assert.Equal(s.T(), 0, checks)
+	_, ok = c.Candidate()
+	assert.False(s.T(), ok)
+	_, isCandidate := c.Select("0")
+	assert.False(s.T(), isCandidate)
+
+	// candidate checked against config which has changed since is not promoted
+	cfg.Workers = 8
+	require.NoError(s.T(), c.SetCandidate(cfg, 0.5))
+	next := c.Config()
+	next.Workers = 6
+	require.NoError(s.T(), c.Update(next))
+	assert.ErrorContains(s.T(), c.Promote(), "config has changed since candidate was set")
+	assert.Equal(s.T(), next, c.Config())
+	_, ok = c.Candidate()
+	assert.True(s.T(), ok)
+}
+
+type boundsTestConfig struct {
+	Cache struct {
+		Size int `maxDelta:"50%"`
+	}
+	Timeout float64 `maxDelta:"10"`
+	Version uint    `monotonic:"increase"`
+}
+
+func (s *testSuite) TestSafeChanges() {
+	h := &remoteHandler{data: `{"Cache":{"Size":10000},"Timeout":30,"Version":3}`}
+	c, err := New[boundsTestConfig](WithHandler(h))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	initial := c.Config()
+
+	for _, update := range []func(cfg *boundsTestConfig){
+		func(cfg *boundsTestConfig) { cfg.Cache.Size = 10 },
+		func(cfg *boundsTestConfig) { cfg.Cache.Size = 15001 },
+		func(cfg *boundsTestConfig) { cfg.Timeout = 40.5 },
+		func(cfg *boundsTestConfig) { cfg.Version = 2 },
+	} {
+		cfg := c.Config()
+		update(&cfg)
+		assert.ErrorIs(s.T(), c.Update(cfg), ErrUnsafeChange)
+		assert.Equal(s.T(), initial, c.Config())
+
+		sim, err := c.Simulate(cfg)
+		require.NoError(s.T(), err)
+		assert.ErrorIs(s.T(), sim.Invalid, ErrUnsafeChange)
+	}
+
+	cfg := boundsTestConfig{Timeout: 20, Version: 4}
+	cfg.Cache.Size = 5000
+	require.NoError(s.T(), c.Update(cfg))
+	assert.Equal(s.T(), cfg, c.Config())
+}
+
+func (s *testSuite) TestUpdatePolicy() {
+	var got PolicyInput
+	policy := PolicyFunc(func(ctx context.Context, in PolicyInput) (Decision, error) {
+		got = in
+		if in.New["Name"] == "broken" {
+			return Decision{}, errors.New("policy error")
+		}
+		if err := ctx.Err(); err != nil {
+			return Decision{}, err
+		}
+		return Decision{Allow: in.Actor == "admin", Reason: "only admin can update"}, nil
+	})
+
+	c, err := New[snapshotTestConfig](WithHandler(&stubFileHandler{}), WithUpdatePolicy(policy))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	err = c.UpdateAs("dev", snapshotTestConfig{Name: "new", Password: "s3cr3t"})
+	assert.ErrorIs(s.T(), err, ErrPolicyDenied)
+	assert.ErrorContains(s.T(), err, "only admin can update")
+	assert.Equal(s.T(), "app", c.Config().Name)
+
+	assert.Equal(s.T(), PolicyInput{
+		Actor: "dev",
+		Old:   map[string]any{"Name": "app"},
+		New:   map[string]any{"Name": "new"},
+	}, got)
+
+	require.NoError(s.T(), c.UpdateAs("admin", snapshotTestConfig{Name: "new", Password: "s3cr3t"}))
+	assert.Equal(s.T(), "new", c.Config().Name)
+
+	err = c.UpdateAs("admin", snapshotTestConfig{Name: "broken"})
+	assert.ErrorContains(s.T(), err, "policy error")
+	assert.Equal(s.T(), "new", c.Config().Name)
+
+	// policy is evaluated with context of the update
+	ctx, cancel := context.WithCancel(context.Background())
+	c.OnBeforeUpdate(func(old, new snapshotTestConfig) (snapshotTestConfig, error) {
+		cancel()
+		return new, nil
+	})
+	err = c.UpdateCtx(ctx, snapshotTestConfig{Name: "newer"})
+	assert.ErrorIs(s.T(), err, context.Canceled)
+	assert.Equal(s.T(), "new", c.Config().Name)
+}
+
+func (s *testSuite) TestFieldEncryption() {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	h := &remoteHandler{data: `{"Name":"remote"}`}
+
+	c, err := New[snapshotTestConfig](WithHandler(h), WithFieldEncryption(StaticKey(key)))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	err = c.Update(snapshotTestConfig{Name: "remote", Password: "s3cr3t"})
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), "s3cr3t", c.Config().Password)
+	assert.Contains(s.T(), h.data, `"Password":"enc:v1:default:`)
+	assert.NotContains(s.T(), h.data, "s3cr3t")
+	assert.Contains(s.T(), h.data, `"Name":"remote"`)
+
+	c, err = New[snapshotTestConfig](WithHandler(h), WithFieldEncryption(StaticKey(key)))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	assert.Equal(s.T(), snapshotTestConfig{Name: "remote", Password: "s3cr3t"}, c.Config())
+
+	_, err = New[snapshotTestConfig](WithHandler(h), WithFieldEncryption(StaticKey([]byte("fedcba9876543210fedcba9876543210"))))
+	assert.ErrorIs(s.T(), err, ErrDecryption)
+	assert.ErrorContains(s.T(), err, "Password")
+}
+
+func (s *testSuite) TestSecretAges() {
+	ages := filepath.Join(testDir, "secrets.json")
+	defer os.RemoveAll(testDir)
+
+	h := &remoteHandler{data: `{"Name":"remote"}`}
+
+	c, err := New[snapshotTestConfig](WithHandler(h), WithSecretAges(ages))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	assert.Empty(s.T(), c.StaleSecrets(0))
+
+	err = c.Update(snapshotTestConfig{Name: "remote", Password: "s3cr3t"})
+	require.NoError(s.T(), err)
+
+	stale := c.StaleSecrets(0)
+	require.Len(s.T(), stale, 1)
+	assert.Equal(s.T(), "Password", stale[0].Path)
+	assert.Empty(s.T(), c.StaleSecrets(time.Hour))
+
+	b, err := os.ReadFile(ages)
+	require.NoError(s.T(), err)
+	assert.NotContains(s.T(), string(b), "s3cr3t")
+
+	// secret has not been changed since the last run
+	meta := map[string]secretMeta{}
+	require.NoError(s.T(), json.Unmarshal(b, &meta))
+	m := meta["Password"]
+	m.Changed = time.Now().Add(-48 * time.Hour)
+	meta["Password"] = m
+	require.NoError(s.T(), writeFileAtomic(ages, meta))
+
+	events := make(chan Event, 10)
+	c, err = New[snapshotTestConfig](WithHandler(h), WithSecretAges(ages), WithSecretRotationCheck(24*time.Hour, 10*time.Millisecond))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	defer c.stop()
+	c.OnEvent(func(e Event) { events <- e })
+
+	select {
+	case e := <-events:
+		assert.Equal(s.T(), EventSecretsStale, e.Type)
+		assert.Equal(s.T(), []string{"Password"}, e.Fields)
+	case <-time.After(time.Second):
+		s.T().Fatal("stale secrets event not received")
+	}
+
+	// rotated secret is not stale anymore
+	err = c.Update(snapshotTestConfig{Name: "remote", Password: "rotated"})
+	require.NoError(s.T(), err)
+	assert.Empty(s.T(), c.StaleSecrets(24*time.Hour))
+}
+
+type fleetStore struct {
+	states map[string]*remoteHandler
+}
+
+func (f *fleetStore) Handler(key string) (ConfigHandler, error) {
+	if _, ok := f.states[key]; !ok {
+		f.states[key] = &remoteHandler{}
+	}
+	return f.states[key], nil
+}
+
+func (f *fleetStore) Keys(_ context.Context) ([]string, error) {
+	keys := []string{}
+	for k := range f.states {
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+func (s *testSuite) TestFleetDrift() {
+	store := &fleetStore{states: map[string]*remoteHandler{}}
+	h := &remoteHandler{data: `{"Name":"app","Password":"secret"}`}
+
+	a, err := New[snapshotTestConfig](WithHandler(h), WithFleet(NewFleet(store, "a")))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	b, err := New[snapshotTestConfig](WithHandler(h), WithFleet(NewFleet(store, "b")))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	drift, err := a.Drift(context.Background())
+	require.NoError(s.T(), err)
+	assert.Empty(s.T(), drift)
+
+	err = a.Update(snapshotTestConfig{Name: "changed", Password: "secret"})
+	require.NoError(s.T(), err)
+
+	drift, err = a.Drift(context.Background())
+	require.NoError(s.T(), err)
+	require.Len(s.T(), drift, 1)
+	assert.Equal(s.T(), "b", drift[0].Instance)
+	assert.Equal(s.T(), b.Checksum(), drift[0].Checksum)
+	assert.NotContains(s.T(), store.states["b"].data, "secret")
+
+	require.NoError(s.T(), b.Reload())
+
+	drift, err = NewFleet(store, "collector").Drift(context.Background(), a.Checksum())
+	require.NoError(s.T(), err)
+	assert.Empty(s.T(), drift)
+}
+
+type leaseStore struct {
+	lock sync.Mutex
+	remoteHandler
+}
+
+func (l *leaseStore) Load(data any) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.data == "" {
+		return errors.New("not found")
+	}
+	return l.remoteHandler.Load(data)
+}
+
+func (l *leaseStore) Save(data any) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.remoteHandler.Save(data)
+}
+
+func (s *testSuite) TestLeaderLease() {
+	store := &leaseStore{}
+	h := &remoteHandler{data: `{"Name":"app"}`}
+
+	a, err := New[snapshotTestConfig](WithHandler(h), WithLeaderLease(NewLease(store, "a", 100*time.Millisecond), 0))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	assert.True(s.T(), a.IsLeader())
+
+	b, err := New[snapshotTestConfig](WithHandler(h), WithLeaderLease(NewLease(store, "b", time.Hour), 10*time.Millisecond))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	defer b.stop()
+	assert.False(s.T(), b.IsLeader())
+
+	elected := make(chan Event, 1)
+	b.OnEvent(func(e Event) {
+		if e.Type == EventLeaderElected {
+			elected <- e
+		}
+	})
+
+	err = b.Update(snapshotTestConfig{Name: "follower"})
+	assert.ErrorIs(s.T(), err, ErrNotLeader)
+	assert.ErrorIs(s.T(), b.Check(snapshotTestConfig{Name: "follower"}), ErrNotLeader)
+
+	require.NoError(s.T(), a.Update(snapshotTestConfig{Name: "leader"}))
+	require.NoError(s.T(), b.Reload())
+	assert.Equal(s.T(), "leader", b.Config().Name)
+
+	// leader does not renew the lease, follower takes over after it expires
+	select {
+	case <-elected:
+	case <-time.After(time.Second):
+		s.T().Fatal("leader has not been elected")
+	}
+
+	assert.True(s.T(), b.IsLeader())
+	require.NoError(s.T(), b.Update(snapshotTestConfig{Name: "new leader"}))
+	assert.Contains(s.T(), h.data, "new leader")
+}
+
+func (s *testSuite) TestReadOnly() {
+	h := &watchHandler{config: fileHandlerTestConfig{Name: "app", Port: "80"}, changes: make(chan struct{})}
+	h.returnValue = errors.New("source must not be written")
+
+	c, err := New[fileHandlerTestConfig](WithHandler(h), ReadOnly())
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	defer c.stop()
+
+	err = c.Update(fileHandlerTestConfig{Name: "app", Port: "81"})
+	assert.ErrorIs(s.T(), err, ErrReadOnly)
+
+	updated := make(chan fileHandlerTestConfig, 1)
+	c.AddSubscriber(func(cfg fileHandlerTestConfig) error {
+		updated <- cfg
+		return nil
+	})
+
+	h.set(fileHandlerTestConfig{Name: "app", Port: "82"})
+	h.changes <- struct{}{}
+
+	select {
+	case cfg := <-updated:
+		assert.Equal(s.T(), "82", cfg.Port)
+	case <-time.After(time.Second):
+		s.T().Fatal("read-only instance has not been reloaded")
+	}
+
+	m, err := New[fileHandlerTestConfig](WithHandler(h), ReadOnlyInMemory(), WithoutWatch())
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	err = m.Update(fileHandlerTestConfig{Name: "app", Port: "83"})
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), "83", m.Config().Port)
+}
+
+func (s *testSuite) TestAwaitApplied() {
+	c, err := New[fileHandlerTestConfig](WithHandler(&stubFileHandler{}))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	assert.Equal(s.T(), uint64(1), c.Revision())
+
+	release := make(chan struct{})
+	c.AddCallback(func(_ fileHandlerTestConfig) {
+		<-release
+	})
+
+	require.NoError(s.T(), c.Update(fileHandlerTestConfig{Name: "app", Port: "81"}))
+	rev := c.Revision()
+	assert.Equal(s.T(), uint64(2), rev)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(s.T(), c.AwaitApplied(ctx, rev), context.DeadlineExceeded)
+	assert.NoError(s.T(), c.AwaitApplied(context.Background(), rev-1))
+
+	close(release)
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(s.T(), c.AwaitApplied(ctx, rev))
+
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(s.T(), c.AwaitApplied(ctx, rev+1), context.DeadlineExceeded)
+}
+
+func (s *testSuite) TestCallbackDelivery() {
+	for _, tc := range []struct {
+		mode     Delivery
+		expected []uint64
+	}{
+		{DeliverLatest, []uint64{2, 5}},
+		{DeliverAll, []uint64{2, 3, 4, 5}},
+	} {
+		c, err := New[fileHandlerTestConfig](WithHandler(&stubFileHandler{}), WithCallbackDelivery(tc.mode))
+		require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+		lock := sync.Mutex{}
+		got := []uint64{}
+		release := make(chan struct{})
+
+		c.AddRevisionCallback(func(rev uint64, cfg fileHandlerTestConfig) {
+			assert.Equal(s.T(), strconv.Itoa(int(rev)), cfg.Port)
+			if rev == 2 {
+				<-release
+			}
+			lock.Lock()
+			got = append(got, rev)
+			lock.Unlock()
+		})
+
+		for i := 2; i <= 5; i++ {
+			require.NoError(s.T(), c.Update(fileHandlerTestConfig{Name: "app", Port: strconv.Itoa(i)}))
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		assert.ErrorIs(s.T(), c.AwaitApplied(ctx, 3), context.DeadlineExceeded)
+		cancel()
+
+		close(release)
+
+		ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+		assert.NoError(s.T(), c.AwaitApplied(ctx, 5))
+		cancel()
+
+		lock.Lock()
+		assert.Equal(s.T(), tc.expected, got)
+		lock.Unlock()
+	}
+}
+
+func (s *testSuite) TestValidateOnly() {
+	require.NoError(s.T(), os.Mkdir(testDir, os.ModePerm))
+
+	write := func(data string) ConfigHandler {
+		err := os.WriteFile(filepath.Join(testDir, fmt.Sprintf(defaultConfig, s.testCase.Type)), []byte(data), permissions)
+		require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+		h, err := fh.New(fh.WithName(appName), fh.WithPath(testDir), fh.WithType(s.testCase.Type), fh.WithReadOnly())
+		require.NoErrorf(s.T(), err, testSetupErrorMsg)
+		return h
+	}
+
+	assert.NoError(s.T(), ValidateOnly[testConfig](WithHandler(write(s.testCase.TestString))))
+	assert.NoFileExists(s.T(), filepath.Join(testDir, fmt.Sprintf(activeConfig, s.testCase.Type)))
+
+	err := ValidateOnly[testConfig](WithHandler(write(s.testCase.TestStringWithoutVersion)))
+	assert.ErrorContains(s.T(), err, "failed at validate config")
+
+	err = ValidateOnly[testConfig](WithHandler(write("{{ not a config")))
+	assert.ErrorContains(s.T(), err, "failed at load config")
+	assert.NoFileExists(s.T(), filepath.Join(testDir, fmt.Sprintf(activeConfig, s.testCase.Type)))
+
+	// options are applied the same way as on init
+	s.T().Setenv("APP_VERSION", "7")
+	assert.NoError(s.T(), ValidateOnly[testConfig](WithHandler(write(s.testCase.TestStringWithoutVersion)), WithEnvPrefix("APP")))
+
+	err = ValidateOnly[testConfig](WithHandler(write(s.testCase.TestString)), WithValidator(func(config any) error {
+		return fmt.Errorf("version %d is not supported", config.(*testConfig).Version)
+	}))
+	assert.ErrorContains(s.T(), err, "version 123 is not supported")
+
+	err = ValidateOnly[testConfig](WithHandler(write(s.testCase.TestString)), WithLimits(Limits{MaxSize: 10}))
+	assert.ErrorIs(s.T(), err, ErrLimitExceeded)
+}
+
+func (s *testSuite) TestValidateOnlyEncryption() {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	h := &remoteHandler{data: `{"Name":"remote"}`}
+
+	c, err := New[validateOnlyTestConfig](WithHandler(h), WithFieldEncryption(StaticKey(key)))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	require.NoError(s.T(), c.Update(validateOnlyTestConfig{Name: "remote", Password: "s3cr3t"}))
+	stored := h.data
+
+	// encrypted value does not pass validation unless it is decrypted
+	assert.ErrorContains(s.T(), ValidateOnly[validateOnlyTestConfig](WithHandler(h)), "failed at validate config")
+	assert.NoError(s.T(), ValidateOnly[validateOnlyTestConfig](WithHandler(h), WithFieldEncryption(StaticKey(key))))
+
+	err = ValidateOnly[validateOnlyTestConfig](WithHandler(h), WithFieldEncryption(StaticKey([]byte("fedcba9876543210fedcba9876543210"))))
+	assert.ErrorIs(s.T(), err, ErrDecryption)
+	assert.Equal(s.T(), stored, h.data)
+}
+
+type validateOnlyTestConfig struct {
+	Name     string
+	Password string `secret:"true" validate:"omitempty,max=16"`
+}
+
+type fakeTimer struct {
+	at time.Time
+	ch chan time.Time
+}
+
+type fakeClock struct {
+	lock   sync.Mutex
+	now    time.Time
+	timers []fakeTimer
+}
+
+func (f *fakeClock) Now() time.Time {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return f.now
+}
+
+func (f *fakeClock) After(d time.Duration) <-chan time.Time {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	ch := make(chan time.Time, 1)
+	f.timers = append(f.timers, fakeTimer{at: f.now.Add(d), ch: ch})
+	return ch
+}
+
+func (f *fakeClock) Advance(d time.Duration) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.now = f.now.Add(d)
+
+	pending := f.timers[:0]
+	for _, t := range f.timers {
+		if t.at.After(f.now) {
+			pending = append(pending, t)
+			continue
+		}
+		t.ch <- f.now
+	}
+	f.timers = pending
+}
+
+func (s *testSuite) TestClock() {
+	clock := &fakeClock{now: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)}
+	h := &watchHandler{config: fileHandlerTestConfig{Name: "app", Port: "80"}, changes: make(chan struct{})}
+
+	c, err := New[fileHandlerTestConfig](WithHandler(h), WithClock(clock), WithDebounce(time.Minute))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	defer c.stop()
+	assert.Equal(s.T(), strconv.FormatInt(clock.now.Unix(), 10), c.GetTimestamp())
+
+	updated := make(chan fileHandlerTestConfig, 1)
+	c.AddSubscriber(func(cfg fileHandlerTestConfig) error {
+		updated <- cfg
+		return nil
+	})
+
+	h.set(fileHandlerTestConfig{Name: "app", Port: "81"})
+	h.changes <- struct{}{}
+
+	select {
+	case <-updated:
+		s.T().Fatal("change has been applied before debounce period passed")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	require.Eventually(s.T(), func() bool {
+		clock.Advance(time.Minute)
+		select {
+		case cfg := <-updated:
+			return cfg.Port == "81"
+		default:
+			return false
+		}
+	}, time.Second, time.Millisecond)
+}
+
+func (s *testSuite) TestReloadJitter() {
+	clock := &fakeClock{now: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)}
+	h := &watchHandler{config: fileHandlerTestConfig{Name: "app", Port: "80"}, changes: make(chan struct{})}
+
+	c, err := New[fileHandlerTestConfig](WithHandler(h), WithClock(clock), WithReloadJitter(time.Minute))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	defer c.stop()
+
+	h.set(fileHandlerTestConfig{Name: "app", Port: "81"})
+	h.changes <- struct{}{}
+	h.changes <- struct{}{}
+
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(s.T(), "80", c.Config().Port)
+
+	clock.lock.Lock()
+	require.Len(s.T(), clock.timers, 1)
+	assert.False(s.T(), clock.timers[0].at.After(clock.now.Add(time.Minute)))
+	clock.lock.Unlock()
+
+	clock.Advance(time.Minute)
+	require.Eventually(s.T(), func() bool {
+		return c.Config().Port == "81"
+	}, time.Second, time.Millisecond)
+}
+
+func (s *testSuite) TestUpdateReports() {
+	clock := &fakeClock{now: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	c, err := New[fileHandlerTestConfig](WithHandler(&stubFileHandler{}), WithClock(clock), WithUpdateReports(2))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	defer c.stop()
+
+	_, ok := c.LastUpdateReport()
+	assert.False(s.T(), ok)
+
+	reported := []UpdateReport{}
+	c.OnUpdateReport(func(r UpdateReport) {
+		reported = append(reported, r)
+	})
+
+	fast := c.AddSubscriber(func(cfg fileHandlerTestConfig) error {
+		clock.Advance(time.Second)
+		return nil
+	})
+	slow := c.AddSubscriber(func(cfg fileHandlerTestConfig) error {
+		clock.Advance(30 * time.Second)
+		if cfg.Port == "0" {
+			return errors.New("invalid port")
+		}
+		return nil
+	})
+
+	for _, port := range []string{"81", "82", "0"} {
+		c.Update(fileHandlerTestConfig{Name: "app", Port: port})
+	}
+
+	require.Len(s.T(), reported, 3)
+	reports := c.UpdateReports()
+	assert.Equal(s.T(), reported[1:], reports)
+
+	r, ok := c.LastUpdateReport()
+	require.True(s.T(), ok)
+	assert.Equal(s.T(), reports[1], r)
+	assert.Equal(s.T(), uint64(0), r.Revision)
+	assert.ErrorContains(s.T(), r.Err, "invalid port")
+
+	r = reports[0]
+	assert.Equal(s.T(), uint64(3), r.Revision)
+	assert.Equal(s.T(), 31*time.Second, r.Duration)
+	require.Len(s.T(), r.Subscribers, 2)
+	assert.Equal(s.T(), fast, r.Subscribers[0].Id)
+	assert.Equal(s.T(), time.Second, r.Subscribers[0].Duration)
+	assert.Equal(s.T(), slow, r.Subscribers[1].Id)
+	assert.Equal(s.T(), 30*time.Second, r.Subscribers[1].Duration)
+	assert.Contains(s.T(), r.Subscribers[1].Name, "TestUpdateReports")
+}
+
+func (s *testSuite) TestUpdateMeta() {
+	c, err := New[fileHandlerTestConfig](WithHandler(&stubFileHandler{}))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	defer c.stop()
+
+	events := []Event{}
+	c.OnEvent(func(e Event) {
+		events = append(events, e)
+	})
+
+	var received Meta
+	c.AddSubscriber(func(cfg fileHandlerTestConfig) error {
+		received = c.ChangeMeta()
+		return nil
+	})
+
+	meta := Meta{"reason": "incident-1234"}
+	require.NoError(s.T(), c.UpdateWithMeta(fileHandlerTestConfig{Name: "app", Port: "81"}, meta))
+	assert.Equal(s.T(), meta, received)
+	assert.Nil(s.T(), c.ChangeMeta())
+
+	r, ok := c.LastUpdateReport()
+	require.True(s.T(), ok)
+	assert.Equal(s.T(), meta, r.Meta)
+
+	require.Len(s.T(), events, 1)
+	assert.Equal(s.T(), EventUpdated, events[0].Type)
+	assert.Equal(s.T(), []string{"Port"}, events[0].Fields)
+	assert.Equal(s.T(), meta, events[0].Meta)
+
+	require.NoError(s.T(), c.Update(fileHandlerTestConfig{Name: "app", Port: "82"}))
+	assert.Nil(s.T(), received)
+	require.Len(s.T(), events, 2)
+	assert.Nil(s.T(), events[1].Meta)
+}
+
+func (s *testSuite) TestProfilerLabels() {
+	c, err := New[fileHandlerTestConfig](WithHandler(&stubFileHandler{}))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	profile := func() string {
+		b := bytes.Buffer{}
+		pprof.Lookup("goroutine").WriteTo(&b, 1)
+		return b.String()
+	}
+
+	var subscriber string
+	c.AddSubscriber(func(cfg fileHandlerTestConfig) error {
+		subscriber = profile()
+		return nil
+	})
+
+	callback := make(chan string, 1)
+	c.AddCallback(func(cfg fileHandlerTestConfig) {
+		callback <- profile()
+	})
+
+	require.NoError(s.T(), c.Update(fileHandlerTestConfig{Name: "app", Port: "81"}))
+
+	assert.Regexp(s.T(), `"cog_revision":"2", "cog_subscriber":"[^"]*TestProfilerLabels[^"]*"`, subscriber)
+	assert.Regexp(s.T(), `"cog_callback":"[^"]*TestProfilerLabels[^"]*", "cog_revision":"2"`, <-callback)
+}
+
+type limitsTestConfig struct {
+	Name  string
+	Hosts []string
+	Rules map[string]struct {
+		Match []string
+	}
+}
+
+func (s *testSuite) TestLimits() {
+	limits := WithLimits(Limits{MaxSize: 100, MaxDepth: 3, MaxSliceLen: 2})
+
+	_, err := New[limitsTestConfig](WithHandler(&remoteHandler{data: `{"Hosts":["a","b","c"]}`}), limits)
+	assert.ErrorIs(s.T(), err, ErrLimitExceeded)
+	assert.ErrorContains(s.T(), err, "Hosts has 3 elements, max 2")
+
+	h := &remoteHandler{data: `{"Name":"app","Hosts":["a","b"]}`}
+	c, err := New[limitsTestConfig](WithHandler(h), limits)
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	cfg := c.Config()
+	cfg.Name = strings.Repeat("x", 100)
+	err = c.Update(cfg)
+	assert.ErrorIs(s.T(), err, ErrLimitExceeded)
+	assert.ErrorContains(s.T(), err, "max 100")
+
+	cfg = c.Config()
+	cfg.Rules = map[string]struct{ Match []string }{"r": {Match: []string{"x"}}}
+	err = c.Update(cfg)
+	assert.ErrorIs(s.T(), err, ErrLimitExceeded)
+	assert.ErrorContains(s.T(), err, "Rules.r.Match is nested deeper than 3")
+
+	assert.Equal(s.T(), "app", c.Config().Name)
+	assert.Contains(s.T(), h.data, `"Name":"app"`)
+}
+
+func (s *testSuite) TestCompressedCodec() {
+	codec := fh.NewCodec(s.testCase.Type)
+	compressed := fh.Compressed(codec, fh.Gzip)
+	data := fileHandlerTestConfig{Name: strings.Repeat("app", 100), Port: "80"}
+
+	b, err := compressed.Marshal(data)
+	require.NoError(s.T(), err)
+	assert.True(s.T(), bytes.HasPrefix(b, fh.Gzip.Magic()))
+
+	plain, err := codec.Marshal(data)
+	require.NoError(s.T(), err)
+	assert.Less(s.T(), len(b), len(plain))
+
+	for _, stored := range [][]byte{b, plain} {
+		var got fileHandlerTestConfig
+		require.NoError(s.T(), compressed.Unmarshal(stored, &got))
+		assert.Equal(s.T(), data, got)
+	}
+
+	var got fileHandlerTestConfig
+	assert.ErrorContains(s.T(), compressed.Unmarshal(fh.Gzip.Magic(), &got), "failed at decompress")
+}
+
+type memoryKV struct {
+	lock    sync.Mutex
+	entries map[string]nh.Entry
+}
+
+func (kv *memoryKV) Get(ctx context.Context, key string) (nh.Entry, error) {
+	kv.lock.Lock()
+	defer kv.lock.Unlock()
+
+	e, ok := kv.entries[key]
+	if !ok {
+		return nh.Entry{}, nh.ErrNotFound
+	}
+	return e, nil
+}
+
+func (kv *memoryKV) Create(ctx context.Context, key string, value []byte) (uint64, error) {
+	return kv.Update(ctx, key, value, 0)
+}
+
+func (kv *memoryKV) Update(ctx context.Context, key string, value []byte, last uint64) (uint64, error) {
+	kv.lock.Lock()
+	defer kv.lock.Unlock()
+
+	if kv.entries[key].Revision != last {
+		return 0, nh.ErrWrongRevision
+	}
+	if len(value) > 128 {
+		return 0, errors.New("value is too large")
+	}
+
+	kv.entries[key] = nh.Entry{Value: value, Revision: last + 1}
+	return last + 1, nil
+}
+
+func (kv *memoryKV) Watch(ctx context.Context, key string) (<-chan nh.Entry, error) {
+	return make(chan nh.Entry), nil
+}
+
+func (s *testSuite) TestChunking() {
+	kv := &memoryKV{entries: map[string]nh.Entry{}}
+	h, err := nh.New(kv, nh.WithType(s.testCase.Type), nh.WithChunking(64))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	c, err := Init[fileHandlerTestConfig](h)
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	data := fileHandlerTestConfig{Name: strings.Repeat("app", 50), Port: "80"}
+	require.NoError(s.T(), c.Update(data))
+
+	kv.lock.Lock()
+	_, ok := fh.ParseManifest(kv.entries["app"].Value)
+	assert.True(s.T(), ok)
+	assert.Contains(s.T(), kv.entries, "app.chunk.2")
+	kv.lock.Unlock()
+
+	loaded, err := Init[fileHandlerTestConfig](h)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), data, loaded.Config())
+
+	// small value is stored in place of the manifest
+	require.NoError(s.T(), c.Update(fileHandlerTestConfig{Name: "app", Port: "80"}))
+	require.NoError(s.T(), loaded.Reload())
+	assert.Equal(s.T(), "app", loaded.Config().Name)
+}
+
+// Mimics protobuf-generated struct.
+type protoTestConfig struct {
+	state    int
+	MaxConns int32  `protobuf:"varint,1,opt,name=max_conns,json=maxConns,proto3" json:"max_conns,omitempty" default:"10"`
+	Port     *int32 `protobuf:"varint,2,opt,name=port,def=8080" json:"port,omitempty"`
+}
+
+func (c *protoTestConfig) ProtoReflect() any {
+	return c
+}
+
+func (c *protoTestConfig) Validate() error {
+	if c.MaxConns < 0 {
+		return errors.New("max_conns must not be negative")
+	}
+	return nil
+}
+
+// Mimics protojson, which uses JSON names of the fields.
+type protoJSON struct {
+	MaxConns int32  `json:"maxConns"`
+	Port     *int32 `json:"port,omitempty"`
+}
+
+func (s *testSuite) TestProtoConfig() {
+	require.NoError(s.T(), os.Mkdir(testDir, os.ModePerm))
+	err := os.WriteFile(filepath.Join(testDir, appName+".json"), []byte(`{"maxConns":0}`), permissions)
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	codec := fh.NewProtoCodec("json",
+		func(m any) ([]byte, error) {
+			c := m.(*protoTestConfig)
+			return json.Marshal(protoJSON{MaxConns: c.MaxConns, Port: c.Port})
+		},
+		func(b []byte, m any) error {
+			p := protoJSON{}
+			err := json.Unmarshal(b, &p)
+			*m.(*protoTestConfig) = protoTestConfig{state: 1, MaxConns: p.MaxConns, Port: p.Port}
+			return err
+		})
+
+	h, err := fh.New(fh.WithCodec(codec), fh.WithName(appName), fh.WithPath(testDir))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	validated := 0
+	c, err := New[protoTestConfig](WithHandler(h), WithValidator(func(config any) error {
+		validated++
+		return nil
+	}))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	assert.Equal(s.T(), 1, validated)
+
+	cfg := c.Config()
+	assert.Equal(s.T(), int32(0), cfg.MaxConns)
+	require.NotNil(s.T(), cfg.Port)
+	assert.Equal(s.T(), int32(8080), *cfg.Port)
+	assert.Equal(s.T(), 1, cfg.state)
+
+	b, err := os.ReadFile(filepath.Join(testDir, appName+".json"))
+	require.NoError(s.T(), err)
+	assert.JSONEq(s.T(), `{"maxConns":0,"port":8080}`, string(b))
+
+	cfg.MaxConns = -1
+	assert.ErrorContains(s.T(), c.Update(cfg), "max_conns must not be negative")
+	assert.Equal(s.T(), 1, validated)
+}
+
+// Requires Name and fills in default Port, like CUE schema `{Name: string, Port: string | *"9090"}`.
+type testSchema struct{}
+
+func (testSchema) Validate(doc []byte, t fh.FileType) ([]byte, error) {
+	codec := fh.NewCodec(t)
+
+	m := map[string]any{}
+	if err := codec.Unmarshal(doc, &m); err != nil {
+		return nil, err
+	}
+	if _, ok := m[schemaKey("Name", t)]; !ok {
+		return nil, errors.New("Name: incomplete value string")
+	}
+	if _, ok := m[schemaKey("Port", t)]; !ok {
+		m[schemaKey("Port", t)] = "9090"
+	}
+
+	return codec.Marshal(m)
+}
+
+// yaml.v3 matches lowercased field names.
+func schemaKey(k string, t fh.FileType) string {
+	if t == fh.YAML {
+		return strings.ToLower(k)
+	}
+	return k
+}
+
+func (s *testSuite) TestSchema() {
+	require.NoError(s.T(), os.Mkdir(testDir, os.ModePerm))
+	codec := fh.NewCodec(s.testCase.Type)
+	file := filepath.Join(testDir, appName+"."+codec.GetExtension())
+
+	write := func(data any) {
+		b, err := codec.Marshal(data)
+		require.NoError(s.T(), err)
+		require.NoError(s.T(), os.WriteFile(file, b, permissions))
+	}
+
+	h, err := fh.New(fh.WithName(appName), fh.WithPath(testDir), fh.WithType(s.testCase.Type), fh.WithSchema(testSchema{}))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	write(map[string]any{schemaKey("Name", s.testCase.Type): "schema"})
+	c, err := New[fileHandlerTestConfig](WithHandler(h))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	assert.Equal(s.T(), fileHandlerTestConfig{Name: "schema", Port: "9090"}, c.Config())
+
+	write(map[string]any{schemaKey("Port", s.testCase.Type): "80"})
+	err = c.Reload()
+	assert.ErrorContains(s.T(), err, "Name: incomplete value")
+	assert.Equal(s.T(), "schema", c.Config().Name)
+}
 
-	assert.Equal(s.T(), strExpected, str)
+func (s *testSuite) TestInventory() {
+	require.NoError(s.T(), os.Mkdir(testDir, os.ModePerm))
+	other := fh.JSON
+	if s.testCase.Type == fh.JSON {
+		other = fh.TOML
+	}
 
-	str, err = c.String()
-	require.NoErrorf(s.T(), err, "string method should not return error")
+	// files left after switching from the other type
+	for _, name := range []string{appName + "." + string(other), appName + ".default." + string(other), appName + ".yml"} {
+		require.NoError(s.T(), os.WriteFile(filepath.Join(testDir, name), []byte{}, permissions))
+	}
 
-	strExpected = `{
-  "Name": "config_test",
-  "Version": 123,
-  "IsPrefork": true
-}`
+	opts := []fh.Option{fh.WithName(appName), fh.WithPath(testDir), fh.WithType(s.testCase.Type)}
 
-	assert.Equal(s.T(), strExpected, str)
+	// active file of the type in use does not exist yet, so the old one is not superseded
+	artifacts, err := fh.Inventory(opts...)
+	require.NoError(s.T(), err)
+	require.Len(s.T(), artifacts, 3)
+	for _, a := range artifacts {
+		assert.False(s.T(), a.InUse)
+		assert.False(s.T(), a.Superseded, a.File)
+	}
+
+	h, err := fh.New(opts...)
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	c, err := New[fileHandlerTestConfig](WithHandler(h))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	require.NoError(s.T(), c.Update(fileHandlerTestConfig{Name: "app", Port: "80"}))
+
+	removed, err := fh.Cleanup(opts...)
+	require.NoError(s.T(), err)
+	files := []string{}
+	for _, a := range removed {
+		files = append(files, filepath.Base(a.File))
+	}
+	assert.ElementsMatch(s.T(), []string{appName + "." + string(other), appName + ".yml"}, files)
+
+	artifacts, err = fh.Inventory(opts...)
+	require.NoError(s.T(), err)
+	for _, a := range artifacts {
+		assert.False(s.T(), a.Superseded, a.File)
+	}
+	assert.FileExists(s.T(), filepath.Join(testDir, appName+".default."+string(other)))
+
+	// dynamic type is ambiguous with default files of several types
+	require.NoError(s.T(), os.WriteFile(filepath.Join(testDir, appName+".default."+string(s.testCase.Type)), []byte{}, permissions))
+	_, err = fh.Cleanup(fh.WithName(appName), fh.WithPath(testDir))
+	assert.ErrorIs(s.T(), err, fh.ErrAmbiguousType)
+}
+
+func (s *testSuite) TestTemplate() {
+	require.NoError(s.T(), os.Mkdir(testDir, os.ModePerm))
+	s.T().Setenv("COG_TEST_HOST", "node-1")
+
+	codec := fh.NewCodec(s.testCase.Type)
+	b, err := codec.Marshal(map[string]any{
+		schemaKey("Name", s.testCase.Type): "{{ .Data.service }}.{{ upper .Env.COG_TEST_HOST }}",
+		schemaKey("Port", s.testCase.Type): "{{ if .Env.COG_TEST_TLS }}443{{ else }}80{{ end }}",
+	})
+	require.NoError(s.T(), err)
+	require.NoError(s.T(), os.WriteFile(filepath.Join(testDir, appName+"."+codec.GetExtension()), b, permissions))
+
+	h, err := fh.New(fh.WithName(appName), fh.WithPath(testDir), fh.WithType(s.testCase.Type), fh.WithReadOnly(),
+		fh.WithTemplate(map[string]any{"service": "api"}, template.FuncMap{"upper": strings.ToUpper}))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	c, err := New[fileHandlerTestConfig](WithHandler(h), ReadOnlyInMemory())
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	assert.Equal(s.T(), fileHandlerTestConfig{Name: "api.NODE-1", Port: "80"}, c.Config())
+
+	s.T().Setenv("COG_TEST_TLS", "1")
+	require.NoError(s.T(), c.Reload())
+	assert.Equal(s.T(), "443", c.Config().Port)
+}
+
+func (s *testSuite) TestTemplateIsNotSaved() {
+	require.NoError(s.T(), os.Mkdir(testDir, os.ModePerm))
+	s.T().Setenv("COG_TEST_SECRET", "s3cret")
+
+	codec := fh.NewCodec(s.testCase.Type)
+	b, err := codec.Marshal(map[string]any{
+		schemaKey("Name", s.testCase.Type): "{{ .Env.COG_TEST_SECRET }}",
+		schemaKey("Port", s.testCase.Type): "80",
+	})
+	require.NoError(s.T(), err)
+	file := filepath.Join(testDir, appName+"."+codec.GetExtension())
+	require.NoError(s.T(), os.WriteFile(file, b, permissions))
+
+	// handler is writable, but rendered template is not saved on init
+	h, err := fh.New(fh.WithName(appName), fh.WithPath(testDir), fh.WithType(s.testCase.Type),
+		fh.WithTemplate(nil, nil))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	assert.True(s.T(), h.ReadOnly())
+	assert.ErrorContains(s.T(), h.Save(fileHandlerTestConfig{}), "can not be saved")
+
+	c, err := New[fileHandlerTestConfig](WithHandler(h))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	assert.Equal(s.T(), fileHandlerTestConfig{Name: "s3cret", Port: "80"}, c.Config())
+	assert.False(s.T(), c.InitReport().Saved)
+
+	assert.ErrorIs(s.T(), c.Update(fileHandlerTestConfig{Name: "other", Port: "80"}), ErrReadOnly)
+
+	// updates are applied in memory only
+	c, err = New[fileHandlerTestConfig](WithHandler(h), ReadOnlyInMemory())
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	require.NoError(s.T(), c.Update(fileHandlerTestConfig{Name: "other", Port: "80"}))
+
+	stored, err := os.ReadFile(file)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), b, stored)
+}
+
+func (s *testSuite) TestPreprocessor() {
+	require.NoError(s.T(), os.Mkdir(testDir, os.ModePerm))
+	codec := fh.NewCodec(s.testCase.Type)
+	file := filepath.Join(testDir, appName+"."+codec.GetExtension())
+
+	b, err := codec.Marshal(map[string]any{schemaKey("Name", s.testCase.Type): "{{ .Data.name }}"})
+	require.NoError(s.T(), err)
+	require.NoError(s.T(), os.WriteFile(file, []byte(base64.StdEncoding.EncodeToString(b)), permissions))
+
+	order := []string{}
+	h, err := fh.New(fh.WithName(appName), fh.WithPath(testDir), fh.WithType(s.testCase.Type),
+		fh.WithReversiblePreprocessor(
+			func(b []byte) ([]byte, error) {
+				order = append(order, "decode")
+				return base64.StdEncoding.DecodeString(string(b))
+			},
+			func(b []byte) ([]byte, error) {
+				return []byte(base64.StdEncoding.EncodeToString(b)), nil
+			}),
+		fh.WithPreprocessor(func(b []byte) ([]byte, error) {
+			return bytes.ReplaceAll(b, []byte("{{ .Data.name }}"), []byte("templated")), nil
+		}),
+		fh.WithPreprocessor(func(b []byte) ([]byte, error) {
+			order = append(order, "shim")
+			return b, nil
+		}))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	c, err := New[fileHandlerTestConfig](WithHandler(h))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	assert.Equal(s.T(), "templated", c.Config().Name)
+	assert.Equal(s.T(), []string{"decode", "shim"}, order[:2])
+
+	// inverse transforms are applied on save
+	require.NoError(s.T(), c.Update(fileHandlerTestConfig{Name: "updated", Port: "1"}))
+	raw, err := os.ReadFile(file)
+	require.NoError(s.T(), err)
+	decoded, err := base64.StdEncoding.DecodeString(string(raw))
+	require.NoError(s.T(), err)
+	assert.Contains(s.T(), string(decoded), "updated")
+
+	require.NoError(s.T(), c.Reload())
+	assert.Equal(s.T(), fileHandlerTestConfig{Name: "updated", Port: "1"}, c.Config())
+}
+
+type derivedTestConfig struct {
+	Host string `default:"localhost"`
+	Port string `default:"8080"`
+	Addr string `derived:"true"`
+}
+
+func (c *derivedTestConfig) ComputeDerived() {
+	c.Addr = c.Host + ":" + c.Port
+}
+
+func (s *testSuite) TestDerivedFields() {
+	require.NoError(s.T(), os.Mkdir(testDir, os.ModePerm))
+	h, err := fh.New(fh.WithName(appName), fh.WithPath(testDir), fh.WithType(s.testCase.Type))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	c, err := New[derivedTestConfig](WithHandler(h))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	assert.Equal(s.T(), "localhost:8080", c.Config().Addr)
+
+	require.NoError(s.T(), c.Update(derivedTestConfig{Host: "example.com", Port: "443", Addr: "ignored"}))
+	assert.Equal(s.T(), "example.com:443", c.Config().Addr)
+
+	// derived fields are not persisted
+	b, err := os.ReadFile(filepath.Join(testDir, appName+"."+string(s.testCase.Type)))
+	require.NoError(s.T(), err)
+	assert.Contains(s.T(), string(b), "example.com")
+	assert.NotContains(s.T(), string(b), "example.com:443")
+
+	require.NoError(s.T(), c.Reload())
+	assert.Equal(s.T(), "example.com:443", c.Config().Addr)
+}
+
+type envPrefixTestConfig struct {
+	Name   string `env:"COG_TEST_NAME" validate:"required"`
+	Server struct {
+		MaxConns int `default:"10"`
+		APIKey   string
+		Hosts    []string
+		Internal string `env:"-"`
+	}
+}
+
+func (s *testSuite) TestEnvPrefix() {
+	require.NoError(s.T(), os.Mkdir(testDir, os.ModePerm))
+	s.T().Setenv("COG_TEST_NAME", "env")
+	s.T().Setenv("APP_SERVER_MAX_CONNS", "42")
+	s.T().Setenv("APP_SERVER_API_KEY", "key")
+	s.T().Setenv("APP_SERVER_INTERNAL", "ignored")
+
+	h, err := fh.New(fh.WithName(appName), fh.WithPath(testDir), fh.WithType(s.testCase.Type))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	c, err := New[envPrefixTestConfig](WithHandler(h), WithEnvPrefix("APP"))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	assert.Equal(s.T(), "env", c.Config().Name)
+	assert.Equal(s.T(), 42, c.Config().Server.MaxConns)
+	assert.Equal(s.T(), "key", c.Config().Server.APIKey)
+	assert.Equal(s.T(), "", c.Config().Server.Internal)
+
+	s.T().Setenv("APP_SERVER_MAX_CONNS", "many")
+	_, err = New[envPrefixTestConfig](WithHandler(h), WithEnvPrefix("APP"), WithEnvPrecedence(EnvOverridesFile), ReadOnlyInMemory())
+	assert.ErrorContains(s.T(), err, "APP_SERVER_MAX_CONNS")
+}
+
+func (s *testSuite) TestEnvDocs() {
+	assert.Equal(s.T(), []EnvVar{
+		{Name: "COG_TEST_NAME", Field: "Name", Type: "string", Required: true},
+		{Name: "APP_SERVER_MAX_CONNS", Field: "Server.MaxConns", Type: "int", Default: "10"},
+		{Name: "APP_SERVER_API_KEY", Field: "Server.APIKey", Type: "string"},
+	}, EnvVars[envPrefixTestConfig](WithEnvPrefix("APP")))
+
+	assert.Len(s.T(), EnvVars[envPrefixTestConfig](), 1)
+
+	b := bytes.Buffer{}
+	require.NoError(s.T(), WriteEnvDocs[envPrefixTestConfig](&b, EnvDocMarkdown, WithEnvPrefix("APP")))
+	assert.Contains(s.T(), b.String(), "| `APP_SERVER_MAX_CONNS` | `Server.MaxConns` | `int` | `10` | no |")
+
+	b.Reset()
+	require.NoError(s.T(), WriteEnvDocs[envPrefixTestConfig](&b, EnvDocJSON, WithEnvPrefix("APP")))
+	vars := []EnvVar{}
+	require.NoError(s.T(), json.Unmarshal(b.Bytes(), &vars))
+	assert.Len(s.T(), vars, 3)
+
+	b.Reset()
+	require.NoError(s.T(), WriteEnvDocs[envPrefixTestConfig](&b, EnvDocText))
+	assert.Contains(s.T(), b.String(), "COG_TEST_NAME")
+}
+
+func (s *testSuite) TestHelm() {
+	b := bytes.Buffer{}
+	require.NoError(s.T(), WriteHelmValues[envPrefixTestConfig](&b, "config"))
+
+	// values are decoded by YAML file handler the same way
+	values := map[string]envPrefixTestConfig{}
+	require.NoError(s.T(), fh.NewCodec(fh.YAML).Unmarshal(b.Bytes(), &values))
+	expected := envPrefixTestConfig{}
+	expected.Server.MaxConns = 10
+	expected.Server.Hosts = []string{}
+	assert.Equal(s.T(), expected, values["config"])
+
+	b.Reset()
+	require.NoError(s.T(), WriteHelmConfigMap(&b, "config", "app.yaml", "app.fullname"))
+	assert.Contains(s.T(), b.String(), "  app.yaml: |\n{{ toYaml .Values.config | indent 4 }}")
+	assert.Contains(s.T(), b.String(), `{{ include "app.fullname" . }}`)
+}
+
+type refreshEnvTestConfig struct {
+	Name  string
+	Level string `env:"COG_TEST_LEVEL" default:"info"`
+}
+
+func (s *testSuite) TestRefreshEnv() {
+	require.NoError(s.T(), os.Mkdir(testDir, os.ModePerm))
+	envFile := filepath.Join(testDir, "app.env")
+	require.NoError(s.T(), os.WriteFile(envFile, []byte("COG_TEST_LEVEL=debug\n"), permissions))
+
+	h, err := fh.New(fh.WithName(appName), fh.WithPath(testDir), fh.WithType(s.testCase.Type))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	c, err := New[refreshEnvTestConfig](WithHandler(h), WithEnvFile(envFile), WithEnvPrecedence(EnvOverridesFile))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	require.NoError(s.T(), c.Update(refreshEnvTestConfig{Name: "updated", Level: "debug"}))
+	assert.Equal(s.T(), "debug", c.Config().Level)
+
+	changes := []string{}
+	c.AddSubscriber(func(c refreshEnvTestConfig) error {
+		changes = append(changes, c.Level)
+		return nil
+	})
+
+	// source is not loaded again
+	codec := fh.NewCodec(s.testCase.Type)
+	b, err := codec.Marshal(map[string]any{schemaKey("Name", s.testCase.Type): "external"})
+	require.NoError(s.T(), err)
+	require.NoError(s.T(), os.WriteFile(filepath.Join(testDir, appName+"."+codec.GetExtension()), b, permissions))
+
+	require.NoError(s.T(), os.WriteFile(envFile, []byte("COG_TEST_LEVEL=warn\n"), permissions))
+	require.NoError(s.T(), c.RefreshEnv())
+	assert.Equal(s.T(), refreshEnvTestConfig{Name: "updated", Level: "warn"}, c.Config())
+	assert.Equal(s.T(), []string{"warn"}, changes)
+
+	// nothing changed
+	require.NoError(s.T(), c.RefreshEnv())
+	assert.Len(s.T(), changes, 1)
+
+	s.T().Setenv("COG_TEST_LEVEL", "error")
+	require.NoError(s.T(), c.Reload())
+	assert.Equal(s.T(), refreshEnvTestConfig{Name: "external", Level: "error"}, c.Config())
+}
+
+type metadataTestConfig struct {
+	Node     string
+	Instance string
+	Port     string `default:"8080"`
+}
+
+func (s *testSuite) TestMetadataPlaceholders() {
+	require.NoError(s.T(), os.Mkdir(testDir, os.ModePerm))
+	s.T().Setenv("NODE_NAME", "node-1")
+
+	imds := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/latest/api/token":
+			w.Write([]byte("token"))
+		case r.Header.Get("X-aws-ec2-metadata-token") != "token":
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/latest/meta-data/instance-id":
+			w.Write([]byte("i-123"))
+		default:
+			w.Write([]byte("value"))
+		}
+	}))
+	defer imds.Close()
+
+	codec := fh.NewCodec(s.testCase.Type)
+	file := filepath.Join(testDir, appName+"."+codec.GetExtension())
+	b, err := codec.Marshal(map[string]any{
+		schemaKey("Node", s.testCase.Type):     "${meta.node_name}.${meta.zone}",
+		schemaKey("Instance", s.testCase.Type): "${meta.instance_id}",
+	})
+	require.NoError(s.T(), err)
+	require.NoError(s.T(), os.WriteFile(file, b, permissions))
+
+	h, err := fh.New(fh.WithName(appName), fh.WithPath(testDir), fh.WithType(s.testCase.Type))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	zone := MetadataFunc(func(context.Context) (map[string]string, error) {
+		return map[string]string{"zone": "eu-1a"}, nil
+	})
+	c, err := New[metadataTestConfig](WithHandler(h), WithMetadata(zone, metadata.AWS(metadata.WithEndpoint(imds.URL))))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	assert.Equal(s.T(), metadataTestConfig{Node: "node-1.eu-1a", Instance: "i-123", Port: "8080"}, c.Config())
+
+	// placeholders are kept on save unless resolved value is changed
+	cfg := c.Config()
+	cfg.Port = "9090"
+	cfg.Instance = "i-456"
+	require.NoError(s.T(), c.Update(cfg))
+
+	b, err = os.ReadFile(file)
+	require.NoError(s.T(), err)
+	assert.Contains(s.T(), string(b), "${meta.node_name}.${meta.zone}")
+	assert.NotContains(s.T(), string(b), "${meta.instance_id}")
+
+	require.NoError(s.T(), c.Reload())
+	assert.Equal(s.T(), metadataTestConfig{Node: "node-1.eu-1a", Instance: "i-456", Port: "9090"}, c.Config())
+
+	cfg.Node = "${meta.unknown}"
+	assert.ErrorContains(s.T(), c.Update(cfg), "unknown instance metadata: unknown")
+}
+
+func (s *testSuite) TestMetadataRetry() {
+	calls := 0
+	provider := MetadataFunc(func(context.Context) (map[string]string, error) {
+		calls++
+		if calls == 1 {
+			return nil, errors.New("metadata service is unavailable")
+		}
+		return map[string]string{"zone": "eu-1a"}, nil
+	})
+
+	c, err := New[metadataTestConfig](WithHandler(&remoteHandler{data: `{"Node":"node"}`}), WithMetadata(provider))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	// failure is not cached
+	err = c.Update(metadataTestConfig{Node: "${meta.zone}"})
+	assert.ErrorContains(s.T(), err, "metadata service is unavailable")
+
+	require.NoError(s.T(), c.Update(metadataTestConfig{Node: "${meta.zone}"}))
+	assert.Equal(s.T(), "eu-1a", c.Config().Node)
+
+	// successful fetch is cached
+	require.NoError(s.T(), c.Update(metadataTestConfig{Node: "${meta.zone}", Instance: "i-1"}))
+	assert.Equal(s.T(), 2, calls)
+}
+
+type resourceTestConfig struct {
+	CacheSize Resource `default:"25%mem"`
+	Workers   Resource `default:"2x cpu"`
+	Buffer    Resource
+}
+
+func (s *testSuite) TestResources() {
+	require.NoError(s.T(), os.Mkdir(testDir, os.ModePerm))
+	defer func(f func() resources) { systemResources = f }(systemResources)
+	systemResources = func() resources {
+		return resources{cpu: 1.5, memory: 8 << 30}
+	}
+
+	codec := fh.NewCodec(s.testCase.Type)
+	file := filepath.Join(testDir, appName+"."+codec.GetExtension())
+	b, err := codec.Marshal(map[string]any{schemaKey("Buffer", s.testCase.Type): "64MiB"})
+	require.NoError(s.T(), err)
+	require.NoError(s.T(), os.WriteFile(file, b, permissions))
+
+	h, err := fh.New(fh.WithName(appName), fh.WithPath(testDir), fh.WithType(s.testCase.Type))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	c, err := New[resourceTestConfig](WithHandler(h))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	assert.Equal(s.T(), "25%mem", c.Config().CacheSize.Expr())
+	assert.Equal(s.T(), int64(2<<30), c.Config().CacheSize.Value())
+	assert.Equal(s.T(), 3, c.Config().Workers.Int())
+	assert.Equal(s.T(), int64(64<<20), c.Config().Buffer.Value())
+
+	// expressions are kept on save
+	cfg := c.Config()
+	cfg.Workers, err = ParseResource("50%cpu")
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), 1, cfg.Workers.Int())
+	require.NoError(s.T(), c.Update(cfg))
+
+	b, err = os.ReadFile(file)
+	require.NoError(s.T(), err)
+	assert.Contains(s.T(), string(b), "50%cpu")
+	assert.Contains(s.T(), string(b), "25%mem")
+
+	_, err = ParseResource("25%disk")
+	assert.ErrorContains(s.T(), err, "bad resource expression")
+
+	// cgroup v2 limits are applied when they are lower than host resources
+	root := s.T().TempDir()
+	require.NoError(s.T(), os.WriteFile(filepath.Join(root, "cpu.max"), []byte("50000 100000\n"), permissions))
+	require.NoError(s.T(), os.WriteFile(filepath.Join(root, "memory.max"), []byte("1073741824\n"), permissions))
+	require.NoError(s.T(), os.WriteFile(filepath.Join(root, "meminfo"), []byte("MemTotal:       16303792 kB\n"), permissions))
+	assert.Equal(s.T(), resources{cpu: 0.5, memory: 1 << 30}, detectResources(root, filepath.Join(root, "meminfo")))
+
+	require.NoError(s.T(), os.WriteFile(filepath.Join(root, "cpu.max"), []byte("max 100000\n"), permissions))
+	require.NoError(s.T(), os.WriteFile(filepath.Join(root, "memory.max"), []byte("max\n"), permissions))
+	assert.Equal(s.T(), int64(16303792<<10), detectResources(root, filepath.Join(root, "meminfo")).memory)
+}
+
+// Evaluates "name <suffix>; port <env var>; var <ext var>; load <module>" scripts, module content is appended to the name.
+func testEvaluator(t fh.FileType) sh.Evaluator {
+	return sh.EvaluatorFunc(func(_ string, src []byte, in sh.Inputs) ([]byte, error) {
+		cfg := fileHandlerTestConfig{}
+		for _, stmt := range strings.Split(string(src), ";") {
+			k, v, _ := strings.Cut(strings.TrimSpace(stmt), " ")
+			switch k {
+			case "name":
+				cfg.Name = in.Profile + v
+			case "port":
+				cfg.Port = in.Env[v]
+			case "var":
+				cfg.Port = in.Vars[v]
+			case "load":
+				b, err := in.Load(v)
+				if err != nil {
+					return nil, err
+				}
+				cfg.Name += string(b)
+			}
+		}
+		return fh.NewCodec(t).Marshal(cfg)
+	})
+}
+
+func (s *testSuite) TestScriptConfig() {
+	require.NoError(s.T(), os.Mkdir(testDir, os.ModePerm))
+	s.T().Setenv("COG_TEST_PORT", "8443")
+	s.T().Setenv("COG_TEST_SECRET", "hidden")
+
+	script := filepath.Join(testDir, appName+".star")
+	require.NoError(s.T(), os.WriteFile(script, []byte("name -api; port COG_TEST_PORT"), permissions))
+
+	h, err := sh.New(testEvaluator(s.testCase.Type),
+		sh.WithPath(testDir), sh.WithName(appName), sh.WithType(s.testCase.Type),
+		sh.WithEnv("COG_TEST_PORT"), sh.WithProfile("prod"))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	c, err := New[fileHandlerTestConfig](WithHandler(h), ReadOnlyInMemory())
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	assert.Equal(s.T(), fileHandlerTestConfig{Name: "prod-api", Port: "8443"}, c.Config())
+
+	// only allowed variables are available
+	require.NoError(s.T(), os.WriteFile(script, []byte("name -api; port COG_TEST_SECRET"), permissions))
+	require.NoError(s.T(), c.Reload())
+	assert.Equal(s.T(), fileHandlerTestConfig{Name: "prod-api", Port: ""}, c.Config())
+
+	// modules are loaded from the script directory only
+	require.NoError(s.T(), os.WriteFile(filepath.Join(testDir, "lib.star"), []byte(""), permissions))
+	require.NoError(s.T(), os.WriteFile(script, []byte("name -lib; load lib.star"), permissions))
+	require.NoError(s.T(), c.Reload())
+	assert.Equal(s.T(), "prod-lib", c.Config().Name)
+
+	require.NoError(s.T(), os.WriteFile(script, []byte("name -escape; load ../go.mod"), permissions))
+	err = c.Reload()
+	assert.ErrorContains(s.T(), err, sh.ErrForbiddenLoad.Error())
+	assert.Equal(s.T(), "prod-lib", c.Config().Name)
+}
+
+func (s *testSuite) TestJsonnetConfig() {
+	libDir := filepath.Join(testDir, "lib")
+	require.NoError(s.T(), os.MkdirAll(libDir, os.ModePerm))
+	require.NoError(s.T(), os.WriteFile(filepath.Join(libDir, "net.libsonnet"), []byte("-net"), permissions))
+	require.NoError(s.T(), os.WriteFile(filepath.Join(testDir, appName+".jsonnet"), []byte("name -api; var port; load net.libsonnet"), permissions))
+
+	h, err := sh.NewJsonnet(testEvaluator(s.testCase.Type),
+		sh.WithPath(testDir), sh.WithName(appName), sh.WithType(s.testCase.Type),
+		sh.WithImportPaths(libDir), sh.WithVar("port", "9000"))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	c, err := New[fileHandlerTestConfig](WithHandler(h), ReadOnlyInMemory())
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	assert.Equal(s.T(), fileHandlerTestConfig{Name: "-api-net", Port: "9000"}, c.Config())
+
+	// module in the script directory takes precedence over import paths
+	require.NoError(s.T(), os.WriteFile(filepath.Join(testDir, "net.libsonnet"), []byte("-local"), permissions))
+	require.NoError(s.T(), c.Reload())
+	assert.Equal(s.T(), "-api-local", c.Config().Name)
+}
+
+func (s *testSuite) TestScriptWatcher() {
+	require.NoError(s.T(), os.Mkdir(testDir, os.ModePerm))
+	require.NoError(s.T(), os.WriteFile(filepath.Join(testDir, "lib.star"), []byte("-lib"), permissions))
+	require.NoError(s.T(), os.WriteFile(filepath.Join(testDir, appName+".star"), []byte("name api; load lib.star"), permissions))
+
+	h, err := sh.New(testEvaluator(s.testCase.Type), sh.WithPath(testDir), sh.WithName(appName), sh.WithType(s.testCase.Type))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	c, err := New[fileHandlerTestConfig](WithHandler(h), ReadOnlyInMemory(), WithWatcher())
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	defer c.stop()
+	assert.Equal(s.T(), "api-lib", c.Config().Name)
+
+	updated := make(chan fileHandlerTestConfig, 10)
+	c.AddCallback(func(cfg fileHandlerTestConfig) { updated <- cfg })
+
+	// imported module is watched together with the script
+	require.NoError(s.T(), os.WriteFile(filepath.Join(testDir, "lib.star"), []byte("-edited"), permissions))
+
+	timeout := time.After(5 * time.Second)
+	for cfg := c.Config(); cfg.Name != "api-edited"; {
+		select {
+		case cfg = <-updated:
+		case <-timeout:
+			s.T().Fatal("module change has not been reloaded")
+		}
+	}
+}
+
+type rampTestConfig struct {
+	Name  string
+	Limit int `ramp:"10s"`
+}
+
+func (s *testSuite) TestRamp() {
+	clock := &fakeClock{now: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)}
+	h := &remoteHandler{data: `{"Name":"app","Limit":100}`}
+
+	c, err := New[rampTestConfig](WithHandler(h), WithClock(clock), WithRampInterval(5*time.Second))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	defer c.stop()
+
+	limits := make(chan int, 10)
+	c.AddSubscriber(func(cfg rampTestConfig) error {
+		limits <- cfg.Limit
+		return nil
+	})
+
+	step := func() int {
+		require.Eventually(s.T(), func() bool {
+			clock.lock.Lock()
+			defer clock.lock.Unlock()
+			return len(clock.timers) > 0
+		}, time.Second, time.Millisecond)
+		clock.Advance(5 * time.Second)
+
+		select {
+		case l := <-limits:
+			return l
+		case <-time.After(time.Second):
+			s.T().Fatal("ramp step has not been delivered")
+			return 0
+		}
+	}
+
+	require.NoError(s.T(), c.Update(rampTestConfig{Name: "app", Limit: 200}))
+	assert.Equal(s.T(), 100, <-limits)
+	assert.Equal(s.T(), 200, c.Config().Limit)
+	assert.Contains(s.T(), h.data, `"Limit":200`)
+
+	assert.Equal(s.T(), 150, step())
+
+	// new target continues from the delivered value
+	require.NoError(s.T(), c.Update(rampTestConfig{Name: "app", Limit: 50}))
+	assert.Equal(s.T(), 150, <-limits)
+	assert.Equal(s.T(), 100, step())
+	assert.Equal(s.T(), 50, step())
+
+	clock.Advance(time.Minute)
+	select {
+	case l := <-limits:
+		s.T().Fatalf("unexpected delivery after ramp has finished: %d", l)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func (s *testSuite) TestRampRollback() {
+	clock := &fakeClock{now: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)}
+	h := &remoteHandler{data: `{"Name":"app","Limit":100}`}
+
+	c, err := New[rampTestConfig](WithHandler(h), WithClock(clock), WithRampInterval(2*time.Second))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	defer c.stop()
+
+	delivered := make(chan rampTestConfig, 10)
+	c.AddSubscriber(func(cfg rampTestConfig) error {
+		delivered <- cfg
+		return nil
+	})
+	c.AddSubscriber(func(cfg rampTestConfig) error {
+		if cfg.Name == "rejected" || cfg.Limit == 140 {
+			return fmt.Errorf("limit %d is rejected", cfg.Limit)
+		}
+		return nil
+	})
+
+	failed := make(chan Event, 1)
+	c.OnEvent(func(e Event) {
+		if e.Type == EventRampFailed {
+			failed <- e
+		}
+	})
+
+	step := func() {
+		require.Eventually(s.T(), func() bool {
+			clock.lock.Lock()
+			defer clock.lock.Unlock()
+			return len(clock.timers) > 0
+		}, time.Second, time.Millisecond)
+		clock.Advance(2 * time.Second)
+	}
+
+	require.NoError(s.T(), c.Update(rampTestConfig{Name: "app", Limit: 200}))
+	assert.Equal(s.T(), rampTestConfig{Name: "app", Limit: 100}, <-delivered)
+	step()
+	assert.Equal(s.T(), rampTestConfig{Name: "app", Limit: 120}, <-delivered)
+
+	// update rejected during the ramp rolls back to the delivered value, not to the target
+	err = c.Update(rampTestConfig{Name: "rejected", Limit: 200})
+	assert.ErrorContains(s.T(), err, "limit 120 is rejected")
+	assert.Equal(s.T(), rampTestConfig{Name: "rejected", Limit: 120}, <-delivered)
+	assert.Equal(s.T(), rampTestConfig{Name: "app", Limit: 120}, <-delivered)
+
+	// rejected step rolls back to the previous step
+	step()
+	assert.Equal(s.T(), rampTestConfig{Name: "app", Limit: 140}, <-delivered)
+	assert.Equal(s.T(), rampTestConfig{Name: "app", Limit: 120}, <-delivered)
+
+	select {
+	case e := <-failed:
+		assert.ErrorContains(s.T(), e.Err, "limit 140 is rejected")
+	case <-time.After(time.Second):
+		s.T().Fatal("ramp failure has not been reported")
+	}
+	assert.Equal(s.T(), 200, c.Config().Limit)
+}
+
+func (s *testSuite) TestMockHandler() {
+	h := mocks.NewConfigHandler(s.T())
+	h.EXPECT().Load(mock.Anything).RunAndReturn(func(data any) error {
+		return json.Unmarshal([]byte(`{"Name":"mock"}`), data)
+	})
+	h.EXPECT().Save(mock.Anything).Return(nil).Once()
+
+	c, err := New[fileHandlerTestConfig](WithHandler(h))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	assert.Equal(s.T(), fileHandlerTestConfig{Name: "mock", Port: "8080"}, c.Config())
+
+	h.EXPECT().Save(fileHandlerTestConfig{Name: "mock", Port: "81"}).Return(errors.New("disk full")).Once()
+
+	err = c.Update(fileHandlerTestConfig{Name: "mock", Port: "81"})
+	assert.ErrorContains(s.T(), err, "disk full")
+}
+
+func (s *testSuite) TestIdsAreNotReused() {
+	c, err := New[fileHandlerTestConfig](WithHandler(&stubFileHandler{}))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	first := c.AddCallback(func(fileHandlerTestConfig) {})
+	second := c.AddCallback(func(fileHandlerTestConfig) {})
+	require.NoError(s.T(), c.RemoveCallback(first))
+	assert.NotEqual(s.T(), second, c.AddCallback(func(fileHandlerTestConfig) {}))
+	assert.Len(s.T(), c.callbacks, 2)
+
+	first = c.AddSubscriber(func(fileHandlerTestConfig) error { return nil })
+	second = c.AddSubscriber(func(fileHandlerTestConfig) error { return nil })
+	require.NoError(s.T(), c.RemoveSubscriber(first))
+	assert.NotEqual(s.T(), second, c.AddSubscriber(func(fileHandlerTestConfig) error { return nil }))
+	assert.Len(s.T(), c.subscribers, 2)
+}
+
+// Run with -race: concurrent reads, updates, reloads and subscriber changes.
+func (s *testSuite) TestConcurrentAccess() {
+	const n = 100
+
+	h := &watchHandler{config: fileHandlerTestConfig{Name: "app", Port: "0"}, changes: make(chan struct{}, 1)}
+
+	c, err := New[fileHandlerTestConfig](WithHandler(h))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+	defer c.stop()
+
+	var wg sync.WaitGroup
+	run := func(f func(i int)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				f(i)
+			}
+		}()
+	}
+
+	var ids sync.Map
+	run(func(i int) {
+		c.Update(fileHandlerTestConfig{Name: "app", Port: strconv.Itoa(i)})
+	})
+	run(func(i int) {
+		h.set(fileHandlerTestConfig{Name: "app", Port: strconv.Itoa(n + i)})
+		select {
+		case h.changes <- struct{}{}:
+		default:
+		}
+	})
+	run(func(_ int) {
+		c.Reload()
+	})
+	run(func(_ int) {
+		id := c.AddSubscriber(func(fileHandlerTestConfig) error { return nil })
+		_, dup := ids.LoadOrStore(id, true)
+		assert.False(s.T(), dup, "subscriber id %d is reused", id)
+		c.RemoveSubscriber(id)
+	})
+	run(func(_ int) {
+		id := c.AddCallback(func(fileHandlerTestConfig) {})
+		_, dup := ids.LoadOrStore(id, true)
+		assert.False(s.T(), dup, "callback id %d is reused", id)
+		c.RemoveCallback(id)
+	})
+	run(func(_ int) {
+		cfg := c.Config()
+		assert.Equal(s.T(), "app", cfg.Name)
+		c.GetTimestamp()
+		c.Status()
+		c.Revision()
+		c.IsSet("Port")
+		c.String()
+	})
+
+	wg.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(s.T(), c.AwaitApplied(ctx, c.Revision()))
+}
+
+func (s *testSuite) TestReentrantCalls() {
+	c, err := New[fileHandlerTestConfig](WithHandler(&stubFileHandler{}))
+	require.NoErrorf(s.T(), err, testSetupErrorMsg)
+
+	var seen []string
+	var subId int
+	subId = c.AddSubscriber(func(cfg fileHandlerTestConfig) error {
+		// instance still has previous config while subscribers are notified
+		seen = append(seen, c.Config().Port+"->"+cfg.Port)
+		c.GetTimestamp()
+		c.IsSet("Port")
+		c.AddCallback(func(fileHandlerTestConfig) {})
+		return c.RemoveSubscriber(subId)
+	})
+	c.OnBeforeUpdate(func(old, new fileHandlerTestConfig) (fileHandlerTestConfig, error) {
+		assert.Equal(s.T(), old, c.Config())
+		return new, nil
+	})
+	c.OnAfterUpdate(func(_, new fileHandlerTestConfig) {
+		assert.Equal(s.T(), new, c.Config())
+	})
+
+	updated := make(chan struct{})
+	c.AddCallback(func(cfg fileHandlerTestConfig) {
+		// callbacks run in separate goroutines, so they can update the instance
+		if cfg.Port == "81" {
+			assert.NoError(s.T(), c.Update(fileHandlerTestConfig{Name: "app", Port: "82"}))
+			close(updated)
+		}
+	})
+
+	done := make(chan error)
+	go func() {
+		done <- c.Update(fileHandlerTestConfig{Name: "app", Port: "81"})
+	}()
+
+	select {
+	case err := <-done:
+		require.NoError(s.T(), err)
+	case <-time.After(time.Second):
+		s.T().Fatal("update has deadlocked")
+	}
+
+	select {
+	case <-updated:
+	case <-time.After(time.Second):
+		s.T().Fatal("update from callback has deadlocked")
+	}
+
+	assert.Equal(s.T(), []string{"8080->81"}, seen)
+	assert.Equal(s.T(), "82", c.Config().Port)
 }
@@ -0,0 +1,213 @@
+// Package cogcron runs jobs on the schedule read from cog config, e.g. `sync: {cron: "*/15 * * * *"}`.
+// Schedule is hot-updated when the config changes, so apps do not restart tickers in their own subscribers.
+package cogcron
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/leonidasdeim/cog"
+)
+
+// Job is called on every activation of the schedule. Context is canceled when trigger is stopped.
+type Job func(ctx context.Context)
+
+// Trigger runs the job on the schedule bound to the config field.
+type Trigger struct {
+	lock      sync.Mutex
+	expr      string
+	schedule  Schedule
+	delivered bool
+	changed   chan struct{}
+	clock     cog.Clock
+	ctx       context.Context
+	cancel    context.CancelFunc
+	done      chan struct{}
+	stop      func()
+}
+
+type Optional struct {
+	Clock    cog.Clock
+	Parser   Parser
+	Location *time.Location
+}
+
+type Option func(o *Optional)
+
+// Use custom clock, e.g. cogtest.Clock. By default system clock is used.
+func WithClock(c cog.Clock) Option {
+	return func(o *Optional) {
+		o.Clock = c
+	}
+}
+
+// Use custom parser of schedule expressions. By default Parse is used.
+func WithParser(p Parser) Option {
+	return func(o *Optional) {
+		o.Parser = p
+	}
+}
+
+// Evaluate cron expressions in the time zone. By default local time zone is used.
+func WithLocation(loc *time.Location) Option {
+	return func(o *Optional) {
+		o.Location = loc
+	}
+}
+
+// Run job on the schedule returned by the selector, see Parse for the expressions. Empty expression pauses the trigger.
+// cogcron.Bind(c, func(t Config) string { return t.Sync.Cron }, job)
+//
+// Trigger is a subscriber of c: invalid expression rejects the update, and the previous schedule is restored
+// if the update is rolled back. Schedule restarts only when the expression changes. Job runs are not overlapped,
+// activations which have passed while the job was running are skipped. Stop the trigger when it is not needed anymore.
+func Bind[T any](c *cog.C[T], selector func(T) string, job Job, opts ...Option) (*Trigger, error) {
+
+	// Set defaults
+	o := &Optional{
+		Clock:    systemClock{},
+		Location: time.Local,
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	parser := o.Parser
+	if parser == nil {
+		parser = func(expr string) (Schedule, error) {
+			return parse(expr, o.Location)
+		}
+	}
+
+	if selector == nil || job == nil {
+		return nil, fmt.Errorf("selector and job must be provided")
+	}
+
+	t := &Trigger{
+		changed: make(chan struct{}, 1),
+		clock:   o.Clock,
+		done:    make(chan struct{}),
+	}
+
+	set := func(config T, initial bool) error {
+		expr := selector(config)
+
+		t.lock.Lock()
+		defer t.lock.Unlock()
+
+		if initial && t.delivered {
+			// subscriber has been called with newer config since registration
+			return nil
+		}
+
+		if expr != t.expr {
+			var s Schedule
+			if expr != "" {
+				var err error
+				if s, err = parser(expr); err != nil {
+					return fmt.Errorf("failed at parse schedule %q: %v", expr, err)
+				}
+			}
+			t.expr, t.schedule = expr, s
+
+			select {
+			case t.changed <- struct{}{}:
+			default:
+			}
+		}
+
+		t.delivered = true
+		return nil
+	}
+
+	// subscriber is registered before current config is read, so no update is missed in between
+	id := c.AddSubscriber(func(config T) error {
+		return set(config, false)
+	})
+	if err := set(c.Config(), true); err != nil {
+		c.RemoveSubscriber(id)
+		return nil, err
+	}
+	// run reads the schedule on start, so initial change is not signaled
+	select {
+	case <-t.changed:
+	default:
+	}
+
+	t.ctx, t.cancel = context.WithCancel(context.Background())
+	t.stop = func() {
+		c.RemoveSubscriber(id)
+	}
+
+	go t.run(job)
+
+	return t, nil
+}
+
+// Get current schedule expression.
+func (t *Trigger) Expr() string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return t.expr
+}
+
+// Stop the trigger and wait for the running job to return.
+func (t *Trigger) Stop() {
+	t.stop()
+	t.cancel()
+	<-t.done
+}
+
+func (t *Trigger) run(job Job) {
+	defer close(t.done)
+
+	// scheduled time of the last activation, next one is counted from it
+	var last time.Time
+
+	for {
+		t.lock.Lock()
+		s := t.schedule
+		t.lock.Unlock()
+
+		var fire <-chan time.Time
+		var next time.Time
+		if s != nil {
+			now := t.clock.Now()
+			if last.IsZero() {
+				last = now
+			}
+			next = s.Next(last)
+			// skip activations which have passed while the job was running
+			for !next.IsZero() && !next.After(now) {
+				next = s.Next(next)
+			}
+			if !next.IsZero() {
+				fire = t.clock.After(next.Sub(now))
+			}
+		}
+
+		select {
+		case <-t.ctx.Done():
+			return
+		case <-t.changed:
+			last = time.Time{}
+		case <-fire:
+			last = next
+			job(t.ctx)
+		}
+	}
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
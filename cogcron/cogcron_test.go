@@ -0,0 +1,137 @@
+package cogcron
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/leonidasdeim/cog/cogtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testConfig struct {
+	Cron string
+}
+
+func selectCron(c testConfig) string {
+	return c.Cron
+}
+
+// Wait until the trigger is waiting for the clock.
+func waitTimer(t *testing.T, clock *cogtest.Clock) {
+	t.Helper()
+	require.Eventually(t, func() bool { return clock.Timers() == 1 }, time.Second, time.Millisecond)
+}
+
+func TestBindFixedInterval(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := cogtest.NewClock(start)
+	c, _ := cogtest.New(t, testConfig{Cron: "10s"})
+
+	runs := make(chan time.Time)
+	trigger, err := Bind(c, selectCron, func(ctx context.Context) {
+		now := clock.Now()
+		// job takes 3s on first run and 25s on second
+		switch now.Sub(start) {
+		case 10 * time.Second:
+			clock.Advance(3 * time.Second)
+		case 20 * time.Second:
+			clock.Advance(25 * time.Second)
+		}
+		runs <- now
+	}, WithClock(clock))
+	require.NoError(t, err)
+	defer trigger.Stop()
+
+	waitTimer(t, clock)
+	clock.Advance(10 * time.Second)
+	assert.Equal(t, start.Add(10*time.Second), <-runs)
+
+	// next activation is counted from the scheduled time, not from the end of the job
+	waitTimer(t, clock)
+	clock.Advance(7 * time.Second)
+	assert.Equal(t, start.Add(20*time.Second), <-runs)
+
+	// activations at 30s and 40s have passed while the job was running
+	waitTimer(t, clock)
+	clock.Advance(5 * time.Second)
+	assert.Equal(t, start.Add(50*time.Second), <-runs)
+}
+
+func TestBindUpdates(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := cogtest.NewClock(start)
+	c, _ := cogtest.New(t, testConfig{Cron: "1m"})
+
+	runs := make(chan time.Time, 1)
+	trigger, err := Bind(c, selectCron, func(ctx context.Context) {
+		runs <- clock.Now()
+	}, WithClock(clock), WithLocation(time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, "1m", trigger.Expr())
+
+	// invalid expression rejects the update
+	err = c.Update(testConfig{Cron: "* * *"})
+	assert.ErrorContains(t, err, "failed at parse schedule \"* * *\"")
+	assert.Equal(t, testConfig{Cron: "1m"}, c.Config())
+	assert.Equal(t, "1m", trigger.Expr())
+
+	// schedule restarts on change
+	waitTimer(t, clock)
+	require.NoError(t, c.Update(testConfig{Cron: "*/5 * * * *"}))
+	assert.Equal(t, "*/5 * * * *", trigger.Expr())
+	require.Eventually(t, func() bool { return clock.Timers() == 2 }, time.Second, time.Millisecond)
+
+	clock.Advance(5 * time.Minute)
+	assert.Equal(t, start.Add(5*time.Minute), <-runs)
+
+	// empty expression pauses the trigger
+	waitTimer(t, clock)
+	require.NoError(t, c.Update(testConfig{}))
+	assert.Equal(t, "", trigger.Expr())
+	clock.Advance(time.Hour)
+	select {
+	case <-runs:
+		assert.Fail(t, "paused trigger must not run the job")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	trigger.Stop()
+
+	// stopped trigger is not a subscriber anymore
+	require.NoError(t, c.Update(testConfig{Cron: "bad"}))
+	assert.Equal(t, "", trigger.Expr())
+}
+
+func TestBindErrors(t *testing.T) {
+	c, _ := cogtest.New(t, testConfig{Cron: "bad"})
+
+	_, err := Bind(c, selectCron, func(ctx context.Context) {})
+	assert.ErrorContains(t, err, "failed at parse schedule \"bad\"")
+
+	// failed bind does not leave the subscriber behind
+	require.NoError(t, c.Update(testConfig{Cron: "also bad"}))
+
+	_, err = Bind(c, nil, func(ctx context.Context) {})
+	assert.ErrorContains(t, err, "selector and job must be provided")
+}
+
+func TestStopCancelsJob(t *testing.T) {
+	clock := cogtest.NewClock(time.Now())
+	c, _ := cogtest.New(t, testConfig{Cron: "1s"})
+
+	started := make(chan struct{})
+	trigger, err := Bind(c, selectCron, func(ctx context.Context) {
+		close(started)
+		<-ctx.Done()
+	}, WithClock(clock))
+	require.NoError(t, err)
+
+	waitTimer(t, clock)
+	clock.Advance(time.Second)
+	<-started
+
+	// Stop returns after the running job
+	trigger.Stop()
+}
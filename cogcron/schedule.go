@@ -0,0 +1,209 @@
+package cogcron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule provides activation times of the job.
+type Schedule interface {
+	// Get next activation time after t, zero time if there is none.
+	Next(t time.Time) time.Time
+}
+
+// Parser parses schedule expression, e.g. adapter around github.com/robfig/cron/v3 for expressions with seconds.
+type Parser func(expr string) (Schedule, error)
+
+// Fixed interval schedule, next activation is counted from the previous one.
+type Every time.Duration
+
+func (e Every) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+// Parse schedule expression:
+//   - duration, e.g. "30s" or "@every 5m"
+//   - standard cron expression with 5 fields (minute, hour, day of month, month, day of week), e.g. "*/15 9-17 * * MON-FRI"
+//   - descriptor: "@hourly", "@daily" (or "@midnight"), "@weekly", "@monthly" or "@yearly" (or "@annually")
+//
+// Cron expressions are evaluated in the local time zone, see WithLocation.
+func Parse(expr string) (Schedule, error) {
+	return parse(expr, time.Local)
+}
+
+func parse(expr string, loc *time.Location) (Schedule, error) {
+	expr = strings.TrimSpace(expr)
+
+	if strings.HasPrefix(expr, "@every ") {
+		expr = strings.TrimSpace(strings.TrimPrefix(expr, "@every "))
+	}
+	if d, err := time.ParseDuration(expr); err == nil {
+		if d <= 0 {
+			return nil, fmt.Errorf("interval must be positive: %s", expr)
+		}
+		return Every(d), nil
+	}
+
+	if d, ok := descriptors[strings.ToLower(expr)]; ok {
+		expr = d
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected duration, descriptor or 5 cron fields, got %q", expr)
+	}
+
+	c := cron{loc: loc}
+	var err error
+	for i, r := range ranges {
+		if c.fields[i], err = parseField(fields[i], r); err != nil {
+			return nil, fmt.Errorf("bad %s field %q: %v", r.name, fields[i], err)
+		}
+	}
+	// field starting with "*" is unrestricted also with a step, e.g. "*/2", as in Vixie cron
+	c.anyDom = strings.HasPrefix(fields[2], "*") || fields[2] == "?"
+	c.anyDow = strings.HasPrefix(fields[4], "*") || fields[4] == "?"
+
+	return c, nil
+}
+
+var descriptors = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+}
+
+type fieldRange struct {
+	name     string
+	min, max int
+	names    []string
+}
+
+var ranges = [5]fieldRange{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	// 7 is Sunday too
+	{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+// Parse comma separated list of "*", "a", "a-b", each optionally with "/step", into bit set of allowed values.
+func parseField(field string, r fieldRange) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(field, ",") {
+		spec, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			s, err := strconv.Atoi(stepStr)
+			if err != nil || s <= 0 {
+				return 0, fmt.Errorf("bad step %q", stepStr)
+			}
+			step = s
+		}
+
+		lo, hi := r.min, r.max
+		switch {
+		case spec == "*" || spec == "?":
+		case strings.Contains(spec, "-"):
+			a, b, _ := strings.Cut(spec, "-")
+			var err error
+			if lo, err = r.value(a); err != nil {
+				return 0, err
+			}
+			if hi, err = r.value(b); err != nil {
+				return 0, err
+			}
+		default:
+			v, err := r.value(spec)
+			if err != nil {
+				return 0, err
+			}
+			lo = v
+			if !hasStep {
+				hi = v
+			}
+		}
+
+		if lo > hi {
+			return 0, fmt.Errorf("range start %d is after end %d", lo, hi)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	if r.name == "day of week" && bits&(1<<7) != 0 {
+		bits |= 1
+	}
+	return bits, nil
+}
+
+func (r fieldRange) value(s string) (int, error) {
+	for i, name := range r.names {
+		if strings.EqualFold(s, name) {
+			return i + r.min, nil
+		}
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("bad value %q", s)
+	}
+	if v < r.min || v > r.max {
+		return 0, fmt.Errorf("value %d is out of range %d-%d", v, r.min, r.max)
+	}
+	return v, nil
+}
+
+type cron struct {
+	// minute, hour, day of month, month, day of week
+	fields         [5]uint64
+	anyDom, anyDow bool
+	loc            *time.Location
+}
+
+func (c cron) Next(t time.Time) time.Time {
+	t = t.In(c.loc).Truncate(time.Minute).Add(time.Minute)
+	// every valid expression fires at least once in 5 years (e.g. Feb 29 on Monday takes longer, but is rare)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		switch {
+		case !c.has(3, int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, c.loc)
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, c.loc)
+		case !c.has(1, t.Hour()):
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, c.loc)
+		case !c.has(0, t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+func (c cron) has(field, v int) bool {
+	return c.fields[field]&(1<<uint(v)) != 0
+}
+
+// Day matches if both day of month and day of week match, or either of them when both are restricted, as in cron.
+// Field is restricted unless it starts with "*" or is "?".
+func (c cron) dayMatches(t time.Time) bool {
+	dom := c.has(2, t.Day())
+	dow := c.has(4, int(t.Weekday()))
+	if c.anyDom || c.anyDow {
+		return dom && dow
+	}
+	return dom || dow
+}
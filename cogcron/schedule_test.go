@@ -0,0 +1,132 @@
+package cogcron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse("2006-01-02 15:04:05", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := map[string]string{
+		"":              "expected duration, descriptor or 5 cron fields",
+		"* * * *":       "expected duration, descriptor or 5 cron fields",
+		"* * * * * *":   "expected duration, descriptor or 5 cron fields",
+		"@reboot":       "expected duration, descriptor or 5 cron fields",
+		"0s":            "interval must be positive",
+		"-5m":           "interval must be positive",
+		"60 * * * *":    "bad minute field \"60\": value 60 is out of range 0-59",
+		"* 24 * * *":    "bad hour field",
+		"* * 0 * *":     "bad day of month field",
+		"* * * 13 *":    "bad month field",
+		"* * * foo *":   "bad month field \"foo\": bad value \"foo\"",
+		"* * * * 8":     "bad day of week field",
+		"*/0 * * * *":   "bad step \"0\"",
+		"*/x * * * *":   "bad step \"x\"",
+		"30-10 * * * *": "range start 30 is after end 10",
+	}
+
+	for expr, want := range tests {
+		_, err := Parse(expr)
+		assert.ErrorContains(t, err, want, expr)
+	}
+}
+
+func TestParseFields(t *testing.T) {
+	tests := []struct {
+		expr   string
+		fields [5]uint64
+		anyDom bool
+		anyDow bool
+	}{
+		{"* * * * *", [5]uint64{1<<60 - 1, 1<<24 - 1, 1<<32 - 2, 1<<13 - 2, 1<<8 - 1}, true, true},
+		{"0,30 9-17/4 1 jan-mar sun", [5]uint64{1 | 1<<30, 1<<9 | 1<<13 | 1<<17, 1 << 1, 1<<1 | 1<<2 | 1<<3, 1}, false, false},
+		{"5/20 * ? * 7", [5]uint64{1<<5 | 1<<25 | 1<<45, 1<<24 - 1, 1<<32 - 2, 1<<13 - 2, 1 | 1<<7}, true, false},
+		{"0 0 */10 * MON-FRI", [5]uint64{1, 1, 1<<1 | 1<<11 | 1<<21 | 1<<31, 1<<13 - 2, 0b111110}, true, false},
+		{"@weekly", [5]uint64{1, 1, 1<<32 - 2, 1<<13 - 2, 1}, true, false},
+	}
+
+	for _, tt := range tests {
+		s, err := parse(tt.expr, time.UTC)
+		require.NoError(t, err, tt.expr)
+
+		c := s.(cron)
+		assert.Equal(t, tt.fields, c.fields, tt.expr)
+		assert.Equal(t, tt.anyDom, c.anyDom, tt.expr)
+		assert.Equal(t, tt.anyDow, c.anyDow, tt.expr)
+	}
+}
+
+func TestEvery(t *testing.T) {
+	for _, expr := range []string{"90s", "@every 90s", " @every  1m30s "} {
+		s, err := Parse(expr)
+		require.NoError(t, err, expr)
+		assert.Equal(t, Every(90*time.Second), s, expr)
+	}
+
+	s := Every(time.Minute)
+	assert.Equal(t, date("2024-01-01 10:01:30"), s.Next(date("2024-01-01 10:00:30")))
+}
+
+func TestNext(t *testing.T) {
+	tests := []struct {
+		expr string
+		from string
+		want string
+	}{
+		{"*/15 * * * *", "2024-01-01 10:07:00", "2024-01-01 10:15:00"},
+		{"*/15 * * * *", "2024-01-01 10:15:00", "2024-01-01 10:30:00"},
+		{"*/15 * * * *", "2024-01-01 23:59:59", "2024-01-02 00:00:00"},
+		{"0 9-17 * * MON-FRI", "2024-01-05 17:30:00", "2024-01-08 09:00:00"},
+		{"@hourly", "2024-01-01 10:00:00", "2024-01-01 11:00:00"},
+		{"@daily", "2024-12-31 23:59:30", "2025-01-01 00:00:00"},
+		{"@monthly", "2024-01-31 12:00:00", "2024-02-01 00:00:00"},
+		{"@yearly", "2024-06-01 00:00:00", "2025-01-01 00:00:00"},
+		{"0 12 1 jan,jul *", "2024-02-01 00:00:00", "2024-07-01 12:00:00"},
+		{"0 0 * * 7", "2024-01-06 12:00:00", "2024-01-07 00:00:00"},
+		{"0 0 31 * *", "2024-02-01 00:00:00", "2024-03-31 00:00:00"},
+		{"0 0 29 2 *", "2024-03-01 00:00:00", "2028-02-29 00:00:00"},
+		// day of month or day of week when both are restricted
+		{"0 0 1,15 * MON", "2024-01-02 00:00:00", "2024-01-08 00:00:00"},
+		{"0 0 1,15 * MON", "2024-01-09 00:00:00", "2024-01-15 00:00:00"},
+		{"0 0 1,15 * MON", "2024-01-29 00:00:00", "2024-02-01 00:00:00"},
+		// both when either is not restricted, "*/2" is not restricted
+		{"0 0 */2 * MON", "2024-01-02 00:00:00", "2024-01-15 00:00:00"},
+		{"0 0 ? * MON", "2024-01-02 00:00:00", "2024-01-08 00:00:00"},
+		{"0 0 15 * *", "2024-01-02 00:00:00", "2024-01-15 00:00:00"},
+		{"0 0 15 * */1", "2024-01-02 00:00:00", "2024-01-15 00:00:00"},
+		// never
+		{"0 0 30 2 *", "2024-01-01 00:00:00", ""},
+	}
+
+	for _, tt := range tests {
+		s, err := parse(tt.expr, time.UTC)
+		require.NoError(t, err, tt.expr)
+
+		var want time.Time
+		if tt.want != "" {
+			want = date(tt.want)
+		}
+		assert.Equal(t, want, s.Next(date(tt.from)), "%s from %s", tt.expr, tt.from)
+	}
+}
+
+func TestNextLocation(t *testing.T) {
+	loc := time.FixedZone("UTC+2", 2*60*60)
+	s, err := parse("0 9 * * *", loc)
+	require.NoError(t, err)
+
+	// 10:00 local time
+	next := s.Next(date("2024-01-01 08:00:00"))
+	assert.True(t, date("2024-01-02 07:00:00").Equal(next), next)
+	assert.Equal(t, loc, next.Location())
+}
@@ -0,0 +1,70 @@
+package cogtest
+
+import (
+	"sync"
+	"time"
+)
+
+type timer struct {
+	at time.Time
+	ch chan time.Time
+}
+
+// Clock is a fake cog.Clock which time moves only when Advance is called.
+type Clock struct {
+	lock   sync.Mutex
+	now    time.Time
+	timers []timer
+}
+
+// Create fake clock starting at the given time.
+func NewClock(start time.Time) *Clock {
+	return &Clock{now: start}
+}
+
+func (c *Clock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.now
+}
+
+func (c *Clock) After(d time.Duration) <-chan time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+
+	c.timers = append(c.timers, timer{at: c.now.Add(d), ch: ch})
+	return ch
+}
+
+// Move time forward and fire timers which are due.
+func (c *Clock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.now = c.now.Add(d)
+
+	pending := c.timers[:0]
+	for _, t := range c.timers {
+		if t.at.After(c.now) {
+			pending = append(pending, t)
+			continue
+		}
+		t.ch <- c.now
+	}
+	c.timers = pending
+}
+
+// Get number of timers waiting to fire. It can be used to wait until cog goroutines are waiting for the clock.
+func (c *Clock) Timers() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return len(c.timers)
+}
@@ -0,0 +1,91 @@
+// Package cogtest provides fixtures and assertion helpers for testing code which uses cog.
+package cogtest
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/leonidasdeim/cog"
+)
+
+// Timeout of the Eventually* assertions.
+var Timeout = 5 * time.Second
+
+// Create cog instance backed by the controllable handler keeping config in t.TempDir().
+// Initial config is stored before instance is created. Test fails if instance can not be created.
+// Instance is closed when the test finishes.
+// c, h := cogtest.New(t, ConfigStruct{Port: 80})
+func New[T any](t testing.TB, initial T, opts ...cog.Option) (*cog.C[T], *Handler) {
+	t.Helper()
+
+	h := NewHandler(t.TempDir())
+	if err := h.write(initial); err != nil {
+		t.Fatalf("failed at store initial config: %v", err)
+	}
+
+	c, err := cog.New[T](append(opts, cog.WithHandler(h))...)
+	if err != nil {
+		t.Fatalf("failed at init config: %v", err)
+	}
+	t.Cleanup(func() {
+		c.Close()
+	})
+
+	return c, h
+}
+
+// Assert that config eventually equals want and its revision has been applied by all subscribers and callbacks.
+func EventuallyApplied[T any](t testing.TB, c *cog.C[T], want T) bool {
+	t.Helper()
+
+	return EventuallyMatches(t, c, func(config T) bool {
+		return reflect.DeepEqual(config, want)
+	})
+}
+
+// Assert that config eventually satisfies the condition and its revision has been applied
+// by all subscribers and callbacks.
+func EventuallyMatches[T any](t testing.TB, c *cog.C[T], cond func(T) bool) bool {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+
+	for {
+		// revision is read after config, so it is not older than revision of the config
+		config := c.Config()
+		rev := c.Revision()
+		if cond(config) {
+			if err := c.AwaitApplied(ctx, rev); err != nil {
+				t.Errorf("config revision %d has not been applied: %v", rev, err)
+				return false
+			}
+			return true
+		}
+
+		select {
+		case <-ctx.Done():
+			t.Errorf("config has not reached expected state in %s, got: %+v", Timeout, c.Config())
+			return false
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+// Assert that config has not changed from want during the period, e.g. after invalid external change.
+func NeverChanges[T any](t testing.TB, c *cog.C[T], want T, period time.Duration) bool {
+	t.Helper()
+
+	deadline := time.Now().Add(period)
+	for time.Now().Before(deadline) {
+		if got := c.Config(); !reflect.DeepEqual(got, want) {
+			t.Errorf("config has changed, got: %+v", got)
+			return false
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	return true
+}
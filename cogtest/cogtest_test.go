@@ -0,0 +1,174 @@
+package cogtest
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/leonidasdeim/cog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testConfig struct {
+	Name string
+	Port int `validate:"required"`
+}
+
+// Records failures of the helpers instead of failing the test.
+type recorder struct {
+	testing.TB
+	lock   sync.Mutex
+	errors []string
+	fatal  bool
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Fatalf(format string, args ...any) {
+	r.lock.Lock()
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+	r.fatal = true
+	r.lock.Unlock()
+
+	runtime.Goexit()
+}
+
+// Run f with recorder in separate goroutine, so Fatalf can stop it.
+func record(t *testing.T, f func(r *recorder)) *recorder {
+	r := &recorder{TB: t}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f(r)
+	}()
+	<-done
+	return r
+}
+
+func withTimeout(t *testing.T, d time.Duration) {
+	prev := Timeout
+	Timeout = d
+	t.Cleanup(func() { Timeout = prev })
+}
+
+func TestNew(t *testing.T) {
+	c, h := New(t, testConfig{Name: "app", Port: 80})
+	assert.Equal(t, testConfig{Name: "app", Port: 80}, c.Config())
+	assert.Positive(t, h.Loads())
+
+	var stored testConfig
+	require.NoError(t, h.Stored(&stored))
+	assert.Equal(t, c.Config(), stored)
+	assert.FileExists(t, h.File())
+
+	r := record(t, func(r *recorder) {
+		New(r, testConfig{Name: "app"})
+	})
+	assert.True(t, r.fatal)
+	require.Len(t, r.errors, 1)
+	assert.Contains(t, r.errors[0], "failed at init config")
+}
+
+func TestExternalChange(t *testing.T) {
+	c, h := New(t, testConfig{Name: "app", Port: 80})
+
+	applied := make(chan testConfig, 10)
+	c.AddCallback(func(cfg testConfig) {
+		time.Sleep(10 * time.Millisecond)
+		applied <- cfg
+	})
+
+	require.NoError(t, h.Set(testConfig{Name: "app", Port: 81}))
+	assert.True(t, EventuallyApplied(t, c, testConfig{Name: "app", Port: 81}))
+	// callback has returned before the assertion succeeded
+	assert.Len(t, applied, 1)
+
+	// invalid change is rejected and config is kept
+	require.NoError(t, h.SetRaw([]byte(`{"Name":"broken"}`)))
+	assert.True(t, NeverChanges(t, c, testConfig{Name: "app", Port: 81}, 50*time.Millisecond))
+
+	require.NoError(t, h.SetRaw([]byte(`{"Name":"raw","Port":82}`)))
+	assert.True(t, EventuallyMatches(t, c, func(cfg testConfig) bool { return cfg.Name == "raw" }))
+}
+
+func TestFailures(t *testing.T) {
+	c, h := New(t, testConfig{Name: "app", Port: 80})
+
+	h.FailSave(errors.New("disk full"))
+	saves := h.Saves()
+	assert.ErrorContains(t, c.Update(testConfig{Name: "app", Port: 81}), "disk full")
+	assert.Equal(t, saves+1, h.Saves())
+
+	// failed save is not stored
+	var stored testConfig
+	require.NoError(t, h.Stored(&stored))
+	assert.Equal(t, 80, stored.Port)
+	h.FailSave(nil)
+
+	require.NoError(t, c.Update(testConfig{Name: "app", Port: 81}))
+	require.NoError(t, h.Stored(&stored))
+	assert.Equal(t, 81, stored.Port)
+
+	h.FailLoad(errors.New("unavailable"))
+	loads := h.Loads()
+	h.Notify()
+	assert.True(t, NeverChanges(t, c, testConfig{Name: "app", Port: 81}, 50*time.Millisecond))
+	assert.Greater(t, h.Loads(), loads)
+	h.FailLoad(nil)
+}
+
+func TestAssertionsFail(t *testing.T) {
+	withTimeout(t, 20*time.Millisecond)
+	c, h := New(t, testConfig{Name: "app", Port: 80})
+
+	r := record(t, func(r *recorder) {
+		assert.False(t, EventuallyApplied(r, c, testConfig{Name: "other", Port: 80}))
+	})
+	require.Len(t, r.errors, 1)
+	assert.Contains(t, r.errors[0], "has not reached expected state")
+
+	require.NoError(t, h.Set(testConfig{Name: "app", Port: 81}))
+	r = record(t, func(r *recorder) {
+		assert.False(t, NeverChanges(r, c, testConfig{Name: "app", Port: 80}, time.Second))
+	})
+	require.Len(t, r.errors, 1)
+	assert.Contains(t, r.errors[0], "config has changed")
+}
+
+func TestClock(t *testing.T) {
+	start := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewClock(start)
+	var _ cog.Clock = clock
+
+	assert.Equal(t, start, <-clock.After(0))
+	assert.Equal(t, 0, clock.Timers())
+
+	first := clock.After(time.Second)
+	second := clock.After(time.Minute)
+	assert.Equal(t, 2, clock.Timers())
+
+	clock.Advance(time.Second)
+	assert.Equal(t, start.Add(time.Second), <-first)
+	assert.Equal(t, 1, clock.Timers())
+	select {
+	case <-second:
+		t.Fatal("timer fired too early")
+	default:
+	}
+
+	clock.Advance(time.Hour)
+	assert.Equal(t, start.Add(time.Hour+time.Second), <-second)
+	assert.Equal(t, start.Add(time.Hour+time.Second), clock.Now())
+	assert.Equal(t, 0, clock.Timers())
+}
@@ -0,0 +1,183 @@
+package cogtest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Handler is a controllable config handler for tests. Config is kept as JSON file in the given directory,
+// load and save errors can be scripted and external changes simulated. It implements cog.Watchable.
+type Handler struct {
+	lock     sync.Mutex
+	file     string
+	loadErr  error
+	saveErr  error
+	loads    int
+	saves    int
+	watchers []chan struct{}
+}
+
+// Create handler keeping config in the directory, e.g. t.TempDir().
+func NewHandler(dir string) *Handler {
+	return &Handler{file: filepath.Join(dir, "config.json")}
+}
+
+func (h *Handler) Load(data any) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.loads++
+	if h.loadErr != nil {
+		return h.loadErr
+	}
+
+	b, err := os.ReadFile(h.file)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, data)
+}
+
+func (h *Handler) Save(data any) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.saves++
+	if h.saveErr != nil {
+		return h.saveErr
+	}
+
+	return h.write(data)
+}
+
+func (h *Handler) Watch(ctx context.Context) (<-chan struct{}, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	ch := make(chan struct{}, 1)
+	h.watchers = append(h.watchers, ch)
+
+	go func() {
+		<-ctx.Done()
+
+		h.lock.Lock()
+		defer h.lock.Unlock()
+
+		for i, w := range h.watchers {
+			if w == ch {
+				h.watchers = append(h.watchers[:i], h.watchers[i+1:]...)
+				break
+			}
+		}
+		close(ch)
+	}()
+
+	return ch, nil
+}
+
+// Simulate external change: store config and notify watchers.
+func (h *Handler) Set(config any) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if err := h.write(config); err != nil {
+		return err
+	}
+
+	h.notify()
+	return nil
+}
+
+// Simulate external change of the raw stored document, e.g. to test broken input.
+func (h *Handler) SetRaw(data []byte) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if err := os.WriteFile(h.file, data, 0600); err != nil {
+		return err
+	}
+
+	h.notify()
+	return nil
+}
+
+// Notify watchers about a change without changing stored config.
+func (h *Handler) Notify() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.notify()
+}
+
+// Make following loads fail with the error, nil restores normal behavior.
+func (h *Handler) FailLoad(err error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.loadErr = err
+}
+
+// Make following saves fail with the error, nil restores normal behavior.
+func (h *Handler) FailSave(err error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.saveErr = err
+}
+
+// Decode stored config into data.
+func (h *Handler) Stored(data any) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	b, err := os.ReadFile(h.file)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, data)
+}
+
+// Get number of Load calls, including failed ones.
+func (h *Handler) Loads() int {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	return h.loads
+}
+
+// Get number of Save calls, including failed ones.
+func (h *Handler) Saves() int {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	return h.saves
+}
+
+// Get path of the file where config is stored.
+func (h *Handler) File() string {
+	return h.file
+}
+
+func (h *Handler) write(data any) error {
+	b, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed at marshal config: %v", err)
+	}
+
+	return os.WriteFile(h.file, b, 0600)
+}
+
+func (h *Handler) notify() {
+	for _, w := range h.watchers {
+		select {
+		case w <- struct{}{}:
+		default:
+		}
+	}
+}
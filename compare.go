@@ -0,0 +1,86 @@
+package cog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	fh "github.com/leonidasdeim/cog/filehandler"
+)
+
+// CompareSource provides config to compare, see CompareInstance, CompareFile and CompareHandler.
+type CompareSource[T any] interface {
+	load() (T, error)
+}
+
+type compareFunc[T any] func() (T, error)
+
+func (f compareFunc[T]) load() (T, error) {
+	return f()
+}
+
+// Compare current config of the live instance.
+func CompareInstance[T any](c *C[T]) CompareSource[T] {
+	return compareFunc[T](func() (T, error) {
+		return c.Config(), nil
+	})
+}
+
+// Compare config file decoded by its extension: .json, .yaml, .yml or .toml.
+func CompareFile[T any](file string) CompareSource[T] {
+	return compareFunc[T](func() (T, error) {
+		var config T
+
+		codec := fh.NewCodec(fileTypeOf(file))
+		if codec == nil {
+			return config, fmt.Errorf("unsupported config file type: %s", file)
+		}
+
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return config, err
+		}
+
+		if err := codec.Unmarshal(b, &config); err != nil {
+			return config, fmt.Errorf("failed at decode %s: %v", file, err)
+		}
+		return config, nil
+	})
+}
+
+// Get config file type by the extension: .json, .yaml, .yml or .toml.
+func fileTypeOf(file string) fh.FileType {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(file), "."))
+	if ext == "yml" {
+		return fh.YAML
+	}
+	return fh.FileType(ext)
+}
+
+// Compare config document loaded by the handler. Config is compared as stored, sources, defaults and
+// decryption are not applied.
+func CompareHandler[T any](h ConfigHandler) CompareSource[T] {
+	return compareFunc[T](func() (T, error) {
+		var config T
+		err := h.Load(&config)
+		return config, err
+	})
+}
+
+// Compare config of two instances, files or handlers, e.g. to find out how staging differs from prod.
+// Changes are reported from a to b. T can be map[string]any to compare raw documents key by key.
+// d, err := cog.Compare(cog.CompareFile[Config]("staging.yaml"), cog.CompareInstance(c))
+func Compare[T any](a, b CompareSource[T]) (Diff, error) {
+	old, err := a.load()
+	if err != nil {
+		return nil, fmt.Errorf("failed at load first config: %v", err)
+	}
+
+	new, err := b.load()
+	if err != nil {
+		return nil, fmt.Errorf("failed at load second config: %v", err)
+	}
+
+	return diff(old, new), nil
+}
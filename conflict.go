@@ -0,0 +1,102 @@
+package cog
+
+import (
+	"errors"
+	"reflect"
+)
+
+var ErrConflict = errors.New("config source has been changed while local changes exist")
+
+type ConflictPolicy int
+
+const (
+	// External change replaces local changes (default).
+	ExternalWins ConflictPolicy = iota
+	// Local changes are kept and saved over the external change.
+	LocalWins
+	// Local changes are kept, conflict is reported with cog.EventConflict event and conflict hooks.
+	// Application resolves it by calling Update or Reload.
+	ReportConflict
+	// Local and external changes are merged field by field and saved. Fields changed on both sides
+	// keep local value and are reported the same way as with cog.ReportConflict.
+	MergeChanges
+)
+
+// Conflict between external change of the config source and local changes.
+// Base is configuration last synchronized with the source.
+type Conflict[T any] struct {
+	Base     T
+	Local    T
+	External T
+	// Paths of fields changed on both sides, set by cog.MergeChanges policy.
+	Fields []string
+}
+
+type ConflictHook[T any] func(Conflict[T])
+
+// Register hook which is called when watcher detects external change conflicting with local changes.
+// Hook is called after conflict policy has been applied, so it is not holding the cog lock
+// and can resolve conflict by calling Update or Reload.
+func (cog *C[T]) OnConflict(f ConflictHook[T]) {
+	cog.lock.Lock()
+	defer cog.lock.Unlock()
+
+	cog.hooks.conflict = append(cog.hooks.conflict, f)
+}
+
+// Local changes conflict with external change if they have not been saved
+// or if they have been made within conflict window.
+func (cog *C[T]) conflicts() bool {
+	if !reflect.DeepEqual(cog.config, cog.base) {
+		return true
+	}
+
+	return cog.opts.ConflictWindow > 0 && cog.opts.Clock.Now().Sub(cog.updated) < cog.opts.ConflictWindow
+}
+
+// Three-way merge of local and external changes made since base. Struct fields are merged recursively,
+// other values are compared as a whole. Returns paths of fields changed on both sides to different values,
+// such fields keep local value.
+func merge[T any](base, local, external T) (T, []string) {
+	merged := local
+	fields := []string{}
+
+	m := reflect.ValueOf(&merged).Elem()
+	if m.Kind() != reflect.Struct {
+		return external, fields
+	}
+
+	b := reflect.ValueOf(base)
+	e := reflect.ValueOf(external)
+
+	walkFields(m, "", func(path string, _ reflect.StructField, f reflect.Value) {
+		bv := fieldByPath(b, path)
+		ev := fieldByPath(e, path)
+
+		switch {
+		case reflect.DeepEqual(f.Interface(), ev.Interface()), reflect.DeepEqual(ev.Interface(), bv.Interface()):
+			// same change on both sides or changed only locally
+		case reflect.DeepEqual(f.Interface(), bv.Interface()):
+			f.Set(ev)
+		default:
+			fields = append(fields, path)
+		}
+	})
+
+	return merged, fields
+}
+
+func (cog *C[T]) reportConflict(c Conflict[T]) {
+	cog.emit(Event{Type: EventConflict, Time: cog.opts.Clock.Now(), Err: ErrConflict})
+
+	cog.lock.Lock()
+	hooks := cog.hooks.conflict
+	cog.lock.Unlock()
+
+	for _, f := range hooks {
+		if f == nil {
+			continue
+		}
+		f(c)
+	}
+}
@@ -0,0 +1,209 @@
+package cog
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+)
+
+const (
+	ControlGet     = "get"
+	ControlUpdate  = "update"
+	ControlReload  = "reload"
+	ControlHistory = "history"
+	ControlSources = "sources"
+)
+
+var ErrControlDenied = errors.New("control command is not allowed")
+
+// Peer is a local process connected to the control socket, identified by the operating system.
+type Peer struct {
+	// User and group ids, -1 on Windows.
+	UID int
+	GID int
+	PID int
+	// Security identifier of the user on Windows, e.g. "S-1-5-18".
+	SID string
+}
+
+// Actor of the changes made by the peer: "uid:<uid>", or "sid:<sid>" on Windows.
+func (p Peer) actor() string {
+	if p.SID != "" {
+		return "sid:" + p.SID
+	}
+	return fmt.Sprintf("uid:%d", p.UID)
+}
+
+// ControlAuthorizer decides if the peer is allowed to run the control command. Returned error rejects the command.
+type ControlAuthorizer func(peer Peer, command string) error
+
+// ControlRequest is a command sent to the control socket, one JSON document per line.
+type ControlRequest struct {
+	Command string `json:"command"`
+	// JSON merge patch applied by the update command, see c.Patch.
+	Patch json.RawMessage `json:"patch,omitempty"`
+}
+
+// ControlResponse is a reply to the control command, one JSON document per line.
+type ControlResponse struct {
+	Error    string `json:"error,omitempty"`
+	Revision uint64 `json:"revision"`
+	// Current config with secret fields zeroed, set by get, update and reload commands.
+	Config json.RawMessage `json:"config,omitempty"`
+	// Update reports of the last changes, oldest first, set by history command.
+	History json.RawMessage `json:"history,omitempty"`
+	// Source which provided the field on init by its path, set by sources command, see InitReport.Sources.
+	Sources map[string]Source `json:"sources,omitempty"`
+}
+
+// Serve control commands on the unix socket at path, e.g. "/var/run/myapp/cog.sock", or on the named pipe
+// on Windows, e.g. `\\.\pipe\myapp-cog`, so local tooling can get, update and reload config, read history
+// of the changes and sources of the fields without opening TCP admin port. Commands are authorized by credentials
+// of the connected process: by default only the user running the instance and root (LocalSystem on Windows)
+// are allowed, see cog.WithControlAuthorizer. Socket is removed when instance is closed.
+func WithControlSocket(path string) Option {
+	return func(o *Optional) {
+		o.ControlSocket = path
+	}
+}
+
+// Authorize control commands with custom authorizer instead of allowing the same user and root.
+func WithControlAuthorizer(a ControlAuthorizer) Option {
+	return func(o *Optional) {
+		o.ControlAuthorizer = a
+	}
+}
+
+// Send command to the control socket of the instance and wait for the response.
+// Error of the command is returned in the response.
+// resp, err := cog.Control("/var/run/myapp/cog.sock", cog.ControlRequest{Command: cog.ControlReload})
+func Control(path string, req ControlRequest) (ControlResponse, error) {
+	var resp ControlResponse
+
+	conn, err := dialControl(path)
+	if err != nil {
+		return resp, fmt.Errorf("failed at connect control socket: %v", err)
+	}
+	defer conn.Close()
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return resp, fmt.Errorf("failed at send control command: %v", err)
+	}
+
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return resp, fmt.Errorf("failed at read control response: %v", err)
+	}
+	return resp, nil
+}
+
+func (cog *C[T]) startControl() error {
+	if cog.opts.ControlSocket == "" {
+		return nil
+	}
+
+	l, err := listenControl(cog.opts.ControlSocket)
+	if err != nil {
+		return fmt.Errorf("failed at listen control socket: %v", err)
+	}
+
+	cog.background(func() {
+		<-cog.done
+		l.Close()
+	})
+
+	cog.background(func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			cog.background(func() {
+				cog.serveControl(conn)
+			})
+		}
+	})
+
+	return nil
+}
+
+// Serve commands of the connection until it is closed by the peer or the instance is stopped.
+func (cog *C[T]) serveControl(conn net.Conn) {
+	defer conn.Close()
+
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go func() {
+		select {
+		case <-cog.done:
+			conn.Close()
+		case <-stopped:
+		}
+	}()
+
+	peer, err := peerOf(conn)
+
+	enc := json.NewEncoder(conn)
+	s := bufio.NewScanner(conn)
+	for s.Scan() {
+		var resp ControlResponse
+
+		var req ControlRequest
+		switch {
+		case err != nil:
+			resp.Error = fmt.Sprintf("%v: %v", ErrControlDenied, err)
+		case json.Unmarshal(s.Bytes(), &req) != nil:
+			resp.Error = "failed at decode control command"
+		default:
+			resp = cog.control(peer, req)
+		}
+
+		if enc.Encode(resp) != nil {
+			return
+		}
+	}
+}
+
+// Authorize and run the control command.
+func (cog *C[T]) control(peer Peer, req ControlRequest) ControlResponse {
+	authorize := cog.opts.ControlAuthorizer
+	if authorize == nil {
+		authorize = sameUser
+	}
+	if err := authorize(peer, req.Command); err != nil {
+		return ControlResponse{Error: err.Error()}
+	}
+
+	var err error
+	switch req.Command {
+	case ControlGet:
+	case ControlUpdate:
+		var patch map[string]any
+		if patch, err = decodePatch(req.Patch); err == nil {
+			err = cog.patchAs(peer.actor(), patch)
+		}
+	case ControlReload:
+		err = cog.Reload()
+	case ControlHistory:
+		history := []bundleReport{}
+		for _, r := range cog.UpdateReports() {
+			history = append(history, newBundleReport(r))
+		}
+		resp := ControlResponse{Revision: cog.Revision()}
+		if resp.History, err = json.Marshal(history); err != nil {
+			resp.Error = fmt.Sprintf("failed at encode history: %v", err)
+		}
+		return resp
+	case ControlSources:
+		return ControlResponse{Revision: cog.Revision(), Sources: cog.InitReport().Sources}
+	default:
+		return ControlResponse{Error: fmt.Sprintf("unknown control command: %q", req.Command)}
+	}
+
+	resp := ControlResponse{Error: errString(err), Revision: cog.Revision()}
+	if resp.Config, err = json.Marshal(clearSecrets(cog.Config())); err != nil {
+		resp.Error = fmt.Sprintf("failed at encode config: %v", err)
+	}
+	return resp
+}
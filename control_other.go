@@ -0,0 +1,13 @@
+//go:build !linux && !windows
+
+package cog
+
+import (
+	"errors"
+	"net"
+)
+
+// Peer credentials are not available, control commands are rejected.
+func peerOf(_ net.Conn) (Peer, error) {
+	return Peer{}, errors.New("peer credentials are not supported on this platform")
+}
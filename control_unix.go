@@ -0,0 +1,44 @@
+//go:build !windows
+
+package cog
+
+import (
+	"fmt"
+	"net"
+	"os"
+)
+
+// Listen on the unix socket, stale socket left by the previous process is removed.
+// Socket is accessible by the owner and the group, commands are authorized by peer credentials.
+func listenControl(path string) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("socket %s is in use", path)
+		}
+		os.Remove(path)
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(path, 0660); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+func dialControl(path string) (net.Conn, error) {
+	return net.Dial("unix", path)
+}
+
+// Allow commands of the user running the instance and root.
+func sameUser(peer Peer, _ string) error {
+	if peer.UID != 0 && peer.UID != os.Getuid() {
+		return fmt.Errorf("%w: uid %d", ErrControlDenied, peer.UID)
+	}
+	return nil
+}
@@ -0,0 +1,318 @@
+//go:build windows
+
+package cog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	pipePrefix      = `\\.\pipe\`
+	pipeBufferSize  = 64 * 1024
+	pipeDialTimeout = 2 * time.Second
+	localSystemSID  = "S-1-5-18"
+)
+
+var procGetNamedPipeClientProcessId = windows.NewLazySystemDLL("kernel32.dll").NewProc("GetNamedPipeClientProcessId")
+
+type pipeAddr string
+
+func (a pipeAddr) Network() string { return "pipe" }
+func (a pipeAddr) String() string  { return string(a) }
+
+// Listener of the named pipe, every connection gets its own pipe instance.
+type pipeListener struct {
+	path string
+	sa   *windows.SecurityAttributes
+	// Set when listener is closed to interrupt pending Accept.
+	closing   windows.Handle
+	closeOnce sync.Once
+
+	lock   sync.Mutex
+	next   windows.Handle
+	closed bool
+}
+
+// Connection of the named pipe. I/O is overlapped, so Close can interrupt pending Read.
+type pipeConn struct {
+	h    windows.Handle
+	path string
+	// Pending operations hold read lock, Close waits for them to be cancelled before closing the handle.
+	ops       sync.RWMutex
+	closeOnce sync.Once
+}
+
+// Listen on the named pipe, e.g. `\\.\pipe\myapp-cog`, plain name is prefixed with `\\.\pipe\`.
+// Pipe is accessible by the user running the instance, LocalSystem and administrators, remote clients are rejected.
+func listenControl(path string) (net.Listener, error) {
+	path = pipePath(path)
+
+	user, err := windows.GetCurrentProcessToken().GetTokenUser()
+	if err != nil {
+		return nil, err
+	}
+	sd, err := windows.SecurityDescriptorFromString("D:P(A;;GA;;;SY)(A;;GA;;;BA)(A;;GA;;;" + user.User.Sid.String() + ")")
+	if err != nil {
+		return nil, err
+	}
+
+	l := &pipeListener{
+		path: path,
+		sa:   &windows.SecurityAttributes{Length: uint32(unsafe.Sizeof(windows.SecurityAttributes{})), SecurityDescriptor: sd},
+	}
+
+	if l.next, err = l.create(true); err != nil {
+		if errors.Is(err, windows.ERROR_ACCESS_DENIED) {
+			return nil, fmt.Errorf("pipe %s is in use", path)
+		}
+		return nil, err
+	}
+
+	if l.closing, err = windows.CreateEvent(nil, 1, 0, nil); err != nil {
+		windows.CloseHandle(l.next)
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func dialControl(path string) (net.Conn, error) {
+	path = pipePath(path)
+	name, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(pipeDialTimeout)
+	for {
+		h, err := windows.CreateFile(name, windows.GENERIC_READ|windows.GENERIC_WRITE, 0, nil,
+			windows.OPEN_EXISTING, windows.FILE_FLAG_OVERLAPPED, 0)
+		if err == nil {
+			return &pipeConn{h: h, path: path}, nil
+		}
+		// all instances are busy until the server creates the next one
+		if !errors.Is(err, windows.ERROR_PIPE_BUSY) || time.Now().After(deadline) {
+			return nil, err
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Allow commands of the user running the instance and LocalSystem.
+func sameUser(peer Peer, _ string) error {
+	user, err := windows.GetCurrentProcessToken().GetTokenUser()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrControlDenied, err)
+	}
+
+	if peer.SID != localSystemSID && peer.SID != user.User.Sid.String() {
+		return fmt.Errorf("%w: sid %s", ErrControlDenied, peer.SID)
+	}
+	return nil
+}
+
+// Get user of the process connected to the named pipe.
+func peerOf(conn net.Conn) (Peer, error) {
+	pc, ok := conn.(*pipeConn)
+	if !ok {
+		return Peer{}, errors.New("peer credentials are available only for named pipes")
+	}
+
+	var pid uint32
+	if r, _, err := procGetNamedPipeClientProcessId.Call(uintptr(pc.h), uintptr(unsafe.Pointer(&pid))); r == 0 {
+		return Peer{}, err
+	}
+
+	p, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, pid)
+	if err != nil {
+		return Peer{}, err
+	}
+	defer windows.CloseHandle(p)
+
+	var token windows.Token
+	if err := windows.OpenProcessToken(p, windows.TOKEN_QUERY, &token); err != nil {
+		return Peer{}, err
+	}
+	defer token.Close()
+
+	user, err := token.GetTokenUser()
+	if err != nil {
+		return Peer{}, err
+	}
+
+	return Peer{UID: -1, GID: -1, PID: int(pid), SID: user.User.Sid.String()}, nil
+}
+
+func pipePath(path string) string {
+	if strings.HasPrefix(path, pipePrefix) {
+		return path
+	}
+	return pipePrefix + path
+}
+
+// Create pipe instance, first instance fails if pipe is already served by another process.
+func (l *pipeListener) create(first bool) (windows.Handle, error) {
+	name, err := windows.UTF16PtrFromString(l.path)
+	if err != nil {
+		return windows.InvalidHandle, err
+	}
+
+	flags := uint32(windows.PIPE_ACCESS_DUPLEX | windows.FILE_FLAG_OVERLAPPED)
+	if first {
+		flags |= windows.FILE_FLAG_FIRST_PIPE_INSTANCE
+	}
+
+	return windows.CreateNamedPipe(name, flags,
+		windows.PIPE_TYPE_BYTE|windows.PIPE_READMODE_BYTE|windows.PIPE_WAIT|windows.PIPE_REJECT_REMOTE_CLIENTS,
+		windows.PIPE_UNLIMITED_INSTANCES, pipeBufferSize, pipeBufferSize, 0, l.sa)
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.closed {
+		return nil, net.ErrClosed
+	}
+
+	ev, err := windows.CreateEvent(nil, 1, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer windows.CloseHandle(ev)
+
+	o := windows.Overlapped{HEvent: ev}
+	err = windows.ConnectNamedPipe(l.next, &o)
+	switch {
+	case err == nil, errors.Is(err, windows.ERROR_PIPE_CONNECTED):
+	case errors.Is(err, windows.ERROR_IO_PENDING):
+		i, err := windows.WaitForMultipleObjects([]windows.Handle{ev, l.closing}, false, windows.INFINITE)
+		if err != nil {
+			return nil, err
+		}
+		if i == windows.WAIT_OBJECT_0+1 {
+			windows.CancelIoEx(l.next, &o)
+			var n uint32
+			windows.GetOverlappedResult(l.next, &o, &n, true)
+			return nil, net.ErrClosed
+		}
+
+		var n uint32
+		if err := windows.GetOverlappedResult(l.next, &o, &n, true); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	conn := &pipeConn{h: l.next, path: l.path}
+	if l.next, err = l.create(false); err != nil {
+		l.next = windows.InvalidHandle
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (l *pipeListener) Close() error {
+	l.closeOnce.Do(func() {
+		windows.SetEvent(l.closing)
+
+		l.lock.Lock()
+		defer l.lock.Unlock()
+
+		l.closed = true
+		if l.next != windows.InvalidHandle {
+			windows.CloseHandle(l.next)
+		}
+		windows.CloseHandle(l.closing)
+	})
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return pipeAddr(l.path)
+}
+
+func (c *pipeConn) Read(b []byte) (int, error) {
+	n, err := c.io(b, windows.ReadFile)
+	if errors.Is(err, windows.ERROR_BROKEN_PIPE) || errors.Is(err, windows.ERROR_PIPE_NOT_CONNECTED) {
+		return n, io.EOF
+	}
+	return n, err
+}
+
+func (c *pipeConn) Write(b []byte) (int, error) {
+	written := 0
+	for written < len(b) {
+		n, err := c.io(b[written:], windows.WriteFile)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// Run overlapped read or write and wait for it to complete or to be cancelled by Close.
+func (c *pipeConn) io(b []byte, op func(windows.Handle, []byte, *uint32, *windows.Overlapped) error) (int, error) {
+	c.ops.RLock()
+	defer c.ops.RUnlock()
+
+	if c.h == windows.InvalidHandle {
+		return 0, net.ErrClosed
+	}
+
+	ev, err := windows.CreateEvent(nil, 1, 0, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer windows.CloseHandle(ev)
+
+	var n uint32
+	o := windows.Overlapped{HEvent: ev}
+	err = op(c.h, b, &n, &o)
+	if errors.Is(err, windows.ERROR_IO_PENDING) {
+		err = windows.GetOverlappedResult(c.h, &o, &n, true)
+	}
+	if errors.Is(err, windows.ERROR_OPERATION_ABORTED) {
+		return int(n), net.ErrClosed
+	}
+	return int(n), err
+}
+
+func (c *pipeConn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		// cancel until pending operations return, operation started meanwhile is cancelled on the next try
+		for !c.ops.TryLock() {
+			windows.CancelIoEx(c.h, nil)
+			time.Sleep(time.Millisecond)
+		}
+		defer c.ops.Unlock()
+
+		// handle is closed without disconnecting, so the client can read the remaining responses
+		err = windows.CloseHandle(c.h)
+		c.h = windows.InvalidHandle
+	})
+	return err
+}
+
+func (c *pipeConn) LocalAddr() net.Addr  { return pipeAddr(c.path) }
+func (c *pipeConn) RemoteAddr() net.Addr { return pipeAddr(c.path) }
+
+func (c *pipeConn) SetDeadline(time.Time) error {
+	return errors.New("deadlines are not supported by named pipes")
+}
+
+func (c *pipeConn) SetReadDeadline(t time.Time) error  { return c.SetDeadline(t) }
+func (c *pipeConn) SetWriteDeadline(t time.Time) error { return c.SetDeadline(t) }
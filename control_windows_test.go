@@ -0,0 +1,91 @@
+//go:build windows
+
+package cog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+)
+
+func currentSID(t *testing.T) string {
+	user, err := windows.GetCurrentProcessToken().GetTokenUser()
+	require.NoError(t, err)
+	return user.User.Sid.String()
+}
+
+func TestPipeControl(t *testing.T) {
+	pipe := fmt.Sprintf("cog-test-%d", os.Getpid())
+	sid := currentSID(t)
+
+	peers := make(chan Peer, 1)
+	actors := make(chan string, 1)
+	c, err := New[controlTestConfig](WithHandler(&stubFileHandler{}), WithControlSocket(pipe),
+		WithControlAuthorizer(func(peer Peer, command string) error {
+			peers <- peer
+			return sameUser(peer, command)
+		}),
+		WithUpdateAuthorizer(func(actor string, _ Diff) error {
+			actors <- actor
+			return nil
+		}))
+	require.NoError(t, err)
+
+	_, err = listenControl(pipe)
+	assert.ErrorContains(t, err, "is in use")
+
+	resp, err := Control(pipe, ControlRequest{Command: ControlGet})
+	require.NoError(t, err)
+	assert.Empty(t, resp.Error)
+	assert.JSONEq(t, `{"Name":"app","Port":8080,"Token":""}`, string(resp.Config))
+	assert.Equal(t, Peer{UID: -1, GID: -1, PID: os.Getpid(), SID: sid}, <-peers)
+
+	// full pipe path is accepted as well
+	resp, err = Control(pipePrefix+pipe, ControlRequest{Command: ControlUpdate, Patch: json.RawMessage(`{"port":9090}`)})
+	require.NoError(t, err)
+	assert.Empty(t, resp.Error)
+	<-peers
+	assert.Equal(t, "sid:"+sid, <-actors)
+	assert.Equal(t, 9090, c.Config().Port)
+
+	require.NoError(t, c.Close())
+	_, err = Control(pipe, ControlRequest{Command: ControlGet})
+	assert.ErrorContains(t, err, "failed at connect control socket")
+}
+
+func TestPipeSameUser(t *testing.T) {
+	sid := currentSID(t)
+
+	assert.NoError(t, sameUser(Peer{UID: -1, GID: -1, SID: sid}, ControlGet))
+	assert.NoError(t, sameUser(Peer{UID: -1, GID: -1, SID: localSystemSID}, ControlUpdate))
+	// built-in users group
+	assert.ErrorIs(t, sameUser(Peer{UID: -1, GID: -1, SID: "S-1-5-32-545"}, ControlGet), ErrControlDenied)
+	assert.ErrorIs(t, sameUser(Peer{}, ControlGet), ErrControlDenied)
+
+	assert.Equal(t, "sid:"+sid, Peer{UID: -1, GID: -1, SID: sid}.actor())
+}
+
+func TestPipePath(t *testing.T) {
+	assert.Equal(t, `\\.\pipe\myapp-cog`, pipePath("myapp-cog"))
+	assert.Equal(t, `\\.\pipe\myapp-cog`, pipePath(`\\.\pipe\myapp-cog`))
+}
+
+func TestServiceControl(t *testing.T) {
+	c, err := New[controlTestConfig](WithHandler(&stubFileHandler{}))
+	require.NoError(t, err)
+	defer c.Close()
+
+	handled, err := c.ServiceControl(svc.ChangeRequest{Cmd: svc.ParamChange})
+	assert.True(t, handled)
+	assert.NoError(t, err)
+
+	handled, err = c.ServiceControl(svc.ChangeRequest{Cmd: svc.Interrogate})
+	assert.False(t, handled)
+	assert.NoError(t, err)
+}
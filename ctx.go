@@ -0,0 +1,105 @@
+package cog
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/leonidasdeim/cog/handlerapi"
+)
+
+// ContextHandler can be implemented by config handlers which are able to cancel long-running loads and saves,
+// e.g. remote stores. Context is the one passed to InitCtx or UpdateCtx.
+type ContextHandler = handlerapi.ContextHandler
+
+// Subscriber which receives context of the change, see AddSubscriberCtx.
+type SubscriberCtx[T any] func(ctx context.Context, config T) error
+
+// Create new cog instance configured with options. Context bounds loading and saving config on init:
+// if it is done, init fails with its error instead of falling back to snapshot or defaults.
+// Context is not used after init, background goroutines are stopped with the instance.
+// ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// c, err := cog.InitCtx[ConfigStruct](ctx, cog.WithHandler(h))
+func InitCtx[T any](ctx context.Context, opts ...Option) (*C[T], error) {
+	return newInstance[T](ctx, opts)
+}
+
+// Update configuration data, the change is abandoned if context is done before it is applied.
+// Context is passed to the update policy, to handlers implementing cog.ContextHandler and to subscribers registered
+// with AddSubscriberCtx. Subscribers are not called once context is done, the ones already notified are rolled back.
+// Once all subscribers have accepted the change, it is applied: cancelling context does not abandon or interrupt the save.
+func (cog *C[T]) UpdateCtx(ctx context.Context, new T) error {
+	return cog.updateCtx(ctx, "", replace(new), nil)
+}
+
+// Register subscriber which receives context of the change: context passed to UpdateCtx or InitCtx,
+// background context for other changes. It is called the same way as subscribers added with AddSubscriber.
+func (cog *C[T]) AddSubscriberCtx(f SubscriberCtx[T]) int {
+	return cog.addSubscriber(func(config T) error {
+		return f(cog.ChangeContext(), config)
+	}, funcName(f))
+}
+
+// Get context of the change being applied, background context if there is no change in progress
+// or change has no context. It is meant to be called from hooks and subscribers.
+func (cog *C[T]) ChangeContext() context.Context {
+	cog.lock.Lock()
+	defer cog.lock.Unlock()
+
+	if cog.changeCtx == nil {
+		return context.Background()
+	}
+	return cog.changeCtx
+}
+
+func (cog *C[T]) setChangeContext(ctx context.Context) {
+	cog.lock.Lock()
+	defer cog.lock.Unlock()
+
+	cog.changeCtx = ctx
+}
+
+// Load config document with context of the change.
+func (cog *C[T]) loadDoc(data any) error {
+	ctx := cog.ChangeContext()
+	if h, ok := cog.handler.(ContextHandler); ok {
+		return h.LoadContext(ctx, data)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return cog.handler.Load(data)
+}
+
+// Save config document with context of the change.
+func (cog *C[T]) saveDoc(data any) error {
+	ctx := cog.ChangeContext()
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("failed at save config: %w", err)
+	}
+	if h, ok := cog.handler.(ContextHandler); ok {
+		return h.SaveContext(ctx, data)
+	}
+	return cog.handler.Save(data)
+}
+
+// Context which keeps values of the parent, but is never cancelled.
+type detachedCtx struct {
+	context.Context
+}
+
+func withoutCancel(ctx context.Context) context.Context {
+	return detachedCtx{ctx}
+}
+
+func (detachedCtx) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedCtx) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedCtx) Err() error {
+	return nil
+}
@@ -1,86 +1,136 @@
 package cog
 
 import (
-	"os"
+	"encoding"
+	"fmt"
 	"reflect"
 	"strconv"
 )
 
 type getValue func(reflect.StructField) string
 
-var tagHandlers = []getValue{
-	environmentVariable("env"),
-	defaultValue("default"),
-}
+var (
+	defaultValue = firstValue(tagValue("default"), protoDefault)
+)
 
+// Set values from environment variables and default tags for the empty fields.
 func SetDefaults[T any](data *T) {
-	setNested(reflect.ValueOf(data).Elem())
+	r := resolver{
+		precedence: []Source{SourceFile, SourceEnv, SourceDefault},
+		layers:     map[Source]layer{SourceFile: {}},
+	}
+	r.resolve(reflect.ValueOf(data).Elem())
 }
 
-func environmentVariable(tag string) getValue {
+func tagValue(tag string) getValue {
 	return func(sf reflect.StructField) string {
-		if env := sf.Tag.Get(tag); env != "" {
-			return os.Getenv(env)
+		if val := sf.Tag.Get(tag); val != "" {
+			return val
 		}
 
 		return ""
 	}
 }
 
-func defaultValue(tag string) getValue {
+func firstValue(values ...getValue) getValue {
 	return func(sf reflect.StructField) string {
-		if val := sf.Tag.Get(tag); val != "" {
-			return val
+		for _, v := range values {
+			if val := v(sf); val != "" {
+				return val
+			}
 		}
 
 		return ""
 	}
 }
 
-func setNested(v reflect.Value) {
+// Default value of proto2 field from the tag of protobuf-generated struct, e.g. `protobuf:"varint,1,opt,name=port,def=8080"`.
+func protoDefault(sf reflect.StructField) string {
+	return protoTagValue(sf, "def")
+}
+
+// Walk through all non-struct fields of v, nested structs are traversed recursively.
+// Structs with custom marshaling, e.g. time.Time or Resource, are visited as values.
+func walkFields(v reflect.Value, prefix string, visit func(path string, sf reflect.StructField, f reflect.Value)) {
+	t := v.Type()
 	for i := 0; i < v.NumField(); i++ {
-		if v.Field(i).Kind() == reflect.Struct {
-			setNested(v.Field(i))
-		} else {
-			t := v.Type()
-			for i := 0; i < t.NumField(); i++ {
-				setField(t.Field(i), v.Field(i))
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+
+		path := prefix + sf.Name
+
+		if v.Field(i).Kind() == reflect.Struct && !isMarshaler(sf.Type) {
+			if sf.Anonymous {
+				walkFields(v.Field(i), prefix, visit)
+			} else {
+				walkFields(v.Field(i), path+".", visit)
 			}
+			continue
 		}
-	}
-}
 
-func setField(sf reflect.StructField, f reflect.Value) {
-	for _, getValue := range tagHandlers {
-		setValue(f, getValue(sf))
+		visit(path, sf, v.Field(i))
 	}
 }
 
-func setValue(field reflect.Value, val string) {
-	if val == "" || !isEmpty(field) || !field.CanSet() {
-		return
+func parseValue(field reflect.Value, val string) error {
+	var err error
+
+	if u, ok := textUnmarshalerOf(field); ok {
+		if err := u.UnmarshalText([]byte(val)); err != nil {
+			return fmt.Errorf("expected %s: %v", field.Type(), err)
+		}
+		return nil
 	}
 
 	switch field.Kind() {
-	case reflect.Int:
-		if val, err := strconv.Atoi(val); err == nil {
-			field.Set(reflect.ValueOf(int(val)).Convert(field.Type()))
+	case reflect.Pointer:
+		// optional scalar, e.g. proto3 optional field
+		v := reflect.New(field.Type().Elem())
+		if err := parseValue(v.Elem(), val); err != nil {
+			return err
+		}
+		field.Set(v)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var v int64
+		if v, err = strconv.ParseInt(val, 10, field.Type().Bits()); err == nil {
+			field.SetInt(v)
 		}
-	case reflect.Float32:
-		if val, err := strconv.ParseFloat(val, 32); err == nil {
-			field.Set(reflect.ValueOf(float32(val)).Convert(field.Type()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var v uint64
+		if v, err = strconv.ParseUint(val, 10, field.Type().Bits()); err == nil {
+			field.SetUint(v)
 		}
-	case reflect.Float64:
-		if val, err := strconv.ParseFloat(val, 64); err == nil {
-			field.Set(reflect.ValueOf(float64(val)).Convert(field.Type()))
+	case reflect.Float32, reflect.Float64:
+		var v float64
+		if v, err = strconv.ParseFloat(val, field.Type().Bits()); err == nil {
+			field.SetFloat(v)
 		}
 	case reflect.String:
-		field.Set(reflect.ValueOf(val).Convert(field.Type()))
+		field.SetString(val)
 	case reflect.Bool:
-		if val, err := strconv.ParseBool(val); err == nil {
-			field.Set(reflect.ValueOf(bool(val)).Convert(field.Type()))
+		var v bool
+		if v, err = strconv.ParseBool(val); err == nil {
+			field.SetBool(v)
 		}
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+
+	if err != nil {
+		return fmt.Errorf("expected %s: %v", field.Type(), err)
+	}
+	return nil
+}
+
+func textUnmarshalerOf(field reflect.Value) (encoding.TextUnmarshaler, bool) {
+	if !field.CanAddr() {
+		return nil, false
 	}
+	u, ok := field.Addr().Interface().(encoding.TextUnmarshaler)
+	return u, ok
 }
 
 func isEmpty(v reflect.Value) bool {
@@ -0,0 +1,37 @@
+package cog
+
+import "reflect"
+
+// Deriver can be implemented by config type to compute derived fields, e.g. address from host and port.
+// ComputeDerived is called after defaults are applied and fields are normalized, on every load and update.
+// Derived fields should be tagged with `derived:"true"`, so they are not persisted.
+type Deriver interface {
+	ComputeDerived()
+}
+
+// Field tagged with `derived:"true"` is computed by Deriver and is not persisted.
+func isDerived(sf reflect.StructField) bool {
+	return sf.Tag.Get("derived") == "true"
+}
+
+func derive[T any](data *T) {
+	if d, ok := any(data).(Deriver); ok {
+		d.ComputeDerived()
+	}
+}
+
+// Get copy of the config with derived fields zeroed.
+func stripDerived[T any](config T) T {
+	v := reflect.ValueOf(&config).Elem()
+	if v.Kind() != reflect.Struct {
+		return config
+	}
+
+	walkFields(v, "", func(_ string, sf reflect.StructField, f reflect.Value) {
+		if isDerived(sf) && f.CanSet() {
+			f.Set(reflect.Zero(f.Type()))
+		}
+	})
+
+	return config
+}
@@ -0,0 +1,185 @@
+package cog
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Change of a single config field.
+type Change struct {
+	// Path of struct field names, e.g. "Server.Port".
+	Path string
+	Old  any
+	New  any
+	// Owner of the field from `owner:"team"` tag, inherited from parent structs.
+	Owner string
+	// Field is tagged with `secret:"true"`.
+	Secret bool
+	// Field is tagged with `immutable:"true"`, inherited from parent structs. Update can not change it.
+	Immutable bool
+	// Field is tagged with `restart:"true"`, inherited from parent structs. Change takes effect only after restart.
+	RestartRequired bool
+}
+
+// Diff is a list of changed fields ordered as they appear in the config struct.
+type Diff []Change
+
+// Get sorted owners of the changed fields. Fields without owner are reported with empty owner.
+func (d Diff) Owners() []string {
+	set := map[string]bool{}
+	for _, c := range d {
+		set[c.Owner] = true
+	}
+
+	owners := make([]string, 0, len(set))
+	for o := range set {
+		owners = append(owners, o)
+	}
+	sort.Strings(owners)
+
+	return owners
+}
+
+// Get paths of the changed fields.
+func (d Diff) Paths() []string {
+	paths := []string{}
+	for _, c := range d {
+		paths = append(paths, c.Path)
+	}
+	return paths
+}
+
+// Get paths of the changed immutable fields.
+func (d Diff) Immutable() []string {
+	paths := []string{}
+	for _, c := range d {
+		if c.Immutable {
+			paths = append(paths, c.Path)
+		}
+	}
+	return paths
+}
+
+// Get paths of the changed fields which require restart.
+func (d Diff) RestartRequired() []string {
+	paths := []string{}
+	for _, c := range d {
+		if c.RestartRequired {
+			paths = append(paths, c.Path)
+		}
+	}
+	return paths
+}
+
+// Format diff one change per line, secret values are masked.
+func (d Diff) String() string {
+	b := strings.Builder{}
+	for _, c := range d {
+		old, new := c.Old, c.New
+		if c.Secret {
+			old, new = "[secret]", "[secret]"
+		}
+		fmt.Fprintf(&b, "%s: %v -> %v\n", c.Path, old, new)
+	}
+	return b.String()
+}
+
+func diff[T any](old, new T) Diff {
+	d := Diff{}
+
+	o := reflect.ValueOf(&old).Elem()
+	n := reflect.ValueOf(&new).Elem()
+
+	if o.Kind() != reflect.Struct {
+		if od, ok := any(old).(map[string]any); ok {
+			diffDoc(od, any(new).(map[string]any), "", &d)
+			return d
+		}
+		if !reflect.DeepEqual(old, new) {
+			d = append(d, Change{Old: old, New: new})
+		}
+		return d
+	}
+
+	diffFields(o, n, "", Change{}, &d)
+	return d
+}
+
+// Compare fields, owner, immutable and restart tags are inherited from parent.
+func diffFields(old, new reflect.Value, prefix string, parent Change, d *Diff) {
+	t := old.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+
+		p := parent
+		if tag := sf.Tag.Get("owner"); tag != "" {
+			p.Owner = tag
+		}
+		p.Immutable = p.Immutable || sf.Tag.Get("immutable") == "true"
+		p.RestartRequired = p.RestartRequired || sf.Tag.Get("restart") == "true"
+
+		of, nf := old.Field(i), new.Field(i)
+
+		if of.Kind() == reflect.Struct && !isMarshaler(of.Type()) {
+			if sf.Anonymous {
+				diffFields(of, nf, prefix, p, d)
+			} else {
+				diffFields(of, nf, prefix+sf.Name+".", p, d)
+			}
+			continue
+		}
+
+		if !reflect.DeepEqual(of.Interface(), nf.Interface()) {
+			p.Path = prefix + sf.Name
+			p.Old = of.Interface()
+			p.New = nf.Interface()
+			p.Secret = isSecret(sf)
+			*d = append(*d, p)
+		}
+	}
+}
+
+// Compare raw documents key by key in sorted order, nested tables are compared recursively.
+// Added and removed keys are reported with nil value.
+func diffDoc(old, new map[string]any, prefix string, d *Diff) {
+	keys := []string{}
+	for k := range old {
+		keys = append(keys, k)
+	}
+	for k := range new {
+		if _, ok := old[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		ov, nv := old[k], new[k]
+
+		om, ok1 := ov.(map[string]any)
+		nm, ok2 := nv.(map[string]any)
+		if ok1 && ok2 {
+			diffDoc(om, nm, prefix+k+".", d)
+			continue
+		}
+
+		if !sameValue(ov, nv) {
+			*d = append(*d, Change{Path: prefix + k, Old: ov, New: nv})
+		}
+	}
+}
+
+// Numbers are decoded to different types by formats, e.g. float64 by JSON and int64 by TOML.
+func sameValue(a, b any) bool {
+	if x, ok := number(reflect.ValueOf(a)); ok {
+		y, ok := number(reflect.ValueOf(b))
+		return ok && x == y
+	}
+	return reflect.DeepEqual(a, b)
+}
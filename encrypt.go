@@ -0,0 +1,160 @@
+package cog
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+const encryptedPrefix = "enc:v1:"
+
+var ErrDecryption = errors.New("config field can not be decrypted")
+
+// KeyProvider provides AES keys (16, 24 or 32 bytes) for field encryption.
+// Encrypted value keeps id of the key, so keys can be rotated.
+type KeyProvider interface {
+	// Get key by id.
+	Key(id string) ([]byte, error)
+	// Get id of the key used to encrypt new values.
+	CurrentKeyID() string
+}
+
+type staticKey []byte
+
+// Use single static key for field encryption.
+func StaticKey(key []byte) KeyProvider {
+	return staticKey(key)
+}
+
+func (k staticKey) Key(id string) ([]byte, error) {
+	if id != k.CurrentKeyID() {
+		return nil, fmt.Errorf("unknown key id: %s", id)
+	}
+	return k, nil
+}
+
+func (k staticKey) CurrentKeyID() string {
+	return "default"
+}
+
+// Get copy of the config with secret string fields encrypted.
+func encryptFields[T any](config T, kp KeyProvider) (T, error) {
+	if kp == nil {
+		return config, nil
+	}
+
+	v := reflect.ValueOf(&config).Elem()
+	if v.Kind() != reflect.Struct {
+		return config, nil
+	}
+
+	var err error
+	walkFields(v, "", func(path string, sf reflect.StructField, f reflect.Value) {
+		if err != nil || !isSecret(sf) || f.Kind() != reflect.String || f.String() == "" || strings.HasPrefix(f.String(), encryptedPrefix) {
+			return
+		}
+
+		var enc string
+		if enc, err = encryptValue(f.String(), kp); err != nil {
+			err = fmt.Errorf("failed at encrypt field %s: %v", path, err)
+			return
+		}
+		f.SetString(enc)
+	})
+
+	return config, err
+}
+
+// Decrypt encrypted secret string fields of the config.
+func decryptFields[T any](config *T, kp KeyProvider) error {
+	if kp == nil {
+		return nil
+	}
+
+	v := reflect.ValueOf(config).Elem()
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var err error
+	walkFields(v, "", func(path string, sf reflect.StructField, f reflect.Value) {
+		if err != nil || !isSecret(sf) || f.Kind() != reflect.String || !strings.HasPrefix(f.String(), encryptedPrefix) {
+			return
+		}
+
+		var dec string
+		if dec, err = decryptValue(f.String(), kp); err != nil {
+			err = fmt.Errorf("%w: %s: %v", ErrDecryption, path, err)
+			return
+		}
+		f.SetString(dec)
+	})
+
+	return err
+}
+
+// Encrypt value with AES-GCM, result is "enc:v1:<key id>:<base64 of nonce and ciphertext>".
+func encryptValue(value string, kp KeyProvider) (string, error) {
+	id := kp.CurrentKeyID()
+
+	gcm, err := newGCM(kp, id)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(value), nil)
+	return encryptedPrefix + id + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func decryptValue(value string, kp KeyProvider) (string, error) {
+	id, data, ok := strings.Cut(strings.TrimPrefix(value, encryptedPrefix), ":")
+	if !ok {
+		return "", fmt.Errorf("bad encrypted value format")
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return "", err
+	}
+
+	gcm, err := newGCM(kp, id)
+	if err != nil {
+		return "", err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return "", fmt.Errorf("bad encrypted value length")
+	}
+
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plain), nil
+}
+
+func newGCM(kp KeyProvider, id string) (cipher.AEAD, error) {
+	key, err := kp.Key(id)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
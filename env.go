@@ -0,0 +1,173 @@
+package cog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+	"unicode"
+)
+
+const envTag = "env"
+
+// EnvVar describes environment variable consulted for the config field.
+type EnvVar struct {
+	Name     string `json:"name"`
+	Field    string `json:"field"`
+	Type     string `json:"type"`
+	Default  string `json:"default,omitempty"`
+	Required bool   `json:"required,omitempty"`
+}
+
+// Format of the environment variables reference, see WriteEnvDocs.
+type EnvDocFormat string
+
+const (
+	EnvDocText     EnvDocFormat = "text"
+	EnvDocMarkdown EnvDocFormat = "markdown"
+	EnvDocJSON     EnvDocFormat = "json"
+)
+
+// List every environment variable cog consults for config T with the given options:
+// explicit `env` tags and names derived with cog.WithEnvPrefix.
+func EnvVars[T any](opts ...Option) []EnvVar {
+	o := &Optional{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	vars := []EnvVar{}
+
+	v := reflect.ValueOf(new(T)).Elem()
+	if v.Kind() != reflect.Struct {
+		return vars
+	}
+
+	walkFields(v, "", func(path string, sf reflect.StructField, f reflect.Value) {
+		name := envName(path, sf, o.EnvPrefix)
+		if name == "" {
+			return
+		}
+
+		vars = append(vars, EnvVar{
+			Name:     name,
+			Field:    path,
+			Type:     f.Type().String(),
+			Default:  defaultValue(sf),
+			Required: hasRule(sf.Tag.Get("validate"), "required"),
+		})
+	})
+
+	return vars
+}
+
+// Write reference of the environment variables consulted for config T, e.g. for onboarding docs or Helm values.
+func WriteEnvDocs[T any](w io.Writer, format EnvDocFormat, opts ...Option) error {
+	vars := EnvVars[T](opts...)
+
+	switch format {
+	case EnvDocJSON:
+		e := json.NewEncoder(w)
+		e.SetIndent("", "  ")
+		return e.Encode(vars)
+
+	case EnvDocMarkdown:
+		fmt.Fprintln(w, "| Variable | Field | Type | Default | Required |")
+		fmt.Fprintln(w, "|---|---|---|---|---|")
+		for _, v := range vars {
+			fmt.Fprintf(w, "| `%s` | `%s` | `%s` | %s | %s |\n", v.Name, v.Field, v.Type, code(v.Default), yesNo(v.Required))
+		}
+		return nil
+
+	case EnvDocText:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "VARIABLE\tFIELD\tTYPE\tDEFAULT\tREQUIRED")
+		for _, v := range vars {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", v.Name, v.Field, v.Type, v.Default, yesNo(v.Required))
+		}
+		return tw.Flush()
+	}
+
+	return fmt.Errorf("unknown env docs format: %s", format)
+}
+
+// Get name of the environment variable consulted for the field: value of the `env` tag, or name derived
+// from the field path if prefix is set, e.g. "APP_SERVER_MAX_CONNS" for Server.MaxConns.
+// Tag `env:"-"` disables environment variable for the field.
+func envName(path string, sf reflect.StructField, prefix string) string {
+	switch tag := sf.Tag.Get(envTag); tag {
+	case "-":
+		return ""
+	case "":
+	default:
+		return tag
+	}
+
+	if prefix == "" || !envSupported(sf.Type) {
+		return ""
+	}
+
+	parts := []string{strings.TrimSuffix(prefix, "_")}
+	for _, name := range strings.Split(path, ".") {
+		parts = append(parts, screamingSnake(name))
+	}
+	return strings.Join(parts, "_")
+}
+
+// Check if the value of the type can be parsed from the environment variable.
+func envSupported(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if reflect.PtrTo(t).Implements(textUnmarshaler) {
+		return true
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.String, reflect.Bool:
+		return true
+	}
+	return false
+}
+
+// Convert field name to upper snake case, e.g. "MaxConns" to "MAX_CONNS" and "APIKey" to "API_KEY".
+func screamingSnake(name string) string {
+	r := []rune(name)
+	b := strings.Builder{}
+
+	for i, c := range r {
+		if i > 0 && unicode.IsUpper(c) && (unicode.IsLower(r[i-1]) || (i+1 < len(r) && unicode.IsLower(r[i+1]) && unicode.IsUpper(r[i-1]))) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(c))
+	}
+
+	return b.String()
+}
+
+func hasRule(tag, rule string) bool {
+	for _, r := range strings.Split(tag, ",") {
+		if r == rule {
+			return true
+		}
+	}
+	return false
+}
+
+func code(s string) string {
+	if s == "" {
+		return ""
+	}
+	return "`" + s + "`"
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
@@ -31,7 +31,7 @@ func SubscriberBad(config Config) error {
 }
 
 func main() {
-	c, err := cog.Init[Config]()
+	c, err := cog.New[Config]()
 	if err != nil {
 		fmt.Printf("Error at initialize cog: %v", err)
 		return
@@ -12,7 +12,7 @@ type Config struct {
 }
 
 func main() {
-	c, err := cog.Init[Config]()
+	c, err := cog.New[Config]()
 	if err != nil {
 		fmt.Printf("Error at initialize cog: %v", err)
 		return
@@ -16,13 +16,13 @@ type Config struct {
 
 func main() {
 	h1, _ := fh.New(fh.WithName("file1"))
-	_, err := cog.Init[Config](h1)
+	_, err := cog.New[Config](cog.WithHandler(h1))
 	if err == nil {
 		fmt.Println("Config with 'file1' successfully initialized.")
 	}
 
 	h2, _ := fh.New(fh.WithName("file2"))
-	_, err = cog.Init[Config](h2)
+	_, err = cog.New[Config](cog.WithHandler(h2))
 	if err != nil {
 		fmt.Println("Validation failed for config using 'file2':")
 		fmt.Println(err)
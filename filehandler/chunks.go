@@ -0,0 +1,69 @@
+package filehandler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+var manifestMagic = []byte("cog-chunks:")
+
+// Manifest is stored in place of the value which has been split to chunks.
+// It is used by handlers of the key-value stores to keep values exceeding value size limit.
+type Manifest struct {
+	Chunks int    `json:"chunks"`
+	Size   int    `json:"size"`
+	Sum    string `json:"sha256"`
+}
+
+// Split value to chunks of at most size bytes. Returns manifest to store in place of the value.
+func SplitChunks(b []byte, size int) ([]byte, [][]byte) {
+	sum := sha256.Sum256(b)
+	m := Manifest{Size: len(b), Sum: hex.EncodeToString(sum[:])}
+
+	chunks := [][]byte{}
+	for len(b) > size {
+		chunks = append(chunks, b[:size])
+		b = b[size:]
+	}
+	chunks = append(chunks, b)
+	m.Chunks = len(chunks)
+
+	manifest, _ := json.Marshal(m)
+
+	return append(append([]byte{}, manifestMagic...), manifest...), chunks
+}
+
+// Parse manifest, false if the value is not a manifest but plain value.
+func ParseManifest(b []byte) (Manifest, bool) {
+	if !bytes.HasPrefix(b, manifestMagic) {
+		return Manifest{}, false
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(b[len(manifestMagic):], &m); err != nil || m.Chunks <= 0 {
+		return Manifest{}, false
+	}
+
+	return m, true
+}
+
+// Join chunks and verify them against the manifest. Mismatch means that chunks are being written
+// by another writer or are incomplete.
+func JoinChunks(m Manifest, chunks [][]byte) ([]byte, error) {
+	b := bytes.Join(chunks, nil)
+
+	sum := sha256.Sum256(b)
+	if len(chunks) != m.Chunks || len(b) != m.Size || hex.EncodeToString(sum[:]) != m.Sum {
+		return nil, fmt.Errorf("chunks do not match manifest")
+	}
+
+	return b, nil
+}
+
+// Get name of the chunk stored next to the value, e.g. "app.chunk.0".
+func ChunkName(name string, i int) string {
+	return fmt.Sprintf("%s.chunk.%d", name, i)
+}
@@ -0,0 +1,130 @@
+package filehandler
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+)
+
+// FileIO reading and writing files with a custom codec, see WithCodec.
+type codecIO struct {
+	m     sync.Mutex
+	codec Codec
+}
+
+func (c *codecIO) Write(data any, file string) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	b, err := c.codec.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	if err := Utils.WriteFile(file, b); err != nil {
+		return fmt.Errorf("failed at write to %s file: %v", c.codec.GetExtension(), err)
+	}
+
+	return nil
+}
+
+func (c *codecIO) Read(data any, file string) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed at open %s file: %w", c.codec.GetExtension(), err)
+	}
+
+	if err := c.codec.Unmarshal(b, data); err != nil {
+		return fmt.Errorf("failed at reading from %s file: %v", c.codec.GetExtension(), err)
+	}
+
+	return nil
+}
+
+func (c *codecIO) Marshal(data any) ([]byte, error) {
+	return c.codec.Marshal(data)
+}
+
+func (c *codecIO) Unmarshal(b []byte, data any) error {
+	return c.codec.Unmarshal(b, data)
+}
+
+func (c *codecIO) GetExtension() string {
+	return c.codec.GetExtension()
+}
+
+type protoCodec struct {
+	ext       string
+	marshal   func(any) ([]byte, error)
+	unmarshal func([]byte, any) error
+}
+
+// Create codec for protobuf-generated config, so cog does not depend on protobuf runtime.
+// Functions receive proto messages only, e.g. protojson or prototext adapters:
+//
+//	fh.NewProtoCodec("json",
+//	    func(m any) ([]byte, error) { return protojson.Marshal(m.(proto.Message)) },
+//	    func(b []byte, m any) error { return protojson.Unmarshal(b, m.(proto.Message)) })
+//
+// Other values, e.g. raw documents used to detect which fields are present, are handled by encoding/json
+// if extension is "json" and fail otherwise.
+func NewProtoCodec(ext string, marshal func(any) ([]byte, error), unmarshal func([]byte, any) error) Codec {
+	return &protoCodec{ext: ext, marshal: marshal, unmarshal: unmarshal}
+}
+
+func (c *protoCodec) Marshal(data any) ([]byte, error) {
+	if m, ok := protoMessage(data); ok {
+		return c.marshal(m)
+	}
+	if c.ext == "json" {
+		return json.Marshal(data)
+	}
+	return nil, fmt.Errorf("%T is not a proto message", data)
+}
+
+func (c *protoCodec) Unmarshal(b []byte, data any) error {
+	if isProtoMessage(data) {
+		return c.unmarshal(b, data)
+	}
+	if c.ext == "json" {
+		return json.Unmarshal(b, data)
+	}
+	return fmt.Errorf("%T is not a proto message", data)
+}
+
+func (c *protoCodec) GetExtension() string {
+	return c.ext
+}
+
+// Get proto message of the value, messages are passed to save by value, so pointer to the copy is created.
+func protoMessage(data any) (any, bool) {
+	if isProtoMessage(data) {
+		return data, true
+	}
+
+	v := reflect.ValueOf(data)
+	if !v.IsValid() || v.Kind() == reflect.Pointer {
+		return nil, false
+	}
+
+	p := reflect.New(v.Type())
+	p.Elem().Set(v)
+	if isProtoMessage(p.Interface()) {
+		return p.Interface(), true
+	}
+
+	return nil, false
+}
+
+func isProtoMessage(data any) bool {
+	if data == nil {
+		return false
+	}
+	_, ok := reflect.TypeOf(data).MethodByName("ProtoReflect")
+	return ok
+}
@@ -0,0 +1,92 @@
+package filehandler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// Compressor compresses marshaled config. Compressed data has to start with the magic header,
+// so compressed and plain data can be told apart on read.
+// Other algorithms, e.g. zstd, can be plugged in by implementing it.
+type Compressor interface {
+	Magic() []byte
+	Compress(b []byte) ([]byte, error)
+	Decompress(b []byte) ([]byte, error)
+}
+
+// Gzip compressor with default compression level.
+var Gzip Compressor = gzipCompressor{}
+
+type gzipCompressor struct{}
+
+func (gzipCompressor) Magic() []byte {
+	return []byte{0x1f, 0x8b}
+}
+
+func (gzipCompressor) Compress(b []byte) ([]byte, error) {
+	buf := bytes.Buffer{}
+	w := gzip.NewWriter(&buf)
+
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (gzipCompressor) Decompress(b []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
+
+type compressedCodec struct {
+	Codec
+	write Compressor
+	read  []Compressor
+}
+
+// Wrap codec to compress marshaled data. On unmarshal compressor is detected by the magic header:
+// data compressed by the given compressor or any of the additional ones and plain data are accepted,
+// so compression can be enabled or changed without migrating stored values.
+func Compressed(c Codec, compressor Compressor, more ...Compressor) Codec {
+	return &compressedCodec{
+		Codec: c,
+		write: compressor,
+		read:  append([]Compressor{compressor}, more...),
+	}
+}
+
+func (c *compressedCodec) Marshal(data any) ([]byte, error) {
+	b, err := c.Codec.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.write.Compress(b)
+}
+
+func (c *compressedCodec) Unmarshal(b []byte, data any) error {
+	for _, r := range c.read {
+		if !bytes.HasPrefix(b, r.Magic()) {
+			continue
+		}
+
+		plain, err := r.Decompress(b)
+		if err != nil {
+			return fmt.Errorf("failed at decompress: %v", err)
+		}
+		return c.Codec.Unmarshal(plain, data)
+	}
+
+	return c.Codec.Unmarshal(b, data)
+}
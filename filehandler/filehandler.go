@@ -1,8 +1,14 @@
 package filehandler
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io/fs"
+	"os"
 	"path/filepath"
+	"sync"
 )
 
 const (
@@ -11,14 +17,35 @@ const (
 )
 
 type FileHandler struct {
-	file   string
-	fileIO FileIO
+	file          string
+	defaultFile   string
+	dir           string
+	fileIO        FileIO
+	sections      []section
+	readOnly      bool
+	templated     bool
+	created       bool
+	minimalDiff   bool
+	overridesFile string
+	preprocessors []Preprocessor
+	rawLock       sync.Mutex
+	raw           []byte
 }
 
 type Optional struct {
-	Name string
-	Path string
-	Type FileType
+	Name           string
+	Path           string
+	Type           FileType
+	Sections       []Section
+	ReadOnly       bool
+	Codec          Codec
+	Preprocessors  []Preprocessor
+	Template       bool
+	TypePrecedence []FileType
+	Overrides      []Override
+	Format         Format
+	MinimalDiff    bool
+	OverridesFile  bool
 }
 
 type Option func(f *Optional)
@@ -48,17 +75,35 @@ func WithType(t FileType) Option {
 	}
 }
 
-func New(opts ...Option) (*FileHandler, error) {
+// Set order in which DYNAMIC type is resolved, e.g. WithTypePrecedence(YAML, JSON): the first type which default
+// config file exists is used. Without it, default config files of several types make New fail with ErrAmbiguousType.
+func WithTypePrecedence(types ...FileType) Option {
+	return func(o *Optional) {
+		o.TypePrecedence = types
+	}
+}
 
-	// Set defaults
-	o := &Optional{
-		Name: "app",
-		Path: Utils.GetWorkDir(),
-		Type: DYNAMIC,
+// Do not create or write any files. Default config file is loaded if active config file does not exist.
+// It is useful for validation of the config without side effects.
+func WithReadOnly() Option {
+	return func(o *Optional) {
+		o.ReadOnly = true
 	}
+}
 
-	for _, opt := range opts {
-		opt(o)
+// Use custom codec instead of the builtin file types, e.g. filehandler.NewProtoCodec.
+// Files are named by the extension of the codec.
+func WithCodec(c Codec) Option {
+	return func(o *Optional) {
+		o.Codec = c
+	}
+}
+
+func New(opts ...Option) (*FileHandler, error) {
+	o := optional(opts)
+
+	if err := checkAmbiguity(o); err != nil {
+		return nil, err
 	}
 
 	h := FileHandler{}
@@ -68,22 +113,167 @@ func New(opts ...Option) (*FileHandler, error) {
 	}
 
 	e := h.fileIO.GetExtension()
+	h.dir, _ = filepath.Abs(o.Path)
 	h.file = filepath.Join(o.Path, fmt.Sprintf(activeConfig, o.Name, e))
-	defaultFile := filepath.Join(o.Path, fmt.Sprintf(defaultConfig, o.Name, e))
+	h.defaultFile = filepath.Join(o.Path, fmt.Sprintf(defaultConfig, o.Name, e))
+
+	sections, err := buildSections(o)
+	if err != nil {
+		return nil, err
+	}
+	h.sections = sections
+
+	if o.OverridesFile {
+		if len(sections) > 0 {
+			return nil, fmt.Errorf("overrides file can not be used with section files")
+		}
+		h.overridesFile = filepath.Join(o.Path, fmt.Sprintf(overridesConfig, o.Name, e))
+	}
+	h.readOnly = o.ReadOnly
+	h.templated = o.Template
+	h.preprocessors = o.Preprocessors
+	h.minimalDiff = o.MinimalDiff
+
+	if h.readOnly {
+		return &h, nil
+	}
 
-	if err := h.initActiveFile(defaultFile, h.file); err != nil {
+	if err := h.initActiveFile(h.defaultFile, h.file); err != nil {
 		return nil, err
 	}
 
 	return &h, nil
 }
 
+func optional(opts []Option) *Optional {
+
+	// Set defaults
+	o := &Optional{
+		Name: "app",
+		Path: Utils.GetWorkDir(),
+		Type: DYNAMIC,
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return o
+}
+
 func (h *FileHandler) Load(data any) error {
-	return h.fileIO.Read(data, h.file)
+	raw, err := h.read(data, h.loadedFile(), true)
+	h.setRaw(raw)
+	if err != nil {
+		return err
+	}
+
+	if err := h.loadOverrides(data); err != nil {
+		return err
+	}
+	return h.loadSections(data)
 }
 
 func (h *FileHandler) Save(data any) error {
-	return h.fileIO.Write(data, h.file)
+	if h.readOnly {
+		return fmt.Errorf("file handler is read-only")
+	}
+	if h.templated {
+		return fmt.Errorf("config file is a template, rendered config can not be saved")
+	}
+
+	if h.overridesFile != "" {
+		return h.saveOverrides(data)
+	}
+	if len(h.sections) > 0 {
+		return h.saveSections(data)
+	}
+	return h.write(data, h.file)
+}
+
+// Check if config files can not be written: handler has been created with WithReadOnly or WithTemplate.
+func (h *FileHandler) ReadOnly() bool {
+	return h.readOnly || h.templated
+}
+
+// Load default config file. It is used as a separate source for the fields missing in the active config file.
+func (h *FileHandler) LoadDefault(data any) error {
+	_, err := h.read(data, h.defaultFile, false)
+	return err
+}
+
+// Get SHA-256 checksum of the config files, see Files.
+func (h *FileHandler) Checksum() (string, error) {
+	sum := sha256.New()
+
+	for i, f := range h.Files() {
+		b, err := os.ReadFile(f)
+		// files other than the active one are optional
+		if err != nil && (i == 0 || !errors.Is(err, fs.ErrNotExist)) {
+			return "", err
+		}
+		sum.Write(b)
+		sum.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+// Get paths of the files config is loaded from: active config file, overrides file and section files.
+func (h *FileHandler) Files() []string {
+	files := []string{h.file}
+	if h.overridesFile != "" {
+		files = append(files, h.overridesFile)
+	}
+	for _, s := range h.sections {
+		files = append(files, s.file)
+	}
+	return files
+}
+
+// Get content of the config file read by the last Load, before preprocessing and decoding.
+// Section files are not included.
+func (h *FileHandler) Raw() []byte {
+	h.rawLock.Lock()
+	defer h.rawLock.Unlock()
+
+	return h.raw
+}
+
+func (h *FileHandler) setRaw(b []byte) {
+	h.rawLock.Lock()
+	defer h.rawLock.Unlock()
+
+	h.raw = b
+}
+
+// Get absolute path of the directory where config files are located.
+func (h *FileHandler) Dir() string {
+	return h.dir
+}
+
+// Get absolute path of the config file which is loaded: active config file,
+// or default config file if read-only handler has no active config file.
+func (h *FileHandler) Location() string {
+	file := h.loadedFile()
+
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return file
+	}
+	return abs
+}
+
+// Check if active config file has been created from the default config file by New.
+func (h *FileHandler) Created() bool {
+	return h.created
+}
+
+func (h *FileHandler) loadedFile() string {
+	if h.readOnly && !Utils.FileExists(h.file) {
+		return h.defaultFile
+	}
+	return h.file
 }
 
 func (h *FileHandler) initActiveFile(defaultFile string, activeFile string) error {
@@ -95,6 +285,19 @@ func (h *FileHandler) initActiveFile(defaultFile string, activeFile string) erro
 		return nil
 	}
 
+	if len(h.preprocessors) > 0 {
+		// default file is copied as is, so it is not decoded before preprocessing, e.g. templates are kept
+		b, err := os.ReadFile(defaultFile)
+		if err != nil {
+			return err
+		}
+		if err := Utils.WriteFile(activeFile, b); err != nil {
+			return err
+		}
+		h.created = true
+		return nil
+	}
+
 	var t interface{}
 
 	if err := h.fileIO.Read(&t, defaultFile); err != nil {
@@ -104,6 +307,7 @@ func (h *FileHandler) initActiveFile(defaultFile string, activeFile string) erro
 	if err := h.fileIO.Write(t, activeFile); err != nil {
 		return err
 	}
+	h.created = true
 
 	return nil
 }
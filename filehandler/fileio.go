@@ -1,10 +1,14 @@
 package filehandler
 
 import (
+	"errors"
 	"fmt"
 	"path/filepath"
+	"strings"
 )
 
+var ErrAmbiguousType = errors.New("dynamic file type is ambiguous")
+
 type FileType string
 
 const (
@@ -26,8 +30,31 @@ type FileIO interface {
 	GetExtension() string
 }
 
+// Codec converts data to and from bytes of the given format.
+// It is used by handlers which keep config outside of the file system.
+type Codec interface {
+	Marshal(data any) ([]byte, error)
+	Unmarshal(b []byte, data any) error
+	GetExtension() string
+}
+
 func BuildFileIO(o *Optional) FileIO {
-	switch resolveType(o) {
+	if o.Codec != nil {
+		return overridden(&codecIO{codec: o.Codec}, o.Overrides)
+	}
+	return overridden(withFormat(build(resolveType(o)), o.Format), o.Overrides)
+}
+
+// Get codec of the given file type. Returns nil for DYNAMIC or unknown type.
+func NewCodec(t FileType) Codec {
+	if c, ok := build(t).(Codec); ok {
+		return c
+	}
+	return nil
+}
+
+func build(t FileType) FileIO {
+	switch t {
 	case JSON:
 		return &Json{}
 	case YAML:
@@ -44,10 +71,27 @@ func resolveType(o *Optional) FileType {
 		return o.Type
 	}
 
-	for _, t := range availableImpl {
-		if Utils.FileExists(filepath.Join(o.Path, fmt.Sprintf(defaultConfig, o.Name, t))) {
-			return t
-		}
+	if types := defaultTypes(o); len(types) > 0 {
+		return types[0]
 	}
 	return JSON
 }
+
+// Check that DYNAMIC type is resolved by a single default config file or by explicit precedence.
+func checkAmbiguity(o *Optional) error {
+	if o.Type != DYNAMIC || o.Codec != nil || len(o.TypePrecedence) > 0 {
+		return nil
+	}
+
+	types := defaultTypes(o)
+	if len(types) < 2 {
+		return nil
+	}
+
+	files := make([]string, 0, len(types))
+	for _, t := range types {
+		files = append(files, filepath.Join(o.Path, fmt.Sprintf(defaultConfig, o.Name, t)))
+	}
+	return fmt.Errorf("%w: default config files %s exist, specify type with WithType or order with WithTypePrecedence",
+		ErrAmbiguousType, strings.Join(files, ", "))
+}
@@ -0,0 +1,120 @@
+package filehandler
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type fuzzConfig struct {
+	Name    string            `json:"name" yaml:"name" toml:"name"`
+	Port    int               `json:"port" yaml:"port" toml:"port"`
+	Ratio   float64           `json:"ratio" yaml:"ratio" toml:"ratio"`
+	Enabled bool              `json:"enabled" yaml:"enabled" toml:"enabled"`
+	Tags    []string          `json:"tags" yaml:"tags" toml:"tags"`
+	Labels  map[string]string `json:"labels" yaml:"labels" toml:"labels"`
+	Timeout time.Duration     `json:"timeout" yaml:"timeout" toml:"timeout"`
+	Server  struct {
+		Host string `json:"host" yaml:"host" toml:"host"`
+		Port uint16 `json:"port" yaml:"port" toml:"port"`
+	} `json:"server" yaml:"server" toml:"server"`
+}
+
+var fuzzSeeds = map[FileType][]string{
+	JSON: {
+		`{"name":"app","port":8080,"ratio":0.5,"enabled":true,"tags":["a","b"],"labels":{"k":"v"},"server":{"host":"localhost","port":80}}`,
+		`{}`,
+		`[]`,
+		`{"port":1e400}`,
+		`{"name":"\ud800"}`,
+		`{"server":{"port":-1}}`,
+		`{"a":{"b":{"c":{"d":[[[[]]]]}}}}`,
+	},
+	YAML: {
+		"name: app\nport: 8080\nratio: 0.5\nenabled: true\ntags: [a, b]\nlabels:\n  k: v\nserver:\n  host: localhost\n  port: 80\n",
+		"",
+		"---\n",
+		"a: &a [*a]\n",
+		"ratio: .nan\nport: 0x1F\n",
+		"? [a, b]\n: c\n",
+		"name: !!binary aGVsbG8=\n",
+	},
+	TOML: {
+		"name = \"app\"\nport = 8080\nratio = 0.5\nenabled = true\ntags = [\"a\", \"b\"]\n[labels]\nk = \"v\"\n[server]\nhost = \"localhost\"\nport = 80\n",
+		"",
+		"ratio = nan\nport = 0x1F\n",
+		"[a.b.c]\nd = 1979-05-27T07:32:00Z\n",
+		"[[arr]]\n[[arr]]\nx = 1\n",
+		"a = \"\"\"\nmultiline\"\"\"\n",
+	},
+}
+
+func FuzzJsonRead(f *testing.F) {
+	fuzzRead(f, JSON)
+}
+
+func FuzzYamlRead(f *testing.F) {
+	fuzzRead(f, YAML)
+}
+
+func FuzzTomlRead(f *testing.F) {
+	fuzzRead(f, TOML)
+}
+
+// Read arbitrary bytes to map and struct, it must not panic. Documents which can be read are
+// written back and must be read again, repeated write of the same document must be stable.
+func fuzzRead(f *testing.F, t FileType) {
+	for _, seed := range fuzzSeeds[t] {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(tt *testing.T, data []byte) {
+		fileIO := build(t)
+		file := filepath.Join(tt.TempDir(), "config."+fileIO.GetExtension())
+
+		if err := os.WriteFile(file, data, filePermissions); err != nil {
+			tt.Fatal(err)
+		}
+
+		var typed fuzzConfig
+		_ = fileIO.Read(&typed, file)
+
+		var doc map[string]any
+		if err := fileIO.Read(&doc, file); err != nil {
+			return
+		}
+
+		first := roundTrip(tt, fileIO, doc, file)
+		second := roundTrip(tt, fileIO, first, file)
+		if !bytes.Equal(write(tt, fileIO, first, file), write(tt, fileIO, second, file)) {
+			tt.Errorf("repeated write is not stable for input %q", data)
+		}
+	})
+}
+
+func roundTrip(t *testing.T, fileIO FileIO, doc map[string]any, file string) map[string]any {
+	write(t, fileIO, doc, file)
+
+	var got map[string]any
+	if err := fileIO.Read(&got, file); err != nil {
+		b, _ := os.ReadFile(file)
+		t.Fatalf("written document can not be read: %v\n%s", err, b)
+	}
+
+	return got
+}
+
+func write(t *testing.T, fileIO FileIO, doc map[string]any, file string) []byte {
+	if err := fileIO.Write(doc, file); err != nil {
+		t.Skipf("document can not be written: %v", err)
+	}
+
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
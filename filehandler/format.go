@@ -0,0 +1,156 @@
+package filehandler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Format of the written config files, so they match the style guide of the repository they are kept in.
+// Zero value keeps the defaults of every type. Custom codecs are not affected.
+type Format struct {
+	// Indent of the nested values, e.g. "  ". By default JSON is indented with tab, YAML with 4 spaces
+	// and TOML tables are not indented. YAML indent must consist of spaces.
+	Indent string
+	// Sort keys alphabetically instead of the struct field order.
+	SortKeys bool
+	// Write nested values inline: YAML in flow style, e.g. {name: app, port: 80}, and TOML tables inline.
+	// JSON is not affected.
+	FlowStyle bool
+	// End file with a single newline. By default JSON files have none.
+	TrailingNewline bool
+}
+
+// Format written config files, including section files.
+// fh.New(fh.WithFormat(fh.Format{Indent: "  ", TrailingNewline: true}))
+func WithFormat(f Format) Option {
+	return func(o *Optional) {
+		o.Format = f
+	}
+}
+
+// Set format of the builtin file types.
+func withFormat(f FileIO, format Format) FileIO {
+	switch io := f.(type) {
+	case *Json:
+		io.format = format
+	case *Yaml:
+		io.format = format
+	case *Toml:
+		io.format = format
+	}
+	return f
+}
+
+func (f Format) terminate(b []byte) []byte {
+	if !f.TrailingNewline {
+		return b
+	}
+	return append(bytes.TrimRight(b, "\n"), '\n')
+}
+
+// Convert data to JSON document which keys are sorted on marshal, numbers are kept as they are.
+func sortedJSON(data any) (any, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+
+	var doc any
+	if err := d.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// Encode data as YAML node in the given format.
+func formatYAML(data any, f Format) ([]byte, error) {
+	if strings.Trim(f.Indent, " ") != "" {
+		return nil, fmt.Errorf("yaml indent must consist of spaces, got %q", f.Indent)
+	}
+
+	var n yaml.Node
+	if err := n.Encode(data); err != nil {
+		return nil, err
+	}
+	if f.SortKeys {
+		sortNode(&n)
+	}
+	if f.FlowStyle {
+		n.Style |= yaml.FlowStyle
+	}
+
+	var buf bytes.Buffer
+	e := yaml.NewEncoder(&buf)
+	if f.Indent != "" {
+		e.SetIndent(len(f.Indent))
+	}
+	if err := e.Encode(&n); err != nil {
+		return nil, err
+	}
+	if err := e.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Sort keys of the YAML mappings recursively.
+func sortNode(n *yaml.Node) {
+	for _, c := range n.Content {
+		sortNode(c)
+	}
+	if n.Kind != yaml.MappingNode {
+		return
+	}
+
+	pairs := make([][2]*yaml.Node, 0, len(n.Content)/2)
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		pairs = append(pairs, [2]*yaml.Node{n.Content[i], n.Content[i+1]})
+	}
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return pairs[i][0].Value < pairs[j][0].Value
+	})
+
+	n.Content = n.Content[:0]
+	for _, p := range pairs {
+		n.Content = append(n.Content, p[0], p[1])
+	}
+}
+
+// Encode data as TOML in the given format.
+func formatTOML(data any, f Format) ([]byte, error) {
+	if f.SortKeys {
+		// maps are encoded with sorted keys
+		b, err := toml.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		doc := map[string]any{}
+		if err := toml.Unmarshal(b, &doc); err != nil {
+			return nil, err
+		}
+		data = doc
+	}
+
+	var buf bytes.Buffer
+	e := toml.NewEncoder(&buf)
+	if f.Indent != "" {
+		e.SetIndentSymbol(f.Indent)
+		e.SetIndentTables(true)
+	}
+	e.SetTablesInline(f.FlowStyle)
+
+	if err := e.Encode(data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
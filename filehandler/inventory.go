@@ -0,0 +1,139 @@
+package filehandler
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Extensions of the config files which can be left by previous versions of the app.
+var artifactExtensions = []string{"json", "yaml", "yml", "toml"}
+
+// Artifact is a config file found for the handler name, e.g. "app.json" or "app.default.yaml".
+type Artifact struct {
+	// Absolute path of the file.
+	File string
+	Type FileType
+	// File is a default config file, "<name>.default.<ext>".
+	Default bool
+	// File is used by the handler created with the same options.
+	InUse bool
+	// File of another type, while file of the same kind (active or default) is in use. Only superseded files
+	// are removed by Cleanup.
+	Superseded bool
+}
+
+// List config files for the handler name in its path: active and default files of all builtin types,
+// e.g. "app.json" left after switching to "app.yaml". Files are sorted by path. Nothing is created.
+// If DYNAMIC type is ambiguous, see ErrAmbiguousType, no file is superseded.
+func Inventory(opts ...Option) ([]Artifact, error) {
+	o := optional(opts)
+
+	ambiguous := checkAmbiguity(o) != nil
+
+	fileIO := BuildFileIO(o)
+	if fileIO == nil {
+		return nil, fmt.Errorf("bad file type, or dynamic type has not been resolved: %s", string(o.Type))
+	}
+
+	dir, err := filepath.Abs(o.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed at resolve config path: %v", err)
+	}
+
+	ext := fileIO.GetExtension()
+	inUse := map[bool]string{
+		false: filepath.Join(dir, fmt.Sprintf(activeConfig, o.Name, ext)),
+		true:  filepath.Join(dir, fmt.Sprintf(defaultConfig, o.Name, ext)),
+	}
+
+	exts := artifactExtensions
+	if !contains(exts, ext) {
+		exts = append(exts, ext)
+	}
+
+	artifacts := []Artifact{}
+	for _, e := range exts {
+		for _, def := range []bool{false, true} {
+			name := activeConfig
+			if def {
+				name = defaultConfig
+			}
+
+			file := filepath.Join(dir, fmt.Sprintf(name, o.Name, e))
+			if info, err := os.Stat(file); err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+
+			a := Artifact{File: file, Type: artifactType(e), Default: def, InUse: file == inUse[def]}
+			a.Superseded = !a.InUse && !ambiguous && Utils.FileExists(inUse[def])
+			artifacts = append(artifacts, a)
+		}
+	}
+
+	sort.Slice(artifacts, func(i, j int) bool {
+		return artifacts[i].File < artifacts[j].File
+	})
+
+	return artifacts, nil
+}
+
+// Remove superseded config files listed by Inventory, e.g. "app.default.json" after switching to YAML,
+// so they do not confuse DYNAMIC type resolution. Files in use and files which are the only config of
+// their kind are never removed. Returns removed files.
+func Cleanup(opts ...Option) ([]Artifact, error) {
+	if err := checkAmbiguity(optional(opts)); err != nil {
+		return nil, err
+	}
+
+	artifacts, err := Inventory(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	removed := []Artifact{}
+	for _, a := range artifacts {
+		if !a.Superseded {
+			continue
+		}
+		if err := os.Remove(a.File); err != nil {
+			return removed, fmt.Errorf("failed at remove superseded config file: %v", err)
+		}
+		removed = append(removed, a)
+	}
+
+	return removed, nil
+}
+
+// Get types of the existing default config files, in the order they are considered by DYNAMIC type.
+func defaultTypes(o *Optional) []FileType {
+	order := availableImpl
+	if len(o.TypePrecedence) > 0 {
+		order = o.TypePrecedence
+	}
+
+	types := []FileType{}
+	for _, t := range order {
+		if Utils.FileExists(filepath.Join(o.Path, fmt.Sprintf(defaultConfig, o.Name, t))) {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
+func artifactType(ext string) FileType {
+	if ext == "yml" {
+		return YAML
+	}
+	return FileType(ext)
+}
+
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
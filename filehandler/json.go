@@ -13,19 +13,20 @@ const (
 )
 
 type Json struct {
-	m sync.Mutex
+	m      sync.Mutex
+	format Format
 }
 
 func (j *Json) Write(data any, file string) error {
 	j.m.Lock()
 	defer j.m.Unlock()
 
-	json, err := json.MarshalIndent(data, emptySpace, marshalIndent)
+	b, err := j.Marshal(data)
 	if err != nil {
-		return fmt.Errorf("failed at marshal json: %v", err)
+		return err
 	}
 
-	err = Utils.WriteFile(file, json)
+	err = Utils.WriteFile(file, b)
 	if err != nil {
 		return fmt.Errorf("failed at write to json file: %v", err)
 	}
@@ -37,19 +38,44 @@ func (j *Json) Read(data any, file string) error {
 	j.m.Lock()
 	defer j.m.Unlock()
 
-	configFile, err := os.Open(file)
+	b, err := os.ReadFile(file)
 	if err != nil {
-		return fmt.Errorf("failed at open json file: %v", err)
+		return fmt.Errorf("failed at open json file: %w", err)
 	}
 
-	jsonParser := json.NewDecoder(configFile)
-	if err = jsonParser.Decode(data); err != nil {
+	if err := j.Unmarshal(b, data); err != nil {
 		return fmt.Errorf("failed at reading from json file: %v", err)
 	}
 
 	return nil
 }
 
+func (j *Json) Marshal(data any) ([]byte, error) {
+	indent := marshalIndent
+	if j.format.Indent != "" {
+		indent = j.format.Indent
+	}
+
+	if j.format.SortKeys {
+		doc, err := sortedJSON(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed at marshal json: %v", err)
+		}
+		data = doc
+	}
+
+	b, err := json.MarshalIndent(data, emptySpace, indent)
+	if err != nil {
+		return nil, fmt.Errorf("failed at marshal json: %v", err)
+	}
+
+	return j.format.terminate(b), nil
+}
+
+func (j *Json) Unmarshal(b []byte, data any) error {
+	return json.Unmarshal(b, data)
+}
+
 func (j *Json) GetExtension() string {
 	return "json"
 }
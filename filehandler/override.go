@@ -0,0 +1,341 @@
+package filehandler
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Override converts values of a field to and from the form they are stored in, e.g. durations as "5m" strings
+// or secrets as references to the external store. It is applied by every format, so field types do not need to
+// implement marshalers of each one. Fields of nested structs are converted, elements of slices and maps are not.
+type Override struct {
+	// Type of the converted fields. Fields of this type are converted if Path is empty.
+	Type reflect.Type
+	// Path of struct field names of the converted field, e.g. "Database.Password".
+	Path string
+	// Convert field value to the stored one, e.g. string, number, bool, map or slice.
+	Marshal func(v any) (any, error)
+	// Convert stored value, as decoded by the format, back to the field value.
+	Unmarshal func(stored any) (any, error)
+}
+
+// Convert fields of type V, e.g. store durations as strings:
+// TypeOverride(func(d time.Duration) (any, error) { return d.String(), nil }, parseDuration)
+func TypeOverride[V any](marshal func(V) (any, error), unmarshal func(any) (V, error)) Override {
+	return Override{
+		Type: reflect.TypeOf((*V)(nil)).Elem(),
+		Marshal: func(v any) (any, error) {
+			return marshal(v.(V))
+		},
+		Unmarshal: func(stored any) (any, error) {
+			return unmarshal(stored)
+		},
+	}
+}
+
+// Convert single field of type V by path, e.g. "Database.Password". Field override takes precedence over type one.
+func FieldOverride[V any](path string, marshal func(V) (any, error), unmarshal func(any) (V, error)) Override {
+	o := TypeOverride(marshal, unmarshal)
+	o.Path = path
+	return o
+}
+
+// Apply overrides to all config files, including section files.
+func WithOverrides(overrides ...Override) Option {
+	return func(o *Optional) {
+		o.Overrides = append(o.Overrides, overrides...)
+	}
+}
+
+// Wrap codec to convert fields with overrides before marshaling and after unmarshaling.
+// Data which is not a struct, e.g. raw document, is passed as is.
+func Overridden(c Codec, overrides ...Override) Codec {
+	return &overrideCodec{Codec: c, overrides: overrides}
+}
+
+type overrideCodec struct {
+	Codec
+	overrides []Override
+	mirrors   sync.Map // reflect.Type -> *mirror
+}
+
+func (c *overrideCodec) Marshal(data any) ([]byte, error) {
+	v := reflect.ValueOf(data)
+	for v.Kind() == reflect.Pointer && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return c.Codec.Marshal(data)
+	}
+
+	m, err := c.mirror(v.Type())
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return c.Codec.Marshal(data)
+	}
+
+	out := reflect.New(m.t).Elem()
+	if err := m.marshal(v, out); err != nil {
+		return nil, err
+	}
+
+	return c.Codec.Marshal(out.Addr().Interface())
+}
+
+func (c *overrideCodec) Unmarshal(b []byte, data any) error {
+	v := reflect.ValueOf(data)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return c.Codec.Unmarshal(b, data)
+	}
+	v = v.Elem()
+
+	m, err := c.mirror(v.Type())
+	if err != nil {
+		return err
+	}
+	if m == nil {
+		return c.Codec.Unmarshal(b, data)
+	}
+
+	// fields missing in the document keep their values, as they do when decoded directly
+	in := reflect.New(m.t).Elem()
+	m.prefill(v, in)
+
+	if err := c.Codec.Unmarshal(b, in.Addr().Interface()); err != nil {
+		return err
+	}
+
+	return m.unmarshal(in, v)
+}
+
+// Get mirror of the struct type, or error if it can not be built. If no field is converted,
+// mirror is not needed and data is passed to the codec as is.
+func (c *overrideCodec) mirror(t reflect.Type) (*mirror, error) {
+	if m, ok := c.mirrors.Load(t); ok {
+		return m.(*mirror), nil
+	}
+
+	m, err := buildMirror(t, "", c.overrides)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mirrors.Store(t, m)
+	return m, nil
+}
+
+// Struct type with the same exported fields and tags, where converted fields hold stored values.
+// So every format names and orders keys the same way as for the original struct.
+type mirror struct {
+	t      reflect.Type
+	fields []mirrorField
+}
+
+type mirrorField struct {
+	// Index of the field in the original struct.
+	index    int
+	path     string
+	override *Override
+	nested   *mirror
+}
+
+// Build mirror of the struct type, nil if no field is converted.
+func buildMirror(t reflect.Type, prefix string, overrides []Override) (m *mirror, err error) {
+	m = &mirror{}
+	fields := []reflect.StructField{}
+	converted := false
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+
+		f := mirrorField{index: i, path: prefix + sf.Name}
+		ft := sf.Type
+
+		if f.override, err = findOverride(overrides, f.path, sf.Type); err != nil {
+			return nil, err
+		}
+
+		switch {
+		case f.override != nil:
+			ft = reflect.TypeOf((*any)(nil)).Elem()
+		case sf.Type.Kind() == reflect.Struct && !isLeaf(sf.Type):
+			p := f.path + "."
+			if sf.Anonymous {
+				p = prefix
+			}
+			if f.nested, err = buildMirror(sf.Type, p, overrides); err != nil {
+				return nil, err
+			}
+			if f.nested != nil {
+				ft = f.nested.t
+			}
+		}
+
+		converted = converted || f.override != nil || f.nested != nil
+		m.fields = append(m.fields, f)
+		fields = append(fields, reflect.StructField{Name: sf.Name, Type: ft, Tag: sf.Tag, Anonymous: sf.Anonymous})
+	}
+
+	if !converted {
+		return nil, nil
+	}
+
+	defer func() {
+		// embedded types with methods are not supported by reflect
+		if r := recover(); r != nil {
+			m, err = nil, fmt.Errorf("overrides can not be applied to %s: %v", t, r)
+		}
+	}()
+	m.t = reflect.StructOf(fields)
+
+	return m, nil
+}
+
+// Find override of the field, field one takes precedence.
+func findOverride(overrides []Override, path string, t reflect.Type) (*Override, error) {
+	for i, o := range overrides {
+		if o.Path == "" || o.Path != path {
+			continue
+		}
+		if o.Type != nil && o.Type != t {
+			return nil, fmt.Errorf("override of %s expects %s, field is %s", path, o.Type, t)
+		}
+		return &overrides[i], nil
+	}
+
+	for i, o := range overrides {
+		if o.Path == "" && o.Type == t {
+			return &overrides[i], nil
+		}
+	}
+
+	return nil, nil
+}
+
+// Copy struct to its mirror, converting fields.
+func (m *mirror) marshal(v reflect.Value, out reflect.Value) error {
+	for i, f := range m.fields {
+		src, dst := v.Field(f.index), out.Field(i)
+
+		switch {
+		case f.override != nil:
+			stored, err := f.override.Marshal(src.Interface())
+			if err != nil {
+				return fmt.Errorf("failed at marshal %s: %v", f.path, err)
+			}
+			if stored != nil {
+				dst.Set(reflect.ValueOf(stored))
+			}
+		case f.nested != nil:
+			if err := f.nested.marshal(src, dst); err != nil {
+				return err
+			}
+		default:
+			dst.Set(src)
+		}
+	}
+	return nil
+}
+
+// Copy fields which are not converted to the mirror, converted ones are set only if they are in the document.
+func (m *mirror) prefill(v reflect.Value, in reflect.Value) {
+	for i, f := range m.fields {
+		switch {
+		case f.override != nil:
+		case f.nested != nil:
+			f.nested.prefill(v.Field(f.index), in.Field(i))
+		default:
+			in.Field(i).Set(v.Field(f.index))
+		}
+	}
+}
+
+// Copy mirror back to the struct, converting stored values.
+func (m *mirror) unmarshal(in reflect.Value, v reflect.Value) error {
+	for i, f := range m.fields {
+		src, dst := in.Field(i), v.Field(f.index)
+
+		switch {
+		case f.override != nil:
+			if src.IsNil() {
+				continue
+			}
+			value, err := f.override.Unmarshal(src.Interface())
+			if err != nil {
+				return fmt.Errorf("failed at unmarshal %s: %v", f.path, err)
+			}
+			if value == nil {
+				dst.Set(reflect.Zero(dst.Type()))
+				continue
+			}
+			dst.Set(reflect.ValueOf(value))
+		case f.nested != nil:
+			if err := f.nested.unmarshal(src, dst); err != nil {
+				return err
+			}
+		default:
+			dst.Set(src)
+		}
+	}
+	return nil
+}
+
+var (
+	textMarshaler = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	jsonMarshaler = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// Check if struct is marshaled as a single value, e.g. time.Time.
+func isLeaf(t reflect.Type) bool {
+	if t == reflect.TypeOf(time.Time{}) {
+		return true
+	}
+	for _, i := range []reflect.Type{textMarshaler, jsonMarshaler} {
+		if t.Implements(i) || reflect.PointerTo(t).Implements(i) {
+			return true
+		}
+	}
+	return false
+}
+
+// Wrap codec of the file IO with overrides, if there are any.
+func overridden(f FileIO, overrides []Override) FileIO {
+	c, ok := f.(Codec)
+	if !ok || len(overrides) == 0 {
+		return f
+	}
+	return &codecIO{codec: Overridden(c, overrides...)}
+}
+
+// Get overrides of the section fields, with section name trimmed from the paths.
+func sectionOverrides(overrides []Override, name string) []Override {
+	result := []Override{}
+	for _, o := range overrides {
+		if o.Path != "" {
+			p, ok := cutPrefix(o.Path, name+".")
+			if !ok {
+				continue
+			}
+			o.Path = p
+		}
+		result = append(result, o)
+	}
+	return result
+}
+
+func cutPrefix(s, prefix string) (string, bool) {
+	if !strings.HasPrefix(s, prefix) {
+		return s, false
+	}
+	return s[len(prefix):], true
+}
@@ -0,0 +1,141 @@
+package filehandler
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"reflect"
+	"strings"
+)
+
+const overridesConfig = "%s.overrides.%s"
+
+// Save changes to a separate "<name>.overrides.<ext>" file, e.g. "app.overrides.yaml", instead of the active
+// config file, so the active config file is kept as the operator wrote it. Overrides file holds only values
+// which differ from the active config file and is merged over it on Load. It is removed once there are no
+// differences. Overrides file can not be used with section files.
+func WithOverridesFile() Option {
+	return func(o *Optional) {
+		o.OverridesFile = true
+	}
+}
+
+// Get path of the overrides file, empty if it is not used.
+func (h *FileHandler) OverridesFile() string {
+	return h.overridesFile
+}
+
+// Merge overrides file over the loaded active config file.
+func (h *FileHandler) loadOverrides(data any) error {
+	if h.overridesFile == "" || !Utils.FileExists(h.overridesFile) {
+		return nil
+	}
+
+	doc, ok := data.(*map[string]any)
+	if !ok {
+		// decoders keep values of the fields missing in the document
+		_, err := h.read(data, h.overridesFile, true)
+		return err
+	}
+
+	over := map[string]any{}
+	if _, err := h.read(&over, h.overridesFile, true); err != nil {
+		return err
+	}
+	if *doc == nil {
+		*doc = map[string]any{}
+	}
+	mergeDoc(*doc, over)
+	return nil
+}
+
+// Write values which differ from the active config file to the overrides file.
+func (h *FileHandler) saveOverrides(data any) error {
+	codec, ok := h.fileIO.(Codec)
+	if !ok {
+		return fmt.Errorf("file type %s can not be saved to overrides file", h.fileIO.GetExtension())
+	}
+
+	b, err := codec.Marshal(data)
+	if err != nil {
+		return err
+	}
+	doc := map[string]any{}
+	if err := codec.Unmarshal(b, &doc); err != nil {
+		return err
+	}
+
+	base := map[string]any{}
+	if _, err := h.read(&base, h.file, true); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	over := diffDoc(base, doc)
+	if len(over) == 0 {
+		if err := os.Remove(h.overridesFile); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed at remove overrides file: %v", err)
+		}
+		return nil
+	}
+
+	return h.write(over, h.overridesFile)
+}
+
+// Get values of the document which differ from the base one. Tables are compared by keys, other values as a whole.
+func diffDoc(base map[string]any, doc map[string]any) map[string]any {
+	over := map[string]any{}
+	for k, v := range doc {
+		b, ok := lookupDoc(base, k)
+		if !ok {
+			over[k] = v
+			continue
+		}
+
+		vm, ok1 := v.(map[string]any)
+		bm, ok2 := b.(map[string]any)
+		switch {
+		case ok1 && ok2:
+			if d := diffDoc(bm, vm); len(d) > 0 {
+				over[k] = d
+			}
+		case !reflect.DeepEqual(b, v):
+			over[k] = v
+		}
+	}
+	return over
+}
+
+// Merge document over the base one, tables are merged by keys.
+func mergeDoc(base map[string]any, over map[string]any) {
+	for k, v := range over {
+		key := k
+		for bk := range base {
+			if strings.EqualFold(bk, k) {
+				key = bk
+				break
+			}
+		}
+
+		vm, ok1 := v.(map[string]any)
+		bm, ok2 := base[key].(map[string]any)
+		if ok1 && ok2 {
+			mergeDoc(bm, vm)
+			continue
+		}
+		base[key] = v
+	}
+}
+
+// Find value by key, keys are matched case-insensitively as decoders do.
+func lookupDoc(doc map[string]any, key string) (any, bool) {
+	if v, ok := doc[key]; ok {
+		return v, true
+	}
+	for k, v := range doc {
+		if strings.EqualFold(k, key) {
+			return v, true
+		}
+	}
+	return nil, false
+}
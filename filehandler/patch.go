@@ -0,0 +1,396 @@
+package filehandler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2/unstable"
+	"gopkg.in/yaml.v3"
+)
+
+// Rewrite only changed values of the existing config file, so one field update is one line diff, comments and
+// layout of the file are kept. If keys are added or removed, or the file can not be patched, it is rewritten
+// as a whole. Files with preprocessors and files of other formats than JSON, YAML and TOML are always rewritten.
+func WithMinimalDiff() Option {
+	return func(o *Optional) {
+		o.MinimalDiff = true
+	}
+}
+
+// Byte range of the value in the document.
+type span struct {
+	start, end int
+}
+
+// Find byte ranges of the scalar values in the document by their path.
+type locator func(b []byte) (map[string]span, error)
+
+var locators = map[string]locator{
+	"json": locateJSON,
+	"yaml": locateYAML,
+	"toml": locateTOML,
+}
+
+// Write data to the file patching only changed values of the existing file. File is not written if nothing has changed.
+func writePatched(f FileIO, data any, file string) error {
+	codec, ok := f.(Codec)
+	if !ok || locators[codec.GetExtension()] == nil {
+		return f.Write(data, file)
+	}
+
+	b, err := codec.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	if old, err := os.ReadFile(file); err == nil {
+		if patched, ok := patch(codec, old, b); ok {
+			if bytes.Equal(patched, old) {
+				return nil
+			}
+			b = patched
+		}
+	}
+
+	if err := Utils.WriteFile(file, b); err != nil {
+		return fmt.Errorf("failed at write to %s file: %v", codec.GetExtension(), err)
+	}
+	return nil
+}
+
+// Replace values of the old document which differ in the new one with their text from the new document.
+// Returns false if documents differ structurally or patched document does not decode to the new one.
+func patch(codec Codec, old []byte, new []byte) ([]byte, bool) {
+	var oldDoc, newDoc any
+	if codec.Unmarshal(old, &oldDoc) != nil || codec.Unmarshal(new, &newDoc) != nil {
+		return nil, false
+	}
+
+	changed := []string{}
+	if !changedValues(oldDoc, newDoc, "", &changed) {
+		return nil, false
+	}
+	if len(changed) == 0 {
+		return old, true
+	}
+
+	locate := locators[codec.GetExtension()]
+	oldSpans, err := locate(old)
+	if err != nil {
+		return nil, false
+	}
+	newSpans, err := locate(new)
+	if err != nil {
+		return nil, false
+	}
+
+	type replacement struct {
+		at   span
+		text []byte
+	}
+	replacements := []replacement{}
+	for _, path := range changed {
+		o, ok1 := oldSpans[path]
+		n, ok2 := newSpans[path]
+		if !ok1 || !ok2 {
+			return nil, false
+		}
+		replacements = append(replacements, replacement{o, new[n.start:n.end]})
+	}
+
+	sort.Slice(replacements, func(i, j int) bool {
+		return replacements[i].at.start > replacements[j].at.start
+	})
+
+	patched := append([]byte(nil), old...)
+	end := len(patched) + 1
+	for _, r := range replacements {
+		if r.at.end > end {
+			// overlapping ranges
+			return nil, false
+		}
+		patched = append(patched[:r.at.start], append(append([]byte(nil), r.text...), patched[r.at.end:]...)...)
+		end = r.at.start
+	}
+
+	var patchedDoc any
+	if codec.Unmarshal(patched, &patchedDoc) != nil || !reflect.DeepEqual(patchedDoc, newDoc) {
+		return nil, false
+	}
+
+	return patched, true
+}
+
+// Collect paths of the scalar values which differ. Returns false if documents differ structurally,
+// e.g. key is added or removed, or value is replaced with a table.
+func changedValues(old any, new any, path string, changed *[]string) bool {
+	switch o := old.(type) {
+	case map[string]any:
+		n, ok := new.(map[string]any)
+		if !ok || len(o) != len(n) {
+			return false
+		}
+		for k, v := range o {
+			nv, ok := n[k]
+			if !ok || !changedValues(v, nv, keyPath(path, k), changed) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		n, ok := new.([]any)
+		if !ok || len(o) != len(n) {
+			return false
+		}
+		for i := range o {
+			if !changedValues(o[i], n[i], indexPath(path, i), changed) {
+				return false
+			}
+		}
+		return true
+	}
+
+	switch new.(type) {
+	case map[string]any, []any:
+		return false
+	}
+
+	if !reflect.DeepEqual(old, new) {
+		*changed = append(*changed, path)
+	}
+	return true
+}
+
+func keyPath(path string, key string) string {
+	return path + "\x00" + key
+}
+
+func indexPath(path string, i int) string {
+	return path + "\x01" + strconv.Itoa(i)
+}
+
+// Locate values by reading tokens, value starts after separators following the previous token.
+func locateJSON(b []byte) (map[string]span, error) {
+	spans := map[string]span{}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+
+	type frame struct {
+		path   string
+		object bool
+		index  int
+		key    *string
+	}
+	stack := []*frame{}
+
+	for {
+		start := int(d.InputOffset())
+		t, err := d.Token()
+		if err == io.EOF {
+			return spans, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		for start < len(b) && strings.IndexByte(" \t\r\n:,", b[start]) >= 0 {
+			start++
+		}
+
+		// path of the value the token starts
+		path := ""
+		if len(stack) > 0 {
+			f := stack[len(stack)-1]
+			if f.object {
+				if f.key == nil {
+					if k, ok := t.(string); ok {
+						f.key = &k
+						continue
+					}
+				} else {
+					path = keyPath(f.path, *f.key)
+				}
+			} else {
+				path = indexPath(f.path, f.index)
+			}
+		}
+
+		switch t {
+		case json.Delim('{'), json.Delim('['):
+			stack = append(stack, &frame{path: path, object: t == json.Delim('{')})
+			continue
+		case json.Delim('}'), json.Delim(']'):
+			stack = stack[:len(stack)-1]
+		default:
+			spans[path] = span{start, int(d.InputOffset())}
+		}
+
+		// value is complete
+		if len(stack) > 0 {
+			f := stack[len(stack)-1]
+			f.key = nil
+			f.index++
+		}
+	}
+}
+
+// Locate values by node positions, value ends at the closing quote, or at the comment or end of the line.
+func locateYAML(b []byte) (map[string]span, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+
+	lines := [][]byte{}
+	offsets := []int{}
+	offset := 0
+	for _, l := range bytes.SplitAfter(b, []byte("\n")) {
+		lines = append(lines, l)
+		offsets = append(offsets, offset)
+		offset += len(l)
+	}
+
+	spans := map[string]span{}
+
+	var walk func(n *yaml.Node, path string, flow bool)
+	walk = func(n *yaml.Node, path string, flow bool) {
+		flow = flow || n.Style&yaml.FlowStyle != 0
+
+		switch n.Kind {
+		case yaml.DocumentNode:
+			for _, c := range n.Content {
+				walk(c, path, flow)
+			}
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				walk(n.Content[i+1], keyPath(path, n.Content[i].Value), flow)
+			}
+		case yaml.SequenceNode:
+			for i, c := range n.Content {
+				walk(c, indexPath(path, i), flow)
+			}
+		case yaml.ScalarNode:
+			if n.Line < 1 || n.Line > len(lines) || n.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 {
+				return
+			}
+			line := lines[n.Line-1]
+			start := n.Column - 1
+			if start < 0 || start >= len(line) {
+				return
+			}
+			if end, ok := yamlScalarEnd(line, start, n.Style, flow); ok {
+				spans[path] = span{offsets[n.Line-1] + start, offsets[n.Line-1] + end}
+			}
+		}
+	}
+	walk(&doc, "", false)
+
+	return spans, nil
+}
+
+// Find end of the scalar starting at the line position.
+func yamlScalarEnd(line []byte, start int, style yaml.Style, flow bool) (int, bool) {
+	switch {
+	case style&yaml.DoubleQuotedStyle != 0:
+		for i := start + 1; i < len(line); i++ {
+			switch line[i] {
+			case '\\':
+				i++
+			case '"':
+				return i + 1, true
+			}
+		}
+		return 0, false
+	case style&yaml.SingleQuotedStyle != 0:
+		for i := start + 1; i < len(line); i++ {
+			if line[i] != '\'' {
+				continue
+			}
+			if i+1 < len(line) && line[i+1] == '\'' {
+				i++
+				continue
+			}
+			return i + 1, true
+		}
+		return 0, false
+	}
+
+	end := len(line)
+	for i := start; i < len(line); i++ {
+		if line[i] == '#' && i > start && (line[i-1] == ' ' || line[i-1] == '\t') {
+			end = i
+			break
+		}
+		if flow && strings.IndexByte(",]}", line[i]) >= 0 {
+			end = i
+			break
+		}
+	}
+	return len(bytes.TrimRight(line[:end], " \t\r\n")), true
+}
+
+// Locate values by parsed expressions, values of array tables are not located.
+func locateTOML(b []byte) (spans map[string]span, err error) {
+	defer func() {
+		// ranges of the nodes which do not reference the input can not be resolved
+		if r := recover(); r != nil {
+			spans, err = nil, fmt.Errorf("failed at locate toml values: %v", r)
+		}
+	}()
+
+	spans = map[string]span{}
+	p := unstable.Parser{}
+	p.Reset(b)
+
+	key := func(it unstable.Iterator, path string) string {
+		for it.Next() {
+			path = keyPath(path, string(it.Node().Data))
+		}
+		return path
+	}
+
+	var value func(n *unstable.Node, path string)
+	value = func(n *unstable.Node, path string) {
+		switch n.Kind {
+		case unstable.Array:
+			it := n.Children()
+			for i := 0; it.Next(); i++ {
+				value(it.Node(), indexPath(path, i))
+			}
+		case unstable.InlineTable:
+			it := n.Children()
+			for it.Next() {
+				kv := it.Node()
+				value(kv.Value(), key(kv.Key(), path))
+			}
+		default:
+			r := n.Raw
+			if r.Length == 0 {
+				r = p.Range(n.Data)
+			}
+			spans[path] = span{int(r.Offset), int(r.Offset + r.Length)}
+		}
+	}
+
+	table := ""
+	for p.NextExpression() {
+		e := p.Expression()
+		switch e.Kind {
+		case unstable.Table:
+			table = key(e.Key(), "")
+		case unstable.ArrayTable:
+			return nil, errors.New("array tables can not be patched")
+		case unstable.KeyValue:
+			value(e.Value(), key(e.Key(), table))
+		}
+	}
+
+	return spans, p.Error()
+}
@@ -0,0 +1,115 @@
+package filehandler
+
+import (
+	"fmt"
+	"os"
+)
+
+// Preprocessor transforms raw config file between reading and decoding, e.g. decryption, templating or format shim.
+type Preprocessor struct {
+	// Transform file content of the given type after it has been read.
+	Read func(b []byte, t FileType) ([]byte, error)
+	// Inverse transform applied before content is written, optional.
+	Write func(b []byte, t FileType) ([]byte, error)
+	// Apply to active config file only, default config file is read as is.
+	ActiveOnly bool
+}
+
+// Add preprocessor of the config file content. Preprocessors, templates and schemas are applied
+// in the order they have been added.
+func WithPreprocessor(f func([]byte) ([]byte, error)) Option {
+	return WithReversiblePreprocessor(f, nil)
+}
+
+// Add preprocessor with inverse transform applied on Save, e.g. decryption and encryption.
+// Inverse transforms are applied in reverse order, preprocessors without them are skipped on Save.
+func WithReversiblePreprocessor(read func([]byte) ([]byte, error), write func([]byte) ([]byte, error)) Option {
+	p := Preprocessor{Read: func(b []byte, _ FileType) ([]byte, error) { return read(b) }}
+	if write != nil {
+		p.Write = func(b []byte, _ FileType) ([]byte, error) { return write(b) }
+	}
+	return withPreprocessor(p)
+}
+
+func withPreprocessor(p Preprocessor) Option {
+	return func(o *Optional) {
+		o.Preprocessors = append(o.Preprocessors, p)
+	}
+}
+
+// Read config file, applying preprocessors if they are configured.
+// Returns content of the file before preprocessing, also if it can not be decoded.
+func (h *FileHandler) read(data any, file string, active bool) ([]byte, error) {
+	codec, ok := h.fileIO.(Codec)
+	if !ok {
+		if len(h.preprocessors) > 0 {
+			return nil, fmt.Errorf("file type %s can not be preprocessed", h.fileIO.GetExtension())
+		}
+		return nil, h.fileIO.Read(data, file)
+	}
+	t := codec.GetExtension()
+
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed at open %s file: %w", t, err)
+	}
+
+	b := raw
+	for _, p := range h.preprocessors {
+		if p.ActiveOnly && !active {
+			continue
+		}
+		if b, err = p.Read(b, FileType(t)); err != nil {
+			return raw, fmt.Errorf("failed at preprocess %s file: %v", t, err)
+		}
+	}
+
+	if err := codec.Unmarshal(b, data); err != nil {
+		return raw, fmt.Errorf("failed at reading from %s file: %v", t, err)
+	}
+
+	return raw, nil
+}
+
+// Write config file, applying inverse transforms of preprocessors if they are configured.
+func (h *FileHandler) write(data any, file string) error {
+	if h.minimalDiff && len(h.preprocessors) == 0 {
+		return writePatched(h.fileIO, data, file)
+	}
+
+	codec, ok := h.fileIO.(Codec)
+	if !ok || !h.reversible() {
+		return h.fileIO.Write(data, file)
+	}
+	t := codec.GetExtension()
+
+	b, err := codec.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	for i := len(h.preprocessors) - 1; i >= 0; i-- {
+		p := h.preprocessors[i]
+		if p.Write == nil {
+			continue
+		}
+		if b, err = p.Write(b, FileType(t)); err != nil {
+			return fmt.Errorf("failed at postprocess %s file: %v", t, err)
+		}
+	}
+
+	if err := Utils.WriteFile(file, b); err != nil {
+		return fmt.Errorf("failed at write to %s file: %v", t, err)
+	}
+
+	return nil
+}
+
+func (h *FileHandler) reversible() bool {
+	for _, p := range h.preprocessors {
+		if p.Write != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,14 @@
+package filehandler
+
+// Schema validates raw config document before it is decoded into the config struct, e.g. CUE schema.
+type Schema interface {
+	// Validate document of the given type. Returned document is decoded instead of the original one,
+	// so schema can fill in defaults. It has to be of the same type (JSON is accepted for YAML too).
+	Validate(doc []byte, t FileType) ([]byte, error)
+}
+
+// Validate active config file against the schema on every Load, see WithPreprocessor for the order. Default config file is not validated,
+// as it may provide only part of the config.
+func WithSchema(s Schema) Option {
+	return withPreprocessor(Preprocessor{Read: s.Validate, ActiveOnly: true})
+}
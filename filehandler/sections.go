@@ -0,0 +1,157 @@
+package filehandler
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// Section is a top-level config struct field kept in a separate file.
+type Section struct {
+	Name string
+	File string
+}
+
+type section struct {
+	name   string
+	file   string
+	fileIO FileIO
+}
+
+// Keep top-level struct field in a separate file, e.g. WithSectionFile("Database", "db.yaml").
+// File type is resolved from the extension, relative path is relative to the config path.
+// Section is merged into config on Load and split back out on Save.
+func WithSectionFile(name string, file string) Option {
+	return func(o *Optional) {
+		o.Sections = append(o.Sections, Section{Name: name, File: file})
+	}
+}
+
+func buildSections(o *Optional) ([]section, error) {
+	sections := []section{}
+
+	for _, s := range o.Sections {
+		ext := strings.TrimPrefix(filepath.Ext(s.File), ".")
+		if ext == "yml" {
+			ext = string(YAML)
+		}
+
+		fileIO := overridden(withFormat(build(FileType(ext)), o.Format), sectionOverrides(o.Overrides, s.Name))
+		if fileIO == nil {
+			return nil, fmt.Errorf("bad section file type: %s", s.File)
+		}
+
+		file := s.File
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(o.Path, file)
+		}
+
+		sections = append(sections, section{name: s.Name, file: file, fileIO: fileIO})
+	}
+
+	return sections, nil
+}
+
+// Read section files into the config struct or raw document.
+func (h *FileHandler) loadSections(data any) error {
+	for _, s := range h.sections {
+		if doc, ok := data.(*map[string]any); ok {
+			var raw map[string]any
+			if err := s.fileIO.Read(&raw, s.file); err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					continue
+				}
+				return err
+			}
+			for k := range *doc {
+				if strings.EqualFold(k, s.name) {
+					delete(*doc, k)
+				}
+			}
+			(*doc)[s.name] = raw
+			continue
+		}
+
+		v := reflect.ValueOf(data)
+		if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+			return fmt.Errorf("sections can be loaded only to struct, got %T", data)
+		}
+
+		f := v.Elem().FieldByName(s.name)
+		if !f.IsValid() {
+			return fmt.Errorf("section %q not found in %T", s.name, data)
+		}
+
+		if err := s.fileIO.Read(f.Addr().Interface(), s.file); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Write config struct without sections to the active config file and every section to its own file.
+func (h *FileHandler) saveSections(data any) error {
+	v := reflect.Indirect(reflect.ValueOf(data))
+	if v.Kind() != reflect.Struct {
+		return fmt.Errorf("sections can be saved only from struct, got %T", data)
+	}
+
+	codec, ok := h.fileIO.(Codec)
+	if !ok {
+		return fmt.Errorf("file type %s can not be split to sections", h.fileIO.GetExtension())
+	}
+
+	b, err := codec.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	doc := map[string]any{}
+	if err := codec.Unmarshal(b, &doc); err != nil {
+		return err
+	}
+
+	for _, s := range h.sections {
+		sf, ok := v.Type().FieldByName(s.name)
+		if !ok {
+			return fmt.Errorf("section %q not found in %T", s.name, data)
+		}
+
+		for k := range doc {
+			if isSectionKey(k, sf) {
+				delete(doc, k)
+			}
+		}
+
+		if err := h.writeSection(s.fileIO, v.FieldByIndex(sf.Index).Interface(), s.file); err != nil {
+			return err
+		}
+	}
+
+	return h.writeSection(h.fileIO, doc, h.file)
+}
+
+func (h *FileHandler) writeSection(f FileIO, data any, file string) error {
+	if h.minimalDiff {
+		return writePatched(f, data, file)
+	}
+	return f.Write(data, file)
+}
+
+func isSectionKey(key string, sf reflect.StructField) bool {
+	if strings.EqualFold(key, sf.Name) {
+		return true
+	}
+
+	for _, tag := range []string{"json", "yaml", "toml"} {
+		if name := strings.Split(sf.Tag.Get(tag), ",")[0]; name != "" && strings.EqualFold(key, name) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,48 @@
+package filehandler
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// Data available to the config file template.
+type templateData struct {
+	// Environment variables.
+	Env map[string]string
+	// User-supplied data, see WithTemplate.
+	Data map[string]any
+}
+
+// Render config files as text/template before decoding, e.g. {{ .Env.HOSTNAME }} or {{ .Data.region }}.
+// Additional functions can be provided, e.g. sprig.TxtFuncMap(). Rendering is one-way, so handler is read-only:
+// Save fails instead of overwriting the template, use cog.ReadOnlyInMemory to apply updates in memory.
+func WithTemplate(data map[string]any, funcs template.FuncMap) Option {
+	return func(o *Optional) {
+		withPreprocessor(Preprocessor{Read: func(b []byte, _ FileType) ([]byte, error) {
+			return render(b, data, funcs)
+		}})(o)
+		o.Template = true
+	}
+}
+
+func render(b []byte, data map[string]any, funcs template.FuncMap) ([]byte, error) {
+	tmpl, err := template.New("config").Funcs(funcs).Option("missingkey=zero").Parse(string(b))
+	if err != nil {
+		return nil, err
+	}
+
+	env := map[string]string{}
+	for _, kv := range os.Environ() {
+		k, v, _ := strings.Cut(kv, "=")
+		env[k] = v
+	}
+
+	out := bytes.Buffer{}
+	if err := tmpl.Execute(&out, templateData{Env: env, Data: data}); err != nil {
+		return nil, err
+	}
+
+	return out.Bytes(), nil
+}
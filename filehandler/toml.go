@@ -9,19 +9,20 @@ import (
 )
 
 type Toml struct {
-	m sync.Mutex
+	m      sync.Mutex
+	format Format
 }
 
 func (t *Toml) Write(data any, file string) error {
 	t.m.Lock()
 	defer t.m.Unlock()
 
-	toml, err := toml.Marshal(data)
+	b, err := t.Marshal(data)
 	if err != nil {
-		return fmt.Errorf("failed at marshal toml: %v", err)
+		return err
 	}
 
-	err = Utils.WriteFile(file, toml)
+	err = Utils.WriteFile(file, b)
 	if err != nil {
 		return fmt.Errorf("failed at write to toml file: %v", err)
 	}
@@ -33,19 +34,38 @@ func (t *Toml) Read(data any, file string) error {
 	t.m.Lock()
 	defer t.m.Unlock()
 
-	configFile, err := os.Open(file)
+	b, err := os.ReadFile(file)
 	if err != nil {
-		return fmt.Errorf("failed at open toml file: %v", err)
+		return fmt.Errorf("failed at open toml file: %w", err)
 	}
 
-	tomlParser := toml.NewDecoder(configFile)
-	if err = tomlParser.Decode(data); err != nil {
+	if err := t.Unmarshal(b, data); err != nil {
 		return fmt.Errorf("failed at reading from toml file: %v", err)
 	}
 
 	return nil
 }
 
+func (t *Toml) Marshal(data any) ([]byte, error) {
+	b, err := formatTOML(data, t.format)
+	if err != nil {
+		return nil, fmt.Errorf("failed at marshal toml: %v", err)
+	}
+
+	return t.format.terminate(b), nil
+}
+
+func (t *Toml) Unmarshal(b []byte, data any) (err error) {
+	// parser panics on some malformed documents, e.g. "a = 00000", it must not crash the application
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("failed at parse toml: %v", r)
+		}
+	}()
+
+	return toml.Unmarshal(b, data)
+}
+
 func (t *Toml) GetExtension() string {
 	return "toml"
 }
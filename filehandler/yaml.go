@@ -9,19 +9,20 @@ import (
 )
 
 type Yaml struct {
-	m sync.Mutex
+	m      sync.Mutex
+	format Format
 }
 
 func (y *Yaml) Write(data any, file string) error {
 	y.m.Lock()
 	defer y.m.Unlock()
 
-	yaml, err := yaml.Marshal(data)
+	b, err := y.Marshal(data)
 	if err != nil {
-		return fmt.Errorf("failed at marshal yaml: %v", err)
+		return err
 	}
 
-	err = Utils.WriteFile(file, yaml)
+	err = Utils.WriteFile(file, b)
 	if err != nil {
 		return fmt.Errorf("failed at write to yaml file: %v", err)
 	}
@@ -33,19 +34,38 @@ func (y *Yaml) Read(data any, file string) error {
 	y.m.Lock()
 	defer y.m.Unlock()
 
-	configFile, err := os.Open(file)
+	b, err := os.ReadFile(file)
 	if err != nil {
-		return fmt.Errorf("failed at open yaml file: %v", err)
+		return fmt.Errorf("failed at open yaml file: %w", err)
 	}
 
-	yamlParser := yaml.NewDecoder(configFile)
-	if err = yamlParser.Decode(data); err != nil {
+	if err := y.Unmarshal(b, data); err != nil {
 		return fmt.Errorf("failed at reading from yaml file: %v", err)
 	}
 
 	return nil
 }
 
+func (y *Yaml) Marshal(data any) ([]byte, error) {
+	marshal := yaml.Marshal
+	if y.format != (Format{}) {
+		marshal = func(data any) ([]byte, error) {
+			return formatYAML(data, y.format)
+		}
+	}
+
+	b, err := marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed at marshal yaml: %v", err)
+	}
+
+	return y.format.terminate(b), nil
+}
+
+func (y *Yaml) Unmarshal(b []byte, data any) error {
+	return yaml.Unmarshal(b, data)
+}
+
 func (y *Yaml) GetExtension() string {
 	return "yaml"
 }
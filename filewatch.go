@@ -0,0 +1,116 @@
+package cog
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Handlers which load config from local files can implement this interface to be watched with cog.WithWatcher,
+// e.g. file handler returns active config file, overrides file and section files.
+// Handlers implementing only cog.Locator are watched by the location.
+type FileLister interface {
+	Files() []string
+}
+
+// Reload configuration automatically when config files are modified outside the process, e.g. by an editor,
+// configmap sync or config management tool. Changes are reloaded and validated, and subscribers and callbacks
+// are notified the same way as on update. Handler has to implement cog.FileLister or cog.Locator.
+// Handlers implementing cog.Watchable are watched without this option.
+func WithWatcher() Option {
+	return func(o *Optional) {
+		o.Watcher = true
+	}
+}
+
+// Watch files of the handler implementing cog.FileLister or cog.Locator.
+func fileWatcherOf(h ConfigHandler) (Watchable, error) {
+	var files []string
+	switch l := h.(type) {
+	case FileLister:
+		files = l.Files()
+	case Locator:
+		files = []string{l.Location()}
+	default:
+		return nil, fmt.Errorf("handler does not implement cog.FileLister or cog.Locator, config files can not be watched")
+	}
+
+	for i, f := range files {
+		abs, err := filepath.Abs(f)
+		if err != nil {
+			return nil, err
+		}
+		files[i] = abs
+	}
+
+	return &fileWatcher{files: files}, nil
+}
+
+// File watcher sends change notification when content of any watched file changes.
+// Directories of the files are watched, so files replaced by rename or symlink swap are detected as well.
+type fileWatcher struct {
+	files []string
+}
+
+func (w *fileWatcher) Watch(ctx context.Context) (<-chan struct{}, error) {
+	dirs := []string{}
+	seen := map[string]bool{}
+	for _, f := range w.files {
+		if d := filepath.Dir(f); !seen[d] {
+			seen[d] = true
+			dirs = append(dirs, d)
+		}
+	}
+
+	wake, err := watchDirs(ctx, dirs)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan struct{}, 1)
+	last := w.sum()
+
+	go func() {
+		defer close(ch)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case _, ok := <-wake:
+				if !ok {
+					return
+				}
+			}
+
+			sum := w.sum()
+			if sum == last {
+				continue
+			}
+			last = sum
+
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+// Get checksum of the content of the watched files, missing files are treated as empty.
+func (w *fileWatcher) sum() [sha256.Size]byte {
+	h := sha256.New()
+	for _, f := range w.files {
+		b, _ := os.ReadFile(f)
+		h.Write(b)
+		h.Write([]byte{0})
+	}
+
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
@@ -0,0 +1,56 @@
+//go:build linux
+
+package cog
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+const inotifyMask = unix.IN_CLOSE_WRITE | unix.IN_MODIFY | unix.IN_ATTRIB | unix.IN_CREATE |
+	unix.IN_DELETE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO
+
+// Watch directories with inotify, every batch of events wakes the watcher.
+func watchDirs(ctx context.Context, dirs []string) (<-chan struct{}, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("failed at init inotify: %v", err)
+	}
+
+	for _, d := range dirs {
+		if _, err := unix.InotifyAddWatch(fd, d, inotifyMask); err != nil {
+			unix.Close(fd)
+			return nil, fmt.Errorf("failed at watch %s: %v", d, err)
+		}
+	}
+
+	// non-blocking descriptor is read through the runtime poller, so Close unblocks Read
+	f := os.NewFile(uintptr(fd), "inotify")
+
+	wake := make(chan struct{}, 1)
+
+	go func() {
+		<-ctx.Done()
+		f.Close()
+	}()
+
+	go func() {
+		defer close(wake)
+
+		buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+		for {
+			if _, err := f.Read(buf); err != nil {
+				return
+			}
+			select {
+			case wake <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	return wake, nil
+}
@@ -0,0 +1,36 @@
+//go:build !linux
+
+package cog
+
+import (
+	"context"
+	"time"
+)
+
+const watchPollInterval = time.Second
+
+// Poll watched files periodically where inotify is not available.
+func watchDirs(ctx context.Context, _ []string) (<-chan struct{}, error) {
+	wake := make(chan struct{}, 1)
+
+	go func() {
+		defer close(wake)
+
+		t := time.NewTicker(watchPollInterval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				select {
+				case wake <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+	return wake, nil
+}
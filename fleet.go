@@ -0,0 +1,141 @@
+package cog
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// InstanceState is published by every instance of the fleet after config is loaded or changed.
+type InstanceState struct {
+	Instance string `json:"instance"`
+	// Checksum of the config, fields tagged with `secret:"true"` are not included.
+	Checksum string `json:"checksum"`
+	// Config timestamp, see c.GetTimestamp().
+	Timestamp string    `json:"timestamp"`
+	Published time.Time `json:"published"`
+}
+
+// Fleet coordinates instances sharing the same config. Every instance publishes its state
+// under own key of the shared store, so drift can be detected by any instance or external collector.
+type Fleet struct {
+	handler  KeyedHandler
+	instance string
+}
+
+// Create fleet backed by the shared store. Instance name has to be unique within the fleet, e.g. hostname.
+// Handler has to implement cog.KeyLister to list states of the other instances.
+func NewFleet(handler KeyedHandler, instance string) *Fleet {
+	return &Fleet{handler: handler, instance: instance}
+}
+
+// Publish state of the instance.
+func (f *Fleet) Publish(state InstanceState) error {
+	h, err := f.handler.Handler(state.Instance)
+	if err != nil {
+		return fmt.Errorf("failed at get handler for instance %q: %v", state.Instance, err)
+	}
+
+	return h.Save(state)
+}
+
+// Get published states of all instances sorted by instance name.
+func (f *Fleet) States(ctx context.Context) ([]InstanceState, error) {
+	l, ok := f.handler.(KeyLister)
+	if !ok {
+		return nil, fmt.Errorf("handler does not implement cog.KeyLister")
+	}
+
+	keys, err := l.Keys(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed at list instances: %v", err)
+	}
+
+	states := make([]InstanceState, 0, len(keys))
+	for _, k := range keys {
+		h, err := f.handler.Handler(k)
+		if err != nil {
+			return nil, fmt.Errorf("failed at get handler for instance %q: %v", k, err)
+		}
+
+		var s InstanceState
+		if err := h.Load(&s); err != nil {
+			return nil, fmt.Errorf("failed at load state of instance %q: %v", k, err)
+		}
+		states = append(states, s)
+	}
+
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Instance < states[j].Instance
+	})
+
+	return states, nil
+}
+
+// Get states of the instances which config checksum differs from the desired one.
+func (f *Fleet) Drift(ctx context.Context, checksum string) ([]InstanceState, error) {
+	states, err := f.States(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	drifted := []InstanceState{}
+	for _, s := range states {
+		if s.Checksum != checksum {
+			drifted = append(drifted, s)
+		}
+	}
+
+	return drifted, nil
+}
+
+// Get checksum of the current config, fields tagged with `secret:"true"` are not included.
+func (cog *C[T]) Checksum() string {
+	return checksum(cog.Config())
+}
+
+// Get states of the fleet instances which config differs from the config of this instance.
+// Fleet has to be configured with cog.WithFleet.
+func (cog *C[T]) Drift(ctx context.Context) ([]InstanceState, error) {
+	if cog.opts.Fleet == nil {
+		return nil, fmt.Errorf("fleet is not configured")
+	}
+
+	return cog.opts.Fleet.Drift(ctx, cog.Checksum())
+}
+
+// Publish state of the instance to the fleet. Publishing is best effort, error is reported in cog.Status().
+func (cog *C[T]) publish() {
+	f := cog.opts.Fleet
+	if f == nil {
+		return
+	}
+
+	err := f.Publish(InstanceState{
+		Instance:  f.instance,
+		Checksum:  checksum(cog.config),
+		Timestamp: cog.timestamp,
+		Published: cog.opts.Clock.Now(),
+	})
+
+	cog.status.lock.Lock()
+	defer cog.status.lock.Unlock()
+
+	cog.status.current.LastPublishError = err
+}
+
+func checksum[T any](config T) string {
+	var data any = config
+	if v := reflect.ValueOf(config); v.Kind() == reflect.Struct {
+		data = snapshotDoc(v, "", nil, false)
+	}
+
+	b, _ := json.Marshal(data)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
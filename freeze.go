@@ -0,0 +1,85 @@
+package cog
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrFrozen = errors.New("config is frozen")
+
+type FreezePolicy int
+
+const (
+	// Only updates are rejected while config is frozen, changes of the source are reloaded.
+	FreezeUpdates FreezePolicy = iota
+	// Changes of the source detected while config is frozen are reloaded once it is unfrozen,
+	// the same way as when watching is paused. Explicit c.Reload is not affected.
+	FreezeReloads
+)
+
+// Specify what is suppressed while config is frozen with c.Freeze.
+// - cog.FreezeUpdates (default)
+// - cog.FreezeReloads
+func WithFreezePolicy(p FreezePolicy) Option {
+	return func(o *Optional) {
+		o.FreezePolicy = p
+	}
+}
+
+// Freeze config, e.g. during change freeze around big events. Updates are rejected with cog.ErrFrozen
+// until c.Unfreeze, reloads are suppressed according to the freeze policy. Freeze state is reported in Status.
+// Freezing frozen config only changes the reason.
+func (cog *C[T]) Freeze(reason string) {
+	now := cog.opts.Clock.Now()
+
+	cog.status.lock.Lock()
+	s := &cog.status.current
+	if !s.Frozen {
+		s.FrozenSince = now
+	}
+	s.Frozen = true
+	s.FreezeReason = reason
+	cog.status.lock.Unlock()
+
+	cog.emit(Event{Type: EventFrozen, Time: now})
+}
+
+// Unfreeze config. Changes of the source suppressed while frozen are reloaded.
+func (cog *C[T]) Unfreeze() {
+	cog.status.lock.Lock()
+	s := &cog.status.current
+	frozen := s.Frozen
+	s.Frozen = false
+	s.FreezeReason = ""
+	cog.status.lock.Unlock()
+
+	if !frozen {
+		return
+	}
+
+	cog.emit(Event{Type: EventUnfrozen, Time: cog.opts.Clock.Now()})
+
+	cog.watch.lock.Lock()
+	defer cog.watch.lock.Unlock()
+
+	cog.resumePending()
+}
+
+// Check that config is not frozen.
+func (cog *C[T]) checkFrozen() error {
+	cog.status.lock.Lock()
+	defer cog.status.lock.Unlock()
+
+	if s := cog.status.current; s.Frozen {
+		return fmt.Errorf("%w: %s", ErrFrozen, s.FreezeReason)
+	}
+	return nil
+}
+
+// Check if reloads are suppressed by freeze.
+func (cog *C[T]) reloadsFrozen() bool {
+	cog.status.lock.Lock()
+	defer cog.status.lock.Unlock()
+
+	return cog.status.current.Frozen && cog.opts.FreezePolicy == FreezeReloads
+}
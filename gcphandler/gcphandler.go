@@ -0,0 +1,185 @@
+package gcphandler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	fh "github.com/leonidasdeim/cog/filehandler"
+)
+
+const latestVersion = "latest"
+
+type SecretVersion struct {
+	// Full resource name of the resolved version: projects/*/secrets/*/versions/<number>
+	Name    string
+	Payload []byte
+}
+
+// SecretManagerClient is a subset of GCP Secret Manager API used by the handler.
+// It is satisfied by a thin adapter around secretmanager.Client from Google Cloud SDK,
+// which is also responsible for credentials.
+type SecretManagerClient interface {
+	// Access secret version by its resource name, "latest" alias is resolved by the service.
+	AccessSecretVersion(ctx context.Context, name string) (SecretVersion, error)
+	// Add new version of the secret, returns resolved version.
+	AddSecretVersion(ctx context.Context, secret string, payload []byte) (SecretVersion, error)
+}
+
+// SecretManagerHandler keeps marshaled config as a secret in GCP Secret Manager.
+// By default "latest" version is loaded and Watch refreshes it periodically.
+type SecretManagerHandler struct {
+	m        sync.Mutex
+	client   SecretManagerClient
+	secret   string
+	version  string
+	codec    fh.Codec
+	interval time.Duration
+	resolved string
+}
+
+type Optional struct {
+	Version      string
+	Type         fh.FileType
+	PollInterval time.Duration
+}
+
+type Option func(o *Optional)
+
+// Pin secret version. By default "latest" is used.
+func WithVersion(v string) Option {
+	return func(o *Optional) {
+		o.Version = v
+	}
+}
+
+// Specify secret format.
+// - filehandler.JSON (default)
+// - filehandler.YAML
+// - filehandler.TOML
+func WithType(t fh.FileType) Option {
+	return func(o *Optional) {
+		o.Type = t
+	}
+}
+
+// Specify how often Watch checks for a new version. By default it is 1 minute.
+func WithPollInterval(d time.Duration) Option {
+	return func(o *Optional) {
+		o.PollInterval = d
+	}
+}
+
+// Create handler for the secret, name is in "projects/<project>/secrets/<secret>" format.
+func New(client SecretManagerClient, secret string, opts ...Option) (*SecretManagerHandler, error) {
+
+	// Set defaults
+	o := &Optional{
+		Version:      latestVersion,
+		Type:         fh.JSON,
+		PollInterval: time.Minute,
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	codec := fh.NewCodec(o.Type)
+	if codec == nil {
+		return nil, fmt.Errorf("bad secret type: %s", string(o.Type))
+	}
+
+	return &SecretManagerHandler{
+		client:   client,
+		secret:   secret,
+		version:  o.Version,
+		codec:    codec,
+		interval: o.PollInterval,
+	}, nil
+}
+
+func (h *SecretManagerHandler) Load(data any) error {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	v, err := h.client.AccessSecretVersion(context.Background(), h.versionName())
+	if err != nil {
+		return fmt.Errorf("failed at access secret %q: %w", h.versionName(), err)
+	}
+
+	if err := h.codec.Unmarshal(v.Payload, data); err != nil {
+		return fmt.Errorf("failed at unmarshal secret %q: %v", v.Name, err)
+	}
+
+	h.resolved = v.Name
+	return nil
+}
+
+// Add new secret version. If version is pinned, Save is a no-op.
+func (h *SecretManagerHandler) Save(data any) error {
+	if h.version != latestVersion {
+		return nil
+	}
+
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	b, err := h.codec.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	v, err := h.client.AddSecretVersion(context.Background(), h.secret, b)
+	if err != nil {
+		return fmt.Errorf("failed at add secret version %q: %w", h.secret, err)
+	}
+
+	h.resolved = v.Name
+	return nil
+}
+
+// Get resource name of the version loaded or saved last time.
+func (h *SecretManagerHandler) Version() string {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	return h.resolved
+}
+
+// Periodically resolve the version and send notification to the returned channel
+// when new version is available. Channel is closed when context is cancelled.
+func (h *SecretManagerHandler) Watch(ctx context.Context) (<-chan struct{}, error) {
+	ch := make(chan struct{}, 1)
+
+	go func() {
+		defer close(ch)
+
+		t := time.NewTicker(h.interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+
+			v, err := h.client.AccessSecretVersion(ctx, h.versionName())
+			if err != nil || v.Name == h.Version() {
+				continue
+			}
+
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+func (h *SecretManagerHandler) versionName() string {
+	return h.secret + "/versions/" + h.version
+}
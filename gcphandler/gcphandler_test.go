@@ -0,0 +1,122 @@
+package gcphandler
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	fh "github.com/leonidasdeim/cog/filehandler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSecret = "projects/my-project/secrets/my-app"
+
+type testConfig struct {
+	Name string `json:"name" yaml:"name"`
+	Port int    `json:"port" yaml:"port"`
+}
+
+// In-memory Secret Manager with numbered versions of one secret.
+type fakeSecretManager struct {
+	m        sync.Mutex
+	versions [][]byte
+}
+
+func (f *fakeSecretManager) AccessSecretVersion(_ context.Context, name string) (SecretVersion, error) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	secret, version, ok := strings.Cut(name, "/versions/")
+	if !ok || secret != testSecret {
+		return SecretVersion{}, errors.New("NotFound: secret not found")
+	}
+
+	n := len(f.versions)
+	if version != latestVersion {
+		var err error
+		if n, err = strconv.Atoi(version); err != nil || n < 1 || n > len(f.versions) {
+			return SecretVersion{}, errors.New("NotFound: version not found")
+		}
+	}
+	if n == 0 {
+		return SecretVersion{}, errors.New("FailedPrecondition: secret has no versions")
+	}
+
+	return SecretVersion{Name: secret + "/versions/" + strconv.Itoa(n), Payload: f.versions[n-1]}, nil
+}
+
+func (f *fakeSecretManager) AddSecretVersion(_ context.Context, secret string, payload []byte) (SecretVersion, error) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	f.versions = append(f.versions, payload)
+	return SecretVersion{Name: secret + "/versions/" + strconv.Itoa(len(f.versions)), Payload: payload}, nil
+}
+
+func TestLoadSave(t *testing.T) {
+	f := &fakeSecretManager{}
+	h, err := New(f, testSecret, WithType(fh.YAML))
+	require.NoError(t, err)
+
+	var c testConfig
+	assert.ErrorContains(t, h.Load(&c), "has no versions")
+
+	require.NoError(t, h.Save(testConfig{Name: "app", Port: 8080}))
+	assert.Equal(t, testSecret+"/versions/1", h.Version())
+	assert.Equal(t, "name: app\nport: 8080\n", string(f.versions[0]))
+
+	require.NoError(t, h.Save(testConfig{Name: "app", Port: 8081}))
+	require.NoError(t, h.Load(&c))
+	assert.Equal(t, testConfig{Name: "app", Port: 8081}, c)
+	assert.Equal(t, testSecret+"/versions/2", h.Version())
+}
+
+func TestPinnedVersion(t *testing.T) {
+	f := &fakeSecretManager{versions: [][]byte{[]byte(`{"name":"v1"}`), []byte(`{"name":"v2"}`)}}
+	h, err := New(f, testSecret, WithVersion("1"))
+	require.NoError(t, err)
+
+	var c testConfig
+	require.NoError(t, h.Load(&c))
+	assert.Equal(t, "v1", c.Name)
+
+	// pinned version is not changed by save
+	require.NoError(t, h.Save(testConfig{Name: "v3"}))
+	assert.Len(t, f.versions, 2)
+	assert.Equal(t, testSecret+"/versions/1", h.Version())
+}
+
+func TestWatch(t *testing.T) {
+	f := &fakeSecretManager{}
+	h, err := New(f, testSecret, WithPollInterval(time.Millisecond))
+	require.NoError(t, err)
+	require.NoError(t, h.Save(testConfig{Name: "app"}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := h.Watch(ctx)
+	require.NoError(t, err)
+
+	select {
+	case <-ch:
+		t.Fatal("unexpected notification without new version")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	_, err = f.AddSecretVersion(ctx, testSecret, []byte(`{"name":"other"}`))
+	require.NoError(t, err)
+
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		t.Fatal("expected notification about new version")
+	}
+
+	cancel()
+	for range ch {
+	}
+}
@@ -0,0 +1,313 @@
+package githandler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	fh "github.com/leonidasdeim/cog/filehandler"
+)
+
+var ErrPushRejected = errors.New("push rejected, remote branch has been modified")
+
+// GitHandler reads config file from a git repository at the given branch.
+// Repository is cloned to a local directory and fetched on every Load, so the repository stays
+// the source of truth. Save commits and pushes the file only if push is enabled, otherwise it is a no-op.
+type GitHandler struct {
+	m        sync.Mutex
+	repo     string
+	dir      string
+	ref      string
+	file     string
+	codec    fh.Codec
+	interval time.Duration
+	push     bool
+	message  string
+	author   string
+	commit   string
+}
+
+type Optional struct {
+	Dir          string
+	Ref          string
+	File         string
+	PollInterval time.Duration
+	Push         bool
+	Message      string
+	Author       string
+}
+
+type Option func(o *Optional)
+
+// Add custom directory for the local clone. By default temporary directory is created.
+func WithDir(d string) Option {
+	return func(o *Optional) {
+		o.Dir = d
+	}
+}
+
+// Specify branch. By default it is set to "main".
+func WithRef(r string) Option {
+	return func(o *Optional) {
+		o.Ref = r
+	}
+}
+
+// Specify config file path inside the repository. Format is resolved from the file extension.
+// By default it is set to "app.json".
+func WithFile(f string) Option {
+	return func(o *Optional) {
+		o.File = f
+	}
+}
+
+// Specify how often Watch checks remote branch. By default it is 1 minute.
+func WithPollInterval(d time.Duration) Option {
+	return func(o *Optional) {
+		o.PollInterval = d
+	}
+}
+
+// Enable commit and push on Save. Author is in "Name <email>" format, empty author uses git config.
+func WithPush(message string, author string) Option {
+	return func(o *Optional) {
+		o.Push = true
+		o.Message = message
+		o.Author = author
+	}
+}
+
+func New(repo string, opts ...Option) (*GitHandler, error) {
+
+	// Set defaults
+	o := &Optional{
+		Ref:          "main",
+		File:         "app.json",
+		PollInterval: time.Minute,
+		Message:      "Update config",
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	codec := fh.NewCodec(fileType(o.File))
+	if codec == nil {
+		return nil, fmt.Errorf("bad file type: %s", o.File)
+	}
+
+	if o.Dir == "" {
+		d, err := os.MkdirTemp("", "cog-git-")
+		if err != nil {
+			return nil, fmt.Errorf("failed at create clone directory: %v", err)
+		}
+		o.Dir = d
+	}
+
+	h := &GitHandler{
+		repo:     repo,
+		dir:      o.Dir,
+		ref:      o.Ref,
+		file:     o.File,
+		codec:    codec,
+		interval: o.PollInterval,
+		push:     o.Push,
+		message:  o.Message,
+		author:   o.Author,
+	}
+
+	if err := h.clone(); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// Get absolute path of the directory where config file is located in the local clone.
+func (h *GitHandler) Dir() string {
+	return filepath.Join(h.dir, filepath.Dir(h.file))
+}
+
+func (h *GitHandler) Load(data any) error {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	if _, err := h.git("fetch", "--quiet", "origin", h.ref); err != nil {
+		return err
+	}
+
+	commit, err := h.git("rev-parse", h.remoteRef())
+	if err != nil {
+		return err
+	}
+
+	b, err := h.git("show", h.remoteRef()+":"+filepath.ToSlash(h.file))
+	if err != nil {
+		return fmt.Errorf("failed at read %s at %s: %w", h.file, h.ref, os.ErrNotExist)
+	}
+
+	if err := h.codec.Unmarshal([]byte(b), data); err != nil {
+		return fmt.Errorf("failed at unmarshal %s: %v", h.file, err)
+	}
+
+	h.commit = commit
+	return nil
+}
+
+func (h *GitHandler) Save(data any) error {
+	if !h.push {
+		return nil
+	}
+
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	b, err := h.codec.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	base := h.commit
+	if base == "" {
+		base = h.remoteRef()
+	}
+	if _, err := h.git("checkout", "--quiet", "-B", h.ref, base); err != nil {
+		return err
+	}
+
+	file := filepath.Join(h.dir, h.file)
+	if err := os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+		return fmt.Errorf("failed at create directory: %v", err)
+	}
+	if err := fh.Utils.WriteFile(file, b); err != nil {
+		return fmt.Errorf("failed at write %s: %v", h.file, err)
+	}
+
+	if _, err := h.git("add", h.file); err != nil {
+		return err
+	}
+	if _, err := h.git("diff", "--cached", "--quiet"); err == nil {
+		return nil // nothing changed
+	}
+
+	if _, err := h.run(authorEnv(h.author), "commit", "--quiet", "-m", h.message); err != nil {
+		return err
+	}
+
+	if _, err := h.git("push", "--quiet", "origin", "HEAD:refs/heads/"+h.ref); err != nil {
+		return fmt.Errorf("%w: %v", ErrPushRejected, err)
+	}
+
+	commit, err := h.git("rev-parse", "HEAD")
+	if err != nil {
+		return err
+	}
+
+	h.commit = commit
+	return nil
+}
+
+// Check remote branch and send notification to the returned channel when it points to a commit
+// different from the one seen by last Load or Save. Channel is closed when context is cancelled.
+func (h *GitHandler) Watch(ctx context.Context) (<-chan struct{}, error) {
+	ch := make(chan struct{}, 1)
+
+	go func() {
+		defer close(ch)
+
+		t := time.NewTicker(h.interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+
+			out, err := h.git("ls-remote", "origin", "refs/heads/"+h.ref)
+			if err != nil || out == "" {
+				continue
+			}
+
+			h.m.Lock()
+			changed := strings.Fields(out)[0] != h.commit
+			h.m.Unlock()
+
+			if changed {
+				select {
+				case ch <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+func (h *GitHandler) clone() error {
+	if fh.Utils.FileExists(filepath.Join(h.dir, ".git")) {
+		return nil
+	}
+
+	_, err := h.git("clone", "--quiet", "--no-checkout", h.repo, h.dir)
+	return err
+}
+
+func (h *GitHandler) remoteRef() string {
+	return "origin/" + h.ref
+}
+
+func (h *GitHandler) git(args ...string) (string, error) {
+	return h.run(nil, args...)
+}
+
+func (h *GitHandler) run(env []string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	if args[0] != "clone" {
+		cmd.Dir = h.dir
+	}
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("failed at git %s: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// Build author and committer identity environment from "Name <email>" string.
+func authorEnv(author string) []string {
+	i, j := strings.Index(author, "<"), strings.LastIndex(author, ">")
+	if i < 0 || j < i {
+		return nil
+	}
+
+	name, email := strings.TrimSpace(author[:i]), author[i+1:j]
+	return []string{
+		"GIT_AUTHOR_NAME=" + name, "GIT_AUTHOR_EMAIL=" + email,
+		"GIT_COMMITTER_NAME=" + name, "GIT_COMMITTER_EMAIL=" + email,
+	}
+}
+
+func fileType(file string) fh.FileType {
+	ext := strings.TrimPrefix(filepath.Ext(file), ".")
+	if ext == "yml" {
+		ext = "yaml"
+	}
+	return fh.FileType(ext)
+}
@@ -0,0 +1,182 @@
+package githandler
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testConfig struct {
+	Name string `json:"name" yaml:"name"`
+	Port int    `json:"port" yaml:"port"`
+}
+
+// Create bare repository with config file committed to main branch and return its path
+// and a working clone to make external changes.
+func newRemote(t *testing.T, file, content string) (string, string) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	for _, k := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+		t.Setenv(k, "test")
+	}
+	for _, k := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+		t.Setenv(k, "test@example.com")
+	}
+
+	remote := filepath.Join(t.TempDir(), "remote.git")
+	work := filepath.Join(t.TempDir(), "work")
+
+	gitIn(t, "", "init", "--quiet", "--bare", remote)
+	gitIn(t, "", "clone", "--quiet", remote, work)
+	commitFile(t, work, file, content)
+
+	return remote, work
+}
+
+func commitFile(t *testing.T, work, file, content string) {
+	path := filepath.Join(work, file)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), os.ModePerm))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	gitIn(t, work, "add", file)
+	gitIn(t, work, "commit", "--quiet", "-m", "external change")
+	gitIn(t, work, "push", "--quiet", "origin", "HEAD:refs/heads/main")
+}
+
+func gitIn(t *testing.T, dir string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+	return string(out)
+}
+
+func TestLoad(t *testing.T) {
+	remote, _ := newRemote(t, "config/app.yaml", "name: app\nport: 8080\n")
+
+	h, err := New(remote, WithDir(filepath.Join(t.TempDir(), "clone")), WithFile("config/app.yaml"))
+	require.NoError(t, err)
+
+	var c testConfig
+	require.NoError(t, h.Load(&c))
+	assert.Equal(t, testConfig{Name: "app", Port: 8080}, c)
+	assert.Equal(t, filepath.Join(h.dir, "config"), h.Dir())
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	remote, _ := newRemote(t, "app.json", `{"name":"app"}`)
+
+	h, err := New(remote, WithFile("other.json"))
+	require.NoError(t, err)
+	defer os.RemoveAll(h.dir)
+
+	var c testConfig
+	assert.ErrorIs(t, h.Load(&c), os.ErrNotExist)
+}
+
+func TestSaveWithoutPush(t *testing.T) {
+	remote, work := newRemote(t, "app.json", `{"name":"app"}`)
+
+	h, err := New(remote, WithDir(filepath.Join(t.TempDir(), "clone")))
+	require.NoError(t, err)
+
+	var c testConfig
+	require.NoError(t, h.Load(&c))
+	require.NoError(t, h.Save(testConfig{Name: "changed"}))
+
+	gitIn(t, work, "pull", "--quiet", "origin", "main")
+	b, err := os.ReadFile(filepath.Join(work, "app.json"))
+	require.NoError(t, err)
+	assert.Equal(t, `{"name":"app"}`, string(b))
+}
+
+func TestSavePush(t *testing.T) {
+	remote, work := newRemote(t, "app.json", `{"name":"app"}`)
+
+	h, err := New(remote, WithDir(filepath.Join(t.TempDir(), "clone")), WithPush("Update port", "Cog Bot <bot@example.com>"))
+	require.NoError(t, err)
+
+	var c testConfig
+	require.NoError(t, h.Load(&c))
+
+	c.Port = 8081
+	require.NoError(t, h.Save(c))
+	first := h.commit
+
+	// unchanged config does not create a commit
+	require.NoError(t, h.Save(c))
+	assert.Equal(t, first, h.commit)
+
+	gitIn(t, work, "pull", "--quiet", "origin", "main")
+	assert.Equal(t, "Cog Bot <bot@example.com> Update port\n", gitIn(t, work, "log", "-1", "--format=%an <%ae> %s"))
+
+	var pushed testConfig
+	require.NoError(t, h.Load(&pushed))
+	assert.Equal(t, c, pushed)
+}
+
+func TestSaveRejected(t *testing.T) {
+	remote, work := newRemote(t, "app.json", `{"name":"app"}`)
+
+	h, err := New(remote, WithDir(filepath.Join(t.TempDir(), "clone")), WithPush("Update config", ""))
+	require.NoError(t, err)
+
+	var c testConfig
+	require.NoError(t, h.Load(&c))
+
+	commitFile(t, work, "app.json", `{"name":"external"}`)
+
+	assert.ErrorIs(t, h.Save(testConfig{Name: "local"}), ErrPushRejected)
+
+	require.NoError(t, h.Load(&c))
+	assert.Equal(t, "external", c.Name)
+	assert.NoError(t, h.Save(testConfig{Name: "local"}))
+}
+
+func TestWatch(t *testing.T) {
+	remote, work := newRemote(t, "app.json", `{"name":"app"}`)
+
+	h, err := New(remote, WithDir(filepath.Join(t.TempDir(), "clone")), WithPollInterval(10*time.Millisecond))
+	require.NoError(t, err)
+
+	var c testConfig
+	require.NoError(t, h.Load(&c))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := h.Watch(ctx)
+	require.NoError(t, err)
+
+	select {
+	case <-ch:
+		t.Fatal("unexpected notification without change")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	commitFile(t, work, "app.json", `{"name":"external"}`)
+
+	select {
+	case <-ch:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected notification about new commit")
+	}
+
+	cancel()
+	for range ch {
+	}
+}
+
+func TestAuthorEnv(t *testing.T) {
+	assert.Equal(t, []string{
+		"GIT_AUTHOR_NAME=Cog Bot", "GIT_AUTHOR_EMAIL=bot@example.com",
+		"GIT_COMMITTER_NAME=Cog Bot", "GIT_COMMITTER_EMAIL=bot@example.com",
+	}, authorEnv("Cog Bot <bot@example.com>"))
+	assert.Nil(t, authorEnv("Cog Bot"))
+	assert.Nil(t, authorEnv(""))
+}
@@ -0,0 +1,70 @@
+// Package handlerapi defines interfaces implemented by config handlers. It has no dependencies,
+// so handlers and tests can depend on it without importing cog itself. Interfaces are re-exported
+// by cog under the same names.
+package handlerapi
+
+import "context"
+
+//go:generate mockery --all --with-expecter --output ./mocks
+
+// ConfigHandler loads and saves config document. Load returns error wrapping fs.ErrNotExist
+// if the document does not exist yet, then config is initialized with defaults and saved.
+type ConfigHandler interface {
+	Load(any) error
+	Save(any) error
+}
+
+// Handlers which keep default config document separately from the active one can implement this interface.
+// Default document is then used as a separate source for the fields missing in the active document.
+type DefaultLoader interface {
+	LoadDefault(any) error
+}
+
+// Watchable can be implemented by config handlers which are able to detect changes of the source,
+// e.g. by file system notifications, watches, blocking queries or polling. Handler sends to the returned
+// channel when config has changed and closes it when context is cancelled.
+type Watchable interface {
+	Watch(ctx context.Context) (<-chan struct{}, error)
+}
+
+// ReadOnlyHandler can be implemented by config handlers which can not write the source, e.g. file handler
+// rendering templates. ReadOnly reports whether Save would fail, such handlers are never saved.
+type ReadOnlyHandler interface {
+	ReadOnly() bool
+}
+
+// ContextHandler can be implemented by config handlers which are able to cancel long-running loads and saves,
+// e.g. remote stores. Context is the one passed to InitCtx or UpdateCtx.
+type ContextHandler interface {
+	LoadContext(ctx context.Context, data any) error
+	SaveContext(ctx context.Context, data any) error
+}
+
+// Checksummer can be implemented by config handlers which are able to cheaply compute checksum of the stored config.
+// It is used to recognize change notifications caused by own Save and skip reloading.
+type Checksummer interface {
+	Checksum() (string, error)
+}
+
+// RawProvider can be implemented by config handlers which read config document as bytes.
+// Raw returns bytes read by the last Load before decoding, nil if nothing has been read.
+type RawProvider interface {
+	Raw() []byte
+}
+
+// Pinger can be implemented by config handlers backed by remote sources.
+// Ping should check if the source is reachable without loading the config.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// KeyedHandler is a config store which keeps separate config per key, e.g. per tenant.
+type KeyedHandler interface {
+	// Get handler of the config stored under the key.
+	Handler(key string) (ConfigHandler, error)
+}
+
+// KeyLister can be implemented by KeyedHandler to list keys of the stored configs.
+type KeyLister interface {
+	Keys(ctx context.Context) ([]string, error)
+}
@@ -0,0 +1,44 @@
+package cog
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+
+	fh "github.com/leonidasdeim/cog/filehandler"
+)
+
+const helmConfigMap = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ include %[3]q . }}-config
+data:
+  %[2]s: |
+{{ toYaml .Values.%[1]s | indent 4 }}
+`
+
+// Write values.yaml skeleton of config T nested under the key, e.g. "config". Values of `default` tags
+// are used, other fields are zero. Keys are the same as in YAML config file.
+func WriteHelmValues[T any](w io.Writer, key string) error {
+	config := new(T)
+
+	r := resolver{precedence: []Source{SourceDefault}}
+	if err := r.resolve(reflect.ValueOf(config).Elem()); err != nil {
+		return err
+	}
+
+	b, err := fh.NewCodec(fh.YAML).Marshal(map[string]any{key: stripDerived(*config)})
+	if err != nil {
+		return fmt.Errorf("failed at marshal values: %v", err)
+	}
+
+	_, err = w.Write(b)
+	return err
+}
+
+// Write ConfigMap template which renders values under the key as config file, e.g. "app.yaml".
+// Fullname is the name of the chart's fullname template, e.g. "mychart.fullname".
+func WriteHelmConfigMap(w io.Writer, key, file, fullname string) error {
+	_, err := fmt.Fprintf(w, helmConfigMap, key, file, fullname)
+	return err
+}
@@ -0,0 +1,84 @@
+package cog
+
+import "fmt"
+
+type BeforeUpdateHook[T any] func(old T, new T) (T, error)
+type BeforeSaveHook[T any] func(T) error
+type AfterUpdateHook[T any] func(old T, new T)
+
+type hooks[T any] struct {
+	beforeUpdate []BeforeUpdateHook[T]
+	beforeSave   []BeforeSaveHook[T]
+	afterUpdate  []AfterUpdateHook[T]
+	conflict     []ConflictHook[T]
+	report       []UpdateReportHook
+}
+
+// Register hook which is called on Update before validation.
+// Hook receives current and new configuration and returns configuration which will be used further,
+// so it can be used to normalize or enrich incoming data. Returned error cancels the update.
+func (cog *C[T]) OnBeforeUpdate(f BeforeUpdateHook[T]) {
+	cog.lock.Lock()
+	defer cog.lock.Unlock()
+
+	cog.hooks.beforeUpdate = append(cog.hooks.beforeUpdate, f)
+}
+
+// Register hook which is called right before configuration is passed to the handler for saving.
+// Returned error cancels the save.
+func (cog *C[T]) OnBeforeSave(f BeforeSaveHook[T]) {
+	cog.lock.Lock()
+	defer cog.lock.Unlock()
+
+	cog.hooks.beforeSave = append(cog.hooks.beforeSave, f)
+}
+
+// Register hook which is called after configuration has been updated and saved.
+func (cog *C[T]) OnAfterUpdate(f AfterUpdateHook[T]) {
+	cog.lock.Lock()
+	defer cog.lock.Unlock()
+
+	cog.hooks.afterUpdate = append(cog.hooks.afterUpdate, f)
+}
+
+// Get copy of the registered hooks, so they can be run while instance is not locked.
+func (cog *C[T]) getHooks() hooks[T] {
+	cog.lock.Lock()
+	defer cog.lock.Unlock()
+
+	return cog.hooks
+}
+
+func (h *hooks[T]) runBeforeUpdate(old T, new T) (T, error) {
+	for _, f := range h.beforeUpdate {
+		if f == nil {
+			continue
+		}
+		var err error
+		if new, err = f(old, new); err != nil {
+			return new, fmt.Errorf("before update hook returned an error: %v", err)
+		}
+	}
+	return new, nil
+}
+
+func (h *hooks[T]) runBeforeSave(config T) error {
+	for _, f := range h.beforeSave {
+		if f == nil {
+			continue
+		}
+		if err := f(config); err != nil {
+			return fmt.Errorf("before save hook returned an error: %v", err)
+		}
+	}
+	return nil
+}
+
+func (h *hooks[T]) runAfterUpdate(old T, new T) {
+	for _, f := range h.afterUpdate {
+		if f == nil {
+			continue
+		}
+		f(old, new)
+	}
+}
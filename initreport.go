@@ -0,0 +1,141 @@
+package cog
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Handlers which know location of the loaded config can implement this interface,
+// e.g. file handler returns absolute path of the config file. It is reported in InitReport.
+type Locator interface {
+	Location() string
+}
+
+// Handlers which create config on init can implement this interface,
+// e.g. file handler creates active config file from the default one. It is reported in InitReport.
+type Creator interface {
+	Created() bool
+}
+
+// InitReport describes how the instance has been initialized: where config has been loaded from,
+// which source provided every field, warnings and timing.
+type InitReport struct {
+	Started time.Time
+	// Total time spent initializing the instance.
+	Duration time.Duration
+	// Time spent loading config from the handler, including retries.
+	LoadDuration time.Duration
+	// Location of the config reported by the handler implementing cog.Locator, e.g. path of the config file.
+	Location string
+	// Config has been loaded from the handler. Otherwise LoadErr tells why.
+	Loaded       bool
+	LoadErr      error
+	FromSnapshot bool
+	// Source could not be loaded and config has been initialized with defaults. It is not saved on init,
+	// so the source is not overwritten, and is synchronized on reload.
+	Unavailable bool
+	// Config has been created by the handler implementing cog.Creator, e.g. active config file copied from the default one.
+	Created bool
+	// Config has been saved on init.
+	Saved bool
+	// Source which provided the field by path, e.g. "Server.Port": cog.SourceEnv.
+	// Fields which are not provided by any source are missing.
+	Sources map[string]Source
+	// Config document read from the source before decoding, see c.Raw.
+	Raw []byte
+	// Problems which do not fail init, e.g. keys of the config document which do not match any field.
+	Warnings []string
+	// Error init failed with.
+	Err error
+}
+
+// Get paths of the fields provided by the source, sorted.
+// env := report.FieldsFrom(cog.SourceEnv)
+func (r InitReport) FieldsFrom(s Source) []string {
+	fields := []string{}
+	for path, from := range r.Sources {
+		if from == s {
+			fields = append(fields, path)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// Fill r with the init report when New returns, also when it fails.
+// var report cog.InitReport
+// c, err := cog.New[ConfigStruct](cog.WithInitReport(&report))
+func WithInitReport(r *InitReport) Option {
+	return func(o *Optional) {
+		o.InitReport = r
+	}
+}
+
+// Get report of the instance initialization.
+func (cog *C[T]) InitReport() InitReport {
+	cog.lock.Lock()
+	defer cog.lock.Unlock()
+
+	return cog.initReport.clone()
+}
+
+// Record report of the finished initialization.
+func (cog *C[T]) finishInit(r InitReport, err error) {
+	r.Duration = cog.opts.Clock.Now().Sub(r.Started)
+	r.Err = err
+
+	cog.lock.Lock()
+	cog.initReport = r
+	cog.lock.Unlock()
+
+	if cog.opts.InitReport != nil {
+		*cog.opts.InitReport = r.clone()
+	}
+	if cog.opts.Logger != nil {
+		cog.logInit(r)
+	}
+}
+
+// Describe config load on init.
+func (cog *C[T]) reportLoad(r *InitReport, started time.Time) {
+	r.LoadDuration = cog.opts.Clock.Now().Sub(started)
+
+	if l, ok := cog.handler.(Locator); ok {
+		r.Location = l.Location()
+	}
+	if c, ok := cog.handler.(Creator); ok {
+		r.Created = c.Created()
+	}
+	r.Raw = cog.Raw()
+
+	switch {
+	case r.FromSnapshot:
+		r.Warnings = append(r.Warnings, fmt.Sprintf("config has been loaded from the snapshot: %v", r.LoadErr))
+	case !r.Loaded && r.LoadErr != nil:
+		r.Warnings = append(r.Warnings, fmt.Sprintf("config has not been loaded, defaults are used: %v", r.LoadErr))
+	}
+
+	if r.Loaded {
+		cog.lock.Lock()
+		unknown := cog.unknownKeys
+		cog.lock.Unlock()
+
+		for _, k := range unknown {
+			r.Warnings = append(r.Warnings, fmt.Sprintf("unknown key %q", k))
+		}
+	}
+}
+
+func (r InitReport) clone() InitReport {
+	if r.Sources != nil {
+		sources := make(map[string]Source, len(r.Sources))
+		for k, v := range r.Sources {
+			sources[k] = v
+		}
+		r.Sources = sources
+	}
+	r.Warnings = append([]string(nil), r.Warnings...)
+	r.Raw = append([]byte(nil), r.Raw...)
+	return r
+}
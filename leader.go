@@ -0,0 +1,126 @@
+package cog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var ErrNotLeader = errors.New("config can be updated only by the leader")
+
+// Lease elects single leader among instances sharing writable config store.
+type Lease interface {
+	// Acquire lease or renew it if it is already held. Returns true if instance is the leader.
+	Acquire(ctx context.Context) (bool, error)
+}
+
+type leaseDoc struct {
+	Holder  string    `json:"holder"`
+	Expires time.Time `json:"expires"`
+}
+
+// StoreLease is a simple lease kept as a document in the config store.
+// Store does not provide compare-and-swap, so two instances may briefly both consider themselves leaders
+// if they acquire expired lease at the same moment. Lease is verified by reading it back after write
+// to make this window as small as possible.
+type StoreLease struct {
+	lock    sync.Mutex
+	handler ConfigHandler
+	holder  string
+	ttl     time.Duration
+}
+
+// Create lease stored by the handler, e.g. separate key of the same store.
+// Holder has to be unique among instances, e.g. hostname. Lease expires if it is not renewed within ttl.
+func NewLease(handler ConfigHandler, holder string, ttl time.Duration) *StoreLease {
+	return &StoreLease{handler: handler, holder: holder, ttl: ttl}
+}
+
+func (l *StoreLease) Acquire(ctx context.Context) (bool, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	var doc leaseDoc
+	if err := l.handler.Load(&doc); err != nil {
+		// store without the lease document, e.g. missing file or key
+		doc = leaseDoc{}
+	}
+
+	now := time.Now()
+	if doc.Holder != l.holder && doc.Holder != "" && now.Before(doc.Expires) {
+		return false, nil
+	}
+
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	if err := l.handler.Save(leaseDoc{Holder: l.holder, Expires: now.Add(l.ttl)}); err != nil {
+		return false, fmt.Errorf("failed at write lease: %v", err)
+	}
+
+	if err := l.handler.Load(&doc); err != nil {
+		return false, fmt.Errorf("failed at read lease: %v", err)
+	}
+
+	return doc.Holder == l.holder, nil
+}
+
+// Check if instance is the leader. Instance is always the leader if lease is not configured.
+func (cog *C[T]) IsLeader() bool {
+	cog.lock.Lock()
+	defer cog.lock.Unlock()
+
+	return cog.leader
+}
+
+// Acquire lease on init. Instance which can not reach the lease store starts as a follower.
+func (cog *C[T]) acquireLease() {
+	if cog.opts.Lease == nil {
+		cog.leader = true
+		return
+	}
+
+	ctx := context.Background()
+	if cog.opts.LeaseRenew > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cog.opts.LeaseRenew)
+		defer cancel()
+	}
+
+	cog.leader, _ = cog.opts.Lease.Acquire(ctx)
+}
+
+func (cog *C[T]) startLeaseRenewal() {
+	if cog.opts.Lease == nil || cog.opts.LeaseRenew <= 0 {
+		return
+	}
+
+	cog.background(func() {
+		for {
+			select {
+			case <-cog.done:
+				return
+			case <-cog.opts.Clock.After(cog.opts.LeaseRenew):
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), cog.opts.LeaseRenew)
+			leader, err := cog.opts.Lease.Acquire(ctx)
+			cancel()
+
+			cog.lock.Lock()
+			was := cog.leader
+			cog.leader = leader
+			cog.lock.Unlock()
+
+			switch {
+			case !was && leader:
+				cog.emit(Event{Type: EventLeaderElected, Time: cog.opts.Clock.Now()})
+			case was && !leader:
+				cog.emit(Event{Type: EventLeaderLost, Time: cog.opts.Clock.Now(), Err: err})
+			}
+		}
+	})
+}
@@ -0,0 +1,117 @@
+package cog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+var ErrLimitExceeded = errors.New("config exceeds limit")
+
+// Limits of the config size and complexity, zero value disables the limit.
+type Limits struct {
+	// Maximal size of the config marshaled to JSON, in bytes.
+	MaxSize int
+	// Maximal nesting depth of structs, maps and slices, top level struct has depth 1.
+	MaxDepth int
+	// Maximal length of any slice, array or map.
+	MaxSliceLen int
+}
+
+// Check config against the limits. Size is checked last, so oversized collections are reported
+// without marshaling them.
+func checkLimits[T any](config T, l Limits) error {
+	if l == (Limits{}) {
+		return nil
+	}
+
+	if err := checkValue(reflect.ValueOf(config), "", 1, l); err != nil {
+		return err
+	}
+
+	if l.MaxSize > 0 {
+		b, err := json.Marshal(config)
+		if err != nil {
+			return fmt.Errorf("failed at check config size: %v", err)
+		}
+		if len(b) > l.MaxSize {
+			return fmt.Errorf("%w: size is %d bytes, max %d", ErrLimitExceeded, len(b), l.MaxSize)
+		}
+	}
+
+	return nil
+}
+
+func checkValue(v reflect.Value, path string, depth int, l Limits) error {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return checkValue(v.Elem(), path, depth, l)
+	case reflect.Struct:
+		if isMarshaler(v.Type()) {
+			return nil
+		}
+	case reflect.Map, reflect.Slice, reflect.Array:
+	default:
+		return nil
+	}
+
+	if l.MaxDepth > 0 && depth > l.MaxDepth {
+		return fmt.Errorf("%w: %s is nested deeper than %d", ErrLimitExceeded, pathOrRoot(path), l.MaxDepth)
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if !t.Field(i).IsExported() {
+				continue
+			}
+			if err := checkValue(v.Field(i), joinPath(path, t.Field(i).Name), depth+1, l); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if l.MaxSliceLen > 0 && v.Len() > l.MaxSliceLen {
+			return fmt.Errorf("%w: %s has %d entries, max %d", ErrLimitExceeded, pathOrRoot(path), v.Len(), l.MaxSliceLen)
+		}
+		it := v.MapRange()
+		for it.Next() {
+			if err := checkValue(it.Value(), joinPath(path, fmt.Sprint(it.Key())), depth+1, l); err != nil {
+				return err
+			}
+		}
+	default:
+		if l.MaxSliceLen > 0 && v.Len() > l.MaxSliceLen {
+			return fmt.Errorf("%w: %s has %d elements, max %d", ErrLimitExceeded, pathOrRoot(path), v.Len(), l.MaxSliceLen)
+		}
+		// byte slices are values, not collections of nested values
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return nil
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := checkValue(v.Index(i), fmt.Sprintf("%s[%d]", pathOrRoot(path), i), depth+1, l); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func joinPath(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+func pathOrRoot(path string) string {
+	if path == "" {
+		return "config"
+	}
+	return path
+}
@@ -0,0 +1,280 @@
+package cog
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	fh "github.com/leonidasdeim/cog/filehandler"
+)
+
+const deprecatedTag = "deprecated"
+
+type LintSeverity string
+
+const (
+	LintError   LintSeverity = "error"
+	LintWarning LintSeverity = "warning"
+	LintInfo    LintSeverity = "info"
+)
+
+// Finding of the lint rule.
+type Finding struct {
+	// Name of the rule, e.g. "secret-value".
+	Rule     string       `json:"rule"`
+	Severity LintSeverity `json:"severity"`
+	// Path of struct field names, e.g. "Server.Port", or key path of the document if config type is not known.
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s: %s (%s)", f.Severity, f.Path, f.Message, f.Rule)
+}
+
+// LintTarget is config document checked by lint rules.
+type LintTarget struct {
+	// Document as decoded by the format.
+	Doc map[string]any
+	// Fields of the config struct ordered as they appear in it, empty if config type is not a struct.
+	Fields []LintField
+	// Keys of the document which do not match any field, sorted.
+	Unknown []string
+}
+
+type LintField struct {
+	// Path of struct field names, e.g. "Server.Port".
+	Path  string
+	Field reflect.StructField
+	// Decoded value of the field.
+	Value any
+	// Field is present in the document.
+	Present bool
+}
+
+// LintRule checks config document and reports findings.
+type LintRule interface {
+	Lint(t LintTarget) []Finding
+}
+
+// LintRuleFunc is an adapter to use function as lint rule.
+type LintRuleFunc func(t LintTarget) []Finding
+
+func (f LintRuleFunc) Lint(t LintTarget) []Finding {
+	return f(t)
+}
+
+// Get builtin rules: secret-value, deprecated-field, redundant-default and unknown-key.
+func DefaultLintRules() []LintRule {
+	return []LintRule{SecretValueRule(), DeprecatedFieldRule(), RedundantDefaultRule(), UnknownKeyRule()}
+}
+
+// Lint config document of the file type, decoded as T. Without rules DefaultLintRules are used.
+// T can be map[string]any to lint document without config type, only document rules apply then.
+// Findings are ordered by rule, then by path.
+func Lint[T any](doc []byte, t fh.FileType, rules ...LintRule) ([]Finding, error) {
+	codec := fh.NewCodec(t)
+	if codec == nil {
+		return nil, fmt.Errorf("unsupported config file type: %s", t)
+	}
+
+	load := func(data any) error {
+		return codec.Unmarshal(doc, data)
+	}
+
+	target := LintTarget{Doc: map[string]any{}}
+	if err := load(&target.Doc); err != nil {
+		return nil, fmt.Errorf("failed at decode config document: %v", err)
+	}
+
+	var config T
+	if err := load(&config); err != nil {
+		return nil, fmt.Errorf("failed at decode config document: %v", err)
+	}
+
+	if v := reflect.ValueOf(&config).Elem(); v.Kind() == reflect.Struct {
+		var present fieldSet
+		present, target.Unknown = loadKeys[T](load)
+		walkFields(v, "", func(path string, sf reflect.StructField, f reflect.Value) {
+			target.Fields = append(target.Fields, LintField{Path: path, Field: sf, Value: f.Interface(), Present: present[path]})
+		})
+	}
+
+	if len(rules) == 0 {
+		rules = DefaultLintRules()
+	}
+
+	findings := []Finding{}
+	for _, r := range rules {
+		f := r.Lint(target)
+		sort.SliceStable(f, func(i, j int) bool {
+			return f[i].Path < f[j].Path
+		})
+		findings = append(findings, f...)
+	}
+
+	return findings, nil
+}
+
+// Lint config file, file type is resolved from the extension: .json, .yaml, .yml or .toml.
+// findings, err := cog.LintFile[ConfigStruct]("app.yaml")
+func LintFile[T any](file string, rules ...LintRule) ([]Finding, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return Lint[T](b, fileTypeOf(file), rules...)
+}
+
+var (
+	secretName     = regexp.MustCompile(`(?i)(passw(or)?d|secret|token|api_?key|private_?key|credential)`)
+	secretPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`AKIA[0-9A-Z]{16}`),                                     // AWS access key
+		regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`),                   // PEM private key
+		regexp.MustCompile(`gh[pousr]_[A-Za-z0-9]{36}`),                            // GitHub token
+		regexp.MustCompile(`xox[abprs]-[A-Za-z0-9-]{10,}`),                         // Slack token
+		regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`), // JWT
+	}
+)
+
+// Report secret-looking values in the fields which are not tagged with `secret:"true"`, so they are not
+// masked, encrypted or excluded from snapshots. Value looks like a secret if it matches a known token format,
+// or if it is a random-looking string in the field named like a secret, e.g. "Password" or "ApiKey".
+// Encrypted values and placeholders are not reported. Without config type every value of the document is checked.
+func SecretValueRule() LintRule {
+	return LintRuleFunc(func(t LintTarget) []Finding {
+		findings := []Finding{}
+		report := func(path, name string, v any) {
+			if s, ok := v.(string); ok && looksSecret(name, s) {
+				findings = append(findings, Finding{Rule: "secret-value", Severity: LintError, Path: path,
+					Message: "value looks like a secret, tag the field with `secret:\"true\"` and keep the value out of the file"})
+			}
+		}
+
+		if len(t.Fields) == 0 {
+			walkDoc(t.Doc, "", func(path, key string, v any) {
+				report(path, key, v)
+			})
+			return findings
+		}
+
+		for _, f := range t.Fields {
+			if f.Present && !isSecret(f.Field) {
+				report(f.Path, f.Field.Name, f.Value)
+			}
+		}
+		return findings
+	})
+}
+
+// Report fields tagged with `deprecated:"reason"` which are present in the document.
+func DeprecatedFieldRule() LintRule {
+	return LintRuleFunc(func(t LintTarget) []Finding {
+		findings := []Finding{}
+		for _, f := range t.Fields {
+			reason, ok := f.Field.Tag.Lookup(deprecatedTag)
+			if !ok || !f.Present {
+				continue
+			}
+			msg := "field is deprecated"
+			if reason != "" {
+				msg += ": " + reason
+			}
+			findings = append(findings, Finding{Rule: "deprecated-field", Severity: LintWarning, Path: f.Path, Message: msg})
+		}
+		return findings
+	})
+}
+
+// Report fields present in the document with the value of their `default:"value"` tag, they can be removed.
+func RedundantDefaultRule() LintRule {
+	return LintRuleFunc(func(t LintTarget) []Finding {
+		findings := []Finding{}
+		for _, f := range t.Fields {
+			tag := defaultValue(f.Field)
+			if !f.Present || tag == "" {
+				continue
+			}
+
+			def := reflect.New(f.Field.Type).Elem()
+			if parseValue(def, tag) != nil || !reflect.DeepEqual(def.Interface(), f.Value) {
+				continue
+			}
+			findings = append(findings, Finding{Rule: "redundant-default", Severity: LintInfo, Path: f.Path,
+				Message: fmt.Sprintf("value equals the default %q and can be removed", tag)})
+		}
+		return findings
+	})
+}
+
+// Report keys of the document which do not match any field, e.g. typos.
+func UnknownKeyRule() LintRule {
+	return LintRuleFunc(func(t LintTarget) []Finding {
+		findings := []Finding{}
+		for _, k := range t.Unknown {
+			findings = append(findings, Finding{Rule: "unknown-key", Severity: LintError, Path: k, Message: "key does not match any field"})
+		}
+		return findings
+	})
+}
+
+func looksSecret(name, s string) bool {
+	if s == "" || strings.HasPrefix(s, encryptedPrefix) || strings.Contains(s, "${") {
+		return false
+	}
+
+	for _, p := range secretPatterns {
+		if p.MatchString(s) {
+			return true
+		}
+	}
+
+	return secretName.MatchString(name) && len(s) >= 8 && entropy(s) >= 3
+}
+
+// Get Shannon entropy of the string in bits per character.
+func entropy(s string) float64 {
+	counts := map[rune]int{}
+	n := 0
+	for _, r := range s {
+		counts[r]++
+		n++
+	}
+
+	e := 0.0
+	for _, c := range counts {
+		p := float64(c) / float64(n)
+		e -= p * math.Log2(p)
+	}
+	return e
+}
+
+// Visit scalar values of the document, lists are visited by index.
+func walkDoc(v any, path string, visit func(path, key string, v any)) {
+	key := path
+	if i := strings.LastIndexAny(path, ".["); i >= 0 {
+		key = path[i+1:]
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+			walkDoc(e, p, visit)
+		}
+	case []any:
+		for i, e := range v {
+			walkDoc(e, fmt.Sprintf("%s[%d]", path, i), visit)
+		}
+	default:
+		visit(path, key, v)
+	}
+}
@@ -0,0 +1,43 @@
+package cog
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Logger receives messages about the instance lifecycle, e.g. *log.Logger from the standard library.
+type Logger interface {
+	Printf(format string, v ...any)
+}
+
+// Log the event. Only paths of the changed fields are logged, values are not.
+func (cog *C[T]) logEvent(e Event) {
+	msg := "cog: " + string(e.Type)
+
+	fields := e.Fields
+	if len(e.Diff) > 0 {
+		fields = e.Diff.Paths()
+	}
+	if len(fields) > 0 {
+		msg += " [" + strings.Join(fields, ", ") + "]"
+	}
+	if e.Err != nil {
+		msg += fmt.Sprintf(": %v", e.Err)
+	}
+
+	cog.opts.Logger.Printf("%s", msg)
+}
+
+// Log outcome of the init.
+func (cog *C[T]) logInit(r InitReport) {
+	for _, w := range r.Warnings {
+		cog.opts.Logger.Printf("cog: %s", w)
+	}
+
+	switch {
+	case r.Err != nil:
+		cog.opts.Logger.Printf("cog: init has failed: %v", r.Err)
+	case r.Location != "":
+		cog.opts.Logger.Printf("cog: config has been loaded from %s", r.Location)
+	}
+}
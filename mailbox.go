@@ -0,0 +1,79 @@
+package cog
+
+import "sync"
+
+// Delivery mode of the config changes to callbacks.
+type Delivery int
+
+const (
+	// Callback receives changes in order, one at a time. Changes received while callback is busy
+	// are superseded by the latest one (default).
+	DeliverLatest Delivery = iota
+	// Callback receives every change in order, one at a time.
+	DeliverAll
+)
+
+type delivery[T any] struct {
+	revision   uint64
+	config     T
+	superseded []uint64
+}
+
+// Mailbox serializes delivery of the changes to a single callback.
+type mailbox[T any] struct {
+	lock    sync.Mutex
+	f       RevisionCallback[T]
+	name    string
+	mode    Delivery
+	done    func(revision uint64)
+	running bool
+	queue   []delivery[T]
+}
+
+func newMailbox[T any](f RevisionCallback[T], name string, mode Delivery, done func(revision uint64)) *mailbox[T] {
+	return &mailbox[T]{f: f, name: name, mode: mode, done: done}
+}
+
+// Post change to the callback. If callback is idle, it is called in a new goroutine.
+func (m *mailbox[T]) post(d delivery[T]) {
+	m.lock.Lock()
+
+	if m.running {
+		if n := len(m.queue); n > 0 && m.mode == DeliverLatest {
+			d.superseded = append(m.queue[n-1].superseded, m.queue[n-1].revision)
+			m.queue[n-1] = d
+		} else {
+			m.queue = append(m.queue, d)
+		}
+		m.lock.Unlock()
+		return
+	}
+
+	m.running = true
+	m.lock.Unlock()
+
+	go m.run(d)
+}
+
+func (m *mailbox[T]) run(d delivery[T]) {
+	for {
+		observe("callback", m.name, d.revision, func() {
+			m.f(d.revision, d.config)
+		})
+
+		// superseded revisions are applied together with the one which replaced them
+		for _, rev := range d.superseded {
+			m.done(rev)
+		}
+		m.done(d.revision)
+
+		m.lock.Lock()
+		if len(m.queue) == 0 {
+			m.running = false
+			m.lock.Unlock()
+			return
+		}
+		d, m.queue = m.queue[0], m.queue[1:]
+		m.lock.Unlock()
+	}
+}
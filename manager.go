@@ -0,0 +1,244 @@
+package cog
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"sync"
+
+	"github.com/leonidasdeim/cog/handlerapi"
+)
+
+// KeyedHandler is a config store which keeps separate config per key, e.g. per tenant.
+type KeyedHandler = handlerapi.KeyedHandler
+
+// KeyLister can be implemented by KeyedHandler to list keys of the stored configs.
+type KeyLister = handlerapi.KeyLister
+
+// KeyedHandlerFunc is an adapter to use function as KeyedHandler.
+// cog.KeyedHandlerFunc(func(key string) (cog.ConfigHandler, error) { return fh.New(fh.WithName(key)) })
+type KeyedHandlerFunc func(key string) (ConfigHandler, error)
+
+func (f KeyedHandlerFunc) Handler(key string) (ConfigHandler, error) {
+	return f(key)
+}
+
+type KeyedCallback[T any] func(key string, config T)
+
+type keyedCallback[T any] struct {
+	pattern string
+	f       KeyedCallback[T]
+	ids     map[string]int
+}
+
+// Manager maintains cog instance per key backed by the same store.
+type Manager[T any] struct {
+	lock      sync.Mutex
+	handler   KeyedHandler
+	opts      []Option
+	instances map[string]*C[T]
+	callbacks map[int]*keyedCallback[T]
+	nextId    int
+}
+
+// Initialize cog instance for every key. Options are applied to every instance, handler option is ignored.
+// m, err := cog.InitMulti[ConfigStruct](h, []string{"tenant-a", "tenant-b"})
+func InitMulti[T any](handler KeyedHandler, keys []string, opts ...Option) (*Manager[T], error) {
+	m := &Manager[T]{
+		handler:   handler,
+		opts:      opts,
+		instances: make(map[string]*C[T]),
+		callbacks: make(map[int]*keyedCallback[T]),
+	}
+
+	for _, key := range keys {
+		if _, err := m.Add(key); err != nil {
+			// instances initialized so far are not returned, so their goroutines are stopped
+			for _, c := range m.instances {
+				c.Close()
+			}
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// Get cog instance of the key.
+func (m *Manager[T]) Get(key string) (*C[T], bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	c, ok := m.instances[key]
+	return c, ok
+}
+
+// Initialize cog instance for the key. If instance already exists, it is returned.
+// Manager is not locked while the instance is initialized, so other keys can be used meanwhile.
+func (m *Manager[T]) Add(key string) (*C[T], error) {
+	if c, ok := m.Get(key); ok {
+		return c, nil
+	}
+
+	h, err := m.handler.Handler(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed at get handler for key %q: %v", key, err)
+	}
+
+	// options are shared by concurrent calls, so they are copied
+	c, err := New[T](append(append([]Option{}, m.opts...), WithHandler(h))...)
+	if err != nil {
+		return nil, fmt.Errorf("failed at init config for key %q: %v", key, err)
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if existing, ok := m.instances[key]; ok {
+		// instance has been added concurrently
+		c.Close()
+		return existing, nil
+	}
+
+	m.instances[key] = c
+
+	for _, cb := range m.callbacks {
+		cb.register(key, c)
+	}
+
+	return c, nil
+}
+
+// Remove cog instance of the key and close it. Stored config is not deleted.
+func (m *Manager[T]) Remove(key string) error {
+	m.lock.Lock()
+
+	c, ok := m.instances[key]
+	if !ok {
+		m.lock.Unlock()
+		return fmt.Errorf("config with key=%s not found", key)
+	}
+
+	delete(m.instances, key)
+
+	for _, cb := range m.callbacks {
+		delete(cb.ids, key)
+	}
+	m.lock.Unlock()
+
+	// callbacks of the instance can use the manager while it is closed
+	return c.Close()
+}
+
+// Get sorted keys of the managed instances.
+func (m *Manager[T]) Keys() []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	keys := make([]string, 0, len(m.instances))
+	for k := range m.instances {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Get sorted keys of the managed instances matching the pattern, see path.Match for pattern syntax.
+func (m *Manager[T]) Match(pattern string) ([]string, error) {
+	keys := []string{}
+
+	for _, k := range m.Keys() {
+		ok, err := path.Match(pattern, k)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			keys = append(keys, k)
+		}
+	}
+
+	return keys, nil
+}
+
+// Register callback for all instances which keys match the pattern, including instances added later.
+// It is called after config update of the instance in non blocking goroutine, see path.Match for pattern syntax.
+// This method returns callback id (int). It can be used to remove callback by calling m.RemoveCallback(id).
+func (m *Manager[T]) AddCallback(pattern string, f KeyedCallback[T]) (int, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return 0, err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.nextId++
+	cb := &keyedCallback[T]{pattern: pattern, f: f, ids: make(map[string]int)}
+	m.callbacks[m.nextId] = cb
+
+	for key, c := range m.instances {
+		cb.register(key, c)
+	}
+
+	return m.nextId, nil
+}
+
+// Remove callback by id.
+func (m *Manager[T]) RemoveCallback(id int) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	cb, ok := m.callbacks[id]
+	if !ok {
+		return fmt.Errorf("callback with id=%d not found", id)
+	}
+
+	for key, cid := range cb.ids {
+		m.instances[key].RemoveCallback(cid)
+	}
+	delete(m.callbacks, id)
+
+	return nil
+}
+
+// Synchronize managed instances with the keys listed by the handler: instances are added for new keys
+// and removed for keys which do not exist anymore. Handler has to implement cog.KeyLister.
+func (m *Manager[T]) Sync(ctx context.Context) error {
+	l, ok := m.handler.(KeyLister)
+	if !ok {
+		return fmt.Errorf("handler does not implement cog.KeyLister")
+	}
+
+	keys, err := l.Keys(ctx)
+	if err != nil {
+		return fmt.Errorf("failed at list keys: %v", err)
+	}
+
+	listed := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		listed[k] = true
+		if _, err := m.Add(k); err != nil {
+			return err
+		}
+	}
+
+	for _, k := range m.Keys() {
+		if !listed[k] {
+			m.Remove(k)
+		}
+	}
+
+	return nil
+}
+
+func (cb *keyedCallback[T]) register(key string, c *C[T]) {
+	if ok, _ := path.Match(cb.pattern, key); !ok {
+		return
+	}
+
+	f := cb.f
+	cb.ids[key] = c.AddCallback(func(config T) {
+		f(key, config)
+	})
+}
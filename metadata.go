@@ -0,0 +1,164 @@
+package cog
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+var placeholder = regexp.MustCompile(`\$\{meta\.([A-Za-z0-9_.-]+)\}`)
+
+// MetadataProvider provides runtime metadata of the instance, e.g. availability zone or instance ID
+// from cloud metadata service, see metadata package.
+type MetadataProvider interface {
+	Metadata(ctx context.Context) (map[string]string, error)
+}
+
+// MetadataFunc is an adapter to use ordinary function as MetadataProvider.
+type MetadataFunc func(ctx context.Context) (map[string]string, error)
+
+func (f MetadataFunc) Metadata(ctx context.Context) (map[string]string, error) {
+	return f(ctx)
+}
+
+// Metadata fetched from the providers. Only successful fetch is cached, failed one is retried next time.
+type metadataCache struct {
+	lock   sync.Mutex
+	values map[string]string
+}
+
+// Resolve ${meta.<key>} placeholders in string fields from the providers, e.g. `node_name: ${meta.hostname}`.
+// Host metadata is always available: hostname, and pod_name, pod_namespace and node_name from Kubernetes downward API
+// variables POD_NAME, POD_NAMESPACE and NODE_NAME. Values of the later providers win. Metadata is fetched once,
+// on the first placeholder, failed fetch is retried when placeholders are resolved next time. Placeholders are kept on save as long as resolved value is not changed.
+func WithMetadata(providers ...MetadataProvider) Option {
+	return func(o *Optional) {
+		o.Metadata = append(o.Metadata, providers...)
+	}
+}
+
+func hostMetadata(_ context.Context) (map[string]string, error) {
+	m := map[string]string{}
+
+	if h, err := os.Hostname(); err == nil {
+		m["hostname"] = h
+	}
+
+	for key, env := range map[string]string{"pod_name": "POD_NAME", "pod_namespace": "POD_NAMESPACE", "node_name": "NODE_NAME"} {
+		if v := os.Getenv(env); v != "" {
+			m[key] = v
+		}
+	}
+
+	return m, nil
+}
+
+func (cog *C[T]) metadata() (map[string]string, error) {
+	c := &cog.meta
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.values != nil {
+		return c.values, nil
+	}
+
+	values := map[string]string{}
+	providers := append([]MetadataProvider{MetadataFunc(hostMetadata)}, cog.opts.Metadata...)
+	for _, p := range providers {
+		m, err := p.Metadata(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("failed at get instance metadata: %v", err)
+		}
+		for k, v := range m {
+			values[k] = v
+		}
+	}
+
+	c.values = values
+	return c.values, nil
+}
+
+// Resolve placeholders in the string.
+func (cog *C[T]) expandString(s string) (string, error) {
+	if !strings.Contains(s, "${meta.") {
+		return s, nil
+	}
+
+	meta, err := cog.metadata()
+	if err != nil {
+		return "", err
+	}
+
+	var missing []string
+	s = placeholder.ReplaceAllStringFunc(s, func(p string) string {
+		key := placeholder.FindStringSubmatch(p)[1]
+		v, ok := meta[key]
+		if !ok {
+			missing = append(missing, key)
+		}
+		return v
+	})
+
+	if len(missing) > 0 {
+		return "", fmt.Errorf("unknown instance metadata: %s", strings.Join(missing, ", "))
+	}
+	return s, nil
+}
+
+// Resolve placeholders in the config. Returns placeholders by field path: new ones found in the config,
+// and previous ones which resolved values are still in the config.
+func (cog *C[T]) expandPlaceholders(config *T, prev map[string]string) (map[string]string, error) {
+	placeholders := map[string]string{}
+
+	v := reflect.ValueOf(config).Elem()
+	if v.Kind() != reflect.Struct {
+		return placeholders, nil
+	}
+
+	var err error
+	walkFields(v, "", func(path string, sf reflect.StructField, f reflect.Value) {
+		if err != nil || f.Kind() != reflect.String || !f.CanSet() {
+			return
+		}
+
+		if s := f.String(); placeholder.MatchString(s) {
+			var resolved string
+			if resolved, err = cog.expandString(s); err != nil {
+				err = fmt.Errorf("failed at resolve field %s: %v", path, err)
+				return
+			}
+			placeholders[path] = s
+			f.SetString(resolved)
+			return
+		}
+
+		if raw, ok := prev[path]; ok {
+			if resolved, rerr := cog.expandString(raw); rerr == nil && resolved == f.String() {
+				placeholders[path] = raw
+			}
+		}
+	})
+
+	return placeholders, err
+}
+
+// Get copy of the config with placeholders put back in place of their unchanged resolved values.
+func (cog *C[T]) restorePlaceholders(config T, placeholders map[string]string) T {
+	if len(placeholders) == 0 {
+		return config
+	}
+
+	v := reflect.ValueOf(&config).Elem()
+	for path, raw := range placeholders {
+		f := fieldByPath(v, path)
+		if resolved, err := cog.expandString(raw); err == nil && f.IsValid() && f.String() == resolved {
+			f.SetString(raw)
+		}
+	}
+
+	return config
+}
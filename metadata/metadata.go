@@ -0,0 +1,225 @@
+// Package metadata provides instance metadata of cloud virtual machines for cog.WithMetadata,
+// read from the metadata services of AWS, GCP and Azure. Providers return the same keys where possible:
+// instance_id, instance_name, instance_type, region, availability_zone and private_ip.
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	awsEndpoint   = "http://169.254.169.254"
+	gcpEndpoint   = "http://metadata.google.internal"
+	azureEndpoint = "http://169.254.169.254"
+)
+
+type Optional struct {
+	Endpoint string
+	Client   *http.Client
+	Timeout  time.Duration
+}
+
+type Option func(o *Optional)
+
+// Use custom metadata service address, e.g. emulator in tests.
+func WithEndpoint(url string) Option {
+	return func(o *Optional) {
+		o.Endpoint = url
+	}
+}
+
+// Use custom HTTP client.
+func WithClient(c *http.Client) Option {
+	return func(o *Optional) {
+		o.Client = c
+	}
+}
+
+// Specify timeout of the metadata requests. Default is 2 seconds.
+func WithTimeout(d time.Duration) Option {
+	return func(o *Optional) {
+		o.Timeout = d
+	}
+}
+
+// Provider reads metadata of the instance from cloud metadata service.
+type Provider struct {
+	endpoint string
+	client   *http.Client
+	read     func(p *Provider, ctx context.Context) (map[string]string, error)
+}
+
+func newProvider(endpoint string, read func(p *Provider, ctx context.Context) (map[string]string, error), opts []Option) *Provider {
+
+	// Set defaults
+	o := &Optional{
+		Endpoint: endpoint,
+		Timeout:  2 * time.Second,
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	client := o.Client
+	if client == nil {
+		client = &http.Client{Timeout: o.Timeout}
+	}
+
+	return &Provider{endpoint: strings.TrimSuffix(o.Endpoint, "/"), client: client, read: read}
+}
+
+// Read metadata of the instance.
+func (p *Provider) Metadata(ctx context.Context) (map[string]string, error) {
+	return p.read(p, ctx)
+}
+
+// Create provider reading EC2 instance metadata service (IMDSv2).
+func AWS(opts ...Option) *Provider {
+	return newProvider(awsEndpoint, readAWS, opts)
+}
+
+// Create provider reading Compute Engine metadata server.
+func GCP(opts ...Option) *Provider {
+	return newProvider(gcpEndpoint, readGCP, opts)
+}
+
+// Create provider reading Azure Instance Metadata Service.
+func Azure(opts ...Option) *Provider {
+	return newProvider(azureEndpoint, readAzure, opts)
+}
+
+func readAWS(p *Provider, ctx context.Context) (map[string]string, error) {
+	token, err := p.get(ctx, http.MethodPut, "/latest/api/token", map[string]string{"X-aws-ec2-metadata-token-ttl-seconds": "60"})
+	if err != nil {
+		return nil, err
+	}
+
+	h := map[string]string{"X-aws-ec2-metadata-token": token}
+	paths := map[string]string{
+		"instance_id":       "instance-id",
+		"instance_type":     "instance-type",
+		"availability_zone": "placement/availability-zone",
+		"region":            "placement/region",
+		"private_ip":        "local-ipv4",
+	}
+
+	m := map[string]string{}
+	for key, path := range paths {
+		if m[key], err = p.get(ctx, http.MethodGet, "/latest/meta-data/"+path, h); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+func readGCP(p *Provider, ctx context.Context) (map[string]string, error) {
+	h := map[string]string{"Metadata-Flavor": "Google"}
+	paths := map[string]string{
+		"instance_id":   "instance/id",
+		"instance_name": "instance/name",
+		"instance_type": "instance/machine-type",
+		"zone":          "instance/zone",
+		"project_id":    "project/project-id",
+		"private_ip":    "instance/network-interfaces/0/ip",
+	}
+
+	m := map[string]string{}
+	for key, path := range paths {
+		v, err := p.get(ctx, http.MethodGet, "/computeMetadata/v1/"+path, h)
+		if err != nil {
+			return nil, err
+		}
+		m[key] = v
+	}
+
+	// zone and machine type are resource names, e.g. projects/123/zones/us-central1-a
+	m["instance_type"] = m["instance_type"][strings.LastIndex(m["instance_type"], "/")+1:]
+	m["availability_zone"] = m["zone"][strings.LastIndex(m["zone"], "/")+1:]
+	if i := strings.LastIndex(m["availability_zone"], "-"); i > 0 {
+		m["region"] = m["availability_zone"][:i]
+	}
+	delete(m, "zone")
+
+	return m, nil
+}
+
+func readAzure(p *Provider, ctx context.Context) (map[string]string, error) {
+	b, err := p.get(ctx, http.MethodGet, "/metadata/instance?api-version=2021-02-01", map[string]string{"Metadata": "true"})
+	if err != nil {
+		return nil, err
+	}
+
+	var doc struct {
+		Compute struct {
+			VMID           string `json:"vmId"`
+			Name           string `json:"name"`
+			VMSize         string `json:"vmSize"`
+			Location       string `json:"location"`
+			Zone           string `json:"zone"`
+			ResourceGroup  string `json:"resourceGroupName"`
+			SubscriptionID string `json:"subscriptionId"`
+		} `json:"compute"`
+		Network struct {
+			Interface []struct {
+				IPv4 struct {
+					IPAddress []struct {
+						PrivateIPAddress string `json:"privateIpAddress"`
+					} `json:"ipAddress"`
+				} `json:"ipv4"`
+			} `json:"interface"`
+		} `json:"network"`
+	}
+	if err := json.Unmarshal([]byte(b), &doc); err != nil {
+		return nil, fmt.Errorf("failed at decode instance metadata: %v", err)
+	}
+
+	c := doc.Compute
+	m := map[string]string{
+		"instance_id":       c.VMID,
+		"instance_name":     c.Name,
+		"instance_type":     c.VMSize,
+		"region":            c.Location,
+		"availability_zone": c.Zone,
+		"resource_group":    c.ResourceGroup,
+		"subscription_id":   c.SubscriptionID,
+	}
+	if n := doc.Network.Interface; len(n) > 0 && len(n[0].IPv4.IPAddress) > 0 {
+		m["private_ip"] = n[0].IPv4.IPAddress[0].PrivateIPAddress
+	}
+
+	return m, nil
+}
+
+func (p *Provider) get(ctx context.Context, method, path string, header map[string]string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, method, p.endpoint+path, nil)
+	if err != nil {
+		return "", err
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed at request instance metadata: %v", err)
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed at read instance metadata: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("instance metadata %s: unexpected status %s", path, resp.Status)
+	}
+
+	return strings.TrimSpace(string(b)), nil
+}
@@ -0,0 +1,172 @@
+package metadata
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAWS(t *testing.T) {
+	var tokens int32
+	values := map[string]string{
+		"/latest/meta-data/instance-id":                 "i-0123456789",
+		"/latest/meta-data/instance-type":               "m5.large",
+		"/latest/meta-data/placement/availability-zone": "eu-west-1a",
+		"/latest/meta-data/placement/region":            "eu-west-1",
+		"/latest/meta-data/local-ipv4":                  "10.0.0.12",
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/latest/api/token" {
+			// IMDSv2 session token is requested with PUT and ttl header
+			if r.Method != http.MethodPut || r.Header.Get("X-aws-ec2-metadata-token-ttl-seconds") != "60" {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			atomic.AddInt32(&tokens, 1)
+			w.Write([]byte("session-token"))
+			return
+		}
+
+		if r.Header.Get("X-aws-ec2-metadata-token") != "session-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		v, ok := values[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(v + "\n"))
+	}))
+	defer srv.Close()
+
+	m, err := AWS(WithEndpoint(srv.URL + "/")).Metadata(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"instance_id":       "i-0123456789",
+		"instance_type":     "m5.large",
+		"availability_zone": "eu-west-1a",
+		"region":            "eu-west-1",
+		"private_ip":        "10.0.0.12",
+	}, m)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&tokens))
+
+	delete(values, "/latest/meta-data/local-ipv4")
+	_, err = AWS(WithEndpoint(srv.URL)).Metadata(context.Background())
+	assert.ErrorContains(t, err, "instance metadata /latest/meta-data/local-ipv4: unexpected status 404 Not Found")
+}
+
+func TestAWSTokenRejected(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	_, err := AWS(WithEndpoint(srv.URL)).Metadata(context.Background())
+	assert.ErrorContains(t, err, "/latest/api/token: unexpected status 403 Forbidden")
+}
+
+func TestGCP(t *testing.T) {
+	values := map[string]string{
+		"instance/id":                      "4520031799277581759",
+		"instance/name":                    "api-1",
+		"instance/machine-type":            "projects/123456/machineTypes/e2-medium",
+		"instance/zone":                    "projects/123456/zones/us-central1-a",
+		"project/project-id":               "my-project",
+		"instance/network-interfaces/0/ip": "10.128.0.2",
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		v, ok := values[strings.TrimPrefix(r.URL.Path, "/computeMetadata/v1/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(v))
+	}))
+	defer srv.Close()
+
+	m, err := GCP(WithEndpoint(srv.URL)).Metadata(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"instance_id":       "4520031799277581759",
+		"instance_name":     "api-1",
+		"instance_type":     "e2-medium",
+		"availability_zone": "us-central1-a",
+		"region":            "us-central1",
+		"project_id":        "my-project",
+		"private_ip":        "10.128.0.2",
+	}, m)
+}
+
+func TestAzure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata") != "true" || r.URL.Path != "/metadata/instance" || r.URL.Query().Get("api-version") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{
+			"compute": {
+				"vmId": "02aab8a4-74ef-476e-8182-f6d2ba4166a6",
+				"name": "api-1",
+				"vmSize": "Standard_D2s_v3",
+				"location": "westeurope",
+				"zone": "2",
+				"resourceGroupName": "app-rg",
+				"subscriptionId": "8d10da13-8125-4ba9-a717-bf7490507b3d"
+			},
+			"network": {"interface": [{"ipv4": {"ipAddress": [{"privateIpAddress": "10.1.0.4"}]}}]}
+		}`))
+	}))
+	defer srv.Close()
+
+	m, err := Azure(WithEndpoint(srv.URL)).Metadata(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"instance_id":       "02aab8a4-74ef-476e-8182-f6d2ba4166a6",
+		"instance_name":     "api-1",
+		"instance_type":     "Standard_D2s_v3",
+		"region":            "westeurope",
+		"availability_zone": "2",
+		"resource_group":    "app-rg",
+		"subscription_id":   "8d10da13-8125-4ba9-a717-bf7490507b3d",
+		"private_ip":        "10.1.0.4",
+	}, m)
+}
+
+func TestAzureBadResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("not json"))
+	}))
+	defer srv.Close()
+
+	_, err := Azure(WithEndpoint(srv.URL)).Metadata(context.Background())
+	assert.ErrorContains(t, err, "failed at decode instance metadata")
+}
+
+func TestTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	_, err := GCP(WithEndpoint(srv.URL), WithTimeout(10*time.Millisecond)).Metadata(context.Background())
+	assert.ErrorContains(t, err, "failed at request instance metadata")
+
+	_, err = GCP(WithEndpoint(srv.URL), WithClient(&http.Client{Timeout: 10 * time.Millisecond})).Metadata(context.Background())
+	assert.ErrorContains(t, err, "failed at request instance metadata")
+}
@@ -0,0 +1,253 @@
+package natshandler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sync"
+
+	fh "github.com/leonidasdeim/cog/filehandler"
+)
+
+var (
+	// Wraps fs.ErrNotExist, so cog saves defaults on init when the key does not exist.
+	ErrNotFound      = fmt.Errorf("key not found: %w", fs.ErrNotExist)
+	ErrWrongRevision = errors.New("key has been modified by another writer")
+)
+
+type Entry struct {
+	Value    []byte
+	Revision uint64
+}
+
+// KeyValue is a subset of NATS JetStream key-value bucket API used by the handler.
+// It is satisfied by a thin adapter around jetstream.KeyValue.
+type KeyValue interface {
+	// Get latest entry of the key. Returns ErrNotFound if key does not exist.
+	Get(ctx context.Context, key string) (Entry, error)
+	// Create key, fails if it already exists.
+	Create(ctx context.Context, key string, value []byte) (uint64, error)
+	// Update key only if its latest revision matches last. Returns ErrWrongRevision otherwise.
+	Update(ctx context.Context, key string, value []byte, last uint64) (uint64, error)
+	// Watch key for updates, channel is closed when context is cancelled.
+	Watch(ctx context.Context, key string) (<-chan Entry, error)
+}
+
+// NatsHandler keeps marshaled config as a value of the key in NATS KV bucket.
+// Save is conditional on the revision seen by last Load or Save,
+// Watch fans out bucket updates made by other writers.
+type NatsHandler struct {
+	m        sync.Mutex
+	kv       KeyValue
+	key      string
+	codec    fh.Codec
+	chunk    int
+	revision uint64
+}
+
+type Optional struct {
+	Key         string
+	Type        fh.FileType
+	Compression fh.Compressor
+	ChunkSize   int
+}
+
+type Option func(o *Optional)
+
+// Add custom key. By default it is set to "app".
+func WithKey(k string) Option {
+	return func(o *Optional) {
+		o.Key = k
+	}
+}
+
+// Specify value format.
+// - filehandler.JSON (default)
+// - filehandler.YAML
+// - filehandler.TOML
+func WithType(t fh.FileType) Option {
+	return func(o *Optional) {
+		o.Type = t
+	}
+}
+
+// Compress stored value, e.g. to fit value size limit of the bucket. Plain values are still read,
+// so compression can be enabled for existing keys.
+func WithCompression(c fh.Compressor) Option {
+	return func(o *Optional) {
+		o.Compression = c
+	}
+}
+
+// Split values larger than size bytes to chunks stored under "<key>.chunk.<n>" keys, e.g. to fit
+// max value size of the bucket. Value of the key is replaced by the manifest, which is written last,
+// so watchers are notified once all chunks are written. Disabled by default.
+func WithChunking(size int) Option {
+	return func(o *Optional) {
+		o.ChunkSize = size
+	}
+}
+
+func New(kv KeyValue, opts ...Option) (*NatsHandler, error) {
+
+	// Set defaults
+	o := &Optional{
+		Key:  "app",
+		Type: fh.JSON,
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	codec := fh.NewCodec(o.Type)
+	if codec == nil {
+		return nil, fmt.Errorf("bad value type: %s", string(o.Type))
+	}
+	if o.Compression != nil {
+		codec = fh.Compressed(codec, o.Compression)
+	}
+
+	return &NatsHandler{
+		kv:    kv,
+		key:   o.Key,
+		codec: codec,
+		chunk: o.ChunkSize,
+	}, nil
+}
+
+func (h *NatsHandler) Load(data any) error {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	e, err := h.kv.Get(context.Background(), h.key)
+	if err != nil {
+		return fmt.Errorf("failed at get key %q: %w", h.key, err)
+	}
+
+	b, err := h.readChunks(e.Value)
+	if err != nil {
+		return err
+	}
+
+	if err := h.codec.Unmarshal(b, data); err != nil {
+		return fmt.Errorf("failed at unmarshal key %q: %v", h.key, err)
+	}
+
+	h.revision = e.Revision
+	return nil
+}
+
+func (h *NatsHandler) Save(data any) error {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	b, err := h.codec.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	if b, err = h.writeChunks(b); err != nil {
+		return err
+	}
+
+	var revision uint64
+	if h.revision == 0 {
+		revision, err = h.kv.Create(context.Background(), h.key, b)
+	} else {
+		revision, err = h.kv.Update(context.Background(), h.key, b, h.revision)
+	}
+	if err != nil {
+		return fmt.Errorf("failed at put key %q: %w", h.key, err)
+	}
+
+	h.revision = revision
+	return nil
+}
+
+// Read chunks if the value is a manifest.
+func (h *NatsHandler) readChunks(b []byte) ([]byte, error) {
+	m, ok := fh.ParseManifest(b)
+	if !ok {
+		return b, nil
+	}
+
+	chunks := make([][]byte, 0, m.Chunks)
+	for i := 0; i < m.Chunks; i++ {
+		key := fh.ChunkName(h.key, i)
+		e, err := h.kv.Get(context.Background(), key)
+		if err != nil {
+			return nil, fmt.Errorf("failed at get key %q: %w", key, err)
+		}
+		chunks = append(chunks, e.Value)
+	}
+
+	b, err := fh.JoinChunks(m, chunks)
+	if err != nil {
+		return nil, fmt.Errorf("failed at read chunks of key %q: %v", h.key, err)
+	}
+
+	return b, nil
+}
+
+// Write chunks if the value exceeds chunk size, returns manifest to store as the value.
+func (h *NatsHandler) writeChunks(b []byte) ([]byte, error) {
+	if h.chunk <= 0 || len(b) <= h.chunk {
+		return b, nil
+	}
+
+	manifest, chunks := fh.SplitChunks(b, h.chunk)
+	for i, c := range chunks {
+		key := fh.ChunkName(h.key, i)
+
+		e, err := h.kv.Get(context.Background(), key)
+		switch {
+		case errors.Is(err, ErrNotFound):
+			_, err = h.kv.Create(context.Background(), key, c)
+		case err == nil:
+			_, err = h.kv.Update(context.Background(), key, c, e.Revision)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed at put key %q: %w", key, err)
+		}
+	}
+
+	return manifest, nil
+}
+
+// Get revision of the key seen by last Load or Save.
+func (h *NatsHandler) Revision() uint64 {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	return h.revision
+}
+
+// Watch key and send notification to the returned channel when it is updated by another writer.
+// Channel is closed when context is cancelled.
+func (h *NatsHandler) Watch(ctx context.Context) (<-chan struct{}, error) {
+	updates, err := h.kv.Watch(ctx, h.key)
+	if err != nil {
+		return nil, fmt.Errorf("failed at watch key %q: %v", h.key, err)
+	}
+
+	ch := make(chan struct{}, 1)
+
+	go func() {
+		defer close(ch)
+
+		for e := range updates {
+			if e.Revision == h.Revision() {
+				continue
+			}
+
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	return ch, nil
+}
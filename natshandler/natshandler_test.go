@@ -0,0 +1,199 @@
+package natshandler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	fh "github.com/leonidasdeim/cog/filehandler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testConfig struct {
+	Name string `json:"name"`
+	Port int    `json:"port"`
+}
+
+// In-memory bucket, updates of the keys are sent to watchers.
+type memoryKV struct {
+	m        sync.Mutex
+	entries  map[string]Entry
+	watchers map[string][]chan Entry
+	maxValue int
+}
+
+func newMemoryKV() *memoryKV {
+	return &memoryKV{entries: map[string]Entry{}, watchers: map[string][]chan Entry{}}
+}
+
+func (kv *memoryKV) Get(_ context.Context, key string) (Entry, error) {
+	kv.m.Lock()
+	defer kv.m.Unlock()
+
+	e, ok := kv.entries[key]
+	if !ok {
+		return Entry{}, ErrNotFound
+	}
+	return e, nil
+}
+
+func (kv *memoryKV) Create(ctx context.Context, key string, value []byte) (uint64, error) {
+	return kv.Update(ctx, key, value, 0)
+}
+
+func (kv *memoryKV) Update(_ context.Context, key string, value []byte, last uint64) (uint64, error) {
+	kv.m.Lock()
+	defer kv.m.Unlock()
+
+	if kv.entries[key].Revision != last {
+		return 0, ErrWrongRevision
+	}
+	if kv.maxValue > 0 && len(value) > kv.maxValue {
+		return 0, errors.New("value is too large")
+	}
+
+	e := Entry{Value: value, Revision: last + 1}
+	kv.entries[key] = e
+	for _, w := range kv.watchers[key] {
+		w <- e
+	}
+	return e.Revision, nil
+}
+
+func (kv *memoryKV) Watch(ctx context.Context, key string) (<-chan Entry, error) {
+	kv.m.Lock()
+	defer kv.m.Unlock()
+
+	ch := make(chan Entry, 16)
+	kv.watchers[key] = append(kv.watchers[key], ch)
+
+	go func() {
+		<-ctx.Done()
+
+		kv.m.Lock()
+		defer kv.m.Unlock()
+
+		w := kv.watchers[key]
+		for i := range w {
+			if w[i] == ch {
+				kv.watchers[key] = append(w[:i], w[i+1:]...)
+				break
+			}
+		}
+		close(ch)
+	}()
+
+	return ch, nil
+}
+
+func TestLoadSave(t *testing.T) {
+	kv := newMemoryKV()
+	h, err := New(kv, WithKey("svc"))
+	require.NoError(t, err)
+
+	var c testConfig
+	assert.ErrorIs(t, h.Load(&c), ErrNotFound)
+
+	require.NoError(t, h.Save(testConfig{Name: "app", Port: 8080}))
+	assert.Equal(t, uint64(1), h.Revision())
+
+	require.NoError(t, h.Save(testConfig{Name: "app", Port: 8081}))
+	assert.Equal(t, uint64(2), h.Revision())
+
+	other, err := New(kv, WithKey("svc"))
+	require.NoError(t, err)
+	require.NoError(t, other.Load(&c))
+	assert.Equal(t, testConfig{Name: "app", Port: 8081}, c)
+	assert.Equal(t, uint64(2), other.Revision())
+}
+
+func TestSaveConflict(t *testing.T) {
+	kv := newMemoryKV()
+	h, err := New(kv)
+	require.NoError(t, err)
+	other, err := New(kv)
+	require.NoError(t, err)
+
+	var c testConfig
+	require.NoError(t, h.Save(testConfig{Name: "app"}))
+	require.NoError(t, other.Load(&c))
+	require.NoError(t, other.Save(testConfig{Name: "other"}))
+
+	assert.ErrorIs(t, h.Save(testConfig{Name: "app", Port: 1}), ErrWrongRevision)
+	assert.Equal(t, uint64(1), h.Revision())
+
+	// new handler does not know the revision and must not overwrite existing key
+	fresh, err := New(kv)
+	require.NoError(t, err)
+	assert.Error(t, fresh.Save(testConfig{Name: "fresh"}))
+}
+
+func TestCompressionAndChunking(t *testing.T) {
+	kv := newMemoryKV()
+	kv.maxValue = 128
+
+	h, err := New(kv, WithCompression(fh.Gzip), WithChunking(64))
+	require.NoError(t, err)
+
+	var name strings.Builder
+	for i := 0; i < 100; i++ {
+		name.WriteString(strconv.Itoa(i * i * 7919))
+	}
+	data := testConfig{Name: name.String(), Port: 8080}
+	require.NoError(t, h.Save(data))
+
+	_, ok := fh.ParseManifest(kv.entries["app"].Value)
+	assert.True(t, ok)
+	assert.True(t, bytes.HasPrefix(kv.entries[fh.ChunkName("app", 0)].Value, fh.Gzip.Magic()))
+
+	var c testConfig
+	require.NoError(t, h.Load(&c))
+	assert.Equal(t, data, c)
+
+	// chunks are overwritten on the next save
+	data.Port = 8081
+	require.NoError(t, h.Save(data))
+	require.NoError(t, h.Load(&c))
+	assert.Equal(t, data, c)
+
+	delete(kv.entries, fh.ChunkName("app", 0))
+	assert.ErrorIs(t, h.Load(&c), ErrNotFound)
+}
+
+func TestWatch(t *testing.T) {
+	kv := newMemoryKV()
+	h, err := New(kv)
+	require.NoError(t, err)
+	require.NoError(t, h.Save(testConfig{Name: "app"}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := h.Watch(ctx)
+	require.NoError(t, err)
+
+	// own save is not reported
+	require.NoError(t, h.Save(testConfig{Name: "own"}))
+	select {
+	case <-ch:
+		t.Fatal("unexpected notification about own save")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	_, err = kv.Update(ctx, "app", []byte(`{"name":"other"}`), h.Revision())
+	require.NoError(t, err)
+
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		t.Fatal("expected notification about update by another writer")
+	}
+
+	cancel()
+	for range ch {
+	}
+}
@@ -0,0 +1,124 @@
+package cog
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	fh "github.com/leonidasdeim/cog/filehandler"
+)
+
+const (
+	normalizeTag = "normalize"
+	pathTag      = "path"
+
+	pathRelativeToConfig = "relative-to-config"
+)
+
+type normalizer func(string) string
+
+// Handlers which know location of the configuration can implement this interface,
+// it is used to resolve relative paths. Work directory is used otherwise.
+type DirProvider interface {
+	Dir() string
+}
+
+func normalizers(dir string) map[string]normalizer {
+	return map[string]normalizer{
+		"trim":  strings.TrimSpace,
+		"lower": strings.ToLower,
+		"upper": strings.ToUpper,
+		"path": func(p string) string {
+			if p == "" || filepath.IsAbs(p) {
+				return p
+			}
+			return filepath.Join(dir, p)
+		},
+	}
+}
+
+func configDir(handler ConfigHandler) string {
+	if p, ok := handler.(DirProvider); ok {
+		return p.Dir()
+	}
+	return fh.Utils.GetWorkDir()
+}
+
+// Normalize tagged fields and compute derived ones.
+func normalize[T any](data *T, dir string) error {
+	if err := normalizeNested(reflect.ValueOf(data).Elem(), normalizers(dir)); err != nil {
+		return err
+	}
+
+	derive(data)
+	return nil
+}
+
+func normalizeNested(v reflect.Value, fns map[string]normalizer) error {
+	t := v.Type()
+
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		sf := t.Field(i)
+
+		if f.Kind() == reflect.Struct {
+			if err := normalizeNested(f, fns); err != nil {
+				return err
+			}
+			continue
+		}
+
+		names, err := fieldNormalizers(sf)
+		if err != nil {
+			return err
+		}
+		if len(names) == 0 || !f.CanSet() {
+			continue
+		}
+
+		for _, name := range names {
+			fn, ok := fns[strings.TrimSpace(name)]
+			if !ok {
+				return fmt.Errorf("unknown normalizer %q on field %s", name, sf.Name)
+			}
+			if err := normalizeField(f, fn); err != nil {
+				return fmt.Errorf("failed at normalize field %s: %v", sf.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func fieldNormalizers(sf reflect.StructField) ([]string, error) {
+	names := []string{}
+
+	if tag := sf.Tag.Get(normalizeTag); tag != "" {
+		names = append(names, strings.Split(tag, ",")...)
+	}
+
+	switch tag := sf.Tag.Get(pathTag); tag {
+	case "":
+	case pathRelativeToConfig:
+		names = append(names, "path")
+	default:
+		return nil, fmt.Errorf("unknown path mode %q on field %s", tag, sf.Name)
+	}
+
+	return names, nil
+}
+
+func normalizeField(f reflect.Value, fn normalizer) error {
+	switch {
+	case f.Kind() == reflect.String:
+		f.SetString(fn(f.String()))
+	case f.Kind() == reflect.Slice && f.Type().Elem().Kind() == reflect.String:
+		for i := 0; i < f.Len(); i++ {
+			f.Index(i).SetString(fn(f.Index(i).String()))
+		}
+	default:
+		return fmt.Errorf("unsupported type %s", f.Type())
+	}
+	return nil
+}
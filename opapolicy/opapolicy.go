@@ -0,0 +1,120 @@
+package opapolicy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/leonidasdeim/cog"
+)
+
+// Policy evaluates OPA decision through the Data API of OPA server or sidecar:
+// POST <url>/v1/data/<path> with policy input as "input".
+// Decision has to be boolean or object with "allow" and optional "reason", e.g.:
+//
+//	package cog.admission
+//	default decision := {"allow": true}
+//	decision := {"allow": false, "reason": "replicas may not decrease by more than 50%"} {
+//	    input.new.Replicas < input.old.Replicas / 2
+//	}
+type Policy struct {
+	url    string
+	client *http.Client
+}
+
+type Optional struct {
+	Client  *http.Client
+	Timeout time.Duration
+}
+
+type Option func(o *Optional)
+
+// Use custom HTTP client, e.g. with TLS configuration.
+func WithClient(c *http.Client) Option {
+	return func(o *Optional) {
+		o.Client = c
+	}
+}
+
+// Specify timeout of the single evaluation. Default is 5 seconds.
+func WithTimeout(d time.Duration) Option {
+	return func(o *Optional) {
+		o.Timeout = d
+	}
+}
+
+// Create policy evaluated by OPA server at the address, e.g. http://localhost:8181,
+// path of the decision is slash separated, e.g. "cog/admission/decision".
+func New(address string, path string, opts ...Option) *Policy {
+
+	// Set defaults
+	o := &Optional{
+		Timeout: 5 * time.Second,
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	client := o.Client
+	if client == nil {
+		client = &http.Client{Timeout: o.Timeout}
+	}
+
+	return &Policy{
+		url:    strings.TrimSuffix(address, "/") + "/v1/data/" + strings.Trim(path, "/"),
+		client: client,
+	}
+}
+
+// Evaluate decision for the update.
+func (p *Policy) Evaluate(ctx context.Context, input cog.PolicyInput) (cog.Decision, error) {
+	body, err := json.Marshal(map[string]any{"input": input})
+	if err != nil {
+		return cog.Decision{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return cog.Decision{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return cog.Decision{}, fmt.Errorf("failed at query opa: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return cog.Decision{}, fmt.Errorf("failed at query opa: %s", resp.Status)
+	}
+
+	var res struct {
+		Result *json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return cog.Decision{}, fmt.Errorf("failed at decode opa response: %v", err)
+	}
+
+	// undefined decision, e.g. policy is not loaded
+	if res.Result == nil {
+		return cog.Decision{}, fmt.Errorf("decision %q is undefined", p.url)
+	}
+
+	var allow bool
+	if err := json.Unmarshal(*res.Result, &allow); err == nil {
+		return cog.Decision{Allow: allow}, nil
+	}
+
+	var d cog.Decision
+	if err := json.Unmarshal(*res.Result, &d); err != nil {
+		return cog.Decision{}, fmt.Errorf("failed at decode opa decision: %v", err)
+	}
+
+	return d, nil
+}
@@ -0,0 +1,153 @@
+package opapolicy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/leonidasdeim/cog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testInput = cog.PolicyInput{
+	Actor: "alice",
+	Old:   map[string]any{"Replicas": float64(10)},
+	New:   map[string]any{"Replicas": float64(2)},
+}
+
+// Start OPA Data API stub which responds to the decision path with the given status and body.
+func opaServer(t *testing.T, status int, body string) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/v1/data/cog/admission/decision", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		var req struct {
+			Input cog.PolicyInput `json:"input"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, testInput, req.Input)
+
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := map[string]struct {
+		body string
+		want cog.Decision
+	}{
+		"allow bool":   {`{"result":true}`, cog.Decision{Allow: true}},
+		"deny bool":    {`{"result":false}`, cog.Decision{}},
+		"allow object": {`{"result":{"allow":true}}`, cog.Decision{Allow: true}},
+		"deny object": {
+			`{"result":{"allow":false,"reason":"replicas may not decrease by more than 50%"}}`,
+			cog.Decision{Reason: "replicas may not decrease by more than 50%"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := opaServer(t, http.StatusOK, tt.body)
+
+			d, err := New(srv.URL+"/", "/cog/admission/decision/").Evaluate(context.Background(), testInput)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, d)
+		})
+	}
+}
+
+func TestEvaluateErrors(t *testing.T) {
+	tests := map[string]struct {
+		status int
+		body   string
+		err    string
+	}{
+		"server error": {http.StatusInternalServerError, `{"code":"internal_error"}`, "failed at query opa: 500 Internal Server Error"},
+		"bad response": {http.StatusOK, `not json`, "failed at decode opa response"},
+		"undefined":    {http.StatusOK, `{}`, "is undefined"},
+		"bad decision": {http.StatusOK, `{"result":"yes"}`, "failed at decode opa decision"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := opaServer(t, tt.status, tt.body)
+
+			_, err := New(srv.URL, "cog/admission/decision").Evaluate(context.Background(), testInput)
+			assert.ErrorContains(t, err, tt.err)
+		})
+	}
+}
+
+func TestEvaluateTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	_, err := New(srv.URL, "cog/admission/decision", WithTimeout(10*time.Millisecond)).Evaluate(context.Background(), testInput)
+	assert.ErrorContains(t, err, "failed at query opa")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = New(srv.URL, "cog/admission/decision", WithClient(srv.Client())).Evaluate(ctx, testInput)
+	assert.ErrorContains(t, err, context.Canceled.Error())
+}
+
+type replicasConfig struct {
+	Replicas int
+}
+
+func TestUpdatePolicy(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Input cog.PolicyInput `json:"input"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		if req.Input.New["Replicas"].(float64) < req.Input.Old["Replicas"].(float64)/2 {
+			w.Write([]byte(`{"result":{"allow":false,"reason":"replicas may not decrease by more than 50%"}}`))
+			return
+		}
+		w.Write([]byte(`{"result":{"allow":true}}`))
+	}))
+	defer srv.Close()
+
+	c, err := cog.New[replicasConfig](cog.WithHandler(&memoryHandler{}), cog.WithUpdatePolicy(New(srv.URL, "cog/admission/decision")))
+	require.NoError(t, err)
+	defer c.Close()
+
+	require.NoError(t, c.Update(replicasConfig{Replicas: 10}))
+	require.NoError(t, c.Update(replicasConfig{Replicas: 6}))
+
+	err = c.Update(replicasConfig{Replicas: 2})
+	assert.ErrorIs(t, err, cog.ErrPolicyDenied)
+	assert.ErrorContains(t, err, "replicas may not decrease by more than 50%")
+	assert.Equal(t, 6, c.Config().Replicas)
+}
+
+type memoryHandler struct {
+	data []byte
+}
+
+func (h *memoryHandler) Load(data any) error {
+	if h.data == nil {
+		return nil
+	}
+	return json.Unmarshal(h.data, data)
+}
+
+func (h *memoryHandler) Save(data any) error {
+	var err error
+	h.data, err = json.Marshal(data)
+	return err
+}
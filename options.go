@@ -0,0 +1,376 @@
+package cog
+
+import (
+	"flag"
+	"time"
+)
+
+type EnvPrecedence int
+
+const (
+	// Environment variables are used only for fields which are not provided by the config file (default).
+	FileOverridesEnv EnvPrecedence = iota
+	// Environment variables replace values loaded from the config file.
+	EnvOverridesFile
+)
+
+// Authorizer decides if actor is allowed to apply the changes. Returned error rejects the update.
+type Authorizer func(actor string, diff Diff) error
+
+type Optional struct {
+	Handler             ConfigHandler
+	EnvPrecedence       EnvPrecedence
+	LenientEnv          bool
+	EnvPrefix           string
+	EnvFiles            []string
+	Credentials         bool
+	CredentialsDir      string
+	Registry            string
+	Metadata            []MetadataProvider
+	Precedence          []Source
+	Flags               *flag.FlagSet
+	HealthCheckInterval time.Duration
+	DisableWatch        bool
+	DisableInitSave     bool
+	Watcher             bool
+	ConflictPolicy      ConflictPolicy
+	ConflictWindow      time.Duration
+	Debounce            time.Duration
+	Jitter              time.Duration
+	ReloadRetry         time.Duration
+	InitTimeout         time.Duration
+	InitRetries         *RetryPolicy
+	Snapshot            string
+	SnapshotNoSecrets   bool
+	Authorizer          Authorizer
+	Policy              Policy
+	KeyProvider         KeyProvider
+	SecretAges          string
+	SecretMaxAge        time.Duration
+	SecretCheckInterval time.Duration
+	Fleet               *Fleet
+	Lease               Lease
+	LeaseRenew          time.Duration
+	ReadOnly            bool
+	MemoryUpdates       bool
+	Shadow              bool
+	FreezePolicy        FreezePolicy
+	InitReport          *InitReport
+	RoundTripCheck      bool
+	Telemetry           TelemetrySink
+	Clock               Clock
+	Delivery            Delivery
+	RampInterval        time.Duration
+	UpdateReports       int
+	Limits              Limits
+	Validator           func(config any) error
+	Logger              Logger
+	ControlSocket       string
+	ControlAuthorizer   ControlAuthorizer
+}
+
+type Option func(o *Optional)
+
+// Specify config handler. By default dynamic file handler is used.
+func WithHandler(h ConfigHandler) Option {
+	return func(o *Optional) {
+		o.Handler = h
+	}
+}
+
+// Specify whether environment variables or config file values take precedence.
+// It is a shortcut for the most common precedence change, see cog.WithPrecedence for the full control.
+// - cog.FileOverridesEnv (default)
+// - cog.EnvOverridesFile
+func WithEnvPrecedence(p EnvPrecedence) Option {
+	return func(o *Optional) {
+		o.EnvPrecedence = p
+	}
+}
+
+// Read fields without `env` tag from environment variables named by the prefix and field path,
+// e.g. "APP_SERVER_MAX_CONNS" for Server.MaxConns with prefix "APP". Use cog.WriteEnvDocs to list them.
+func WithEnvPrefix(prefix string) Option {
+	return func(o *Optional) {
+		o.EnvPrefix = prefix
+	}
+}
+
+// Ignore environment variables which values can not be parsed to the field type.
+// By default initialization fails with an error naming the variable and expected type.
+func WithLenientEnv() Option {
+	return func(o *Optional) {
+		o.LenientEnv = true
+	}
+}
+
+// Specify order in which sources are consulted for every field, from the highest precedence to the lowest.
+// Sources which are not listed are not used at all. By default cog.DefaultPrecedence() is used.
+func WithPrecedence(sources ...Source) Option {
+	return func(o *Optional) {
+		o.Precedence = sources
+	}
+}
+
+// Use parsed command line flags as a source. Field is bound to the flag with `flag:"name"` tag,
+// only flags which were explicitly set are used.
+func WithFlags(fs *flag.FlagSet) Option {
+	return func(o *Optional) {
+		o.Flags = fs
+	}
+}
+
+// Periodically ping config source if handler implements cog.Pinger.
+// Result is reflected in cog.Status() and source health events.
+func WithHealthCheck(interval time.Duration) Option {
+	return func(o *Optional) {
+		o.HealthCheckInterval = interval
+	}
+}
+
+// Do not reload configuration automatically when handler implements cog.Watchable.
+// Configuration can still be reloaded manually with c.Reload().
+func WithoutWatch() Option {
+	return func(o *Optional) {
+		o.DisableWatch = true
+	}
+}
+
+// Specify what happens when watcher detects external change while local changes exist.
+// - cog.ExternalWins (default)
+// - cog.LocalWins
+// - cog.ReportConflict
+// - cog.MergeChanges
+func WithConflictPolicy(p ConflictPolicy) Option {
+	return func(o *Optional) {
+		o.ConflictPolicy = p
+	}
+}
+
+// Treat external change as conflicting if local Update has been made within the window,
+// even if it has been saved. By default only unsaved local changes conflict.
+func WithConflictWindow(d time.Duration) Option {
+	return func(o *Optional) {
+		o.ConflictWindow = d
+	}
+}
+
+// Wait for the quiet period after change notification before reloading. Notifications received
+// in the meantime restart the period, so editors and tools writing files in several operations
+// cause a single reload of the final state.
+func WithDebounce(d time.Duration) Option {
+	return func(o *Optional) {
+		o.Debounce = d
+	}
+}
+
+// Delay reload after change notification by random duration within the window, after debounce period.
+// It spreads reloads of the fleet instances watching the same source, so they do not reconnect
+// to dependencies all at once when the change is picked up. Disabled by default.
+func WithReloadJitter(window time.Duration) Option {
+	return func(o *Optional) {
+		o.Jitter = window
+	}
+}
+
+// Specify how often failed automatic reload is retried. Last good config is kept in the meantime.
+// By default it is 5 seconds, zero disables retries.
+func WithReloadRetry(d time.Duration) Option {
+	return func(o *Optional) {
+		o.ReloadRetry = d
+	}
+}
+
+// Validate config with custom validator in addition to validation tags, e.g. protovalidate for protobuf-generated
+// config. Validator receives pointer to the config. Config implementing Validate() error is validated without it.
+func WithValidator(f func(config any) error) Option {
+	return func(o *Optional) {
+		o.Validator = f
+	}
+}
+
+// Limit config size and complexity. Limits are checked on load and update, exceeding config is rejected
+// with cog.ErrLimitExceeded. Init fails instead of falling back to defaults, so oversized source is not overwritten.
+func WithLimits(l Limits) Option {
+	return func(o *Optional) {
+		o.Limits = l
+	}
+}
+
+// Specify how many latency breakdowns of the last changes are kept, see c.UpdateReports.
+// By default 10 reports are kept, zero disables keeping them.
+func WithUpdateReports(n int) Option {
+	return func(o *Optional) {
+		o.UpdateReports = n
+	}
+}
+
+// Specify how often intermediate values of the fields tagged with `ramp:"5m"` are delivered to subscribers.
+// By default it is 1 second.
+func WithRampInterval(d time.Duration) Option {
+	return func(o *Optional) {
+		if d > 0 {
+			o.RampInterval = d
+		}
+	}
+}
+
+// Limit time spent loading config on init, including retries.
+func WithInitTimeout(d time.Duration) Option {
+	return func(o *Optional) {
+		o.InitTimeout = d
+	}
+}
+
+// Retry loading config on init with backoff, e.g. when remote store is momentarily unavailable.
+// Without retry policy config is loaded once and defaults are used if it fails.
+func WithInitRetries(p RetryPolicy) Option {
+	return func(o *Optional) {
+		if p.Delay <= 0 {
+			p.Delay = 100 * time.Millisecond
+		}
+		if p.MaxDelay <= 0 {
+			p.MaxDelay = 10 * time.Second
+		}
+		o.InitRetries = &p
+	}
+}
+
+// Keep local snapshot of the config at the path. Snapshot is written atomically after every load or save
+// and used on init if config can not be loaded from the source, e.g. when remote store is unavailable.
+// Fields tagged with `secret:"true"` are written to the snapshot, unless cog.WithoutSnapshotSecrets is used.
+func WithSnapshot(path string) Option {
+	return func(o *Optional) {
+		o.Snapshot = path
+	}
+}
+
+// Exclude fields tagged with `secret:"true"` from the snapshot. They have to be provided by other sources,
+// e.g. environment variables, when config is loaded from the snapshot.
+func WithoutSnapshotSecrets() Option {
+	return func(o *Optional) {
+		o.SnapshotNoSecrets = true
+	}
+}
+
+// Consult authorizer before applying Update. It receives actor passed to UpdateAs (empty for Update)
+// and changed fields with their owners from `owner:"team"` tags.
+func WithUpdateAuthorizer(a Authorizer) Option {
+	return func(o *Optional) {
+		o.Authorizer = a
+	}
+}
+
+// Evaluate policy before applying Update, e.g. CEL expression or OPA bundle (see opapolicy package).
+// It receives actor passed to UpdateAs, old and new config. Denied update fails with cog.ErrPolicyDenied.
+func WithUpdatePolicy(p Policy) Option {
+	return func(o *Optional) {
+		o.Policy = p
+	}
+}
+
+// Store string fields tagged with `secret:"true"` encrypted (AES-GCM) and decrypt them on load,
+// so most of the config stays human-readable while credentials are protected.
+func WithFieldEncryption(kp KeyProvider) Option {
+	return func(o *Optional) {
+		o.KeyProvider = kp
+	}
+}
+
+// Track when fields tagged with `secret:"true"` have been changed. Change times are kept in the metadata file
+// at the path together with salted fingerprints of the values, so changes are detected across restarts.
+// Use c.StaleSecrets(maxAge) to get secrets which should be rotated.
+func WithSecretAges(path string) Option {
+	return func(o *Optional) {
+		o.SecretAges = path
+	}
+}
+
+// Check secret ages every interval and emit cog.EventSecretsStale with paths of the secrets older than maxAge.
+// It has effect only together with cog.WithSecretAges.
+func WithSecretRotationCheck(maxAge time.Duration, interval time.Duration) Option {
+	return func(o *Optional) {
+		o.SecretMaxAge = maxAge
+		o.SecretCheckInterval = interval
+	}
+}
+
+// Publish config checksum of the instance to the fleet after config is loaded or changed,
+// so instances stuck on old config can be detected with c.Drift or fleet.Drift.
+func WithFleet(f *Fleet) Option {
+	return func(o *Optional) {
+		o.Fleet = f
+	}
+}
+
+// Allow only the leader holding the lease to save config when replicas share writable store.
+// Other instances are read-only: they reload changes, but do not write the store and reject updates.
+// Lease is renewed every renew interval, which should be shorter than lease ttl.
+func WithLeaderLease(l Lease, renew time.Duration) Option {
+	return func(o *Optional) {
+		o.Lease = l
+		o.LeaseRenew = renew
+	}
+}
+
+// Do not save config on init, so the source is kept as written, e.g. without defaults and environment values
+// filled in. Updates are saved as usual.
+func WithoutSave() Option {
+	return func(o *Optional) {
+		o.DisableInitSave = true
+	}
+}
+
+// Never write config source: config is not saved on init and updates are rejected with cog.ErrReadOnly.
+// Instance only reflects changes arriving from the source, e.g. in sidecars and observers.
+func ReadOnly() Option {
+	return func(o *Optional) {
+		o.ReadOnly = true
+	}
+}
+
+// Never write config source, but apply updates in memory. Updates are lost on restart
+// and external changes are handled according to the conflict policy.
+func ReadOnlyInMemory() Option {
+	return func(o *Optional) {
+		o.ReadOnly = true
+		o.MemoryUpdates = true
+	}
+}
+
+// Log init warnings and events, e.g. reloads, failures and conflicts. Only paths of the changed fields are logged.
+// c, err := cog.New[ConfigStruct](cog.WithLogger(log.Default()))
+func WithLogger(l Logger) Option {
+	return func(o *Optional) {
+		o.Logger = l
+	}
+}
+
+// Use custom clock for timestamps, debouncing, retries and periodic checks, e.g. fake clock in tests.
+// By default system clock is used.
+func WithClock(c Clock) Option {
+	return func(o *Optional) {
+		if c != nil {
+			o.Clock = c
+		}
+	}
+}
+
+// Specify how config changes are delivered to callbacks. Every callback receives changes in order, one at a time.
+// - cog.DeliverLatest (default): changes received while callback is busy are superseded by the latest one
+// - cog.DeliverAll: every change is delivered
+func WithCallbackDelivery(d Delivery) Option {
+	return func(o *Optional) {
+		o.Delivery = d
+	}
+}
+
+func (o *Optional) precedence() []Source {
+	if o.Precedence != nil {
+		return o.Precedence
+	}
+	if o.EnvPrecedence == EnvOverridesFile {
+		return o.withOptionalSources(envPrecedence())
+	}
+	return o.withOptionalSources(DefaultPrecedence())
+}
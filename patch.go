@@ -0,0 +1,105 @@
+package cog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Update configuration data with RFC 7386 JSON merge patch, e.g. {"server": {"port": 8081}}, so a single field
+// can be changed without knowing the whole config. Patch is merged onto the current config as encoded to JSON:
+// objects are merged recursively, null removes the field so it gets zero value, other values replace the current ones.
+// Keys are matched case-insensitively, unknown keys reject the patch. Patched config is applied the same way as Update.
+func (cog *C[T]) Patch(patch []byte) error {
+	p, err := decodePatch(patch)
+	if err != nil {
+		return err
+	}
+
+	return cog.PatchMap(p)
+}
+
+// Update configuration data with merge patch decoded to map, see Patch.
+func (cog *C[T]) PatchMap(patch map[string]any) error {
+	return cog.patchAs("", patch)
+}
+
+func (cog *C[T]) patchAs(actor string, patch map[string]any) error {
+	return cog.updateCtx(context.Background(), actor, func(cur T) (T, error) {
+		return mergePatch(cur, patch)
+	}, nil)
+}
+
+func decodePatch(patch []byte) (map[string]any, error) {
+	var p map[string]any
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, fmt.Errorf("failed at decode patch: %v", err)
+	}
+	if p == nil {
+		return nil, fmt.Errorf("failed at decode patch: patch must be a JSON object")
+	}
+	return p, nil
+}
+
+// Apply merge patch to the config.
+func mergePatch[T any](config T, patch map[string]any) (T, error) {
+	var new T
+
+	b, err := json.Marshal(config)
+	if err != nil {
+		return new, fmt.Errorf("failed at encode config: %v", err)
+	}
+
+	var doc any
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return new, fmt.Errorf("failed at encode config: %v", err)
+	}
+
+	b, err = json.Marshal(mergeDoc(doc, patch))
+	if err != nil {
+		return new, fmt.Errorf("failed at apply patch: %v", err)
+	}
+
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.DisallowUnknownFields()
+	if err := d.Decode(&new); err != nil {
+		return new, fmt.Errorf("failed at apply patch: %v", err)
+	}
+
+	return new, nil
+}
+
+// Merge patch onto the document as defined by RFC 7386, keys are matched case-insensitively.
+func mergeDoc(doc any, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	d, ok := doc.(map[string]any)
+	if !ok {
+		d = map[string]any{}
+	}
+
+	for k, v := range p {
+		key := k
+		if _, ok := d[k]; !ok {
+			for existing := range d {
+				if strings.EqualFold(existing, k) {
+					key = existing
+					break
+				}
+			}
+		}
+
+		if v == nil {
+			delete(d, key)
+			continue
+		}
+		d[key] = mergeDoc(d[key], v)
+	}
+
+	return d
+}
@@ -0,0 +1,75 @@
+package cog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+var ErrPolicyDenied = errors.New("update denied by policy")
+
+// PolicyInput is passed to the policy on every update. Configs are JSON documents,
+// fields tagged with `secret:"true"` are not included.
+type PolicyInput struct {
+	Actor string         `json:"actor"`
+	Old   map[string]any `json:"old"`
+	New   map[string]any `json:"new"`
+}
+
+// Policy decision, reason is reported to the caller if update is denied.
+type Decision struct {
+	Allow  bool   `json:"allow"`
+	Reason string `json:"reason"`
+}
+
+// Policy evaluates organization rules for config updates, e.g. CEL expression or OPA bundle.
+type Policy interface {
+	Evaluate(ctx context.Context, input PolicyInput) (Decision, error)
+}
+
+// PolicyFunc is an adapter to use ordinary function as a policy.
+type PolicyFunc func(ctx context.Context, input PolicyInput) (Decision, error)
+
+func (f PolicyFunc) Evaluate(ctx context.Context, input PolicyInput) (Decision, error) {
+	return f(ctx, input)
+}
+
+// Evaluate policy configured with cog.WithUpdatePolicy with context of the change.
+// Policy which can not be evaluated denies the update.
+func (cog *C[T]) evaluatePolicy(actor string, old T, new T) error {
+	if cog.opts.Policy == nil {
+		return nil
+	}
+
+	input := PolicyInput{Actor: actor, Old: policyDoc(old), New: policyDoc(new)}
+
+	d, err := cog.opts.Policy.Evaluate(cog.ChangeContext(), input)
+	if err != nil {
+		return fmt.Errorf("failed at evaluate policy: %w", err)
+	}
+
+	if !d.Allow {
+		if d.Reason == "" {
+			return ErrPolicyDenied
+		}
+		return fmt.Errorf("%w: %s", ErrPolicyDenied, d.Reason)
+	}
+
+	return nil
+}
+
+func policyDoc[T any](config T) map[string]any {
+	var data any = config
+	if v := reflect.ValueOf(config); v.Kind() == reflect.Struct {
+		data = snapshotDoc(v, "", nil, false)
+	}
+
+	doc := map[string]any{}
+	if b, err := json.Marshal(data); err == nil {
+		json.Unmarshal(b, &doc)
+	}
+
+	return doc
+}
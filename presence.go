@@ -0,0 +1,168 @@
+package cog
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var keyTags = []string{"json", "yaml", "toml"}
+
+// Set of field paths (e.g. "Server.Port") which were provided by the source.
+// nil set means presence is unknown and non-empty fields are treated as provided.
+type fieldSet map[string]bool
+
+func (s fieldSet) has(path string, f reflect.Value) bool {
+	if s == nil {
+		return !isEmpty(f)
+	}
+	return s[path]
+}
+
+// Load raw document using the same load function and collect paths of the fields which keys exist in it.
+func loadPresence[T any](load func(any) error) fieldSet {
+	s, _ := loadKeys[T](load)
+	return s
+}
+
+// Load raw document using the same load function, collect paths of the fields which keys exist in it
+// and keys which do not match any field, e.g. misspelled or removed options.
+func loadKeys[T any](load func(any) error) (fieldSet, []string) {
+	raw := map[string]any{}
+	if err := load(&raw); err != nil {
+		return nil, nil
+	}
+
+	t := reflect.TypeOf(*new(T))
+	s := fieldSet{}
+	collectPresence(t, raw, "", s)
+
+	unknown := []string{}
+	collectUnknown(t, raw, "", &unknown)
+	sort.Strings(unknown)
+
+	return s, unknown
+}
+
+func collectPresence(t reflect.Type, doc map[string]any, prefix string, s fieldSet) {
+	if t.Kind() != reflect.Struct {
+		return
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct && !hasKeyTag(sf) {
+			collectPresence(sf.Type, doc, prefix, s)
+			continue
+		}
+
+		val, ok := lookupKey(doc, sf)
+		if !ok {
+			continue
+		}
+
+		path := prefix + sf.Name
+		s[path] = true
+
+		if nested, ok := val.(map[string]any); ok {
+			collectPresence(sf.Type, nested, path+".", s)
+		}
+	}
+}
+
+// Collect document keys which do not match any field of t, nested keys are joined with dot, e.g. "server.prot".
+func collectUnknown(t reflect.Type, doc map[string]any, prefix string, unknown *[]string) {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || isMarshaler(t) {
+		return
+	}
+
+	for k, v := range doc {
+		sf, ok := fieldByKey(t, k)
+		if !ok {
+			*unknown = append(*unknown, prefix+k)
+			continue
+		}
+		if nested, ok := v.(map[string]any); ok {
+			collectUnknown(sf.Type, nested, prefix+k+".", unknown)
+		}
+	}
+}
+
+// Find field of t which document key belongs to, fields of embedded structs included.
+func fieldByKey(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct && !hasKeyTag(sf) {
+			if f, ok := fieldByKey(sf.Type, key); ok {
+				return f, true
+			}
+			continue
+		}
+
+		for _, name := range keyNames(sf) {
+			if strings.EqualFold(name, key) {
+				return sf, true
+			}
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func lookupKey(doc map[string]any, sf reflect.StructField) (any, bool) {
+	for _, name := range keyNames(sf) {
+		for k, v := range doc {
+			if strings.EqualFold(k, name) {
+				return v, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// Possible document keys of the field: names from format tags and the field name itself.
+func keyNames(sf reflect.StructField) []string {
+	names := []string{}
+	for _, tag := range keyTags {
+		name := strings.Split(sf.Tag.Get(tag), ",")[0]
+		if name != "" && name != "-" {
+			names = append(names, name)
+		}
+	}
+	// protobuf-generated structs, protojson accepts both original and JSON names
+	for _, key := range []string{"json", "name"} {
+		if name := protoTagValue(sf, key); name != "" {
+			names = append(names, name)
+		}
+	}
+	return append(names, sf.Name)
+}
+
+// Get value of the key from the tag of protobuf-generated struct, e.g. `protobuf:"varint,1,opt,name=max_conns,json=maxConns,proto3"`.
+func protoTagValue(sf reflect.StructField, key string) string {
+	for _, part := range strings.Split(sf.Tag.Get("protobuf"), ",") {
+		if k, v, ok := strings.Cut(part, "="); ok && k == key {
+			return v
+		}
+	}
+	return ""
+}
+
+func hasKeyTag(sf reflect.StructField) bool {
+	for _, tag := range keyTags {
+		if sf.Tag.Get(tag) != "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,18 @@
+package cog
+
+import (
+	"context"
+	"runtime/pprof"
+	"runtime/trace"
+	"strconv"
+)
+
+// Run config consumer with pprof labels and within execution trace region, so CPU profiles
+// and traces of the service attribute work to the subscriber or callback and config revision.
+func observe(kind string, name string, revision uint64, f func()) {
+	labels := pprof.Labels("cog_"+kind, name, "cog_revision", strconv.FormatUint(revision, 10))
+
+	pprof.Do(context.Background(), labels, func(ctx context.Context) {
+		trace.WithRegion(ctx, "cog."+kind+" "+name, f)
+	})
+}
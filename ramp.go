@@ -0,0 +1,195 @@
+package cog
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+)
+
+const rampTag = "ramp"
+
+// Numeric field changing gradually from the value subscribers have seen to the target value.
+type rampField struct {
+	index    []int
+	from     float64
+	to       float64
+	started  time.Time
+	duration time.Duration
+}
+
+// Ramp in progress. It is replaced by the next change and accessed only holding the update lock.
+type rampState[T any] struct {
+	fields []rampField
+	// Last config delivered to subscribers.
+	current T
+	cancel  chan struct{}
+}
+
+// Plan ramp of the changed fields tagged with `ramp:"5m"`. Ramp starts from the value delivered to subscribers,
+// fields which keep target of the ramp in progress continue it. Returns config to notify subscribers with.
+func (cog *C[T]) planRamp(old, new T) (T, *rampState[T], error) {
+	v := reflect.ValueOf(&new).Elem()
+	if v.Kind() != reflect.Struct {
+		return new, nil, nil
+	}
+
+	delivered := reflect.ValueOf(&old).Elem()
+	running := map[string]rampField{}
+	if cog.ramp != nil {
+		delivered = reflect.ValueOf(&cog.ramp.current).Elem()
+		for _, f := range cog.ramp.fields {
+			running[fmt.Sprint(f.index)] = f
+		}
+	}
+
+	now := cog.opts.Clock.Now()
+	fields := []rampField{}
+
+	for _, index := range taggedFields(v.Type(), rampTag, nil) {
+		sf := v.Type().FieldByIndex(index)
+
+		d, err := time.ParseDuration(sf.Tag.Get(rampTag))
+		if err != nil {
+			return new, nil, fmt.Errorf("failed at ramp %s: %v", sf.Name, err)
+		}
+
+		to, ok := number(v.FieldByIndex(index))
+		if !ok {
+			return new, nil, fmt.Errorf("failed at ramp %s: %s is not a number", sf.Name, sf.Type)
+		}
+		from, _ := number(delivered.FieldByIndex(index))
+
+		if f, ok := running[fmt.Sprint(index)]; ok && f.to == to {
+			fields = append(fields, f)
+		} else if from != to && d > 0 {
+			fields = append(fields, rampField{index: index, from: from, to: to, started: now, duration: d})
+		}
+	}
+
+	if len(fields) == 0 {
+		return new, nil, nil
+	}
+
+	r := &rampState[T]{fields: fields, current: new, cancel: make(chan struct{})}
+	r.interpolate(&r.current, now)
+
+	return r.current, r, nil
+}
+
+// Replace ramp in progress, ramp is started once change has been applied.
+func (cog *C[T]) setRamp(r *rampState[T]) {
+	if cog.ramp != nil {
+		close(cog.ramp.cancel)
+	}
+
+	cog.ramp = r
+	if r != nil {
+		cog.background(func() { cog.runRamp(r) })
+	}
+}
+
+// Deliver intermediate values until ramped fields reach the target. Every step is a regular change:
+// all subscribers and callbacks get the whole config, revision is incremented and update report is recorded.
+func (cog *C[T]) runRamp(r *rampState[T]) {
+	for {
+		select {
+		case <-cog.done:
+			return
+		case <-r.cancel:
+			return
+		case <-cog.opts.Clock.After(cog.opts.RampInterval):
+		}
+
+		cog.update.Lock()
+		if cog.ramp != r {
+			cog.update.Unlock()
+			return
+		}
+
+		now := cog.opts.Clock.Now()
+		config := cog.config
+		finished := r.interpolate(&config, now)
+
+		if err := cog.notify(config, r.current); err != nil {
+			cog.ramp = nil
+			cog.update.Unlock()
+			cog.emit(Event{Type: EventRampFailed, Time: now, Err: err})
+			return
+		}
+
+		r.current = config
+		if finished {
+			cog.ramp = nil
+		}
+		cog.update.Unlock()
+
+		if finished {
+			return
+		}
+	}
+}
+
+// Get config last delivered to subscribers, it differs from the applied one while ramp is in progress.
+func (cog *C[T]) delivered() T {
+	if cog.ramp != nil {
+		return cog.ramp.current
+	}
+	return cog.config
+}
+
+// Set ramped fields of the target config to their values at the time. Finished fields keep target value.
+// Returns true if all fields have reached the target.
+func (r *rampState[T]) interpolate(config *T, now time.Time) bool {
+	v := reflect.ValueOf(config).Elem()
+	finished := true
+
+	for _, f := range r.fields {
+		elapsed := now.Sub(f.started)
+		if elapsed >= f.duration {
+			continue
+		}
+		finished = false
+
+		value := f.from + (f.to-f.from)*float64(elapsed)/float64(f.duration)
+		setNumber(v.FieldByIndex(f.index), value)
+	}
+
+	return finished
+}
+
+// Collect index paths of the fields tagged with the tag.
+func taggedFields(t reflect.Type, tag string, parent []int) [][]int {
+	fields := [][]int{}
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+
+		index := append(append([]int{}, parent...), i)
+
+		if sf.Type.Kind() == reflect.Struct && !isMarshaler(sf.Type) {
+			fields = append(fields, taggedFields(sf.Type, tag, index)...)
+			continue
+		}
+
+		if sf.Tag.Get(tag) != "" {
+			fields = append(fields, index)
+		}
+	}
+
+	return fields
+}
+
+func setNumber(v reflect.Value, n float64) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(int64(math.Round(n)))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		v.SetUint(uint64(math.Round(n)))
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(n)
+	}
+}
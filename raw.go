@@ -0,0 +1,31 @@
+package cog
+
+import "github.com/leonidasdeim/cog/handlerapi"
+
+// RawProvider can be implemented by config handlers which read config document as bytes.
+// Raw returns bytes read by the last Load before decoding, nil if nothing has been read.
+type RawProvider = handlerapi.RawProvider
+
+// Get config document exactly as it has been last read from the source, before decoding, e.g. to store it
+// for audit or serve it from admin endpoint. Bytes are kept also when they could not be decoded, so format
+// issues can be inspected. Returns nil if handler does not implement cog.RawProvider.
+func (cog *C[T]) Raw() []byte {
+	cog.lock.Lock()
+	defer cog.lock.Unlock()
+
+	return append([]byte(nil), cog.raw...)
+}
+
+// Keep bytes read by the last load of the handler.
+func (cog *C[T]) recordRaw() {
+	p, ok := cog.handler.(RawProvider)
+	if !ok {
+		return
+	}
+
+	raw := append([]byte(nil), p.Raw()...)
+
+	cog.lock.Lock()
+	cog.raw = raw
+	cog.lock.Unlock()
+}
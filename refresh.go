@@ -0,0 +1,51 @@
+package cog
+
+import (
+	"reflect"
+)
+
+// Config document as it has been loaded from or saved to the source, before other sources are resolved.
+type sourceDoc[T any] struct {
+	config  T
+	present fieldSet
+}
+
+// Re-evaluate environment variables, env files and other sources without loading config source again,
+// e.g. after an agent rewrote sourced env file and sent SIGHUP. Changes are validated and subscribers
+// are notified the same way as on Reload. Only fields which these sources provide according to the precedence
+// can change, e.g. fields persisted in the config file win over environment unless cog.EnvOverridesFile is used.
+func (cog *C[T]) RefreshEnv() error {
+	cog.update.Lock()
+	defer cog.update.Unlock()
+
+	if err := cog.checkClosed(); err != nil {
+		return err
+	}
+
+	_, err := cog.apply(cog.source.config, cog.source.present, false)
+	return err
+}
+
+// Remember source document once it has been applied, so invalid document is never written to the snapshot.
+func (cog *C[T]) setSource(doc sourceDoc[T]) {
+	if reflect.DeepEqual(cog.source, doc) {
+		return
+	}
+	cog.source = doc
+	cog.writeSnapshot(doc.config, doc.present)
+}
+
+// Get presence of every field, e.g. of the document written by save.
+func allFields[T any]() fieldSet {
+	s := fieldSet{}
+
+	v := reflect.ValueOf(new(T)).Elem()
+	if v.Kind() != reflect.Struct {
+		return s
+	}
+
+	walkFields(v, "", func(path string, _ reflect.StructField, _ reflect.Value) {
+		s[path] = true
+	})
+	return s
+}
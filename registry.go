@@ -0,0 +1,39 @@
+package cog
+
+import (
+	"strings"
+)
+
+const registryTag = "registry"
+
+// Windows registry values, field is bound to value with the same name as the field, or with `registry:"name"` tag,
+// nested structs are subkeys. Requires cog.WithRegistry option.
+const SourceRegistry Source = "registry"
+
+// Read value of the registry key, false if it does not exist. Replaced in tests.
+var registryValue = readRegistryValue
+
+// Read fields from Windows registry key hierarchy, e.g. `HKLM\SOFTWARE\Policies\MyApp` managed by Group Policy.
+// Registry comes right after flags and credentials. On other platforms registry provides no values.
+func WithRegistry(key string) Option {
+	return func(o *Optional) {
+		o.Registry = key
+	}
+}
+
+// Get registry key and value name of the field, e.g. `<root>\Server` and "Port" for Server.Port.
+// Tag `registry:"-"` excludes the field.
+func registryName(root, path, tag string) (string, string) {
+	if root == "" || tag == "-" {
+		return "", ""
+	}
+
+	parts := strings.Split(path, ".")
+	name := parts[len(parts)-1]
+	if tag != "" {
+		name = tag
+	}
+
+	key := strings.Join(append([]string{strings.TrimRight(root, `\`)}, parts[:len(parts)-1]...), `\`)
+	return key, name
+}
@@ -0,0 +1,7 @@
+//go:build !windows
+
+package cog
+
+func readRegistryValue(_, _ string) (string, bool, error) {
+	return "", false, nil
+}
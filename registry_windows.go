@@ -0,0 +1,72 @@
+//go:build windows
+
+package cog
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+var registryRoots = map[string]registry.Key{
+	"HKLM":                registry.LOCAL_MACHINE,
+	"HKEY_LOCAL_MACHINE":  registry.LOCAL_MACHINE,
+	"HKCU":                registry.CURRENT_USER,
+	"HKEY_CURRENT_USER":   registry.CURRENT_USER,
+	"HKU":                 registry.USERS,
+	"HKEY_USERS":          registry.USERS,
+	"HKCR":                registry.CLASSES_ROOT,
+	"HKEY_CLASSES_ROOT":   registry.CLASSES_ROOT,
+	"HKCC":                registry.CURRENT_CONFIG,
+	"HKEY_CURRENT_CONFIG": registry.CURRENT_CONFIG,
+}
+
+func readRegistryValue(key, name string) (string, bool, error) {
+	root, path, _ := strings.Cut(key, `\`)
+	r, ok := registryRoots[strings.ToUpper(root)]
+	if !ok {
+		return "", false, fmt.Errorf("unknown registry root key %q", root)
+	}
+
+	k, err := registry.OpenKey(r, path, registry.QUERY_VALUE)
+	if errors.Is(err, registry.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed at open registry key %s: %v", key, err)
+	}
+	defer k.Close()
+
+	_, typ, err := k.GetValue(name, nil)
+	if errors.Is(err, registry.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil && !errors.Is(err, registry.ErrShortBuffer) {
+		return "", false, fmt.Errorf("failed at read registry value %s\\%s: %v", key, name, err)
+	}
+
+	switch typ {
+	case registry.SZ, registry.EXPAND_SZ:
+		v, _, err := k.GetStringValue(name)
+		if err != nil {
+			return "", false, err
+		}
+		if typ == registry.EXPAND_SZ {
+			if v, err = registry.ExpandString(v); err != nil {
+				return "", false, err
+			}
+		}
+		return v, true, nil
+	case registry.DWORD, registry.QWORD:
+		v, _, err := k.GetIntegerValue(name)
+		if err != nil {
+			return "", false, err
+		}
+		return strconv.FormatUint(v, 10), true, nil
+	}
+
+	return "", false, fmt.Errorf("unsupported type of registry value %s\\%s", key, name)
+}
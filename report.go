@@ -0,0 +1,117 @@
+package cog
+
+import (
+	"reflect"
+	"runtime"
+	"sort"
+	"time"
+)
+
+// Time spent by a single subscriber applying the change.
+type SubscriberTiming struct {
+	Id int
+	// Name of the subscriber function, e.g. "main.(*Server).applyConfig-fm".
+	Name     string
+	Duration time.Duration
+	Err      error
+}
+
+// UpdateReport is a latency breakdown of notifying subscribers about the change,
+// recorded on every update, reload and ramp step.
+type UpdateReport struct {
+	// Revision of the change, zero if change has been rejected by a subscriber.
+	Revision uint64
+	Started  time.Time
+	// Total time spent notifying subscribers, including rollback.
+	Duration time.Duration
+	// Subscribers in the order they have been called. Subscribers after the failed one are not called.
+	Subscribers []SubscriberTiming
+	Err         error
+	// Metadata of the change, see UpdateWithMeta.
+	Meta Meta
+}
+
+type UpdateReportHook func(UpdateReport)
+
+// Registered subscriber, name of the function is resolved once on registration.
+type subscriber[T any] struct {
+	f    Subscriber[T]
+	name string
+}
+
+// Subscriber registered at the moment of the change.
+type subscriberEntry[T any] struct {
+	id   int
+	f    Subscriber[T]
+	name string
+}
+
+// Get latency breakdown of the last change, false if there have been no changes yet.
+func (cog *C[T]) LastUpdateReport() (UpdateReport, bool) {
+	cog.status.lock.Lock()
+	defer cog.status.lock.Unlock()
+
+	if len(cog.status.reports) == 0 {
+		return UpdateReport{}, false
+	}
+
+	return cog.status.reports[len(cog.status.reports)-1], true
+}
+
+// Get latency breakdowns of the last changes, oldest first. Number of kept reports is set by cog.WithUpdateReports.
+func (cog *C[T]) UpdateReports() []UpdateReport {
+	cog.status.lock.Lock()
+	defer cog.status.lock.Unlock()
+
+	return append([]UpdateReport{}, cog.status.reports...)
+}
+
+// Register hook which receives latency breakdown after every change, e.g. to export it as metrics.
+// Hook is called synchronously during the change, so it must not Update or Reload the instance.
+func (cog *C[T]) OnUpdateReport(f UpdateReportHook) {
+	cog.lock.Lock()
+	defer cog.lock.Unlock()
+
+	cog.hooks.report = append(cog.hooks.report, f)
+}
+
+func (cog *C[T]) recordReport(r UpdateReport) {
+	cog.status.lock.Lock()
+	if n := cog.opts.UpdateReports; n > 0 {
+		cog.status.reports = append(cog.status.reports, r)
+		if len(cog.status.reports) > n {
+			cog.status.reports = cog.status.reports[len(cog.status.reports)-n:]
+		}
+	}
+	cog.status.lock.Unlock()
+
+	hooks := cog.getHooks()
+	for _, f := range hooks.report {
+		if f != nil {
+			f(r)
+		}
+	}
+}
+
+// Get subscribers ordered by registration.
+func sortedSubscribers[T any](subscribers map[int]subscriber[T]) []subscriberEntry[T] {
+	entries := make([]subscriberEntry[T], 0, len(subscribers))
+	for id, s := range subscribers {
+		if s.f != nil {
+			entries = append(entries, subscriberEntry[T]{id: id, f: s.f, name: s.name})
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].id < entries[j].id
+	})
+
+	return entries
+}
+
+func funcName(f any) string {
+	if fn := runtime.FuncForPC(reflect.ValueOf(f).Pointer()); fn != nil {
+		return fn.Name()
+	}
+	return ""
+}
@@ -0,0 +1,233 @@
+package cog
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Resource is a quantity sized by the machine it runs on, e.g. `cache_size: "25%mem"` or `workers: "2x cpu"`.
+// Expression is resolved against detected resources when the value is decoded:
+//   - "<n>%mem" or "<n>%cpu": percentage of memory in bytes or of CPU cores
+//   - "<n>x mem" or "<n>x cpu": multiple of memory in bytes or of CPU cores
+//   - "<n>", "<n>Ki", "<n>Mi", "<n>Gi" or "<n>Ti": absolute value, optionally with binary unit and "B" suffix
+//
+// Limits of the cgroup (v2 or v1) the process runs in are used when they are lower than machine resources.
+// CPU based values are rounded down and at least 1. Expression is kept on save, resolved value is available with Value.
+type Resource struct {
+	expr  string
+	value int64
+}
+
+// Resources of the machine or container.
+type resources struct {
+	cpu    float64
+	memory int64
+}
+
+var (
+	resourcesOnce sync.Once
+	detected      resources
+)
+
+// Get detected resources. Replaced in tests.
+var systemResources = func() resources {
+	resourcesOnce.Do(func() {
+		detected = detectResources("/sys/fs/cgroup", "/proc/meminfo")
+	})
+	return detected
+}
+
+var units = map[string]int64{"": 1, "k": 1 << 10, "m": 1 << 20, "g": 1 << 30, "t": 1 << 40}
+
+// Parse and resolve resource expression.
+func ParseResource(expr string) (Resource, error) {
+	r := Resource{}
+	return r, r.set(expr)
+}
+
+// Get original expression, e.g. "25%mem".
+func (r Resource) Expr() string {
+	return r.expr
+}
+
+// Get resolved value, e.g. bytes of memory or number of CPU cores.
+func (r Resource) Value() int64 {
+	return r.value
+}
+
+// Get resolved value as int.
+func (r Resource) Int() int {
+	return int(r.value)
+}
+
+func (r Resource) String() string {
+	return r.expr
+}
+
+func (r Resource) MarshalText() ([]byte, error) {
+	return []byte(r.expr), nil
+}
+
+func (r *Resource) UnmarshalText(b []byte) error {
+	return r.set(string(b))
+}
+
+func (r *Resource) set(expr string) error {
+	value, err := resolveResource(expr, systemResources())
+	if err != nil {
+		return err
+	}
+	r.expr = expr
+	r.value = value
+	return nil
+}
+
+func resolveResource(expr string, res resources) (int64, error) {
+	e := strings.ToLower(strings.ReplaceAll(expr, " ", ""))
+	if e == "" {
+		return 0, nil
+	}
+
+	var num, resource string
+	var factor float64
+	switch {
+	case strings.HasSuffix(e, "mem") || strings.HasSuffix(e, "cpu"):
+		num, resource = e[:len(e)-3], e[len(e)-3:]
+		if strings.HasSuffix(num, "%") {
+			num, factor = strings.TrimSuffix(num, "%"), 0.01
+		} else if strings.HasSuffix(num, "x") {
+			num, factor = strings.TrimSuffix(num, "x"), 1
+		} else {
+			return 0, fmt.Errorf("bad resource expression %q, expected e.g. \"25%%mem\" or \"2x cpu\"", expr)
+		}
+	default:
+		return parseQuantity(expr, e)
+	}
+
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("bad resource expression %q: invalid number %q", expr, num)
+	}
+
+	if resource == "mem" {
+		if res.memory <= 0 {
+			return 0, fmt.Errorf("failed at resolve %q: memory size is unknown", expr)
+		}
+		return int64(n * factor * float64(res.memory)), nil
+	}
+
+	if res.cpu <= 0 {
+		return 0, fmt.Errorf("failed at resolve %q: number of CPU cores is unknown", expr)
+	}
+	return int64(math.Max(1, math.Floor(n*factor*res.cpu))), nil
+}
+
+// Parse absolute quantity with optional binary unit, e.g. "512Mi" or "1GiB".
+func parseQuantity(expr, e string) (int64, error) {
+	e = strings.TrimSuffix(strings.TrimSuffix(e, "b"), "i")
+	unit := ""
+	if n := len(e); n > 0 && units[e[n-1:]] > 1 {
+		e, unit = e[:n-1], e[n-1:]
+	}
+
+	n, err := strconv.ParseInt(e, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad resource expression %q: %v", expr, err)
+	}
+	return n * units[unit], nil
+}
+
+// Detect CPU cores and memory available to the process, limited by cgroup if there is a limit.
+func detectResources(cgroupRoot, meminfo string) resources {
+	res := resources{
+		cpu:    float64(runtime.NumCPU()),
+		memory: hostMemory(meminfo),
+	}
+
+	if cpu, ok := cgroupCPU(cgroupRoot); ok && cpu < res.cpu {
+		res.cpu = cpu
+	}
+	if mem, ok := cgroupMemory(cgroupRoot); ok && (res.memory == 0 || mem < res.memory) {
+		res.memory = mem
+	}
+
+	return res
+}
+
+// Get CPU quota from cgroup v2 cpu.max ("<quota> <period>") or cgroup v1 cfs files.
+func cgroupCPU(root string) (float64, bool) {
+	if b, err := os.ReadFile(filepath.Join(root, "cpu.max")); err == nil {
+		fields := strings.Fields(string(b))
+		if len(fields) == 2 {
+			return quota(fields[0], fields[1])
+		}
+		return 0, false
+	}
+
+	q, err := os.ReadFile(filepath.Join(root, "cpu", "cpu.cfs_quota_us"))
+	if err != nil {
+		return 0, false
+	}
+	p, err := os.ReadFile(filepath.Join(root, "cpu", "cpu.cfs_period_us"))
+	if err != nil {
+		return 0, false
+	}
+	return quota(strings.TrimSpace(string(q)), strings.TrimSpace(string(p)))
+}
+
+func quota(q, p string) (float64, bool) {
+	quota, err := strconv.ParseFloat(q, 64)
+	if err != nil || quota <= 0 {
+		// "max" or -1 means no limit
+		return 0, false
+	}
+	period, err := strconv.ParseFloat(p, 64)
+	if err != nil || period <= 0 {
+		return 0, false
+	}
+	return quota / period, true
+}
+
+// Get memory limit from cgroup v2 memory.max or cgroup v1 memory.limit_in_bytes.
+func cgroupMemory(root string) (int64, bool) {
+	for _, file := range []string{filepath.Join(root, "memory.max"), filepath.Join(root, "memory", "memory.limit_in_bytes")} {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		// "max" means no limit, cgroup v1 reports no limit as a huge number, which is above host memory
+		limit, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+		return limit, err == nil && limit > 0
+	}
+	return 0, false
+}
+
+// Get total memory of the host from /proc/meminfo, 0 if it is not available.
+func hostMemory(meminfo string) int64 {
+	f, err := os.Open(meminfo)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		// MemTotal:       16303792 kB
+		fields := strings.Fields(s.Text())
+		if len(fields) >= 2 && fields[0] == "MemTotal:" {
+			kb, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return 0
+			}
+			return kb << 10
+		}
+	}
+	return 0
+}
@@ -0,0 +1,79 @@
+package cog
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// RetryPolicy specifies how loading config is retried on init.
+type RetryPolicy struct {
+	// Maximum number of attempts, zero means unlimited (bounded by init timeout).
+	Attempts int
+	// Delay before the first retry, doubled after every failed attempt. By default it is 100 milliseconds.
+	Delay time.Duration
+	// Maximum delay between attempts. By default it is 10 seconds.
+	MaxDelay time.Duration
+	// Continue initialization with defaults if config could not be loaded. By default initialization fails.
+	FallbackToDefaults bool
+}
+
+type loadResult[T any] struct {
+	config  T
+	present fieldSet
+	err     error
+}
+
+// Load config retrying with backoff according to the retry policy, until init timeout is exceeded.
+func (cog *C[T]) loadWithRetries() (T, fieldSet, error) {
+	var deadline <-chan time.Time
+	if cog.opts.InitTimeout > 0 {
+		deadline = cog.opts.Clock.After(cog.opts.InitTimeout)
+	}
+
+	policy := cog.opts.InitRetries
+	delay := time.Duration(0)
+	if policy != nil {
+		delay = policy.Delay
+	}
+
+	ctx := cog.ChangeContext()
+
+	for attempt := 1; ; attempt++ {
+		ch := make(chan loadResult[T], 1)
+		go func() {
+			config, present, err := cog.read()
+			ch <- loadResult[T]{config, present, err}
+		}()
+
+		var r loadResult[T]
+		select {
+		case r = <-ch:
+		case <-deadline:
+			return *new(T), nil, fmt.Errorf("failed at load config: init timeout of %s exceeded", cog.opts.InitTimeout)
+		case <-ctx.Done():
+			return *new(T), nil, fmt.Errorf("failed at load config: %w", ctx.Err())
+		}
+
+		if r.err == nil {
+			return r.config, r.present, nil
+		}
+
+		// decryption and limits fail the same way on every attempt
+		if policy == nil || (policy.Attempts > 0 && attempt >= policy.Attempts) || errors.Is(r.err, ErrDecryption) || errors.Is(r.err, ErrLimitExceeded) {
+			return *new(T), nil, fmt.Errorf("failed at load config after %d attempt(s): %w", attempt, r.err)
+		}
+
+		select {
+		case <-cog.opts.Clock.After(delay):
+		case <-deadline:
+			return *new(T), nil, fmt.Errorf("failed at load config: init timeout of %s exceeded: %v", cog.opts.InitTimeout, r.err)
+		case <-ctx.Done():
+			return *new(T), nil, fmt.Errorf("failed at load config: %w: %v", ctx.Err(), r.err)
+		}
+
+		if delay *= 2; delay > policy.MaxDelay {
+			delay = policy.MaxDelay
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package cog
+
+import (
+	"context"
+	"sync"
+)
+
+// Revisions of the config applied in memory. Revision is applied when all subscribers have accepted it
+// and all callbacks notified about it have returned.
+type revisions struct {
+	lock    sync.Mutex
+	current uint64
+	pending map[uint64]int
+	changed chan struct{}
+}
+
+func newRevisions() revisions {
+	return revisions{current: 1, pending: make(map[uint64]int), changed: make(chan struct{})}
+}
+
+// Get revision of the current config. Initial config has revision 1, it is incremented on every applied change.
+func (cog *C[T]) Revision() uint64 {
+	cog.revs.lock.Lock()
+	defer cog.revs.lock.Unlock()
+
+	return cog.revs.current
+}
+
+// Wait until config revision has been applied by all subscribers and callbacks registered at the time of the change.
+// Returns context error if it has not been applied before context is done.
+// rev := c.Revision() // after c.Update
+// err := c.AwaitApplied(ctx, rev)
+func (cog *C[T]) AwaitApplied(ctx context.Context, revision uint64) error {
+	for {
+		cog.revs.lock.Lock()
+		applied := cog.revs.applied(revision)
+		changed := cog.revs.changed
+		cog.revs.lock.Unlock()
+
+		if applied {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// Start new revision waiting for n callbacks.
+func (r *revisions) next(n int) uint64 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.current++
+	if n > 0 {
+		r.pending[r.current] = n
+	}
+	r.broadcast()
+
+	return r.current
+}
+
+// Mark callback of the revision as done.
+func (r *revisions) done(revision uint64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.pending[revision]--; r.pending[revision] <= 0 {
+		delete(r.pending, revision)
+	}
+	r.broadcast()
+}
+
+func (r *revisions) applied(revision uint64) bool {
+	if revision > r.current {
+		return false
+	}
+	for rev := range r.pending {
+		if rev <= revision {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *revisions) broadcast() {
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
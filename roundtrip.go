@@ -0,0 +1,71 @@
+package cog
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Read config back after every save and compare it with the saved config, so lossy round trips of the format
+// are noticed, e.g. time zones, float precision or unknown keys of the source dropped on save.
+// Differences are reported with cog.EventRoundTripLoss and counted in Status, differences found on init
+// are reported in InitReport warnings. Config is not changed, check costs an additional load on every save.
+func WithRoundTripCheck() Option {
+	return func(o *Optional) {
+		o.RoundTripCheck = true
+	}
+}
+
+// Read saved document back and compare it with the saved one. Keys of the previously read document
+// which do not match any field are reported as dropped. Returns warnings.
+func (cog *C[T]) checkRoundTrip(saved T) []string {
+	cog.lock.Lock()
+	dropped := cog.unknownKeys
+	cog.lock.Unlock()
+
+	warnings := []string{}
+	for _, k := range dropped {
+		warnings = append(warnings, fmt.Sprintf("unknown key %q has been dropped on save", k))
+	}
+
+	d := Diff{}
+	read, _, err := cog.read()
+	if err != nil {
+		warnings = append(warnings, fmt.Sprintf("saved config can not be read back: %v", err))
+	} else {
+		for _, c := range diff(saved, read) {
+			if sameTime(c.Old, c.New) {
+				// monotonic clock reading is never persisted
+				continue
+			}
+			d = append(d, c)
+			warnings = append(warnings, fmt.Sprintf("lossy round trip of %s", strings.TrimSuffix(Diff{c}.String(), "\n")))
+		}
+	}
+
+	if len(warnings) == 0 {
+		return nil
+	}
+
+	cog.status.lock.Lock()
+	cog.status.current.RoundTripLosses++
+	cog.status.lock.Unlock()
+
+	cog.emit(Event{
+		Type:   EventRoundTripLoss,
+		Time:   cog.opts.Clock.Now(),
+		Err:    fmt.Errorf("saved config differs from the read one: %s", strings.Join(warnings, "; ")),
+		Fields: d.Paths(),
+		Diff:   d,
+		Raw:    cog.Raw(),
+	})
+
+	return warnings
+}
+
+// Check if values are the same instant in the same time zone.
+func sameTime(a, b any) bool {
+	t1, ok1 := a.(time.Time)
+	t2, ok2 := b.(time.Time)
+	return ok1 && ok2 && t1.Equal(t2) && t1.Location().String() == t2.Location().String()
+}
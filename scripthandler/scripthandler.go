@@ -0,0 +1,298 @@
+package scripthandler
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	fh "github.com/leonidasdeim/cog/filehandler"
+)
+
+// ErrForbiddenLoad is returned by Inputs.Load for modules outside of the script directory and import paths.
+var ErrForbiddenLoad = errors.New("module is outside of the script directory and import paths")
+
+// Evaluator runs config program and returns resulting document, e.g. thin adapter around
+// go.starlark.net/starlark, github.com/yuin/gopher-lua or github.com/google/go-jsonnet. Program must not have access to anything
+// but the inputs, so the same inputs always produce the same document.
+type Evaluator interface {
+	Eval(file string, src []byte, in Inputs) ([]byte, error)
+}
+
+// EvaluatorFunc is an adapter to use ordinary function as Evaluator.
+type EvaluatorFunc func(file string, src []byte, in Inputs) ([]byte, error)
+
+func (f EvaluatorFunc) Eval(file string, src []byte, in Inputs) ([]byte, error) {
+	return f(file, src, in)
+}
+
+// Inputs available to the config program.
+type Inputs struct {
+	// Allowed environment variables, unset ones are missing.
+	Env map[string]string
+	// Deployment profile, e.g. "prod".
+	Profile string
+	// External variables, e.g. Jsonnet ext vars.
+	Vars map[string]string
+	// Read module imported by the program. Path is relative to the script directory or one of the import paths,
+	// which are searched in order.
+	Load func(module string) ([]byte, error)
+}
+
+// ScriptHandler evaluates config program on every Load. Nothing is written back, so Save is a no-op,
+// use cog.ReadOnlyInMemory to apply updates in memory.
+type ScriptHandler struct {
+	m         sync.Mutex
+	evaluator Evaluator
+	file      string
+	dir       string
+	codec     fh.Codec
+	env       []string
+	profile   string
+	vars      map[string]string
+	imports   []string
+	modules   []string
+}
+
+type Optional struct {
+	Name        string
+	Path        string
+	Extension   string
+	Type        fh.FileType
+	Env         []string
+	Profile     string
+	Vars        map[string]string
+	ImportPaths []string
+}
+
+type Option func(o *Optional)
+
+// Add custom script name. By default it is set to "app".
+func WithName(n string) Option {
+	return func(o *Optional) {
+		o.Name = n
+	}
+}
+
+// Add custom script path. By default library uses work directory.
+func WithPath(p string) Option {
+	return func(o *Optional) {
+		o.Path = p
+	}
+}
+
+// Add custom script extension. By default it is set to "star".
+func WithExtension(e string) Option {
+	return func(o *Optional) {
+		o.Extension = e
+	}
+}
+
+// Specify format of the document produced by the program.
+// - filehandler.JSON (default)
+// - filehandler.YAML
+// - filehandler.TOML
+func WithType(t fh.FileType) Option {
+	return func(o *Optional) {
+		o.Type = t
+	}
+}
+
+// Allow program to read environment variables. Names ending with "*" are prefixes, e.g. "APP_*".
+// By default no environment variables are available.
+func WithEnv(names ...string) Option {
+	return func(o *Optional) {
+		o.Env = append(o.Env, names...)
+	}
+}
+
+// Set deployment profile available to the program.
+func WithProfile(p string) Option {
+	return func(o *Optional) {
+		o.Profile = p
+	}
+}
+
+// Set external variable available to the program.
+func WithVar(k, v string) Option {
+	return func(o *Optional) {
+		if o.Vars == nil {
+			o.Vars = map[string]string{}
+		}
+		o.Vars[k] = v
+	}
+}
+
+// Add directories to search for the modules imported by the program, e.g. shared Jsonnet libraries.
+// Script directory is always searched first.
+func WithImportPaths(paths ...string) Option {
+	return func(o *Optional) {
+		o.ImportPaths = append(o.ImportPaths, paths...)
+	}
+}
+
+// Create handler of Jsonnet entrypoint "<name>.jsonnet" evaluated by e, e.g. adapter around go-jsonnet VM.
+func NewJsonnet(e Evaluator, opts ...Option) (*ScriptHandler, error) {
+	return New(e, append([]Option{WithExtension("jsonnet")}, opts...)...)
+}
+
+func New(e Evaluator, opts ...Option) (*ScriptHandler, error) {
+
+	// Set defaults
+	o := &Optional{
+		Name:      "app",
+		Path:      fh.Utils.GetWorkDir(),
+		Extension: "star",
+		Type:      fh.JSON,
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if e == nil {
+		return nil, fmt.Errorf("evaluator is not provided")
+	}
+
+	codec := fh.NewCodec(o.Type)
+	if codec == nil {
+		return nil, fmt.Errorf("bad document type: %s", string(o.Type))
+	}
+
+	dir, err := filepath.Abs(o.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed at resolve script path: %v", err)
+	}
+
+	imports := []string{dir}
+	for _, p := range o.ImportPaths {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed at resolve import path: %v", err)
+		}
+		imports = append(imports, abs)
+	}
+
+	return &ScriptHandler{
+		evaluator: e,
+		file:      filepath.Join(dir, o.Name+"."+o.Extension),
+		dir:       dir,
+		codec:     codec,
+		env:       o.Env,
+		profile:   o.Profile,
+		vars:      o.Vars,
+		imports:   imports,
+	}, nil
+}
+
+func (h *ScriptHandler) Load(data any) error {
+	b, err := h.Eval()
+	if err != nil {
+		return err
+	}
+
+	if err := h.codec.Unmarshal(b, data); err != nil {
+		return fmt.Errorf("failed at unmarshal document of %s: %v", h.file, err)
+	}
+
+	return nil
+}
+
+func (h *ScriptHandler) Save(_ any) error {
+	return nil
+}
+
+// Evaluate config program and get resulting document.
+func (h *ScriptHandler) Eval() ([]byte, error) {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	src, err := os.ReadFile(h.file)
+	if err != nil {
+		return nil, fmt.Errorf("failed at read script: %w", err)
+	}
+
+	modules := []string{}
+	b, err := h.evaluator.Eval(h.file, src, h.inputs(&modules))
+	if err != nil {
+		return nil, fmt.Errorf("failed at evaluate %s: %v", h.file, err)
+	}
+	h.modules = modules
+
+	return b, nil
+}
+
+// Get paths of the script and modules imported by the last successful evaluation,
+// so edits of both are picked up by cog.WithWatcher.
+func (h *ScriptHandler) Files() []string {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	return append([]string{h.file}, h.modules...)
+}
+
+// Get absolute path of the directory where script is located.
+func (h *ScriptHandler) Dir() string {
+	return h.dir
+}
+
+func (h *ScriptHandler) inputs(modules *[]string) Inputs {
+	return Inputs{
+		Env:     environ(h.env),
+		Profile: h.profile,
+		Vars:    h.vars,
+		Load: func(module string) ([]byte, error) {
+			return h.load(module, modules)
+		},
+	}
+}
+
+// Read module and record its path.
+func (h *ScriptHandler) load(module string, modules *[]string) ([]byte, error) {
+	allowed := false
+
+	for _, dir := range h.imports {
+		file := filepath.Join(dir, module)
+		if rel, err := filepath.Rel(dir, file); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		allowed = true
+
+		b, err := os.ReadFile(file)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err == nil {
+			*modules = append(*modules, file)
+		}
+		return b, err
+	}
+
+	if !allowed {
+		return nil, fmt.Errorf("%w: %s", ErrForbiddenLoad, module)
+	}
+	return nil, fmt.Errorf("module %s: %w", module, fs.ErrNotExist)
+}
+
+// Get allowed environment variables.
+func environ(allowed []string) map[string]string {
+	env := map[string]string{}
+	if len(allowed) == 0 {
+		return env
+	}
+
+	for _, kv := range os.Environ() {
+		k, v, _ := strings.Cut(kv, "=")
+		for _, a := range allowed {
+			if k == a || (strings.HasSuffix(a, "*") && strings.HasPrefix(k, strings.TrimSuffix(a, "*"))) {
+				env[k] = v
+				break
+			}
+		}
+	}
+
+	return env
+}
@@ -0,0 +1,168 @@
+package scripthandler
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	fh "github.com/leonidasdeim/cog/filehandler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testConfig struct {
+	Name string `json:"name" yaml:"name" toml:"name"`
+	Port string `json:"port" yaml:"port" toml:"port"`
+}
+
+// Evaluates "name <value>; env <var>; var <ext var>; load <module>" scripts, module content is appended to the name.
+func fakeEvaluator(t fh.FileType) Evaluator {
+	return EvaluatorFunc(func(_ string, src []byte, in Inputs) ([]byte, error) {
+		c := testConfig{}
+		for _, stmt := range strings.Split(string(src), ";") {
+			k, v, _ := strings.Cut(strings.TrimSpace(stmt), " ")
+			switch k {
+			case "name":
+				c.Name = in.Profile + v
+			case "env":
+				c.Port = in.Env[v]
+			case "var":
+				c.Port = in.Vars[v]
+			case "load":
+				b, err := in.Load(v)
+				if err != nil {
+					return nil, err
+				}
+				c.Name += string(b)
+			case "fail":
+				return nil, errors.New(v)
+			}
+		}
+		return fh.NewCodec(t).Marshal(c)
+	})
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), os.ModePerm))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+}
+
+func TestLoad(t *testing.T) {
+	for _, ft := range []fh.FileType{fh.JSON, fh.YAML, fh.TOML} {
+		t.Run(string(ft), func(t *testing.T) {
+			dir := t.TempDir()
+			writeFile(t, filepath.Join(dir, "app.star"), "name -api; env APP_PORT")
+			t.Setenv("APP_PORT", "8443")
+			t.Setenv("SECRET", "hidden")
+
+			h, err := New(fakeEvaluator(ft), WithPath(dir), WithType(ft), WithEnv("APP_*"), WithProfile("prod"))
+			require.NoError(t, err)
+			assert.Equal(t, dir, h.Dir())
+
+			var c testConfig
+			require.NoError(t, h.Load(&c))
+			assert.Equal(t, testConfig{Name: "prod-api", Port: "8443"}, c)
+
+			// only allowed variables are available
+			writeFile(t, filepath.Join(dir, "app.star"), "name -api; env SECRET")
+			c = testConfig{}
+			require.NoError(t, h.Load(&c))
+			assert.Equal(t, testConfig{Name: "prod-api"}, c)
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	dir := t.TempDir()
+	h, err := New(fakeEvaluator(fh.JSON), WithPath(dir))
+	require.NoError(t, err)
+
+	var c testConfig
+	assert.ErrorIs(t, h.Load(&c), fs.ErrNotExist)
+
+	writeFile(t, filepath.Join(dir, "app.star"), "fail syntax error")
+	assert.ErrorContains(t, h.Load(&c), "syntax error")
+
+	h, err = New(EvaluatorFunc(func(string, []byte, Inputs) ([]byte, error) {
+		return []byte("not json"), nil
+	}), WithPath(dir))
+	require.NoError(t, err)
+	assert.ErrorContains(t, h.Load(&c), "failed at unmarshal document")
+
+	_, err = New(nil)
+	assert.Error(t, err)
+	_, err = New(fakeEvaluator(fh.JSON), WithType("ini"))
+	assert.Error(t, err)
+}
+
+func TestSave(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "app.star")
+	writeFile(t, script, "name app")
+
+	h, err := New(fakeEvaluator(fh.JSON), WithPath(dir))
+	require.NoError(t, err)
+	require.NoError(t, h.Save(testConfig{Name: "changed"}))
+
+	// script is never written
+	b, err := os.ReadFile(script)
+	require.NoError(t, err)
+	assert.Equal(t, "name app", string(b))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestModules(t *testing.T) {
+	dir := t.TempDir()
+	lib := filepath.Join(t.TempDir(), "lib")
+	writeFile(t, filepath.Join(lib, "net.libsonnet"), "-net")
+	writeFile(t, filepath.Join(dir, "app.jsonnet"), "name api; var port; load net.libsonnet")
+
+	h, err := NewJsonnet(fakeEvaluator(fh.JSON), WithPath(dir), WithImportPaths(lib), WithVar("port", "9000"))
+	require.NoError(t, err)
+
+	var c testConfig
+	require.NoError(t, h.Load(&c))
+	assert.Equal(t, testConfig{Name: "api-net", Port: "9000"}, c)
+
+	// module in the script directory takes precedence over import paths
+	writeFile(t, filepath.Join(dir, "net.libsonnet"), "-local")
+	require.NoError(t, h.Load(&c))
+	assert.Equal(t, "api-local", c.Name)
+
+	writeFile(t, filepath.Join(dir, "app.jsonnet"), "load missing.libsonnet")
+	assert.ErrorContains(t, h.Load(&c), fs.ErrNotExist.Error())
+
+	writeFile(t, filepath.Join(dir, "app.jsonnet"), "load ../escape.libsonnet")
+	assert.ErrorContains(t, h.Load(&c), ErrForbiddenLoad.Error())
+}
+
+func TestFiles(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "app.star")
+	writeFile(t, filepath.Join(dir, "lib.star"), "-lib")
+	writeFile(t, script, "name api; load lib.star")
+
+	h, err := New(fakeEvaluator(fh.JSON), WithPath(dir))
+	require.NoError(t, err)
+	assert.Equal(t, []string{script}, h.Files())
+
+	var c testConfig
+	require.NoError(t, h.Load(&c))
+	assert.Equal(t, []string{script, filepath.Join(dir, "lib.star")}, h.Files())
+
+	// failed evaluation keeps modules of the last successful one
+	writeFile(t, script, "load lib.star; fail broken")
+	assert.Error(t, h.Load(&c))
+	assert.Equal(t, []string{script, filepath.Join(dir, "lib.star")}, h.Files())
+
+	writeFile(t, script, "name api")
+	require.NoError(t, h.Load(&c))
+	assert.Equal(t, []string{script}, h.Files())
+}
@@ -0,0 +1,163 @@
+package cog
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// SecretAge is the time when value of the field tagged with `secret:"true"` has been changed last time.
+type SecretAge struct {
+	Path    string
+	Changed time.Time
+}
+
+// Secret metadata persisted next to the config. Value is not stored, only salted fingerprint
+// used to detect changes made while application was not running.
+type secretMeta struct {
+	Changed time.Time `json:"changed"`
+	Salt    string    `json:"salt"`
+	Sum     string    `json:"sum"`
+}
+
+// Get secrets which have not been changed for longer than maxAge, sorted by path.
+// Empty secrets are not reported. Secret ages are tracked only if cog.WithSecretAges is used.
+func (cog *C[T]) StaleSecrets(maxAge time.Duration) []SecretAge {
+	cog.lock.Lock()
+	defer cog.lock.Unlock()
+
+	stale := []SecretAge{}
+	now := cog.opts.Clock.Now()
+
+	for path, m := range cog.secrets {
+		if now.Sub(m.Changed) > maxAge {
+			stale = append(stale, SecretAge{Path: path, Changed: m.Changed})
+		}
+	}
+
+	sort.Slice(stale, func(i, j int) bool {
+		return stale[i].Path < stale[j].Path
+	})
+
+	return stale
+}
+
+// Load secret metadata file. Missing file is not an error, ages are tracked from now on.
+func (cog *C[T]) loadSecretAges() error {
+	if cog.opts.SecretAges == "" {
+		return nil
+	}
+
+	cog.secrets = map[string]secretMeta{}
+
+	b, err := os.ReadFile(cog.opts.SecretAges)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed at read secret ages: %v", err)
+	}
+
+	if err := json.Unmarshal(b, &cog.secrets); err != nil {
+		return fmt.Errorf("failed at read secret ages: %v", err)
+	}
+
+	return nil
+}
+
+// Update change time of the secrets which values differ from the tracked ones. Metadata file is written
+// only if something has changed, write error is reported in cog.Status().
+func (cog *C[T]) trackSecrets(config T) {
+	if cog.opts.SecretAges == "" {
+		return
+	}
+
+	v := reflect.ValueOf(config)
+	if v.Kind() != reflect.Struct {
+		return
+	}
+
+	cog.lock.Lock()
+	defer cog.lock.Unlock()
+
+	now := cog.opts.Clock.Now()
+	changed := false
+	var err error
+
+	walkFields(v, "", func(path string, sf reflect.StructField, f reflect.Value) {
+		if !isSecret(sf) || err != nil {
+			return
+		}
+
+		if f.IsZero() {
+			if _, ok := cog.secrets[path]; ok {
+				delete(cog.secrets, path)
+				changed = true
+			}
+			return
+		}
+
+		m, ok := cog.secrets[path]
+		if ok && m.Sum == fingerprint(m.Salt, f.Interface()) {
+			return
+		}
+
+		salt := make([]byte, 16)
+		if _, err = rand.Read(salt); err != nil {
+			return
+		}
+
+		m = secretMeta{Changed: now, Salt: hex.EncodeToString(salt)}
+		m.Sum = fingerprint(m.Salt, f.Interface())
+		cog.secrets[path] = m
+		changed = true
+	})
+
+	if err == nil && changed {
+		err = writeFileAtomic(cog.opts.SecretAges, cog.secrets)
+	}
+
+	cog.status.lock.Lock()
+	cog.status.current.LastSecretAgesError = err
+	cog.status.lock.Unlock()
+}
+
+func (cog *C[T]) startSecretRotationCheck() {
+	if cog.opts.SecretAges == "" || cog.opts.SecretMaxAge <= 0 || cog.opts.SecretCheckInterval <= 0 {
+		return
+	}
+
+	cog.background(func() {
+		for {
+			select {
+			case <-cog.done:
+				return
+			case <-cog.opts.Clock.After(cog.opts.SecretCheckInterval):
+			}
+
+			stale := cog.StaleSecrets(cog.opts.SecretMaxAge)
+			if len(stale) == 0 {
+				continue
+			}
+
+			fields := make([]string, 0, len(stale))
+			for _, s := range stale {
+				fields = append(fields, s.Path)
+			}
+
+			cog.emit(Event{Type: EventSecretsStale, Time: cog.opts.Clock.Now(), Fields: fields})
+		}
+	})
+}
+
+func fingerprint(salt string, value any) string {
+	b, _ := json.Marshal(value)
+	sum := sha256.Sum256(append([]byte(salt), b...))
+	return hex.EncodeToString(sum[:])
+}
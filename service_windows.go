@@ -0,0 +1,21 @@
+//go:build windows
+
+package cog
+
+import "golang.org/x/sys/windows/svc"
+
+// Handle change request of the Windows service control manager in the Execute loop of the service:
+// svc.ParamChange, e.g. sent by `sc control <service> paramchange`, reloads config the same way as SIGHUP
+// does for daemons. Service has to accept svc.AcceptParamChange. Other commands are left to the service.
+//
+//	case c := <-r:
+//		if handled, err := cfg.ServiceControl(c); handled {
+//			// log err, reload failure keeps the last good config
+//			continue
+//		}
+func (cog *C[T]) ServiceControl(r svc.ChangeRequest) (bool, error) {
+	if r.Cmd != svc.ParamChange {
+		return false, nil
+	}
+	return true, cog.Reload()
+}
@@ -0,0 +1,41 @@
+package cog
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Check updates without applying them: update is run through hooks, normalization, validation, authorization,
+// policy and appliers implementing cog.CanApplier, then reported with cog.EventShadowUpdate and counted in Status.
+// Subscribers are not notified and config is neither changed nor saved, Update returns the error it would return,
+// or error of appliers which would reject it. Changes of the source are still reloaded, so updates are checked
+// against the real config. It is useful to soak-test new update pipeline in production before enforcing it.
+func WithShadowMode() Option {
+	return func(o *Optional) {
+		o.Shadow = true
+	}
+}
+
+func (cog *C[T]) shadowUpdate(old T, new T, meta Meta, err error) error {
+	if err == nil {
+		if rejected := cog.canApply(new); len(rejected) > 0 {
+			msgs := make([]string, 0, len(rejected))
+			for _, r := range rejected {
+				msgs = append(msgs, r.Error())
+			}
+			err = fmt.Errorf("subscriber would reject update: %s", strings.Join(msgs, "; "))
+		}
+	}
+
+	cog.status.lock.Lock()
+	cog.status.current.ShadowUpdates++
+	if err != nil {
+		cog.status.current.ShadowRejected++
+	}
+	cog.status.lock.Unlock()
+
+	d := diff(old, new)
+	cog.emit(Event{Type: EventShadowUpdate, Time: cog.opts.Clock.Now(), Err: err, Fields: d.Paths(), Diff: d, Meta: meta.clone()})
+
+	return err
+}
@@ -0,0 +1,144 @@
+package cog
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrCannotApply = errors.New("config can not be applied")
+
+// Applier is a component applying config changes, registered with c.AddApplier.
+type Applier[T any] interface {
+	Apply(T) error
+}
+
+// CanApplier is optionally implemented by Applier to take part in c.Simulate.
+// CanApply checks that the config could be applied without applying it.
+type CanApplier[T any] interface {
+	CanApply(T) error
+}
+
+// Simulation is a result of the change preflight, see c.Simulate.
+type Simulation[T any] struct {
+	// Config which would be applied, after update hooks and normalization.
+	Config T
+	Diff   Diff
+	// Paths of the changed fields tagged with `restart:"true"`.
+	RestartRequired []string
+	// Paths of the changed fields tagged with `immutable:"true"`, update would be rejected with cog.ErrImmutable.
+	Immutable []string
+	// Validation error, exceeded cog.Limits or unsafe change of the field tagged with `maxDelta` or `monotonic`,
+	// update would be rejected.
+	Invalid error
+	// Error of the update authorizer or policy, update would be rejected. They are asked only if config is valid.
+	Denied error
+	// Errors returned by CanApply of the appliers, update would most likely be rolled back.
+	Rejected []error
+}
+
+// Check whether update would be accepted.
+func (s Simulation[T]) OK() bool {
+	return len(s.Immutable) == 0 && s.Invalid == nil && s.Denied == nil && len(s.Rejected) == 0
+}
+
+// Register applier as a subscriber. If applier implements cog.CanApplier, it is asked by c.Simulate.
+// This method returns subscriber id (int). It can be used to remove applier by calling cog.RemoveSubscriber(id).
+func (cog *C[T]) AddApplier(a Applier[T]) int {
+	id := cog.AddSubscriber(a.Apply)
+
+	if c, ok := a.(CanApplier[T]); ok {
+		cog.lock.Lock()
+		if _, ok := cog.subscribers[id]; ok {
+			cog.checks[id] = c.CanApply
+		}
+		cog.lock.Unlock()
+	}
+
+	return id
+}
+
+// Run update preflight without applying config: config is checked the same way as by c.Check, but problems
+// are collected instead of stopping at the first one. Simulation reports diff with the current config, immutable
+// and restart-required fields, validation, authorization and policy errors and rejections of the appliers
+// implementing cog.CanApplier. Error is returned only if simulation itself fails, e.g. update hook returns an error,
+// or if the instance does not accept updates, e.g. it is frozen.
+func (cog *C[T]) Simulate(new T) (Simulation[T], error) {
+	c, err := cog.dryRun(new, true)
+	if err != nil {
+		return Simulation[T]{}, err
+	}
+
+	s := Simulation[T]{
+		Config:          c.config,
+		Diff:            c.diff,
+		RestartRequired: c.diff.RestartRequired(),
+		Immutable:       c.immutable,
+		Invalid:         c.invalid,
+		Denied:          c.denied,
+		Rejected:        c.rejected,
+	}
+	if s.Invalid == nil {
+		s.Invalid = c.unsafe
+	}
+
+	return s, nil
+}
+
+// Check whether update would be accepted without saving config or notifying subscribers, e.g. to pre-flight
+// a change in admin UI. Config is checked the same way as Update: hooks, normalization, validation, limits,
+// immutable and bounded fields, authorization and policy. Then appliers implementing cog.CanApplier are asked,
+// their rejection is reported with cog.ErrCannotApply. Update of read-only or frozen instance or not the leader is
+// rejected the same way as by Update.
+func (cog *C[T]) Check(new T) error {
+	c, err := cog.dryRun(new, false)
+	if err != nil {
+		return err
+	}
+	if err := c.err(); err != nil {
+		return err
+	}
+
+	if len(c.rejected) > 0 {
+		return fmt.Errorf("%w: %v", ErrCannotApply, c.rejected[0])
+	}
+	return nil
+}
+
+// Check config under the update lock as Update does and ask appliers, nothing is applied.
+// Appliers are asked only if config passes the checks, unless all problems are collected.
+func (cog *C[T]) dryRun(new T, collect bool) (checked[T], error) {
+	cog.update.Lock()
+	defer cog.update.Unlock()
+
+	if err := cog.canUpdate(); err != nil {
+		return checked[T]{}, err
+	}
+
+	c, err := cog.preflight("", cog.getHooks(), cog.config, new)
+	if err != nil {
+		return c, err
+	}
+
+	if collect || c.err() == nil {
+		c.rejected = cog.canApply(c.config)
+	}
+	return c, nil
+}
+
+// Ask appliers implementing cog.CanApplier whether config could be applied.
+func (cog *C[T]) canApply(config T) []error {
+	cog.lock.Lock()
+	checks := make([]func(T) error, 0, len(cog.checks))
+	for _, f := range cog.checks {
+		checks = append(checks, f)
+	}
+	cog.lock.Unlock()
+
+	rejected := []error{}
+	for _, f := range checks {
+		if err := f(config); err != nil {
+			rejected = append(rejected, err)
+		}
+	}
+	return rejected
+}
@@ -0,0 +1,152 @@
+package cog
+
+import (
+	"encoding"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+var (
+	jsonMarshaler   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshaler   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// Field tagged with `secret:"true"` holds sensitive data.
+func isSecret(sf reflect.StructField) bool {
+	return sf.Tag.Get("secret") == "true"
+}
+
+// Write snapshot of the config synchronized with the source. Snapshot is best effort,
+// error is reported in cog.Status().
+func (cog *C[T]) writeSnapshot(config T, present fieldSet) {
+	if cog.opts.Snapshot == "" {
+		return
+	}
+
+	config, err := encryptFields(stripDerived(config), cog.opts.KeyProvider)
+	if err == nil {
+		doc := snapshotDoc(reflect.ValueOf(config), "", present, !cog.opts.SnapshotNoSecrets)
+		err = writeFileAtomic(cog.opts.Snapshot, doc)
+	}
+
+	cog.status.lock.Lock()
+	defer cog.status.lock.Unlock()
+
+	cog.status.current.LastSnapshotError = err
+	if err == nil {
+		cog.status.current.FromSnapshot = false
+	}
+}
+
+// Read snapshot, fields which were present in the source are present in the snapshot.
+func readSnapshot[T any](path string, kp KeyProvider) (T, fieldSet, error) {
+	var config T
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return config, nil, err
+	}
+
+	load := func(data any) error {
+		return json.Unmarshal(b, data)
+	}
+
+	if err := load(&config); err != nil {
+		return *new(T), nil, err
+	}
+
+	if err := decryptFields(&config, kp); err != nil {
+		return *new(T), nil, err
+	}
+
+	return config, loadPresence[T](load), nil
+}
+
+// Build snapshot document from the fields present in the source (all fields if presence is not tracked).
+func snapshotDoc(v reflect.Value, prefix string, present fieldSet, secrets bool) map[string]any {
+	doc := map[string]any{}
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() || (isSecret(sf) && !secrets) {
+			continue
+		}
+
+		name := strings.Split(sf.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+
+		f := v.Field(i)
+
+		if f.Kind() == reflect.Struct && !isMarshaler(f.Type()) {
+			if sf.Anonymous && !hasKeyTag(sf) {
+				for k, val := range snapshotDoc(f, prefix, present, secrets) {
+					doc[k] = val
+				}
+			} else if nested := snapshotDoc(f, prefix+sf.Name+".", present, secrets); len(nested) > 0 {
+				doc[name] = nested
+			}
+			continue
+		}
+
+		if present != nil && !present[prefix+sf.Name] {
+			continue
+		}
+
+		doc[name] = f.Interface()
+	}
+
+	return doc
+}
+
+func isMarshaler(t reflect.Type) bool {
+	p := reflect.PtrTo(t)
+	return t.Implements(jsonMarshaler) || p.Implements(jsonMarshaler) || t.Implements(textMarshaler) || p.Implements(textMarshaler)
+}
+
+// Write file through temporary file and rename, so readers never see partially written file.
+// File is readable only by the owner.
+func writeFileAtomic(path string, data any) error {
+	b, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(dir, filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(0600); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,247 @@
+package cog
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/leonidasdeim/cog/handlerapi"
+)
+
+const flagTag = "flag"
+
+// Source of the field value.
+type Source string
+
+const (
+	// Command line flags, field is bound to flag with `flag:"name"` tag. Requires cog.WithFlags option.
+	SourceFlags Source = "flags"
+	// Environment variables, field is bound to variable with `env:"NAME"` tag or by name derived with cog.WithEnvPrefix.
+	SourceEnv Source = "env"
+	// Active config document loaded by the handler.
+	SourceFile Source = "file"
+	// Default config document, used by handlers which implement DefaultLoader.
+	SourceDefaultFile Source = "default_file"
+	// Value of the `default:"value"` tag.
+	SourceDefault Source = "default"
+)
+
+// Get default order in which sources are consulted for every field, from the highest precedence to the lowest:
+// flags > active file > default file > env > default tags.
+// With cog.WithEnvPrecedence(cog.EnvOverridesFile) env is moved right after flags.
+func DefaultPrecedence() []Source {
+	return []Source{SourceFlags, SourceFile, SourceDefaultFile, SourceEnv, SourceDefault}
+}
+
+func envPrecedence() []Source {
+	return []Source{SourceFlags, SourceEnv, SourceFile, SourceDefaultFile, SourceDefault}
+}
+
+// Handlers which keep default config document separately from the active one can implement this interface.
+// Default document is then used as a separate source for the fields missing in the active document.
+type DefaultLoader = handlerapi.DefaultLoader
+
+type layer struct {
+	value   reflect.Value
+	present fieldSet
+}
+
+type resolver struct {
+	precedence []Source
+	layers     map[Source]layer
+	flags      map[string]string
+	strictEnv  bool
+	envPrefix  string
+	envFile    map[string]string
+	credDir    string
+	registry   string
+	// Source which provided the field by path, nil if not recorded.
+	origins map[string]Source
+}
+
+// Resolve every field of v from the first source in precedence order which provides it.
+// v holds data decoded from the active document, its presence is described by SourceFile layer.
+func (r *resolver) resolve(v reflect.Value) error {
+	if _, ok := r.layers[SourceFile]; !ok {
+		v.Set(reflect.Zero(v.Type()))
+	}
+
+	var err error
+
+	walkFields(v, "", func(path string, sf reflect.StructField, f reflect.Value) {
+		if !f.CanSet() || err != nil {
+			return
+		}
+
+		for _, s := range r.precedence {
+			var ok bool
+			if ok, err = r.provide(s, path, sf, f); ok || err != nil {
+				if ok && r.origins != nil {
+					r.origins[path] = s
+				}
+				return
+			}
+		}
+	})
+
+	return err
+}
+
+func (r *resolver) provide(s Source, path string, sf reflect.StructField, f reflect.Value) (bool, error) {
+	switch s {
+	case SourceFlags:
+		name := sf.Tag.Get(flagTag)
+		val, ok := r.flags[name]
+		if name == "" || !ok {
+			return false, nil
+		}
+		if err := parseValue(f, val); err != nil {
+			return false, fmt.Errorf("flag %s has invalid value for field %s: %v", name, path, err)
+		}
+		return true, nil
+
+	case SourceEnv:
+		name := envName(path, sf, r.envPrefix)
+		val := os.Getenv(name)
+		if name == "" || val == "" {
+			return false, nil
+		}
+		if err := parseValue(f, val); err != nil {
+			if r.strictEnv {
+				return false, fmt.Errorf("environment variable %s has invalid value for field %s: %v", name, path, err)
+			}
+			return false, nil
+		}
+		return true, nil
+
+	case SourceEnvFile:
+		name := envName(path, sf, r.envPrefix)
+		val, ok := r.envFile[name]
+		if name == "" || !ok || val == "" {
+			return false, nil
+		}
+		if err := parseValue(f, val); err != nil {
+			if r.strictEnv {
+				return false, fmt.Errorf("env file variable %s has invalid value for field %s: %v", name, path, err)
+			}
+			return false, nil
+		}
+		return true, nil
+
+	case SourceCredentials:
+		val, ok, err := readCredential(r.credDir, sf.Tag.Get(credentialTag))
+		if !ok || err != nil {
+			return false, err
+		}
+		if err := parseValue(f, val); err != nil {
+			return false, fmt.Errorf("credential %s has invalid value for field %s: %v", sf.Tag.Get(credentialTag), path, err)
+		}
+		return true, nil
+
+	case SourceRegistry:
+		key, name := registryName(r.registry, path, sf.Tag.Get(registryTag))
+		if key == "" {
+			return false, nil
+		}
+		val, ok, err := registryValue(key, name)
+		if !ok || err != nil {
+			return false, err
+		}
+		if err := parseValue(f, val); err != nil {
+			return false, fmt.Errorf("registry value %s\\%s has invalid value for field %s: %v", key, name, path, err)
+		}
+		return true, nil
+
+	case SourceFile:
+		l, ok := r.layers[s]
+		return ok && l.present.has(path, f), nil
+
+	case SourceDefaultFile:
+		l, ok := r.layers[s]
+		if !ok {
+			return false, nil
+		}
+		val := fieldByPath(l.value, path)
+		if !l.present.has(path, val) {
+			return false, nil
+		}
+		f.Set(val)
+		return true, nil
+
+	case SourceDefault:
+		val := defaultValue(sf)
+		return val != "" && parseValue(f, val) == nil, nil
+	}
+
+	return false, nil
+}
+
+// Resolve config from the sources. Returns source which provided the field by path.
+func (cog *C[T]) resolve(config *T, present fieldSet) (map[string]Source, error) {
+	r := resolver{
+		origins:    map[string]Source{},
+		precedence: cog.opts.precedence(),
+		layers:     map[Source]layer{},
+		flags:      map[string]string{},
+		strictEnv:  !cog.opts.LenientEnv,
+		envPrefix:  cog.opts.EnvPrefix,
+		registry:   cog.opts.Registry,
+	}
+
+	for _, s := range r.precedence {
+		switch s {
+		case SourceFile:
+			r.layers[s] = layer{present: present}
+		case SourceDefaultFile:
+			if l, ok := loadDefaultLayer[T](cog.handler, cog.opts.KeyProvider); ok {
+				r.layers[s] = l
+			}
+		case SourceEnvFile:
+			vars, err := readEnvFiles(cog.opts.EnvFiles)
+			if err != nil {
+				return nil, err
+			}
+			r.envFile = vars
+		case SourceCredentials:
+			r.credDir = credentialsDir(cog.opts.CredentialsDir)
+		case SourceFlags:
+			if cog.opts.Flags != nil {
+				cog.opts.Flags.Visit(func(f *flag.Flag) {
+					r.flags[f.Name] = f.Value.String()
+				})
+			}
+		}
+	}
+
+	return r.origins, r.resolve(reflect.ValueOf(config).Elem())
+}
+
+func loadDefaultLayer[T any](handler ConfigHandler, kp KeyProvider) (layer, bool) {
+	dl, ok := handler.(DefaultLoader)
+	if !ok {
+		return layer{}, false
+	}
+
+	data := new(T)
+	if err := dl.LoadDefault(data); err != nil {
+		return layer{}, false
+	}
+
+	if err := decryptFields(data, kp); err != nil {
+		return layer{}, false
+	}
+
+	return layer{
+		value:   reflect.ValueOf(data).Elem(),
+		present: loadPresence[T](dl.LoadDefault),
+	}, true
+}
+
+func fieldByPath(v reflect.Value, path string) reflect.Value {
+	for _, name := range strings.Split(path, ".") {
+		v = v.FieldByName(name)
+	}
+	return v
+}
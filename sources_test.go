@@ -0,0 +1,190 @@
+package cog
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type sourcesTestConfig struct {
+	Value string `flag:"value" env:"TEST_SOURCE_VALUE" default:"default"`
+}
+
+type docHandler struct {
+	active string
+	def    string
+}
+
+func (h *docHandler) Load(data any) error {
+	return decodeDoc(h.active, data)
+}
+
+func (h *docHandler) LoadDefault(data any) error {
+	return decodeDoc(h.def, data)
+}
+
+func (h *docHandler) Save(_ any) error {
+	return nil
+}
+
+func decodeDoc(doc string, data any) error {
+	if doc == "" {
+		return errors.New("document not found")
+	}
+	return json.Unmarshal([]byte(doc), data)
+}
+
+func TestSourcePrecedenceMatrix(t *testing.T) {
+	type sources struct {
+		flag, env, file, defaultFile bool
+	}
+
+	precedences := map[string][]Source{
+		"default":     DefaultPrecedence(),
+		"env_first":   envPrecedence(),
+		"no_env":      {SourceFile, SourceDefault},
+		"tags_first":  {SourceDefault, SourceFile},
+		"no_file":     {SourceEnv, SourceDefault},
+		"default_doc": {SourceDefaultFile, SourceFile},
+	}
+
+	matrix := []sources{}
+	for i := 0; i < 16; i++ {
+		matrix = append(matrix, sources{i&1 != 0, i&2 != 0, i&4 != 0, i&8 != 0})
+	}
+
+	for name, precedence := range precedences {
+		for _, m := range matrix {
+			h := &docHandler{}
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.String("value", "", "")
+			os.Unsetenv("TEST_SOURCE_VALUE")
+
+			provided := map[Source]string{SourceDefault: "default"}
+			if m.flag {
+				require.NoError(t, fs.Parse([]string{"-value=flags"}))
+				provided[SourceFlags] = "flags"
+			}
+			if m.env {
+				os.Setenv("TEST_SOURCE_VALUE", "env")
+				provided[SourceEnv] = "env"
+			}
+			if m.file {
+				h.active = `{"Value":"file"}`
+				provided[SourceFile] = "file"
+			}
+			if m.defaultFile {
+				h.def = `{"Value":"default_file"}`
+				provided[SourceDefaultFile] = "default_file"
+			}
+
+			want := ""
+			for _, s := range precedence {
+				if v, ok := provided[s]; ok {
+					want = v
+					break
+				}
+			}
+
+			c, err := New[sourcesTestConfig](WithHandler(h), WithFlags(fs), WithPrecedence(precedence...))
+			require.NoErrorf(t, err, "%s %+v: init failed", name, m)
+			assert.Equalf(t, want, c.Config().Value, "%s %+v: unexpected source won", name, m)
+		}
+	}
+
+	os.Unsetenv("TEST_SOURCE_VALUE")
+}
+
+func TestEnvPrecedenceOption(t *testing.T) {
+	o := Optional{}
+	assert.Equal(t, DefaultPrecedence(), o.precedence())
+
+	WithEnvPrecedence(EnvOverridesFile)(&o)
+	assert.Equal(t, []Source{SourceFlags, SourceEnv, SourceFile, SourceDefaultFile, SourceDefault}, o.precedence())
+
+	WithPrecedence(SourceFile)(&o)
+	assert.Equal(t, []Source{SourceFile}, o.precedence())
+}
+
+type systemdTestConfig struct {
+	Password string `credential:"db-password" env:"TEST_DB_PASSWORD"`
+	Port     int    `env:"TEST_PORT" default:"1"`
+	Name     string `env:"TEST_NAME"`
+	Quoted   string `env:"TEST_QUOTED"`
+}
+
+func TestSystemdSources(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "db-password"), []byte("secret\n"), 0600))
+
+	envFile := filepath.Join(dir, "app.env")
+	require.NoError(t, os.WriteFile(envFile, []byte(`
+# comment
+TEST_DB_PASSWORD=from-file
+export TEST_PORT=8080
+TEST_NAME=file
+TEST_QUOTED="a \"b\""
+`), 0600))
+	t.Setenv("TEST_NAME", "env")
+
+	c, err := New[systemdTestConfig](WithHandler(&docHandler{active: "{}"}),
+		WithCredentialsDir(dir), WithEnvFile(envFile, "-"+filepath.Join(dir, "missing.env")))
+	require.NoError(t, err)
+	assert.Equal(t, systemdTestConfig{Password: "secret", Port: 8080, Name: "env", Quoted: `a "b"`}, c.Config())
+
+	_, err = New[systemdTestConfig](WithHandler(&docHandler{active: "{}"}), WithEnvFile(filepath.Join(dir, "missing.env")))
+	assert.Error(t, err)
+
+	t.Setenv("CREDENTIALS_DIRECTORY", dir)
+	c, err = New[systemdTestConfig](WithHandler(&docHandler{active: `{"Password":"file"}`}), WithCredentials())
+	require.NoError(t, err)
+	assert.Equal(t, "secret", c.Config().Password)
+}
+
+func TestOptionalSourcesPrecedence(t *testing.T) {
+	o := Optional{}
+	WithCredentials()(&o)
+	WithEnvFile("app.env")(&o)
+	assert.Equal(t, []Source{SourceFlags, SourceCredentials, SourceFile, SourceDefaultFile, SourceEnv, SourceEnvFile, SourceDefault}, o.precedence())
+
+	WithEnvPrecedence(EnvOverridesFile)(&o)
+	assert.Equal(t, []Source{SourceFlags, SourceCredentials, SourceEnv, SourceEnvFile, SourceFile, SourceDefaultFile, SourceDefault}, o.precedence())
+}
+
+type registryTestConfig struct {
+	Name   string `registry:"ServiceName" env:"TEST_NAME"`
+	Server struct {
+		Port     int    `default:"1"`
+		Internal string `registry:"-"`
+	}
+}
+
+func TestRegistrySource(t *testing.T) {
+	values := map[string]string{
+		`HKLM\SOFTWARE\Policies\App\ServiceName`:     "policy",
+		`HKLM\SOFTWARE\Policies\App\Server\Port`:     "8443",
+		`HKLM\SOFTWARE\Policies\App\Server\Internal`: "ignored",
+	}
+	defer func(f func(string, string) (string, bool, error)) { registryValue = f }(registryValue)
+	registryValue = func(key, name string) (string, bool, error) {
+		v, ok := values[key+`\`+name]
+		return v, ok, nil
+	}
+	t.Setenv("TEST_NAME", "env")
+
+	c, err := New[registryTestConfig](WithHandler(&docHandler{active: `{"Name":"file"}`}), WithRegistry(`HKLM\SOFTWARE\Policies\App\`))
+	require.NoError(t, err)
+	assert.Equal(t, "policy", c.Config().Name)
+	assert.Equal(t, 8443, c.Config().Server.Port)
+	assert.Equal(t, "", c.Config().Server.Internal)
+
+	values[`HKLM\SOFTWARE\Policies\App\Server\Port`] = "port"
+	_, err = New[registryTestConfig](WithHandler(&docHandler{active: "{}"}), WithRegistry(`HKLM\SOFTWARE\Policies\App`))
+	assert.ErrorContains(t, err, `HKLM\SOFTWARE\Policies\App\Server\Port`)
+}
@@ -0,0 +1,69 @@
+package sqlhandler
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Dialect string
+
+const (
+	Postgres Dialect = "postgres"
+	MySQL    Dialect = "mysql"
+	SQLite   Dialect = "sqlite"
+)
+
+func (d Dialect) createTable(table string) string {
+	return fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s (%s VARCHAR(255) PRIMARY KEY, revision BIGINT NOT NULL, payload TEXT NOT NULL, updated_at TIMESTAMP NOT NULL)",
+		d.quote(table), d.quote("key"),
+	)
+}
+
+func (d Dialect) selectConfig(table string) string {
+	return fmt.Sprintf("SELECT revision, payload FROM %s WHERE %s = %s", d.quote(table), d.quote("key"), d.placeholder(1))
+}
+
+func (d Dialect) selectRevision(table string) string {
+	return fmt.Sprintf("SELECT revision FROM %s WHERE %s = %s", d.quote(table), d.quote("key"), d.placeholder(1))
+}
+
+func (d Dialect) selectKeys(table string) string {
+	return fmt.Sprintf("SELECT %s FROM %s ORDER BY %s", d.quote("key"), d.quote(table), d.quote("key"))
+}
+
+func (d Dialect) insert(table string) string {
+	return fmt.Sprintf(
+		"INSERT INTO %s (%s, revision, payload, updated_at) VALUES (%s)",
+		d.quote(table), d.quote("key"), d.placeholders(1, 4),
+	)
+}
+
+func (d Dialect) update(table string) string {
+	return fmt.Sprintf(
+		"UPDATE %s SET revision = %s, payload = %s, updated_at = %s WHERE %s = %s AND revision = %s",
+		d.quote(table), d.placeholder(1), d.placeholder(2), d.placeholder(3), d.quote("key"), d.placeholder(4), d.placeholder(5),
+	)
+}
+
+func (d Dialect) quote(name string) string {
+	if d == MySQL {
+		return "`" + name + "`"
+	}
+	return `"` + name + `"`
+}
+
+func (d Dialect) placeholder(i int) string {
+	if d == Postgres {
+		return fmt.Sprintf("$%d", i)
+	}
+	return "?"
+}
+
+func (d Dialect) placeholders(from, to int) string {
+	p := []string{}
+	for i := from; i <= to; i++ {
+		p = append(p, d.placeholder(i))
+	}
+	return strings.Join(p, ", ")
+}
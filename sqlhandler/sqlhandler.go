@@ -0,0 +1,281 @@
+package sqlhandler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sync"
+	"time"
+
+	fh "github.com/leonidasdeim/cog/filehandler"
+	"github.com/leonidasdeim/cog/handlerapi"
+)
+
+var (
+	// Wraps fs.ErrNotExist, so cog saves defaults on init when the row does not exist.
+	ErrNotFound = fmt.Errorf("config not found: %w", fs.ErrNotExist)
+	ErrConflict = errors.New("config has been modified by another writer")
+)
+
+// SqlHandler stores marshaled config in a database table with the following columns:
+// key (primary key), revision, payload and updated_at. Use CreateTable to create it.
+// Save uses optimistic concurrency: row is updated only if its revision has not changed since last Load/Save.
+type SqlHandler struct {
+	m        sync.Mutex
+	db       *sql.DB
+	table    string
+	key      string
+	dialect  Dialect
+	codec    fh.Codec
+	interval time.Duration
+	revision int64
+}
+
+type Optional struct {
+	Table        string
+	Key          string
+	Type         fh.FileType
+	Dialect      Dialect
+	PollInterval time.Duration
+}
+
+type Option func(o *Optional)
+
+// Add custom table name. By default it is set to "cog_config".
+func WithTable(t string) Option {
+	return func(o *Optional) {
+		o.Table = t
+	}
+}
+
+// Add custom config key, it allows to keep several configs in the same table. By default it is set to "app".
+func WithKey(k string) Option {
+	return func(o *Optional) {
+		o.Key = k
+	}
+}
+
+// Specify payload format.
+// - filehandler.JSON (default)
+// - filehandler.YAML
+// - filehandler.TOML
+func WithType(t fh.FileType) Option {
+	return func(o *Optional) {
+		o.Type = t
+	}
+}
+
+// Specify SQL dialect.
+// - sqlhandler.Postgres (default)
+// - sqlhandler.MySQL
+// - sqlhandler.SQLite
+func WithDialect(d Dialect) Option {
+	return func(o *Optional) {
+		o.Dialect = d
+	}
+}
+
+// Specify how often Watch polls revision of the config. By default it is 10 seconds.
+func WithPollInterval(d time.Duration) Option {
+	return func(o *Optional) {
+		o.PollInterval = d
+	}
+}
+
+func New(db *sql.DB, opts ...Option) (*SqlHandler, error) {
+
+	// Set defaults
+	o := &Optional{
+		Table:        "cog_config",
+		Key:          "app",
+		Type:         fh.JSON,
+		Dialect:      Postgres,
+		PollInterval: 10 * time.Second,
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	codec := fh.NewCodec(o.Type)
+	if codec == nil {
+		return nil, fmt.Errorf("bad payload type: %s", string(o.Type))
+	}
+
+	return &SqlHandler{
+		db:       db,
+		table:    o.Table,
+		key:      o.Key,
+		dialect:  o.Dialect,
+		codec:    codec,
+		interval: o.PollInterval,
+	}, nil
+}
+
+// Get handler of the config stored under the key in the same table, it is used by cog.Manager.
+func (h *SqlHandler) Handler(key string) (handlerapi.ConfigHandler, error) {
+	return &SqlHandler{
+		db:       h.db,
+		table:    h.table,
+		key:      key,
+		dialect:  h.dialect,
+		codec:    h.codec,
+		interval: h.interval,
+	}, nil
+}
+
+// List keys of the configs stored in the table.
+func (h *SqlHandler) Keys(ctx context.Context) ([]string, error) {
+	rows, err := h.db.QueryContext(ctx, h.dialect.selectKeys(h.table))
+	if err != nil {
+		return nil, fmt.Errorf("failed at list config keys: %v", err)
+	}
+	defer rows.Close()
+
+	keys := []string{}
+	for rows.Next() {
+		var k string
+		if err := rows.Scan(&k); err != nil {
+			return nil, fmt.Errorf("failed at list config keys: %v", err)
+		}
+		keys = append(keys, k)
+	}
+
+	return keys, rows.Err()
+}
+
+// Create config table if it does not exist.
+func (h *SqlHandler) CreateTable(ctx context.Context) error {
+	_, err := h.db.ExecContext(ctx, h.dialect.createTable(h.table))
+	if err != nil {
+		return fmt.Errorf("failed at create config table: %v", err)
+	}
+	return nil
+}
+
+func (h *SqlHandler) Load(data any) error {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	revision, payload, err := h.read(context.Background())
+	if err != nil {
+		return err
+	}
+
+	if err := h.codec.Unmarshal(payload, data); err != nil {
+		return fmt.Errorf("failed at unmarshal config %q: %v", h.key, err)
+	}
+
+	h.revision = revision
+	return nil
+}
+
+func (h *SqlHandler) Save(data any) error {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	payload, err := h.codec.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	// revision is unknown if config has not been loaded, e.g. Load failed or the row did not exist yet
+	if h.revision == 0 {
+		_, err := h.db.ExecContext(ctx, h.dialect.insert(h.table), h.key, 1, string(payload), now)
+		if err != nil {
+			var revision int64
+			if h.db.QueryRowContext(ctx, h.dialect.selectRevision(h.table), h.key).Scan(&revision) == nil {
+				return fmt.Errorf("failed at insert config %q, it exists at revision %d: %w", h.key, revision, ErrConflict)
+			}
+			return fmt.Errorf("failed at insert config %q: %v", h.key, err)
+		}
+		h.revision = 1
+		return nil
+	}
+
+	res, err := h.db.ExecContext(ctx, h.dialect.update(h.table), h.revision+1, string(payload), now, h.key, h.revision)
+	if err != nil {
+		return fmt.Errorf("failed at update config %q: %v", h.key, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed at update config %q: %v", h.key, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("failed at update config %q at revision %d: %w", h.key, h.revision, ErrConflict)
+	}
+
+	h.revision++
+	return nil
+}
+
+// Get revision of the config seen by last Load or Save.
+func (h *SqlHandler) Revision() int64 {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	return h.revision
+}
+
+// Check if database is reachable.
+func (h *SqlHandler) Ping(ctx context.Context) error {
+	return h.db.PingContext(ctx)
+}
+
+// Poll revision of the config and send notification to the returned channel when it differs from
+// the revision seen by last Load or Save. Channel is closed when context is cancelled.
+func (h *SqlHandler) Watch(ctx context.Context) (<-chan struct{}, error) {
+	ch := make(chan struct{}, 1)
+
+	go func() {
+		defer close(ch)
+
+		t := time.NewTicker(h.interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+
+			var revision int64
+			if err := h.db.QueryRowContext(ctx, h.dialect.selectRevision(h.table), h.key).Scan(&revision); err != nil {
+				continue
+			}
+
+			if revision != h.Revision() {
+				select {
+				case ch <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+func (h *SqlHandler) read(ctx context.Context) (int64, []byte, error) {
+	var (
+		revision int64
+		payload  string
+	)
+
+	err := h.db.QueryRowContext(ctx, h.dialect.selectConfig(h.table), h.key).Scan(&revision, &payload)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil, fmt.Errorf("failed at read config %q: %w", h.key, ErrNotFound)
+	}
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed at read config %q: %v", h.key, err)
+	}
+
+	return revision, []byte(payload), nil
+}
@@ -0,0 +1,185 @@
+package sqlhandler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	fh "github.com/leonidasdeim/cog/filehandler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testConfig struct {
+	Name string `json:"name"`
+	Port int    `json:"port"`
+}
+
+func newTestHandler(t *testing.T, opts ...Option) (*SqlHandler, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	h, err := New(db, opts...)
+	require.NoError(t, err)
+	return h, mock
+}
+
+func payload(t *testing.T, c testConfig) string {
+	b, err := fh.NewCodec(fh.JSON).Marshal(c)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestLoad(t *testing.T) {
+	h, mock := newTestHandler(t)
+
+	mock.ExpectQuery(`SELECT revision, payload FROM "cog_config" WHERE "key" = $1`).
+		WithArgs("app").
+		WillReturnRows(sqlmock.NewRows([]string{"revision", "payload"}).AddRow(3, `{"name":"app","port":8080}`))
+
+	var c testConfig
+	require.NoError(t, h.Load(&c))
+	assert.Equal(t, testConfig{Name: "app", Port: 8080}, c)
+	assert.Equal(t, int64(3), h.Revision())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLoadNotFound(t *testing.T) {
+	h, mock := newTestHandler(t, WithDialect(MySQL), WithTable("configs"), WithKey("svc"))
+
+	mock.ExpectQuery("SELECT revision, payload FROM `configs` WHERE `key` = ?").
+		WithArgs("svc").
+		WillReturnRows(sqlmock.NewRows([]string{"revision", "payload"}))
+
+	var c testConfig
+	assert.ErrorIs(t, h.Load(&c), ErrNotFound)
+	assert.Equal(t, int64(0), h.Revision())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSave(t *testing.T) {
+	h, mock := newTestHandler(t)
+
+	mock.ExpectExec(`INSERT INTO "cog_config" ("key", revision, payload, updated_at) VALUES ($1, $2, $3, $4)`).
+		WithArgs("app", 1, payload(t, testConfig{Name: "app", Port: 8080}), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE "cog_config" SET revision = $1, payload = $2, updated_at = $3 WHERE "key" = $4 AND revision = $5`).
+		WithArgs(2, payload(t, testConfig{Name: "app", Port: 8081}), sqlmock.AnyArg(), "app", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, h.Save(testConfig{Name: "app", Port: 8080}))
+	assert.Equal(t, int64(1), h.Revision())
+
+	require.NoError(t, h.Save(testConfig{Name: "app", Port: 8081}))
+	assert.Equal(t, int64(2), h.Revision())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSaveConflict(t *testing.T) {
+	h, mock := newTestHandler(t)
+
+	mock.ExpectQuery(`SELECT revision, payload FROM "cog_config" WHERE "key" = $1`).
+		WithArgs("app").
+		WillReturnRows(sqlmock.NewRows([]string{"revision", "payload"}).AddRow(3, `{"name":"app","port":8080}`))
+	mock.ExpectExec(`UPDATE "cog_config" SET revision = $1, payload = $2, updated_at = $3 WHERE "key" = $4 AND revision = $5`).
+		WithArgs(4, payload(t, testConfig{Name: "app", Port: 8081}), sqlmock.AnyArg(), "app", 3).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	var c testConfig
+	require.NoError(t, h.Load(&c))
+
+	c.Port = 8081
+	assert.ErrorIs(t, h.Save(c), ErrConflict)
+	assert.Equal(t, int64(3), h.Revision())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSaveAfterFailedLoad(t *testing.T) {
+	h, mock := newTestHandler(t, WithDialect(SQLite))
+
+	mock.ExpectQuery(`SELECT revision, payload FROM "cog_config" WHERE "key" = ?`).
+		WithArgs("app").
+		WillReturnError(errors.New("database is locked"))
+	mock.ExpectExec(`INSERT INTO "cog_config" ("key", revision, payload, updated_at) VALUES (?, ?, ?, ?)`).
+		WithArgs("app", 1, payload(t, testConfig{Name: "app", Port: 8081}), sqlmock.AnyArg()).
+		WillReturnError(errors.New("UNIQUE constraint failed: cog_config.key"))
+	mock.ExpectQuery(`SELECT revision FROM "cog_config" WHERE "key" = ?`).
+		WithArgs("app").
+		WillReturnRows(sqlmock.NewRows([]string{"revision"}).AddRow(5))
+
+	var c testConfig
+	require.Error(t, h.Load(&c))
+
+	err := h.Save(testConfig{Name: "app", Port: 8081})
+	assert.ErrorIs(t, err, ErrConflict)
+	assert.ErrorContains(t, err, "revision 5")
+	assert.Equal(t, int64(0), h.Revision())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSaveInsertError(t *testing.T) {
+	h, mock := newTestHandler(t)
+
+	mock.ExpectExec(`INSERT INTO "cog_config" ("key", revision, payload, updated_at) VALUES ($1, $2, $3, $4)`).
+		WillReturnError(errors.New("relation \"cog_config\" does not exist"))
+	mock.ExpectQuery(`SELECT revision FROM "cog_config" WHERE "key" = $1`).
+		WithArgs("app").
+		WillReturnError(errors.New("relation \"cog_config\" does not exist"))
+
+	err := h.Save(testConfig{Name: "app"})
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrConflict)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWatch(t *testing.T) {
+	h, mock := newTestHandler(t, WithPollInterval(time.Millisecond))
+
+	mock.ExpectQuery(`SELECT revision, payload FROM "cog_config" WHERE "key" = $1`).
+		WithArgs("app").
+		WillReturnRows(sqlmock.NewRows([]string{"revision", "payload"}).AddRow(1, `{"name":"app"}`))
+	mock.ExpectQuery(`SELECT revision FROM "cog_config" WHERE "key" = $1`).
+		WithArgs("app").
+		WillReturnRows(sqlmock.NewRows([]string{"revision"}).AddRow(1))
+	mock.ExpectQuery(`SELECT revision FROM "cog_config" WHERE "key" = $1`).
+		WithArgs("app").
+		WillReturnError(errors.New("connection reset"))
+	mock.ExpectQuery(`SELECT revision FROM "cog_config" WHERE "key" = $1`).
+		WithArgs("app").
+		WillReturnRows(sqlmock.NewRows([]string{"revision"}).AddRow(2))
+
+	var c testConfig
+	require.NoError(t, h.Load(&c))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := h.Watch(ctx)
+	require.NoError(t, err)
+
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		t.Fatal("expected notification about changed revision")
+	}
+
+	cancel()
+	for range ch {
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestKeys(t *testing.T) {
+	h, mock := newTestHandler(t)
+
+	mock.ExpectQuery(`SELECT "key" FROM "cog_config" ORDER BY "key"`).
+		WillReturnRows(sqlmock.NewRows([]string{"key"}).AddRow("api").AddRow("worker"))
+
+	keys, err := h.Keys(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"api", "worker"}, keys)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
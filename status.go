@@ -0,0 +1,219 @@
+package cog
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/leonidasdeim/cog/handlerapi"
+)
+
+// Pinger can be implemented by config handlers backed by remote sources.
+// Ping should check if the source is reachable without loading the config.
+type Pinger = handlerapi.Pinger
+
+type EventType string
+
+const (
+	// Config source ping has failed after being healthy.
+	EventSourceUnhealthy EventType = "source_unhealthy"
+	// Config source ping has succeeded after being unhealthy.
+	EventSourceRecovered EventType = "source_recovered"
+	// Config has been changed by Update, event carries changed fields and metadata of the change, see UpdateWithMeta.
+	EventUpdated EventType = "updated"
+	// Config has been reloaded after change notification from cog.Watchable handler.
+	EventReloaded EventType = "reloaded"
+	// Config reload after change notification has failed, last good config is kept and reload is retried.
+	EventReloadFailed EventType = "reload_failed"
+	// External change of the config source conflicts with local changes, see cog.ConflictPolicy.
+	EventConflict EventType = "conflict"
+	// Secrets have not been changed for longer than allowed, see cog.WithSecretRotationCheck.
+	EventSecretsStale EventType = "secrets_stale"
+	// Instance has acquired the leader lease, see cog.WithLeaderLease.
+	EventLeaderElected EventType = "leader_elected"
+	// Instance has lost the leader lease and became read-only.
+	EventLeaderLost EventType = "leader_lost"
+	// Subscriber has failed to apply intermediate value of the ramp, ramp is stopped.
+	EventRampFailed EventType = "ramp_failed"
+	// Config has been frozen with c.Freeze, updates are rejected.
+	EventFrozen EventType = "frozen"
+	// Config has been unfrozen with c.Unfreeze.
+	EventUnfrozen EventType = "unfrozen"
+	// Update has been checked in shadow mode, but not applied. Err is set if update would be rejected,
+	// see cog.WithShadowMode.
+	EventShadowUpdate EventType = "shadow_update"
+	// Config read back after save differs from the saved one, see cog.WithRoundTripCheck.
+	EventRoundTripLoss EventType = "round_trip_loss"
+)
+
+type Event struct {
+	Type EventType
+	Time time.Time
+	Err  error
+	// Paths of the fields related to the event, e.g. stale secrets.
+	Fields []string
+	// Changed fields with old and new values, set for update events.
+	Diff Diff
+	// Metadata of the change, see UpdateWithMeta.
+	Meta Meta
+	// Config document read from the source before decoding, set for reload events, see c.Raw.
+	Raw []byte
+}
+
+type EventListener func(Event)
+
+// Status of the config source and automatic reloads. Counters can be exported as metrics.
+type Status struct {
+	Healthy bool
+	// Error returned by the last failed check.
+	LastError error
+	LastCheck time.Time
+	// Time of the first failed check in a row, zero if source is healthy.
+	UnhealthySince      time.Time
+	Checks              int64
+	Failures            int64
+	ConsecutiveFailures int64
+
+	// Error of the last automatic reload, nil if it has succeeded. Last good config is kept until reload succeeds.
+	LastReloadError error
+	LastReload      time.Time
+	Reloads         int64
+	ReloadFailures  int64
+
+	// Config has been loaded from local snapshot on init because source was unavailable.
+	// It is reset once config is synchronized with the source.
+	FromSnapshot      bool
+	LastSnapshotError error
+
+	// Error of the last secret ages metadata write, see cog.WithSecretAges.
+	LastSecretAgesError error
+
+	// Error of the last instance state publishing, see cog.WithFleet.
+	LastPublishError error
+
+	// Config is frozen with c.Freeze, updates are rejected with cog.ErrFrozen.
+	Frozen       bool
+	FreezeReason string
+	FrozenSince  time.Time
+
+	// Updates checked in shadow mode and how many of them would be rejected, see cog.WithShadowMode.
+	ShadowUpdates  int64
+	ShadowRejected int64
+
+	// Saves which have not survived round trip, see cog.WithRoundTripCheck.
+	RoundTripLosses int64
+}
+
+type status struct {
+	lock      sync.Mutex
+	current   Status
+	listeners []EventListener
+	reports   []UpdateReport
+}
+
+// Get status of the config source. Source is reported healthy until it fails a health check,
+// checks are run only if handler implements cog.Pinger and cog.WithHealthCheck is used.
+func (cog *C[T]) Status() Status {
+	cog.status.lock.Lock()
+	defer cog.status.lock.Unlock()
+
+	return cog.status.current
+}
+
+// Register event listener. Listeners are called synchronously from the cog goroutine, so they should not block.
+func (cog *C[T]) OnEvent(f EventListener) {
+	cog.status.lock.Lock()
+	defer cog.status.lock.Unlock()
+
+	cog.status.listeners = append(cog.status.listeners, f)
+}
+
+func (cog *C[T]) emit(e Event) {
+	cog.status.lock.Lock()
+	listeners := cog.status.listeners
+	cog.status.lock.Unlock()
+
+	for _, f := range listeners {
+		if f == nil {
+			continue
+		}
+		f(e)
+	}
+}
+
+func (cog *C[T]) reportReload(err error, applied bool) {
+	now := cog.opts.Clock.Now()
+
+	cog.status.lock.Lock()
+	s := &cog.status.current
+	s.LastReload = now
+	s.LastReloadError = err
+	s.Reloads++
+	if err != nil {
+		s.ReloadFailures++
+	}
+	cog.status.lock.Unlock()
+
+	switch {
+	case err != nil:
+		cog.emit(Event{Type: EventReloadFailed, Time: now, Err: err, Raw: cog.Raw()})
+	case applied:
+		cog.emit(Event{Type: EventReloaded, Time: now, Raw: cog.Raw()})
+	}
+}
+
+func (cog *C[T]) startHealthCheck() {
+	p, ok := cog.handler.(Pinger)
+	if !ok || cog.opts.HealthCheckInterval <= 0 {
+		return
+	}
+
+	cog.background(func() {
+		for {
+			select {
+			case <-cog.done:
+				return
+			case <-cog.opts.Clock.After(cog.opts.HealthCheckInterval):
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), cog.opts.HealthCheckInterval)
+			err := p.Ping(ctx)
+			cancel()
+
+			cog.reportHealth(err)
+		}
+	})
+}
+
+func (cog *C[T]) reportHealth(err error) {
+	now := cog.opts.Clock.Now()
+
+	cog.status.lock.Lock()
+	s := &cog.status.current
+	wasHealthy := s.Healthy
+
+	s.LastCheck = now
+	s.Checks++
+
+	if err != nil {
+		s.Healthy = false
+		s.LastError = err
+		s.Failures++
+		s.ConsecutiveFailures++
+		if wasHealthy {
+			s.UnhealthySince = now
+		}
+	} else {
+		s.Healthy = true
+		s.ConsecutiveFailures = 0
+		s.UnhealthySince = time.Time{}
+	}
+	cog.status.lock.Unlock()
+
+	switch {
+	case wasHealthy && err != nil:
+		cog.emit(Event{Type: EventSourceUnhealthy, Time: now, Err: err})
+	case !wasHealthy && err == nil:
+		cog.emit(Event{Type: EventSourceRecovered, Time: now})
+	}
+}
@@ -0,0 +1,144 @@
+package stdinhandler
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	fh "github.com/leonidasdeim/cog/filehandler"
+)
+
+// StdinHandler reads full config from stdin (or other reader) once, on the first Load.
+// Following loads return the same config. Nothing is written back, so Save is a no-op.
+type StdinHandler struct {
+	m      sync.Mutex
+	reader io.Reader
+	codec  fh.Codec
+	data   []byte
+	read   bool
+}
+
+type Optional struct {
+	Type   fh.FileType
+	Reader io.Reader
+}
+
+type Option func(o *Optional)
+
+// Specify config format.
+// - filehandler.DYNAMIC (default, detected from the content)
+// - filehandler.JSON
+// - filehandler.YAML
+// - filehandler.TOML
+func WithType(t fh.FileType) Option {
+	return func(o *Optional) {
+		o.Type = t
+	}
+}
+
+// Read config from the reader instead of stdin.
+func WithReader(r io.Reader) Option {
+	return func(o *Optional) {
+		o.Reader = r
+	}
+}
+
+func New(opts ...Option) (*StdinHandler, error) {
+
+	// Set defaults
+	o := &Optional{
+		Type:   fh.DYNAMIC,
+		Reader: os.Stdin,
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	h := &StdinHandler{reader: o.Reader}
+
+	if o.Type != fh.DYNAMIC {
+		if h.codec = fh.NewCodec(o.Type); h.codec == nil {
+			return nil, fmt.Errorf("bad config type: %s", string(o.Type))
+		}
+	}
+
+	return h, nil
+}
+
+func (h *StdinHandler) Load(data any) error {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	if !h.read {
+		b, err := io.ReadAll(h.reader)
+		if err != nil {
+			return fmt.Errorf("failed at read config: %v", err)
+		}
+		h.data = b
+		h.read = true
+	}
+
+	if len(bytes.TrimSpace(h.data)) == 0 {
+		return fmt.Errorf("no config has been provided")
+	}
+
+	codec := h.codec
+	if codec == nil {
+		codec = fh.NewCodec(sniff(h.data))
+	}
+
+	if err := codec.Unmarshal(h.data, data); err != nil {
+		return fmt.Errorf("failed at unmarshal %s config: %v", codec.GetExtension(), err)
+	}
+
+	return nil
+}
+
+// Get config read from the reader, nil if it has not been read yet.
+func (h *StdinHandler) Raw() []byte {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	return h.data
+}
+
+func (h *StdinHandler) Save(_ any) error {
+	return nil
+}
+
+// Detect config format from the first meaningful line.
+func sniff(b []byte) fh.FileType {
+	s := bufio.NewScanner(bytes.NewReader(b))
+
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") || line == "---" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "{") {
+			return fh.JSON
+		}
+		if strings.HasPrefix(line, "[") {
+			// "[section]" is a TOML table, "[1, 2]" is a JSON array
+			if strings.HasSuffix(line, "]") && !strings.ContainsAny(line, ",\"{") {
+				return fh.TOML
+			}
+			return fh.JSON
+		}
+
+		eq := strings.Index(line, "=")
+		colon := strings.Index(line, ":")
+		if eq >= 0 && (colon < 0 || eq < colon) {
+			return fh.TOML
+		}
+		return fh.YAML
+	}
+
+	return fh.JSON
+}
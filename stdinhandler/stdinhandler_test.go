@@ -0,0 +1,119 @@
+package stdinhandler
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	fh "github.com/leonidasdeim/cog/filehandler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testConfig struct {
+	Name   string `json:"name" yaml:"name" toml:"name"`
+	Port   int    `json:"port" yaml:"port" toml:"port"`
+	Server struct {
+		Host string `json:"host" yaml:"host" toml:"host"`
+	} `json:"server" yaml:"server" toml:"server"`
+}
+
+// Reader which counts reads, so the test can check it is consumed once.
+type countingReader struct {
+	r     *strings.Reader
+	reads int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	c.reads++
+	return c.r.Read(p)
+}
+
+type errReader struct{}
+
+func (errReader) Read(_ []byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+func TestLoad(t *testing.T) {
+	tests := map[string]string{
+		"json":         `{"name":"app","port":8080,"server":{"host":"localhost"}}`,
+		"yaml":         "# comment\n---\nname: app\nport: 8080\nserver:\n  host: localhost\n",
+		"toml":         "name = \"app\"\nport = 8080\n[server]\nhost = \"localhost\"\n",
+		"toml_section": "[server]\nhost = \"localhost\"\n",
+	}
+
+	for name, doc := range tests {
+		t.Run(name, func(t *testing.T) {
+			h, err := New(WithReader(strings.NewReader(doc)))
+			require.NoError(t, err)
+
+			var c testConfig
+			require.NoError(t, h.Load(&c))
+			assert.Equal(t, "localhost", c.Server.Host)
+			if name != "toml_section" {
+				assert.Equal(t, "app", c.Name)
+				assert.Equal(t, 8080, c.Port)
+			}
+		})
+	}
+}
+
+func TestLoadOnce(t *testing.T) {
+	r := &countingReader{r: strings.NewReader(`{"name":"app"}`)}
+	h, err := New(WithReader(r), WithType(fh.JSON))
+	require.NoError(t, err)
+
+	var c testConfig
+	require.NoError(t, h.Load(&c))
+	reads := r.reads
+
+	c = testConfig{}
+	require.NoError(t, h.Load(&c))
+	assert.Equal(t, "app", c.Name)
+	assert.Equal(t, reads, r.reads)
+	assert.Equal(t, `{"name":"app"}`, string(h.Raw()))
+
+	require.NoError(t, h.Save(testConfig{Name: "changed"}))
+	require.NoError(t, h.Load(&c))
+	assert.Equal(t, "app", c.Name)
+}
+
+func TestLoadErrors(t *testing.T) {
+	var c testConfig
+
+	h, err := New(WithReader(strings.NewReader(" \n")))
+	require.NoError(t, err)
+	assert.ErrorContains(t, h.Load(&c), "no config has been provided")
+
+	h, err = New(WithReader(errReader{}))
+	require.NoError(t, err)
+	assert.ErrorContains(t, h.Load(&c), "broken pipe")
+
+	h, err = New(WithReader(strings.NewReader("name: app\n")), WithType(fh.JSON))
+	require.NoError(t, err)
+	assert.ErrorContains(t, h.Load(&c), "failed at unmarshal json config")
+
+	_, err = New(WithType("ini"))
+	assert.Error(t, err)
+}
+
+func TestSniff(t *testing.T) {
+	tests := []struct {
+		doc  string
+		want fh.FileType
+	}{
+		{`{"a":1}`, fh.JSON},
+		{`[1, 2]`, fh.JSON},
+		{`[{"a":1}]`, fh.JSON},
+		{"[server]\nport = 1", fh.TOML},
+		{"a = \"b:c\"", fh.TOML},
+		{"a: b=c", fh.YAML},
+		{"# comment\n\n---\na: 1", fh.YAML},
+		{"", fh.JSON},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, sniff([]byte(tt.doc)), tt.doc)
+	}
+}
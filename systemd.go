@@ -0,0 +1,142 @@
+package cog
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const credentialTag = "credential"
+
+const (
+	// Systemd credentials, field is bound to credential with `credential:"name"` tag. Requires cog.WithCredentials option.
+	SourceCredentials Source = "credentials"
+	// EnvironmentFile-style files, variables are named the same as for SourceEnv. Requires cog.WithEnvFile option.
+	SourceEnvFile Source = "env_file"
+)
+
+// Read fields tagged with `credential:"name"` from systemd credentials directory ($CREDENTIALS_DIRECTORY),
+// so secrets are not exported into the environment. Credentials take precedence over everything but flags.
+func WithCredentials() Option {
+	return WithCredentialsDir("")
+}
+
+// Read credentials from the given directory instead of $CREDENTIALS_DIRECTORY.
+func WithCredentialsDir(dir string) Option {
+	return func(o *Optional) {
+		o.Credentials = true
+		o.CredentialsDir = dir
+	}
+}
+
+// Read environment variables from EnvironmentFile-style files, e.g. "/etc/default/app". Files prefixed with "-"
+// are ignored if they do not exist, the same as in systemd. Values of the later files win, real environment
+// variables take precedence over the files.
+func WithEnvFile(files ...string) Option {
+	return func(o *Optional) {
+		o.EnvFiles = append(o.EnvFiles, files...)
+	}
+}
+
+// Insert optional sources to the precedence if they are enabled.
+func (o *Optional) withOptionalSources(precedence []Source) []Source {
+	p := []Source{}
+	for _, s := range precedence {
+		p = append(p, s)
+		if s == SourceFlags && o.Credentials {
+			p = append(p, SourceCredentials)
+		}
+		if s == SourceFlags && o.Registry != "" {
+			p = append(p, SourceRegistry)
+		}
+		if s == SourceEnv && len(o.EnvFiles) > 0 {
+			p = append(p, SourceEnvFile)
+		}
+	}
+	return p
+}
+
+func credentialsDir(dir string) string {
+	if dir != "" {
+		return dir
+	}
+	return os.Getenv("CREDENTIALS_DIRECTORY")
+}
+
+// Read credential, false if it does not exist.
+func readCredential(dir, name string) (string, bool, error) {
+	if dir == "" || name == "" {
+		return "", false, nil
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, filepath.Base(name)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed at read credential %s: %v", name, err)
+	}
+
+	return strings.TrimRight(string(b), "\r\n"), true, nil
+}
+
+// Read variables of EnvironmentFile-style files.
+func readEnvFiles(files []string) (map[string]string, error) {
+	vars := map[string]string{}
+
+	for _, file := range files {
+		optional := strings.HasPrefix(file, "-")
+		file = strings.TrimPrefix(file, "-")
+
+		b, err := os.ReadFile(file)
+		if optional && errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed at read env file: %v", err)
+		}
+
+		if err := parseEnvFile(b, vars); err != nil {
+			return nil, fmt.Errorf("failed at parse env file %s: %v", file, err)
+		}
+	}
+
+	return vars, nil
+}
+
+// Parse "KEY=VALUE" lines. Blank lines and lines starting with "#" or ";" are ignored,
+// values can be enclosed in single or double quotes.
+func parseEnvFile(b []byte, vars map[string]string) error {
+	s := bufio.NewScanner(bytes.NewReader(b))
+
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		k, v, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return fmt.Errorf("line %d: expected KEY=VALUE", n)
+		}
+
+		v = strings.TrimSpace(v)
+		if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+			if v[0] == '"' {
+				v = strings.NewReplacer(`\"`, `"`, `\\`, `\`, `\n`, "\n").Replace(v[1 : len(v)-1])
+			} else {
+				v = v[1 : len(v)-1]
+			}
+		}
+
+		vars[k] = v
+	}
+
+	return s.Err()
+}
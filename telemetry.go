@@ -0,0 +1,97 @@
+package cog
+
+import (
+	"reflect"
+	"strings"
+)
+
+const telemetryTag = "telemetry"
+
+// Usage tells which config fields are in use. Values are never reported, only whether fields are set.
+type Usage struct {
+	// Version of the config schema, see SchemaVersion.
+	Schema   string
+	Revision uint64
+	// Fields ordered as they appear in the config struct. Fields tagged with `telemetry:"-"` are not reported.
+	Fields []FieldUsage
+}
+
+type FieldUsage struct {
+	// Path of struct field names, e.g. "Server.Port".
+	Path string
+	// Value differs from the default one: value of the `default:"value"` tag or zero value.
+	Set bool
+	// Field is tagged with `secret:"true"`.
+	Secret bool
+}
+
+// TelemetrySink receives usage of the config fields. It is called synchronously during the change,
+// so it should hand usage off, e.g. to a channel, instead of sending it.
+type TelemetrySink func(Usage)
+
+// Get paths of the set fields.
+func (u Usage) SetFields() []string {
+	paths := []string{}
+	for _, f := range u.Fields {
+		if f.Set {
+			paths = append(paths, f.Path)
+		}
+	}
+	return paths
+}
+
+// Report which config fields are in use to the sink on init and whenever it changes, e.g. to learn which
+// options are actually exercised before removing them. Values of the fields are never reported.
+func WithTelemetry(sink TelemetrySink) Option {
+	return func(o *Optional) {
+		o.Telemetry = sink
+	}
+}
+
+// Report usage of the current config if set fields have changed since the last report.
+func (cog *C[T]) reportUsage() {
+	if cog.opts.Telemetry == nil {
+		return
+	}
+
+	u := usage(cog.config)
+	u.Revision = cog.Revision()
+
+	set := strings.Join(u.SetFields(), "\n")
+	if cog.usage != nil && *cog.usage == set {
+		return
+	}
+	cog.usage = &set
+
+	cog.opts.Telemetry(u)
+}
+
+// Get usage of the config fields, set fields are compared with the defaults.
+func usage[T any](config T) Usage {
+	u := Usage{Schema: SchemaVersion[T](), Fields: []FieldUsage{}}
+
+	v := reflect.ValueOf(&config).Elem()
+	if v.Kind() != reflect.Struct {
+		return u
+	}
+
+	var defaults T
+	d := reflect.ValueOf(&defaults).Elem()
+	r := resolver{precedence: []Source{SourceDefault}, layers: map[Source]layer{}}
+	if err := r.resolve(d); err != nil {
+		d.Set(reflect.Zero(d.Type()))
+	}
+
+	walkFields(v, "", func(path string, sf reflect.StructField, f reflect.Value) {
+		if sf.Tag.Get(telemetryTag) == "-" {
+			return
+		}
+		u.Fields = append(u.Fields, FieldUsage{
+			Path:   path,
+			Set:    !reflect.DeepEqual(f.Interface(), fieldByPath(d, path).Interface()),
+			Secret: isSecret(sf),
+		})
+	})
+
+	return u
+}
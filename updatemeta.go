@@ -0,0 +1,39 @@
+package cog
+
+// Meta describes why the change has been made, e.g. cog.Meta{"reason": "incident-1234", "pipeline": "deploy-42"}.
+type Meta map[string]string
+
+// Update configuration data with metadata of the change. Metadata is available to hooks and subscribers with
+// ChangeMeta while the change is applied, and is passed to update reports and to EventUpdated event,
+// so changes can be correlated with tickets or automation which caused them, e.g. in audit log.
+func (cog *C[T]) UpdateWithMeta(new T, meta Meta) error {
+	return cog.updateAs("", new, meta)
+}
+
+// Get metadata of the change being applied, nil if change has no metadata or there is no change in progress.
+// It is meant to be called from hooks and subscribers.
+func (cog *C[T]) ChangeMeta() Meta {
+	cog.lock.Lock()
+	defer cog.lock.Unlock()
+
+	return cog.changeMeta.clone()
+}
+
+func (cog *C[T]) setChangeMeta(meta Meta) {
+	cog.lock.Lock()
+	defer cog.lock.Unlock()
+
+	cog.changeMeta = meta.clone()
+}
+
+func (m Meta) clone() Meta {
+	if m == nil {
+		return nil
+	}
+
+	c := make(Meta, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,121 @@
+package cog
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"reflect"
+
+	"github.com/go-playground/validator/v10"
+	fh "github.com/leonidasdeim/cog/filehandler"
+)
+
+const phaseTag = "phase"
+
+// Validation phase. Fields tagged with `phase:"init"` or `phase:"update"`
+// are validated only in the given phase and skipped in the other one.
+type Phase string
+
+const (
+	PhaseInit   Phase = "init"
+	PhaseUpdate Phase = "update"
+)
+
+// Load, resolve and validate config the same way as on init, without creating files, saving config
+// or starting instance. Options are the same as for cog.New, so env, flags, decryption, limits and custom
+// validator are applied, options which have side effects are ignored. Unlike init, error is returned
+// if config can not be loaded. By default read-only file handler is used, pass handler created with
+// filehandler.WithReadOnly to use custom file handler without side effects.
+// if err := cog.ValidateOnly[ConfigStruct](cog.WithEnvPrefix("APP")); err != nil { ... }
+func ValidateOnly[T any](opts ...Option) error {
+	o := newOptional(opts)
+	cog := C[T]{opts: o, handler: o.Handler}
+
+	if cog.handler == nil {
+		h, err := fh.New(fh.WithReadOnly())
+		if err != nil {
+			return err
+		}
+		cog.handler = h
+	}
+
+	config, present, err := cog.read()
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed at load config: %w", err)
+	}
+
+	if _, err := cog.resolve(&config, present); err != nil {
+		return err
+	}
+
+	if _, err := cog.expandPlaceholders(&config, nil); err != nil {
+		return err
+	}
+
+	if err := normalize(&config, configDir(cog.handler)); err != nil {
+		return err
+	}
+
+	return cog.validate(config, PhaseInit)
+}
+
+func validate[T any](data T, phase Phase) error {
+	var err error
+
+	if skip := outOfPhase(reflect.TypeOf(data), phase); len(skip) > 0 {
+		err = validator.New().StructExcept(data, skip...)
+	} else {
+		err = validator.New().Struct(data)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed at validate config: %v", err)
+	}
+
+	// e.g. protobuf-generated config with protoc-gen-validate
+	if v, ok := any(&data).(interface{ Validate() error }); ok {
+		if err := v.Validate(); err != nil {
+			return fmt.Errorf("failed at validate config: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// Validate config with validation tags and custom validator configured with cog.WithValidator.
+func (cog *C[T]) validate(data T, phase Phase) error {
+	if err := validate(data, phase); err != nil {
+		return err
+	}
+
+	if cog.opts.Validator != nil {
+		if err := cog.opts.Validator(&data); err != nil {
+			return fmt.Errorf("failed at validate config: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// Collect paths of the fields which validation rules do not belong to the phase.
+func outOfPhase(t reflect.Type, phase Phase) []string {
+	fields := []string{}
+	if t == nil || t.Kind() != reflect.Struct {
+		return fields
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+
+		if p := sf.Tag.Get(phaseTag); p != "" && Phase(p) != phase {
+			fields = append(fields, sf.Name)
+			continue
+		}
+
+		for _, nested := range outOfPhase(sf.Type, phase) {
+			fields = append(fields, sf.Name+"."+nested)
+		}
+	}
+
+	return fields
+}
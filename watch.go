@@ -0,0 +1,237 @@
+package cog
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/leonidasdeim/cog/handlerapi"
+)
+
+// Watchable can be implemented by config handlers which are able to detect changes of the source,
+// e.g. by file system notifications, watches, blocking queries or polling. Handler sends to the returned
+// channel when config has changed and closes it when context is cancelled.
+// Cog consumes it to reload configuration automatically.
+type Watchable = handlerapi.Watchable
+
+// Checksummer can be implemented by config handlers which are able to cheaply compute checksum of the stored config.
+// It is used to recognize change notifications caused by cog's own Save and skip reloading.
+type Checksummer = handlerapi.Checksummer
+
+type watchState struct {
+	lock     sync.Mutex
+	paused   bool
+	pending  bool
+	checksum string
+	resume   chan struct{}
+}
+
+// Pause automatic reloading. Change notifications received while paused are not lost,
+// configuration is reloaded once watching is resumed.
+func (cog *C[T]) PauseWatching() {
+	cog.watch.lock.Lock()
+	defer cog.watch.lock.Unlock()
+
+	cog.watch.paused = true
+}
+
+// Resume automatic reloading. If changes have been detected while paused, configuration is reloaded.
+func (cog *C[T]) ResumeWatching() {
+	cog.watch.lock.Lock()
+	defer cog.watch.lock.Unlock()
+
+	cog.watch.paused = false
+	cog.resumePending()
+}
+
+// Reload changes detected while paused or frozen, unless reloads are still suppressed. Watch lock must be held.
+func (cog *C[T]) resumePending() {
+	if !cog.watch.pending || cog.watch.paused || cog.reloadsFrozen() {
+		return
+	}
+
+	cog.watch.pending = false
+	select {
+	case cog.watch.resume <- struct{}{}:
+	default:
+	}
+}
+
+func (cog *C[T]) startWatching() error {
+	w, ok := cog.handler.(Watchable)
+	if !ok && cog.opts.Watcher && !cog.opts.DisableWatch {
+		var err error
+		if w, err = fileWatcherOf(cog.handler); err != nil {
+			return err
+		}
+		ok = true
+	}
+	if !ok || cog.opts.DisableWatch {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	ch, err := w.Watch(ctx)
+	if err != nil {
+		cancel()
+		return fmt.Errorf("failed at watch config source: %v", err)
+	}
+
+	cog.background(func() {
+		defer cancel()
+
+		// last good config is kept on failed reload, reload is retried until it succeeds
+		var retry <-chan time.Time
+
+		for {
+			select {
+			case <-cog.done:
+				return
+			case <-cog.watch.resume:
+			case <-retry:
+				if cog.skipChange() {
+					retry = nil
+					continue
+				}
+			case _, ok := <-ch:
+				if !ok || !cog.debounce(ch) || !cog.jitter(ch) {
+					return
+				}
+				if cog.skipChange() {
+					continue
+				}
+			}
+
+			cog.update.Lock()
+			if cog.closed {
+				cog.update.Unlock()
+				return
+			}
+			if cog.ownChange() {
+				// notification has been caused by the save which was in progress
+				cog.update.Unlock()
+				retry = nil
+				continue
+			}
+			conflict, err := cog.reload(true)
+			cog.update.Unlock()
+
+			if conflict != nil {
+				cog.reportConflict(*conflict)
+			}
+
+			retry = nil
+			if err != nil && cog.opts.ReloadRetry > 0 {
+				retry = cog.opts.Clock.After(cog.opts.ReloadRetry)
+			}
+
+			cog.reportReload(err, conflict == nil || cog.opts.ConflictPolicy == ExternalWins || cog.opts.ConflictPolicy == MergeChanges)
+		}
+	})
+
+	return nil
+}
+
+// Wait until no change notifications are received for the debounce period, so bursts of
+// notifications caused by a single edit are coalesced into one reload of the final state.
+// Returns false if watching should be stopped.
+func (cog *C[T]) debounce(ch <-chan struct{}) bool {
+	if cog.opts.Debounce <= 0 {
+		return true
+	}
+
+	quiet := cog.opts.Clock.After(cog.opts.Debounce)
+
+	for {
+		select {
+		case <-cog.done:
+			return false
+		case <-quiet:
+			return true
+		case _, ok := <-ch:
+			if !ok {
+				return false
+			}
+			quiet = cog.opts.Clock.After(cog.opts.Debounce)
+		}
+	}
+}
+
+// Wait random delay within the jitter window, so instances of the fleet watching the same source do not
+// reload all at once. Notifications received in the meantime are coalesced. Returns false if watching should be stopped.
+func (cog *C[T]) jitter(ch <-chan struct{}) bool {
+	if cog.opts.Jitter <= 0 {
+		return true
+	}
+
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(cog.opts.Jitter)))
+	if err != nil {
+		return true
+	}
+
+	delay := cog.opts.Clock.After(time.Duration(n.Int64()))
+
+	for {
+		select {
+		case <-cog.done:
+			return false
+		case <-delay:
+			return true
+		case _, ok := <-ch:
+			if !ok {
+				return false
+			}
+		}
+	}
+}
+
+// Skip change notification if watching is paused, reloads are frozen or if stored config is the one saved by cog.
+func (cog *C[T]) skipChange() bool {
+	cog.watch.lock.Lock()
+	defer cog.watch.lock.Unlock()
+
+	if cog.watch.paused || cog.reloadsFrozen() {
+		cog.watch.pending = true
+		return true
+	}
+
+	return cog.savedChecksum()
+}
+
+// Check if stored config is the one saved by cog.
+func (cog *C[T]) ownChange() bool {
+	cog.watch.lock.Lock()
+	defer cog.watch.lock.Unlock()
+
+	return cog.savedChecksum()
+}
+
+// Compare checksum of the stored config with the saved one. Watch lock must be held.
+func (cog *C[T]) savedChecksum() bool {
+	cs, ok := cog.handler.(Checksummer)
+	if !ok || cog.watch.checksum == "" {
+		return false
+	}
+
+	sum, err := cs.Checksum()
+	return err == nil && sum == cog.watch.checksum
+}
+
+// Remember checksum of the config saved by cog.
+func (cog *C[T]) recordChecksum() {
+	cs, ok := cog.handler.(Checksummer)
+	if !ok {
+		return
+	}
+
+	sum, _ := cs.Checksum()
+
+	cog.watch.lock.Lock()
+	defer cog.watch.lock.Unlock()
+
+	cog.watch.checksum = sum
+}
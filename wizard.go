@@ -0,0 +1,235 @@
+package cog
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	fh "github.com/leonidasdeim/cog/filehandler"
+)
+
+const (
+	descTag   = "desc"
+	enumTag   = "enum"
+	wizardTag = "wizard"
+)
+
+type wizard struct {
+	in   *bufio.Reader
+	out  io.Writer
+	file string
+}
+
+type WizardOption func(w *wizard)
+
+// Read answers from r and write prompts to w. By default stdin and stdout are used.
+func WithWizardIO(r io.Reader, w io.Writer) WizardOption {
+	return func(wz *wizard) {
+		wz.in = bufio.NewReader(r)
+		wz.out = w
+	}
+}
+
+// Write produced config to the new file, format is resolved from the extension: .json, .yaml, .yml or .toml.
+// Existing file is not overwritten.
+func WithWizardFile(file string) WizardOption {
+	return func(w *wizard) {
+		w.file = file
+	}
+}
+
+// Walk user through the fields of config T in the terminal and return valid config, e.g. on the first run of CLI.
+// Every field is prompted with its `desc:"..."` description, choices and the value of `default:"value"` tag,
+// empty answer keeps the default. Choices are taken from `enum:"a,b,c"` tag or `oneof` validation.
+// Answers are validated with `validate` tags and prompted again until they are valid.
+// Fields tagged with `wizard:"-"`, derived fields and fields of unsupported types, e.g. slices, keep their defaults.
+// config, err := cog.Wizard[ConfigStruct](cog.WithWizardFile("app.yaml"))
+func Wizard[T any](opts ...WizardOption) (T, error) {
+	w := wizard{in: bufio.NewReader(os.Stdin), out: os.Stdout}
+	for _, opt := range opts {
+		opt(&w)
+	}
+
+	var config T
+	v := reflect.ValueOf(&config).Elem()
+	if v.Kind() != reflect.Struct {
+		return config, fmt.Errorf("config type %T is not a struct", config)
+	}
+
+	if w.file != "" && fh.NewCodec(fileTypeOf(w.file)) == nil {
+		return config, fmt.Errorf("unsupported config file type: %s", w.file)
+	}
+
+	r := resolver{precedence: []Source{SourceDefault}}
+	if err := r.resolve(v); err != nil {
+		return config, err
+	}
+
+	skip := map[string]bool{}
+	for _, path := range outOfPhase(v.Type(), PhaseInit) {
+		skip[path] = true
+	}
+
+	var err error
+	walkFields(v, "", func(path string, sf reflect.StructField, f reflect.Value) {
+		if err != nil || sf.Tag.Get(wizardTag) == "-" || isDerived(sf) || !promptable(f) {
+			return
+		}
+		err = w.ask(&config, path, sf, f, skip[path])
+	})
+	if err != nil {
+		return config, err
+	}
+
+	if err := validate(config, PhaseInit); err != nil {
+		return config, err
+	}
+
+	if w.file != "" {
+		if err := writeConfigFile(w.file, stripDerived(config)); err != nil {
+			return config, err
+		}
+	}
+
+	return config, nil
+}
+
+// Prompt field until the answer is valid.
+func (w *wizard) ask(config any, path string, sf reflect.StructField, f reflect.Value, skipValidation bool) error {
+	choices := choicesOf(sf)
+	prompt := promptOf(path, sf, f, choices)
+
+	for {
+		fmt.Fprint(w.out, prompt)
+
+		answer, err := w.in.ReadString('\n')
+		if err != nil && (!errors.Is(err, io.EOF) || answer == "") {
+			return fmt.Errorf("failed at read answer for %s: %w", path, io.ErrUnexpectedEOF)
+		}
+		answer = strings.TrimSpace(answer)
+
+		if err := w.set(config, path, f, answer, choices, skipValidation); err != nil {
+			fmt.Fprintf(w.out, "  invalid value: %v\n", err)
+			continue
+		}
+		return nil
+	}
+}
+
+// Set answer to the field and validate it, field keeps previous value if answer is not valid.
+func (w *wizard) set(config any, path string, f reflect.Value, answer string, choices []string, skipValidation bool) error {
+	prev := reflect.New(f.Type()).Elem()
+	prev.Set(f)
+
+	if answer != "" {
+		if len(choices) > 0 && !contains(choices, answer) {
+			return fmt.Errorf("expected one of %s", strings.Join(choices, ", "))
+		}
+		if err := parseValue(f, answer); err != nil {
+			return err
+		}
+	}
+
+	if skipValidation {
+		return nil
+	}
+
+	if err := validator.New().StructPartial(config, path); err != nil {
+		f.Set(prev)
+		return err
+	}
+	return nil
+}
+
+func promptOf(path string, sf reflect.StructField, f reflect.Value, choices []string) string {
+	var b strings.Builder
+
+	b.WriteString(path)
+	if desc := sf.Tag.Get(descTag); desc != "" {
+		b.WriteString(" - " + desc)
+	}
+	if len(choices) > 0 {
+		b.WriteString(" [" + strings.Join(choices, "/") + "]")
+	}
+	if !isSecret(sf) && !isEmpty(f) {
+		v := f
+		if v.Kind() == reflect.Pointer {
+			v = v.Elem()
+		}
+		b.WriteString(fmt.Sprintf(" (%v)", v.Interface()))
+	}
+	b.WriteString(": ")
+
+	return b.String()
+}
+
+// Get choices of the field from `enum:"a,b,c"` tag or `oneof=a b c` validation.
+func choicesOf(sf reflect.StructField) []string {
+	if enum := sf.Tag.Get(enumTag); enum != "" {
+		choices := strings.Split(enum, ",")
+		for i := range choices {
+			choices[i] = strings.TrimSpace(choices[i])
+		}
+		return choices
+	}
+
+	for _, rule := range strings.Split(sf.Tag.Get("validate"), ",") {
+		if strings.HasPrefix(rule, "oneof=") {
+			return strings.Fields(strings.TrimPrefix(rule, "oneof="))
+		}
+	}
+	return nil
+}
+
+// Field can be entered as a single value.
+func promptable(f reflect.Value) bool {
+	if _, ok := textUnmarshalerOf(f); ok {
+		return true
+	}
+
+	k := f.Kind()
+	if k == reflect.Pointer {
+		k = f.Type().Elem().Kind()
+	}
+
+	switch k {
+	case reflect.String, reflect.Bool, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Write config to the new file in the format of its extension.
+func writeConfigFile(file string, config any) error {
+	b, err := fh.NewCodec(fileTypeOf(file)).Marshal(config)
+	if err != nil {
+		return fmt.Errorf("failed at marshal config: %v", err)
+	}
+
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
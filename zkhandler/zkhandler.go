@@ -0,0 +1,264 @@
+package zkhandler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sync"
+	"time"
+
+	fh "github.com/leonidasdeim/cog/filehandler"
+)
+
+var (
+	// Wraps fs.ErrNotExist, so cog saves defaults on init when the znode does not exist.
+	ErrNoNode     = fmt.Errorf("znode does not exist: %w", fs.ErrNotExist)
+	ErrBadVersion = errors.New("znode has been modified by another writer")
+)
+
+// Conn is a subset of ZooKeeper client API used by the handler.
+// It is satisfied by a thin adapter around zk.Conn from github.com/go-zookeeper/zk.
+type Conn interface {
+	// Get znode data and version. Returns ErrNoNode if znode does not exist.
+	Get(path string) ([]byte, int32, error)
+	// Get znode data and version and set one-shot watch, watch channel fires on znode change.
+	GetW(path string) ([]byte, int32, <-chan struct{}, error)
+	// Create persistent znode.
+	Create(path string, data []byte) error
+	// Set znode data if its version matches. Returns new version, or ErrBadVersion.
+	Set(path string, data []byte, version int32) (int32, error)
+}
+
+// ZkHandler keeps marshaled config as a data of the znode.
+// Save is conditional on the znode version seen by last Load or Save.
+type ZkHandler struct {
+	m       sync.Mutex
+	conn    Conn
+	path    string
+	codec   fh.Codec
+	chunk   int
+	version int32
+	exists  bool
+}
+
+type Optional struct {
+	Path        string
+	Type        fh.FileType
+	Compression fh.Compressor
+	ChunkSize   int
+}
+
+type Option func(o *Optional)
+
+// Add custom znode path. By default it is set to "/cog/app".
+func WithPath(p string) Option {
+	return func(o *Optional) {
+		o.Path = p
+	}
+}
+
+// Specify data format.
+// - filehandler.JSON (default)
+// - filehandler.YAML
+// - filehandler.TOML
+func WithType(t fh.FileType) Option {
+	return func(o *Optional) {
+		o.Type = t
+	}
+}
+
+// Compress znode data, e.g. to fit 1 MB data size limit of ZooKeeper. Plain data is still read,
+// so compression can be enabled for existing znodes.
+func WithCompression(c fh.Compressor) Option {
+	return func(o *Optional) {
+		o.Compression = c
+	}
+}
+
+// Split data larger than size bytes to chunks stored in sibling znodes "<path>.chunk.<n>", e.g. to fit
+// 1 MB data size limit. Data of the znode is replaced by the manifest, which is written last,
+// so watchers are notified once all chunks are written. Disabled by default.
+func WithChunking(size int) Option {
+	return func(o *Optional) {
+		o.ChunkSize = size
+	}
+}
+
+func New(conn Conn, opts ...Option) (*ZkHandler, error) {
+
+	// Set defaults
+	o := &Optional{
+		Path: "/cog/app",
+		Type: fh.JSON,
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	codec := fh.NewCodec(o.Type)
+	if codec == nil {
+		return nil, fmt.Errorf("bad data type: %s", string(o.Type))
+	}
+	if o.Compression != nil {
+		codec = fh.Compressed(codec, o.Compression)
+	}
+
+	return &ZkHandler{
+		conn:  conn,
+		path:  o.Path,
+		codec: codec,
+		chunk: o.ChunkSize,
+	}, nil
+}
+
+func (h *ZkHandler) Load(data any) error {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	b, version, err := h.conn.Get(h.path)
+	if err != nil {
+		return fmt.Errorf("failed at get znode %q: %w", h.path, err)
+	}
+
+	if b, err = h.readChunks(b); err != nil {
+		return err
+	}
+
+	if err := h.codec.Unmarshal(b, data); err != nil {
+		return fmt.Errorf("failed at unmarshal znode %q: %v", h.path, err)
+	}
+
+	h.version = version
+	h.exists = true
+	return nil
+}
+
+func (h *ZkHandler) Save(data any) error {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	b, err := h.codec.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	if b, err = h.writeChunks(b); err != nil {
+		return err
+	}
+
+	if !h.exists {
+		if err := h.conn.Create(h.path, b); err != nil {
+			return fmt.Errorf("failed at create znode %q: %w", h.path, err)
+		}
+		h.version = 0
+		h.exists = true
+		return nil
+	}
+
+	version, err := h.conn.Set(h.path, b, h.version)
+	if err != nil {
+		return fmt.Errorf("failed at set znode %q: %w", h.path, err)
+	}
+
+	h.version = version
+	return nil
+}
+
+// Read chunks if the data is a manifest.
+func (h *ZkHandler) readChunks(b []byte) ([]byte, error) {
+	m, ok := fh.ParseManifest(b)
+	if !ok {
+		return b, nil
+	}
+
+	chunks := make([][]byte, 0, m.Chunks)
+	for i := 0; i < m.Chunks; i++ {
+		path := fh.ChunkName(h.path, i)
+		c, _, err := h.conn.Get(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed at get znode %q: %w", path, err)
+		}
+		chunks = append(chunks, c)
+	}
+
+	b, err := fh.JoinChunks(m, chunks)
+	if err != nil {
+		return nil, fmt.Errorf("failed at read chunks of znode %q: %v", h.path, err)
+	}
+
+	return b, nil
+}
+
+// Write chunks if the data exceeds chunk size, returns manifest to store as the data.
+func (h *ZkHandler) writeChunks(b []byte) ([]byte, error) {
+	if h.chunk <= 0 || len(b) <= h.chunk {
+		return b, nil
+	}
+
+	manifest, chunks := fh.SplitChunks(b, h.chunk)
+	for i, c := range chunks {
+		path := fh.ChunkName(h.path, i)
+
+		_, version, err := h.conn.Get(path)
+		switch {
+		case errors.Is(err, ErrNoNode):
+			err = h.conn.Create(path, c)
+		case err == nil:
+			_, err = h.conn.Set(path, c, version)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed at write znode %q: %w", path, err)
+		}
+	}
+
+	return manifest, nil
+}
+
+// Get znode version seen by last Load or Save.
+func (h *ZkHandler) Version() int32 {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	return h.version
+}
+
+// Watch znode and send notification to the returned channel when it is changed by another writer.
+// ZooKeeper watches are one-shot, so the watch is set again after every event.
+// Channel is closed when context is cancelled.
+func (h *ZkHandler) Watch(ctx context.Context) (<-chan struct{}, error) {
+	ch := make(chan struct{}, 1)
+
+	go func() {
+		defer close(ch)
+
+		for {
+			_, version, event, err := h.conn.GetW(h.path)
+			if err != nil {
+				// znode may not exist yet or connection is lost, retry later
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(time.Second):
+					continue
+				}
+			}
+
+			if version != h.Version() {
+				select {
+				case ch <- struct{}{}:
+				default:
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-event:
+			}
+		}
+	}()
+
+	return ch, nil
+}
@@ -0,0 +1,222 @@
+package zkhandler
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"context"
+
+	fh "github.com/leonidasdeim/cog/filehandler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testConfig struct {
+	Name string `json:"name"`
+	Port int    `json:"port"`
+}
+
+type znode struct {
+	data    []byte
+	version int32
+}
+
+// In-memory ZooKeeper with one-shot watches.
+type memoryConn struct {
+	m       sync.Mutex
+	nodes   map[string]znode
+	watches map[string][]chan struct{}
+	maxData int
+}
+
+func newMemoryConn() *memoryConn {
+	return &memoryConn{nodes: map[string]znode{}, watches: map[string][]chan struct{}{}}
+}
+
+func (c *memoryConn) Get(path string) ([]byte, int32, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	n, ok := c.nodes[path]
+	if !ok {
+		return nil, 0, ErrNoNode
+	}
+	return n.data, n.version, nil
+}
+
+func (c *memoryConn) GetW(path string) ([]byte, int32, <-chan struct{}, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	n, ok := c.nodes[path]
+	if !ok {
+		return nil, 0, nil, ErrNoNode
+	}
+
+	ch := make(chan struct{})
+	c.watches[path] = append(c.watches[path], ch)
+	return n.data, n.version, ch, nil
+}
+
+func (c *memoryConn) Create(path string, data []byte) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if _, ok := c.nodes[path]; ok {
+		return errors.New("znode already exists")
+	}
+	if err := c.check(data); err != nil {
+		return err
+	}
+
+	c.nodes[path] = znode{data: data}
+	c.fire(path)
+	return nil
+}
+
+func (c *memoryConn) Set(path string, data []byte, version int32) (int32, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	n, ok := c.nodes[path]
+	if !ok {
+		return 0, ErrNoNode
+	}
+	if n.version != version {
+		return 0, ErrBadVersion
+	}
+	if err := c.check(data); err != nil {
+		return 0, err
+	}
+
+	c.nodes[path] = znode{data: data, version: version + 1}
+	c.fire(path)
+	return version + 1, nil
+}
+
+func (c *memoryConn) check(data []byte) error {
+	if c.maxData > 0 && len(data) > c.maxData {
+		return errors.New("znode data is too large")
+	}
+	return nil
+}
+
+func (c *memoryConn) fire(path string) {
+	for _, w := range c.watches[path] {
+		close(w)
+	}
+	delete(c.watches, path)
+}
+
+func TestLoadSave(t *testing.T) {
+	conn := newMemoryConn()
+	h, err := New(conn, WithPath("/svc/config"))
+	require.NoError(t, err)
+
+	var c testConfig
+	assert.ErrorIs(t, h.Load(&c), ErrNoNode)
+
+	require.NoError(t, h.Save(testConfig{Name: "app", Port: 8080}))
+	assert.Equal(t, int32(0), h.Version())
+
+	require.NoError(t, h.Save(testConfig{Name: "app", Port: 8081}))
+	assert.Equal(t, int32(1), h.Version())
+
+	other, err := New(conn, WithPath("/svc/config"))
+	require.NoError(t, err)
+	require.NoError(t, other.Load(&c))
+	assert.Equal(t, testConfig{Name: "app", Port: 8081}, c)
+	assert.Equal(t, int32(1), other.Version())
+}
+
+func TestSaveConflict(t *testing.T) {
+	conn := newMemoryConn()
+	h, err := New(conn)
+	require.NoError(t, err)
+	other, err := New(conn)
+	require.NoError(t, err)
+
+	var c testConfig
+	require.NoError(t, h.Save(testConfig{Name: "app"}))
+	require.NoError(t, other.Load(&c))
+	require.NoError(t, other.Save(testConfig{Name: "other"}))
+
+	assert.ErrorIs(t, h.Save(testConfig{Name: "app", Port: 1}), ErrBadVersion)
+	assert.Equal(t, int32(0), h.Version())
+
+	require.NoError(t, h.Load(&c))
+	assert.Equal(t, "other", c.Name)
+	assert.NoError(t, h.Save(testConfig{Name: "app", Port: 1}))
+}
+
+func TestCompressionAndChunking(t *testing.T) {
+	conn := newMemoryConn()
+	conn.maxData = 128
+
+	h, err := New(conn, WithCompression(fh.Gzip), WithChunking(64))
+	require.NoError(t, err)
+
+	var name strings.Builder
+	for i := 0; i < 100; i++ {
+		name.WriteString(strconv.Itoa(i * i * 7919))
+	}
+	data := testConfig{Name: name.String(), Port: 8080}
+	require.NoError(t, h.Save(data))
+
+	_, ok := fh.ParseManifest(conn.nodes["/cog/app"].data)
+	assert.True(t, ok)
+	assert.True(t, bytes.HasPrefix(conn.nodes[fh.ChunkName("/cog/app", 0)].data, fh.Gzip.Magic()))
+
+	var c testConfig
+	require.NoError(t, h.Load(&c))
+	assert.Equal(t, data, c)
+
+	// existing chunks are overwritten on the next save
+	data.Port = 8081
+	require.NoError(t, h.Save(data))
+	require.NoError(t, h.Load(&c))
+	assert.Equal(t, data, c)
+
+	delete(conn.nodes, fh.ChunkName("/cog/app", 0))
+	assert.ErrorIs(t, h.Load(&c), ErrNoNode)
+}
+
+func TestWatch(t *testing.T) {
+	conn := newMemoryConn()
+	h, err := New(conn)
+	require.NoError(t, err)
+	require.NoError(t, h.Save(testConfig{Name: "app"}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := h.Watch(ctx)
+	require.NoError(t, err)
+
+	// own save is not reported
+	require.NoError(t, h.Save(testConfig{Name: "own"}))
+	select {
+	case <-ch:
+		t.Fatal("unexpected notification about own save")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// watch is set again after every event
+	for i := 0; i < 2; i++ {
+		_, err = conn.Set("/cog/app", []byte(`{"name":"other"}`), h.Version()+int32(i))
+		require.NoError(t, err)
+
+		select {
+		case <-ch:
+		case <-time.After(time.Second):
+			t.Fatal("expected notification about change by another writer")
+		}
+	}
+
+	cancel()
+	for range ch {
+	}
+}